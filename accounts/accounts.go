@@ -39,6 +39,8 @@ const (
 	MimetypeDataWithValidator = "data/validator"
 	MimetypeTypedData         = "data/typed"
 	MimetypeClique            = "application/x-clique-header"
+	MimetypeCliqueSystemTx    = "application/x-clique-system-tx"
+	MimetypeCliqueVote        = "application/x-clique-checkpoint-vote"
 	MimetypeTextPlain         = "text/plain"
 )
 
@@ -125,6 +125,10 @@ var (
 		Name:  "rules",
 		Usage: "Path to the rule file to auto-authorize requests with",
 	}
+	systemContractsFlag = cli.StringFlag{
+		Name:  "clique.systemcontracts",
+		Usage: "Comma separated StakeManager, SlashManager and validator set contracts to sign PoS system transactions for",
+	}
 	stdiouiFlag = cli.BoolFlag{
 		Name: "stdio-ui",
 		Usage: "Use STDIN/STDOUT as a channel for an external UI. " +
@@ -239,6 +243,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			customDBFlag,
 			auditLogFlag,
 			ruleFlag,
+			systemContractsFlag,
 			stdiouiFlag,
 			testFlag,
 			advancedMode,
@@ -268,6 +273,7 @@ func init() {
 		customDBFlag,
 		auditLogFlag,
 		ruleFlag,
+		systemContractsFlag,
 		stdiouiFlag,
 		testFlag,
 		advancedMode,
@@ -627,6 +633,17 @@ func signer(c *cli.Context) error {
 		"light-kdf", lightKdf, "advanced", advanced)
 	am := core.StartClefAccountManager(ksLoc, nousb, lightKdf, scpath)
 	apiImpl := core.NewSignerAPI(am, chainId, nousb, ui, db, advanced, pwStorage)
+	if list := c.GlobalString(systemContractsFlag.Name); list != "" {
+		var contracts []common.Address
+		for _, addr := range strings.Split(list, ",") {
+			if !common.IsHexAddress(strings.TrimSpace(addr)) {
+				utils.Fatalf("Invalid system contract address %q", addr)
+			}
+			contracts = append(contracts, common.HexToAddress(strings.TrimSpace(addr)))
+		}
+		apiImpl.SetSystemContracts(contracts)
+		log.Info("PoS system transaction signing enabled", "contracts", contracts)
+	}
 
 	// Establish the bidirectional communication, by creating a new UI backend and registering
 	// it with the UI.
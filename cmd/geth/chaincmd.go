@@ -49,6 +49,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.StateSchemeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -210,6 +211,11 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
+		if name == "chaindata" {
+			if _, err := rawdb.SetupStateScheme(chaindb, ctx.GlobalString(utils.StateSchemeFlag.Name)); err != nil {
+				utils.Fatalf("Failed to set up state scheme: %v", err)
+			}
+		}
 		_, hash, err := core.SetupGenesisBlock(chaindb, genesis)
 		if err != nil {
 			utils.Fatalf("Failed to write genesis block: %v", err)
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/console/prompt"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
@@ -72,6 +73,8 @@ Remove blockchain and state databases`,
 			dbImportCmd,
 			dbExportCmd,
 			dbMetadataCmd,
+			dbSlashesCmd,
+			dbPruneHistoryCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -251,6 +254,48 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "Shows metadata about the chain status.",
 	}
+	dbSlashesCmd = cli.Command{
+		Action:    utils.MigrateFlags(showSlashes),
+		Name:      "slashes",
+		Usage:     "Shows the validator slash history recorded by the slash indexer",
+		ArgsUsage: "<start (int)> <end (int)> <validator (optional)>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.SepoliaFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Description: "This command displays the slash events recorded in the given block range.",
+	}
+	dbPruneHistoryKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Usage: "Number of recent blocks to retain the bodies and receipts of",
+		Value: 90000,
+	}
+	dbPruneHistoryCmd = cli.Command{
+		Action: utils.MigrateFlags(pruneHistory),
+		Name:   "prune-history",
+		Usage:  "Prune the ancient block bodies and receipts older than the retained range",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.SepoliaFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			dbPruneHistoryKeepFlag,
+		},
+		Description: `This command deletes the bodies and receipts of the blocks older than the
+last --keep ones from the ancient store, along with their transaction indices.
+The headers are retained, so the chain can still be verified and synced from,
+but the RPC calls retrieving the pruned blocks, receipts and logs fail with a
+"history pruned" error. Only the frozen blocks are pruned.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -750,3 +795,98 @@ func showMetaData(ctx *cli.Context) error {
 	table.Render()
 	return nil
 }
+
+func showSlashes(ctx *cli.Context) error {
+	if ctx.NArg() < 2 || ctx.NArg() > 3 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	start, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		return err
+	}
+	end, err := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	var validator *common.Address
+	if ctx.NArg() == 3 {
+		if !common.IsHexAddress(ctx.Args().Get(2)) {
+			return fmt.Errorf("invalid validator address: %s", ctx.Args().Get(2))
+		}
+		addr := common.HexToAddress(ctx.Args().Get(2))
+		validator = &addr
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, true)
+	defer db.Close()
+
+	events, err := clique.ReadSlashEvents(db, start, end)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Block", "Span", "Validator", "Official node", "Transaction"})
+	for _, event := range events {
+		if validator != nil && event.Validator != *validator {
+			continue
+		}
+		table.Append([]string{
+			fmt.Sprintf("%d", event.BlockNumber),
+			fmt.Sprintf("%d", event.Span),
+			event.Validator.Hex(),
+			event.OfficialNode.Hex(),
+			event.TxHash.Hex(),
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func pruneHistory(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	head := rawdb.ReadHeadBlock(db)
+	if head == nil {
+		return errors.New("no head block found")
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	var (
+		keep = ctx.Uint64(dbPruneHistoryKeepFlag.Name)
+		tail uint64
+	)
+	if number := head.NumberU64(); number > keep {
+		tail = number - keep
+	}
+	if tail > frozen {
+		tail = frozen
+	}
+	old := rawdb.ReadHistoryTail(db)
+	if tail <= old {
+		log.Info("No chain history to prune", "head", head.NumberU64(), "frozen", frozen, "tail", old)
+		return nil
+	}
+	start := time.Now()
+
+	// Drop the transaction indices first, they can't be iterated once the
+	// bodies are gone.
+	from := old
+	if indexed := rawdb.ReadTxIndexTail(db); indexed != nil && *indexed > from {
+		from = *indexed
+	}
+	rawdb.UnindexTransactions(db, from, tail, nil)
+
+	if err := rawdb.PruneHistory(db, tail); err != nil {
+		return err
+	}
+	log.Info("Pruned chain history", "from", old, "tail", tail, "head", head.NumberU64(), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -65,6 +65,9 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
+		utils.StateSchemeFlag,
+		utils.StateOnlinePruneFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -97,6 +100,7 @@ var (
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.ValidatorSetSourceFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -116,6 +120,7 @@ var (
 		utils.CacheTrieRejournalFlag,
 		utils.CacheGCFlag,
 		utils.CacheSnapshotFlag,
+		utils.CacheRegenFlag,
 		utils.CacheNoPrefetchFlag,
 		utils.CachePreimagesFlag,
 		utils.ListenPortFlag,
@@ -240,6 +245,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See poscmd.go
+		posCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -0,0 +1,409 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/clique/contract"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/devnet"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	simulateRunsFlag = cli.IntFlag{
+		Name:  "runs",
+		Usage: "Number of additional random seeds to estimate the selection frequencies over",
+		Value: 0,
+	}
+	devnetValidatorsFlag = cli.IntFlag{
+		Name:  "validators",
+		Usage: "Number of validator keys to generate",
+		Value: 4,
+	}
+	devnetOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "Directory to write the genesis, validator keystore and devnet manifest to",
+		Value: "devnet",
+	}
+	devnetChainIDFlag = cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "Chain id of the network",
+		Value: 1337,
+	}
+	devnetPeriodFlag = cli.Uint64Flag{
+		Name:  "period",
+		Usage: "Number of seconds between blocks",
+		Value: 5,
+	}
+	devnetEpochFlag = cli.Uint64Flag{
+		Name:  "epoch",
+		Usage: "Number of blocks between checkpoints",
+		Value: 30000,
+	}
+	devnetSpanFlag = cli.Uint64Flag{
+		Name:  "span",
+		Usage: "Number of blocks of a span",
+		Value: 100,
+	}
+	devnetPoSBlockFlag = cli.Uint64Flag{
+		Name:  "chaophraya",
+		Usage: "First proof-of-stake block, sealed by authority before (defaults to the span length)",
+	}
+	devnetStakersFlag = cli.StringFlag{
+		Name:  "stakers",
+		Usage: "Comma separated initial stakers as address:power, power in whole coins (defaults to the validators with a power of one)",
+	}
+	devnetOfficialFlag = cli.StringFlag{
+		Name:  "official",
+		Usage: "Address of the official node (defaults to the first validator)",
+	}
+	devnetContractsFlag = cli.StringFlag{
+		Name:  "contracts",
+		Usage: "Directory holding the compiled ValidatorSet.json, StakeManager.json and SlashManager.json",
+	}
+	devnetStakeMethodFlag = cli.StringFlag{
+		Name:  "stake-method",
+		Usage: `StakeManager method each staker calls with its stake in the genesis, taking its address and stake as address and uint256 arguments (e.g. "stake(address)")`,
+	}
+	devnetSetupFlag = cli.StringFlag{
+		Name:  "setup",
+		Usage: "JSON file of contract calls ({from, to, value, data}) applied in the genesis once the system contracts are deployed",
+	}
+	devnetFundsFlag = cli.Uint64Flag{
+		Name:  "funds",
+		Usage: "Balance allocated to every validator and staker on top of its stake, in whole coins",
+		Value: 1000,
+	}
+	posCommand = cli.Command{
+		Name:        "pos",
+		Usage:       "A set of commands for the Chaophraya proof-of-stake consensus",
+		Category:    "MISCELLANEOUS COMMANDS",
+		Description: "",
+		Subcommands: []cli.Command{
+			{
+				Name:      "simulate-span",
+				Usage:     "Replay the validator selection of a span from the local database",
+				ArgsUsage: "<seed block> <validators block (optional)>",
+				Action:    utils.MigrateFlags(simulateSpan),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.SyncModeFlag,
+					utils.MainnetFlag,
+					utils.RopstenFlag,
+					utils.SepoliaFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					simulateRunsFlag,
+				},
+				Description: `
+geth pos simulate-span <seed block> [<validators block>]
+loads the eligible validators from the validator set contract at the given
+validators block (seed block + 5 if omitted, as done when committing a span)
+and replays the weighted random selection seeded by the seed block hash.
+
+If --runs is set, the selection is additionally run over the given number of
+deterministic pseudo-random seeds and the observed selection frequency of each
+validator is reported next to its share of the total voting power.`,
+			},
+			{
+				Name:     "devnet",
+				Usage:    "Generate the genesis and validator keys of a local proof-of-stake network",
+				Action:   utils.MigrateFlags(generateDevnet),
+				Category: "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					devnetValidatorsFlag,
+					devnetOutFlag,
+					devnetChainIDFlag,
+					devnetPeriodFlag,
+					devnetEpochFlag,
+					devnetSpanFlag,
+					devnetPoSBlockFlag,
+					devnetStakersFlag,
+					devnetOfficialFlag,
+					devnetContractsFlag,
+					devnetStakeMethodFlag,
+					devnetSetupFlag,
+					devnetFundsFlag,
+					utils.PasswordFileFlag,
+				},
+				Description: `
+geth pos devnet --validators 4 --contracts <dir> --out devnet
+generates the keys of the given number of validators and a genesis in which
+they seal by authority until the Chaophraya block, from which on the span
+validators are selected among the stakers.
+
+The compiled system contracts are read from the --contracts directory as
+ValidatorSet.json, StakeManager.json and SlashManager.json, either hardhat or
+truffle artifacts or genesis accounts with code and storage, and allocated at
+0x...1000, 0x...1001 and 0x...1002. The constructors of the artifacts are run
+by the official node at these addresses, while the storage of the genesis
+accounts is taken as is. The --setup calls are then applied, and every staker
+calls the --stake-method with its stake, the resulting state being written to
+the genesis. The generation fails if the validator set reports no eligible
+validators, as the network couldn't turn to proof-of-stake.
+
+The output directory receives genesis.json, the validator keystore encrypted
+with the --password file (an empty password if not set) and devnet.json.`,
+			},
+		},
+	}
+)
+
+func simulateSpan(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	seedNumber, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		return err
+	}
+	validatorsNumber := seedNumber + 5
+	if ctx.NArg() == 2 {
+		if validatorsNumber, err = strconv.ParseUint(ctx.Args().Get(1), 10, 64); err != nil {
+			return err
+		}
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	config := chain.Config()
+	if config.Clique == nil || config.Clique.Span == 0 {
+		return errors.New("chain is not configured for proof-of-stake")
+	}
+	seed := chain.GetHeaderByNumber(seedNumber)
+	if seed == nil {
+		return fmt.Errorf("seed block #%d not found", seedNumber)
+	}
+	header := chain.GetHeaderByNumber(validatorsNumber)
+	if header == nil {
+		return fmt.Errorf("validators block #%d not found", validatorsNumber)
+	}
+	if _, err := chain.StateAt(header.Root); err != nil {
+		return fmt.Errorf("state of block #%d not available: %v", validatorsNumber, err)
+	}
+	client, err := contract.NewWithChain(config, chain)
+	if err != nil {
+		return err
+	}
+	eligible, err := client.GetEligibleValidators(context.Background(), header.Hash(), validatorsNumber)
+	if err != nil {
+		return err
+	}
+	if len(eligible) == 0 {
+		return fmt.Errorf("no eligible validators at block #%d", validatorsNumber)
+	}
+	// The committed span follows the one of the commitment block
+	_, start, length := config.Clique.SpanAt(validatorsNumber + 1)
+	_, _, spanLength := config.Clique.SpanAt(start + length)
+
+	fmt.Printf("Seed block #%d (%x), validators at block #%d, span length %d\n\n", seedNumber, seed.Hash(), validatorsNumber, spanLength)
+	printSpanSimulation(os.Stdout, eligible, seed.Hash(), spanLength, ctx.Int(simulateRunsFlag.Name))
+	return nil
+}
+
+// printSpanSimulation replays the selection of the span validators seeded by
+// the given hash, then estimates the selection frequencies of the validators
+// over the given number of additional seeds derived from it.
+func printSpanSimulation(out io.Writer, eligible []*ctypes.Validator, seed common.Hash, spanLength uint64, runs int) {
+	var totalPower uint64
+	for _, val := range eligible {
+		totalPower += val.VotingPower
+	}
+	// Replay the selection of the requested seed
+	selected := clique.SelectValidators(eligible, seed, spanLength)
+
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Slot", "Validator", "Power"})
+	for i, val := range selected {
+		table.Append([]string{strconv.Itoa(i), val.Address.Hex(), strconv.FormatUint(val.VotingPower, 10)})
+	}
+	table.Render()
+
+	// Estimate the selection frequencies over additional seeds
+	counts := countSelections(selected)
+	for i := 0; i < runs; i++ {
+		var nonce [8]byte
+		binary.BigEndian.PutUint64(nonce[:], uint64(i))
+		for addr, n := range countSelections(clique.SelectValidators(eligible, crypto.Keccak256Hash(seed.Bytes(), nonce[:]), spanLength)) {
+			counts[addr] += n
+		}
+	}
+	total := float64(uint64(runs+1) * spanLength)
+
+	eligible = append([]*ctypes.Validator(nil), eligible...)
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return eligible[i].VotingPower > eligible[j].VotingPower
+	})
+	fmt.Fprintf(out, "\nSelection frequencies over %d seed(s)\n\n", runs+1)
+
+	table = tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Validator", "Power", "Power share", "Slots", "Selected"})
+	for _, val := range eligible {
+		table.Append([]string{
+			val.Address.Hex(),
+			strconv.FormatUint(val.VotingPower, 10),
+			fmt.Sprintf("%.2f%%", 100*float64(val.VotingPower)/float64(totalPower)),
+			strconv.FormatUint(counts[val.Address], 10),
+			fmt.Sprintf("%.2f%%", 100*float64(counts[val.Address])/total),
+		})
+	}
+	table.Render()
+}
+
+// countSelections returns the number of slots each validator was selected for.
+func countSelections(selected []ctypes.Validator) map[common.Address]uint64 {
+	counts := make(map[common.Address]uint64)
+	for _, val := range selected {
+		counts[val.Address]++
+	}
+	return counts
+}
+
+// devnetManifest is the summary of a generated devnet written next to its genesis.
+type devnetManifest struct {
+	Validators   []common.Address       `json:"validators"`
+	Stakers      []devnet.Staker        `json:"stakers"`
+	ValidatorSet common.Address         `json:"validatorSet"`
+	Contracts    ctypes.SystemContracts `json:"contracts"`
+}
+
+func generateDevnet(ctx *cli.Context) error {
+	config := &devnet.Config{
+		ChainID:         new(big.Int).SetUint64(ctx.Uint64(devnetChainIDFlag.Name)),
+		Period:          ctx.Uint64(devnetPeriodFlag.Name),
+		Epoch:           ctx.Uint64(devnetEpochFlag.Name),
+		Span:            ctx.Uint64(devnetSpanFlag.Name),
+		GasLimit:        ethconfig.Defaults.Miner.GasCeil,
+		Validators:      ctx.Int(devnetValidatorsFlag.Name),
+		ChaophrayaBlock: ctx.Uint64(devnetPoSBlockFlag.Name),
+		Funds:           new(big.Int).Mul(new(big.Int).SetUint64(ctx.Uint64(devnetFundsFlag.Name)), big.NewInt(params.Ether)),
+	}
+	if config.ChaophrayaBlock == 0 {
+		config.ChaophrayaBlock = config.Span
+	}
+	if official := ctx.String(devnetOfficialFlag.Name); official != "" {
+		if !common.IsHexAddress(official) {
+			return fmt.Errorf("invalid official node address %q", official)
+		}
+		config.OfficialNode = common.HexToAddress(official)
+	}
+	if stakers := ctx.String(devnetStakersFlag.Name); stakers != "" {
+		for _, entry := range strings.Split(stakers, ",") {
+			parts := strings.Split(entry, ":")
+			if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+				return fmt.Errorf("invalid staker %q, want address:power", entry)
+			}
+			power, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid power of staker %q: %v", entry, err)
+			}
+			config.Stakers = append(config.Stakers, devnet.Staker{Address: common.HexToAddress(parts[0]), Power: power})
+		}
+	}
+	dir := ctx.String(devnetContractsFlag.Name)
+	if dir == "" {
+		return errors.New("the compiled system contracts are required (--contracts)")
+	}
+	var err error
+	if config.ValidatorSet, err = devnet.LoadArtifact(filepath.Join(dir, "ValidatorSet.json")); err != nil {
+		return err
+	}
+	if config.StakeManager, err = devnet.LoadArtifact(filepath.Join(dir, "StakeManager.json")); err != nil {
+		return err
+	}
+	if config.SlashManager, err = devnet.LoadArtifact(filepath.Join(dir, "SlashManager.json")); err != nil {
+		return err
+	}
+	if path := ctx.String(devnetSetupFlag.Name); path != "" {
+		if config.Setup, err = devnet.LoadCalls(path); err != nil {
+			return err
+		}
+	}
+	config.StakeMethod = ctx.String(devnetStakeMethodFlag.Name)
+	net, err := devnet.Generate(config)
+	if err != nil {
+		return err
+	}
+	// Write the genesis, the validator keys and the manifest
+	out := ctx.String(devnetOutFlag.Name)
+	if err := os.MkdirAll(out, 0700); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(out, "genesis.json"), net.Genesis); err != nil {
+		return err
+	}
+	var password string
+	if passwords := utils.MakePasswordList(ctx); len(passwords) > 0 {
+		password = passwords[0]
+	}
+	ks := keystore.NewKeyStore(filepath.Join(out, "keystore"), keystore.StandardScryptN, keystore.StandardScryptP)
+	manifest := &devnetManifest{
+		Stakers:      net.Stakers,
+		ValidatorSet: net.ValidatorSet,
+		Contracts:    net.Contracts,
+	}
+	for _, key := range net.Validators {
+		account, err := ks.ImportECDSA(key, password)
+		if err != nil {
+			return err
+		}
+		manifest.Validators = append(manifest.Validators, account.Address)
+	}
+	if err := writeJSON(filepath.Join(out, "devnet.json"), manifest); err != nil {
+		return err
+	}
+	fmt.Printf("Generated devnet with %d validators in %s\n", len(manifest.Validators), out)
+	fmt.Printf("Chaophraya block: %d, stakers listed in devnet.json\n", config.ChaophrayaBlock)
+	return nil
+}
+
+// writeJSON writes the value indented as JSON to the given file.
+func writeJSON(path string, v interface{}) error {
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, blob, 0600)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+)
+
+func TestCountSelections(t *testing.T) {
+	var (
+		a = ctypes.Validator{Address: common.Address{0x01}, VotingPower: 10}
+		b = ctypes.Validator{Address: common.Address{0x02}, VotingPower: 30}
+	)
+	tests := []struct {
+		selected []ctypes.Validator
+		want     map[common.Address]uint64
+	}{
+		{nil, map[common.Address]uint64{}},
+		{[]ctypes.Validator{a}, map[common.Address]uint64{a.Address: 1}},
+		{[]ctypes.Validator{b, a, b, b}, map[common.Address]uint64{a.Address: 1, b.Address: 3}},
+	}
+	for i, tt := range tests {
+		have := countSelections(tt.selected)
+		if len(have) != len(tt.want) {
+			t.Errorf("test %d: count mismatch: have %v, want %v", i, have, tt.want)
+			continue
+		}
+		for addr, n := range tt.want {
+			if have[addr] != n {
+				t.Errorf("test %d: selections of %x mismatch: have %d, want %d", i, addr, have[addr], n)
+			}
+		}
+	}
+}
+
+func TestPrintSpanSimulation(t *testing.T) {
+	var (
+		a = &ctypes.Validator{Address: common.Address{0x01}, VotingPower: 10}
+		b = &ctypes.Validator{Address: common.Address{0x02}, VotingPower: 30}
+	)
+	tests := []struct {
+		eligible   []*ctypes.Validator
+		spanLength uint64
+		runs       int
+		want       string
+	}{
+		// The replayed selection only
+		{
+			eligible:   []*ctypes.Validator{a, b},
+			spanLength: 4,
+			want: `+------+--------------------------------------------+-------+
+| SLOT |                 VALIDATOR                  | POWER |
++------+--------------------------------------------+-------+
+|    0 | 0x0200000000000000000000000000000000000000 |    30 |
+|    1 | 0x0200000000000000000000000000000000000000 |    30 |
+|    2 | 0x0200000000000000000000000000000000000000 |    30 |
+|    3 | 0x0100000000000000000000000000000000000000 |    10 |
++------+--------------------------------------------+-------+
+
+Selection frequencies over 1 seed(s)
+
++--------------------------------------------+-------+-------------+-------+----------+
+|                 VALIDATOR                  | POWER | POWER SHARE | SLOTS | SELECTED |
++--------------------------------------------+-------+-------------+-------+----------+
+| 0x0200000000000000000000000000000000000000 |    30 | 75.00%      |     3 | 75.00%   |
+| 0x0100000000000000000000000000000000000000 |    10 | 25.00%      |     1 | 25.00%   |
++--------------------------------------------+-------+-------------+-------+----------+
+`,
+		},
+		// The frequencies estimated over additional seeds
+		{
+			eligible:   []*ctypes.Validator{a, b},
+			spanLength: 4,
+			runs:       99,
+			want: `+------+--------------------------------------------+-------+
+| SLOT |                 VALIDATOR                  | POWER |
++------+--------------------------------------------+-------+
+|    0 | 0x0200000000000000000000000000000000000000 |    30 |
+|    1 | 0x0200000000000000000000000000000000000000 |    30 |
+|    2 | 0x0200000000000000000000000000000000000000 |    30 |
+|    3 | 0x0100000000000000000000000000000000000000 |    10 |
++------+--------------------------------------------+-------+
+
+Selection frequencies over 100 seed(s)
+
++--------------------------------------------+-------+-------------+-------+----------+
+|                 VALIDATOR                  | POWER | POWER SHARE | SLOTS | SELECTED |
++--------------------------------------------+-------+-------------+-------+----------+
+| 0x0200000000000000000000000000000000000000 |    30 | 75.00%      |   290 | 72.50%   |
+| 0x0100000000000000000000000000000000000000 |    10 | 25.00%      |   110 | 27.50%   |
++--------------------------------------------+-------+-------------+-------+----------+
+`,
+		},
+		// A single validator takes every slot
+		{
+			eligible:   []*ctypes.Validator{b},
+			spanLength: 2,
+			runs:       1,
+			want: `+------+--------------------------------------------+-------+
+| SLOT |                 VALIDATOR                  | POWER |
++------+--------------------------------------------+-------+
+|    0 | 0x0200000000000000000000000000000000000000 |    30 |
+|    1 | 0x0200000000000000000000000000000000000000 |    30 |
++------+--------------------------------------------+-------+
+
+Selection frequencies over 2 seed(s)
+
++--------------------------------------------+-------+-------------+-------+----------+
+|                 VALIDATOR                  | POWER | POWER SHARE | SLOTS | SELECTED |
++--------------------------------------------+-------+-------------+-------+----------+
+| 0x0200000000000000000000000000000000000000 |    30 | 100.00%     |     4 | 100.00%  |
++--------------------------------------------+-------+-------------+-------+----------+
+`,
+		},
+	}
+	for i, tt := range tests {
+		var out bytes.Buffer
+		printSpanSimulation(&out, tt.eligible, common.Hash{}, tt.spanLength, tt.runs)
+		if have := out.String(); have != tt.want {
+			t.Errorf("test %d: output mismatch:\nhave:\n%s\nwant:\n%s", i, have, tt.want)
+		}
+	}
+	// The eligible validators are left in their order
+	eligible := []*ctypes.Validator{a, b}
+	printSpanSimulation(new(bytes.Buffer), eligible, common.Hash{}, 4, 0)
+	if eligible[0] != a || eligible[1] != b {
+		t.Errorf("eligible validators reordered")
+	}
+}
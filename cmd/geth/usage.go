@@ -36,6 +36,9 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
+			utils.StateSchemeFlag,
+			utils.StateOnlinePruneFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.USBFlag,
@@ -50,6 +53,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.ValidatorSetSourceFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -117,6 +121,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.CacheTrieRejournalFlag,
 			utils.CacheGCFlag,
 			utils.CacheSnapshotFlag,
+			utils.CacheRegenFlag,
 			utils.CacheNoPrefetchFlag,
 			utils.CachePreimagesFlag,
 		},
@@ -120,6 +120,18 @@ var (
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble')",
+	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: "Scheme to store the state trie nodes with, only when the database is created ('hash' or 'path')",
+	}
+	StateOnlinePruneFlag = cli.BoolFlag{
+		Name:  "state.onlineprune",
+		Usage: "Enable pruning the stale state while the node is running, through debug_pruneState",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -234,6 +246,11 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	ValidatorSetSourceFlag = cli.StringFlag{
+		Name:  "pos.validatorset",
+		Usage: `Source the Chaophraya span validator sets are verified against ("contract", "header" or "proof")`,
+		Value: "contract",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -426,6 +443,11 @@ var (
 		Usage: "Percentage of cache memory allowance to use for snapshot caching (default = 10% full mode, 20% archive mode)",
 		Value: 10,
 	}
+	CacheRegenFlag = cli.IntFlag{
+		Name:  "cache.regen",
+		Usage: "Disk allowance in megabytes for caching regenerated historical states (0 = disabled)",
+		Value: ethconfig.Defaults.StateRegenCache,
+	}
 	CacheNoPrefetchFlag = cli.BoolFlag{
 		Name:  "cache.noprefetch",
 		Usage: "Disable heuristic state prefetch during block import (less CPU and disk IO, more time waiting for data)",
@@ -1253,6 +1275,16 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		dbEngine := ctx.GlobalString(DBEngineFlag.Name)
+		if dbEngine != rawdb.DBLeveldb && dbEngine != rawdb.DBPebble {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", dbEngine)
+		}
+		if dbEngine == rawdb.DBPebble && !rawdb.PebbleEnabled {
+			Fatalf("Pebble is not supported on this platform")
+		}
+		cfg.DBEngine = dbEngine
+	}
 	if ctx.GlobalIsSet(DeveloperFlag.Name) {
 		cfg.UseLightweightKDF = true
 	}
@@ -1542,6 +1574,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	log.Debug("Sanitizing Go's GC trigger", "percent", int(gogc))
 	godebug.SetGCPercent(int(gogc))
 
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		scheme := ctx.GlobalString(StateSchemeFlag.Name)
+		if scheme != rawdb.HashScheme && scheme != rawdb.PathScheme {
+			Fatalf("Invalid choice for state.scheme '%s', allowed 'hash' or 'path'", scheme)
+		}
+		cfg.StateScheme = scheme
+	}
+	if ctx.GlobalIsSet(StateOnlinePruneFlag.Name) {
+		cfg.OnlinePruning = ctx.GlobalBool(StateOnlinePruneFlag.Name)
+	}
 	if ctx.GlobalIsSet(SyncModeFlag.Name) {
 		cfg.SyncMode = *GlobalTextMarshaler(ctx, SyncModeFlag.Name).(*downloader.SyncMode)
 	}
@@ -1565,6 +1607,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 	}
+	if ctx.GlobalIsSet(CacheRegenFlag.Name) {
+		cfg.StateRegenCache = ctx.GlobalInt(CacheRegenFlag.Name)
+	}
 	// Read the value from the flag no matter if it's set or not.
 	cfg.Preimages = ctx.GlobalBool(CachePreimagesFlag.Name)
 	if cfg.NoPruning && !cfg.Preimages {
@@ -1574,6 +1619,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(ValidatorSetSourceFlag.Name) {
+		cfg.ValidatorSetSource = ctx.GlobalString(ValidatorSetSourceFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1914,9 +1962,13 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("%v", err)
 	}
-	var engine consensus.Engine
+	var (
+		engine consensus.Engine
+		caller *contract.ChainCaller
+	)
 	if config.Clique != nil {
-		client, err := contract.New(config, nil)
+		caller = contract.NewChainCaller(config)
+		client, err := contract.New(config, caller)
 		if err != nil {
 			panic(err)
 		}
@@ -1969,6 +2021,9 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
+	if caller != nil {
+		caller.Attach(chain)
+	}
 	return chain, chainDb
 }
 
@@ -17,12 +17,16 @@
 package clique
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/lightclient"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -233,3 +237,525 @@ func (api *API) GetSigner(rlpOrBlockNr *blockNumberOrHashOrRLP) (common.Address,
 	}
 	return api.clique.Author(header)
 }
+
+// Span is the proof-of-stake span a block belongs to, together with the
+// validator set committed for it.
+type Span struct {
+	Number     uint64              `json:"number"`     // Span number as tracked by the validator set contract
+	StartBlock uint64              `json:"startBlock"` // First block sealed by the span validators
+	EndBlock   uint64              `json:"endBlock"`   // Last block sealed by the span validators
+	Validators []*ctypes.Validator `json:"validators"` // Validators and powers committed in the span header
+}
+
+// ScheduledSeal is a single slot of the validator schedule.
+type ScheduledSeal struct {
+	Number uint64          `json:"number"`           // Block number of the slot
+	Inturn common.Address  `json:"inturn"`           // Validator due to seal the slot
+	Sealer *common.Address `json:"sealer,omitempty"` // Actual sealer, if the block is already known
+	Time   uint64          `json:"time"`             // Block timestamp, estimated for future slots
+}
+
+// maxScheduleLength is the maximum number of slots returned by GetSchedule.
+const maxScheduleLength = 1024
+
+// GetSpan retrieves the span the given block belongs to.
+func (api *API) GetSpan(number *rpc.BlockNumber) (*Span, error) {
+	header := api.header(number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if !api.clique.config.IsChaophraya(header.Number) {
+		return nil, errNotPoSBlock
+	}
+	ctx, cancel := api.clique.callContext(nil, contractCallTimeout)
+	defer cancel()
+
+	current, err := api.clique.spanNumber(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	start, end := spanRange(api.clique.config, header.Number.Uint64())
+	validators, err := api.spanValidators(start)
+	if err != nil {
+		return nil, err
+	}
+	return &Span{
+		Number:     current.Uint64(),
+		StartBlock: start,
+		EndBlock:   end,
+		Validators: validators,
+	}, nil
+}
+
+// GetSpanValidators retrieves the validators and powers committed for the
+// given span, numbered as by GetSpan.
+func (api *API) GetSpanValidators(span uint64) ([]*ctypes.Validator, error) {
+	head := api.chain.CurrentHeader()
+	if !api.clique.config.IsChaophraya(head.Number) {
+		return nil, errNotPoSBlock
+	}
+	ctx, cancel := api.clique.callContext(nil, contractCallTimeout)
+	defer cancel()
+
+	current, err := api.clique.spanNumber(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	number, ok := spanStartAt(api.clique.config, head.Number.Uint64(), current.Uint64(), span)
+	if !ok {
+		return nil, errUnknownSpan
+	}
+	start, end := spanRange(api.clique.config, number)
+	if !api.clique.config.IsChaophraya(new(big.Int).SetUint64(end)) {
+		return nil, errNotPoSBlock
+	}
+	return api.spanValidators(start)
+}
+
+// header resolves the given block number, defaulting to the current head.
+func (api *API) header(number *rpc.BlockNumber) *types.Header {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return api.chain.CurrentHeader()
+	}
+	if *number < 0 {
+		return nil
+	}
+	return api.chain.GetHeaderByNumber(uint64(number.Int64()))
+}
+
+// GetInturnSigner retrieves the validator due to seal the given block. The block
+// may be in the future as long as it is in the span of the current head.
+func (api *API) GetInturnSigner(number rpc.BlockNumber) (common.Address, error) {
+	head := api.chain.CurrentHeader()
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		number = rpc.BlockNumber(head.Number.Int64() + 1)
+	}
+	if number <= 0 {
+		return common.Address{}, errUnknownBlock
+	}
+	snap, err := api.scheduleSnapshot(head, uint64(number))
+	if err != nil {
+		return common.Address{}, err
+	}
+	return snap.getInturnSigner(uint64(number)), nil
+}
+
+// GetSchedule retrieves the in-turn validators of count consecutive blocks
+// starting at from. Sealed blocks also report their actual sealer, future
+// blocks report their earliest sealing time. The schedule stops at the end of
+// the last span whose validators are known.
+func (api *API) GetSchedule(from rpc.BlockNumber, count uint64) ([]*ScheduledSeal, error) {
+	head := api.chain.CurrentHeader()
+	if from == rpc.LatestBlockNumber || from == rpc.PendingBlockNumber {
+		from = rpc.BlockNumber(head.Number.Int64() + 1)
+	}
+	if from <= 0 {
+		return nil, errUnknownBlock
+	}
+	if count > maxScheduleLength {
+		count = maxScheduleLength
+	}
+	var (
+		schedule = make([]*ScheduledSeal, 0, count)
+		snap     *Snapshot
+		eta      uint64 // Estimated time of the last future slot
+	)
+	for n := uint64(from); n < uint64(from)+count; n++ {
+		if snap == nil || isSpanFirstBlock(api.clique.config, new(big.Int).SetUint64(n)) || n <= head.Number.Uint64() {
+			s, err := api.scheduleSnapshot(head, n)
+			if err == errUnknownSpan && len(schedule) > 0 {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			snap = s
+		}
+		slot := &ScheduledSeal{
+			Number: n,
+			Inturn: snap.getInturnSigner(n),
+		}
+		if n <= head.Number.Uint64() {
+			header := api.chain.GetHeaderByNumber(n)
+			if header == nil {
+				return nil, fmt.Errorf("missing block %d", n)
+			}
+			sealer, err := api.clique.Author(header)
+			if err != nil {
+				return nil, err
+			}
+			slot.Sealer, slot.Time = &sealer, header.Time
+		} else {
+			// Estimate from the previous slot, the period may change in between
+			if eta == 0 {
+				eta = head.Time
+				for m := head.Number.Uint64() + 1; m < n; m++ {
+					eta += api.clique.config.Clique.PeriodAt(m)
+				}
+			}
+			eta += api.clique.config.Clique.PeriodAt(n)
+			slot.Time = eta
+		}
+		schedule = append(schedule, slot)
+	}
+	return schedule, nil
+}
+
+// scheduleSnapshot retrieves the snapshot holding the validator set of the given
+// block. Blocks past the head are served from the head snapshot as long as they
+// are in the same span.
+func (api *API) scheduleSnapshot(head *types.Header, number uint64) (*Snapshot, error) {
+	if !api.clique.config.IsChaophraya(new(big.Int).SetUint64(number)) {
+		return nil, errNotPoSBlock
+	}
+	parent := head
+	if number <= head.Number.Uint64() {
+		parent = api.chain.GetHeaderByNumber(number - 1)
+		if parent == nil {
+			return nil, errUnknownBlock
+		}
+	} else if start, _ := spanRange(api.clique.config, number); start > head.Number.Uint64()+1 {
+		return nil, errUnknownSpan
+	}
+	snap, err := api.clique.snapshot(api.chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.Validators) == 0 {
+		return nil, errUnknownSpan
+	}
+	return snap, nil
+}
+
+// spanValidators parses the validator set committed in the header preceding
+// the first block of a span.
+func (api *API) spanValidators(start uint64) ([]*ctypes.Validator, error) {
+	header := api.chain.GetHeaderByNumber(start - 1)
+	if header == nil {
+		return nil, errUnknownSpan
+	}
+	return parseSpanValidators(api.clique.config, header)
+}
+
+// GetSlashes retrieves the slash events recorded in the blocks of the range
+// [from, to]. If a validator is given, only its slash events are returned.
+// Recent blocks are only reported once the slash indexer has processed them.
+func (api *API) GetSlashes(from, to rpc.BlockNumber, validator *common.Address) ([]*SlashEvent, error) {
+	head := api.chain.CurrentHeader().Number.Int64()
+	if from == rpc.LatestBlockNumber || from == rpc.PendingBlockNumber {
+		from = rpc.BlockNumber(head)
+	}
+	if to == rpc.LatestBlockNumber || to == rpc.PendingBlockNumber {
+		to = rpc.BlockNumber(head)
+	}
+	if from < 0 || to < from {
+		return nil, fmt.Errorf("invalid block range [%d, %d]", from, to)
+	}
+	events, err := ReadSlashEvents(api.clique.db, uint64(from), uint64(to))
+	if err != nil {
+		return nil, err
+	}
+	if validator == nil {
+		return events, nil
+	}
+	filtered := make([]*SlashEvent, 0, len(events))
+	for _, event := range events {
+		if event.Validator == *validator {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered, nil
+}
+
+const (
+	// maxStatsRange is the maximum number of blocks ValidatorStats iterates over.
+	maxStatsRange = 100000
+
+	// maxRewardRange is the maximum number of blocks GetRewardsInRange and
+	// GetRewardSummary read the bodies and receipts of. Longer ranges need to
+	// be split into several calls.
+	maxRewardRange = 1024
+)
+
+// ValidatorStats computes the sealing record of the validators over the blocks
+// of the range [from, to] from the headers. Slashes are taken from the slash
+// index and are only reported once the indexer has processed the blocks.
+func (api *API) ValidatorStats(from, to rpc.BlockNumber) (*ValidatorStats, error) {
+	first, last, err := api.posRange(from, to, maxStatsRange)
+	if err != nil {
+		return nil, err
+	}
+	stats := &ValidatorStats{
+		From:       first,
+		To:         last,
+		Validators: make(map[common.Address]*ValidatorRecord),
+	}
+	record := func(validator common.Address) *ValidatorRecord {
+		if _, ok := stats.Validators[validator]; !ok {
+			stats.Validators[validator] = new(ValidatorRecord)
+		}
+		return stats.Validators[validator]
+	}
+	for n := first; n <= last; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, fmt.Errorf("missing block %d", n)
+		}
+		sealer, err := api.clique.Author(header)
+		if err != nil {
+			return nil, err
+		}
+		if isInturnDifficulty(header.Difficulty) {
+			record(sealer).Inturn++
+			continue
+		}
+		snap, err := api.clique.snapshot(api.chain, n-1, header.ParentHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		record(snap.getInturnSigner(n)).Missed++
+		if sealer == snap.SystemContracts.OfficialNode {
+			stats.OfficialNode++
+		} else {
+			stats.Backup++
+		}
+	}
+	slashes, err := ReadSlashEvents(api.clique.db, first, last)
+	if err != nil {
+		return nil, err
+	}
+	for _, slash := range slashes {
+		record(slash.Validator).Slashed++
+	}
+	return stats, nil
+}
+
+// posRange resolves the block range [from, to] of a ranged query, clamping it to
+// the current head and the start of the Chaophraya fork. Ranges longer than
+// limit blocks are rejected.
+func (api *API) posRange(from, to rpc.BlockNumber, limit uint64) (uint64, uint64, error) {
+	head := api.chain.CurrentHeader().Number.Int64()
+	if from == rpc.LatestBlockNumber || from == rpc.PendingBlockNumber {
+		from = rpc.BlockNumber(head)
+	}
+	if to == rpc.LatestBlockNumber || to == rpc.PendingBlockNumber || int64(to) > head {
+		to = rpc.BlockNumber(head)
+	}
+	fork := api.clique.config.ChaophrayaBlock
+	if fork == nil {
+		return 0, 0, errNotPoSBlock
+	}
+	if int64(from) < fork.Int64() {
+		from = rpc.BlockNumber(fork.Int64())
+	}
+	if from <= 0 || to < from {
+		return 0, 0, fmt.Errorf("invalid block range [%d, %d]", from, to)
+	}
+	if uint64(to-from) >= limit {
+		return 0, 0, fmt.Errorf("block range too large, maximum %d blocks", limit)
+	}
+	return uint64(from), uint64(to), nil
+}
+
+// GetRewards retrieves the fee distribution of the given block.
+func (api *API) GetRewards(number rpc.BlockNumber) (*Reward, error) {
+	header := api.header(&number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.clique.reward(api.chain, header)
+}
+
+// GetRewardsInRange retrieves the fee distributions of the blocks in the range
+// [from, to], spanning at most maxRewardRange blocks.
+func (api *API) GetRewardsInRange(from, to rpc.BlockNumber) ([]*Reward, error) {
+	first, last, err := api.posRange(from, to, maxRewardRange)
+	if err != nil {
+		return nil, err
+	}
+	rewards := make([]*Reward, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return nil, fmt.Errorf("missing block %d", n)
+		}
+		reward, err := api.clique.reward(api.chain, header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", n, err)
+		}
+		rewards = append(rewards, reward)
+	}
+	return rewards, nil
+}
+
+// GetRewardSummary aggregates the fees distributed per validator over the blocks
+// in the range [from, to], spanning at most maxRewardRange blocks.
+func (api *API) GetRewardSummary(from, to rpc.BlockNumber) (*RewardSummary, error) {
+	rewards, err := api.GetRewardsInRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	summary := &RewardSummary{
+		Total:      new(hexutil.Big),
+		Validators: make(map[common.Address]*ValidatorReward),
+	}
+	if len(rewards) > 0 {
+		summary.From, summary.To = rewards[0].BlockNumber, rewards[len(rewards)-1].BlockNumber
+	}
+	for _, reward := range rewards {
+		summary.add(reward)
+	}
+	return summary, nil
+}
+
+// GetFinality retrieves the safe and finalized blocks of the chain along with
+// the votes of the span validators they gathered.
+func (api *API) GetFinality() (*Finality, error) {
+	chain, ok := api.chain.(FinalityChain)
+	if !ok {
+		return nil, errFinalityUnavailable
+	}
+	finality := &Finality{Head: chain.CurrentHeader().Number.Uint64()}
+	if block := chain.CurrentFinalizedBlock(); block != nil {
+		checkpoint, err := api.clique.tallyCheckpoint(chain, block.Header())
+		if err != nil {
+			return nil, err
+		}
+		finality.Finalized = checkpoint
+	}
+	if block := chain.CurrentSafeBlock(); block != nil {
+		checkpoint, err := api.clique.tallyCheckpoint(chain, block.Header())
+		if err != nil {
+			return nil, err
+		}
+		finality.Safe = checkpoint
+	}
+	return finality, nil
+}
+
+// GetCheckpointVotes retrieves the votes of the span validators stored for the
+// canonical checkpoint at the given height.
+func (api *API) GetCheckpointVotes(number rpc.BlockNumber) ([]*CheckpointVote, error) {
+	header := api.header(&number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if !api.clique.isCheckpoint(header.Number.Uint64()) {
+		return nil, errNotCheckpoint
+	}
+	return ReadCheckpointVotes(api.clique.db, header.Number.Uint64(), header.Hash())
+}
+
+// SubmitCheckpointVote adds the vote of a span validator for a checkpoint, as
+// retrieved from the node of the validator through GetCheckpointVotes.
+func (api *API) SubmitCheckpointVote(vote CheckpointVote) error {
+	chain, ok := api.chain.(FinalityChain)
+	if !ok {
+		return errFinalityUnavailable
+	}
+	return api.clique.AddCheckpointVote(chain, &vote)
+}
+
+// GetSystemContracts retrieves the system contract registry in effect at the
+// given block.
+func (api *API) GetSystemContracts(number *rpc.BlockNumber) (*Registry, error) {
+	header := api.header(number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if !api.clique.config.IsChaophraya(header.Number) {
+		return nil, errNotPoSBlock
+	}
+	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	version, err := ctypes.RegistryVersionOf(&snap.SystemContracts)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := registryEntries(&snap.SystemContracts)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{
+		Version:      version.Version,
+		Contracts:    contracts,
+		ValidatorSet: validatorSetContractAt(api.clique.config, header.Number),
+	}, nil
+}
+
+// GetSealProof retrieves the proof that the given block was sealed by a
+// validator of its span, verifiable offline by the lightclient package.
+func (api *API) GetSealProof(number rpc.BlockNumber) (*lightclient.SealProof, error) {
+	header := api.header(&number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if !api.clique.config.IsChaophraya(header.Number) {
+		return nil, errNotPoSBlock
+	}
+	start, _ := spanRange(api.clique.config, header.Number.Uint64())
+	span := api.chain.GetHeaderByNumber(start - 1)
+	if span == nil {
+		return nil, errUnknownSpan
+	}
+	parent := api.chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	return lightclient.NewSealProof(api.clique.config, header, CliqueRLP(header), parent, span)
+}
+
+// GetEvidence retrieves the double sign evidence collected from the network over
+// the recent blocks.
+func (api *API) GetEvidence() []*Evidence {
+	return api.clique.evidence.all()
+}
+
+// GetOfficialPreemptions retrieves the blocks of the range [from, to] sealed by
+// the official node while a block sealed by the in-turn validator on the same
+// parent existed. Only the preemptions seen by this node are reported.
+func (api *API) GetOfficialPreemptions(from, to rpc.BlockNumber) ([]*Preemption, error) {
+	head := api.chain.CurrentHeader().Number.Int64()
+	if from == rpc.LatestBlockNumber || from == rpc.PendingBlockNumber {
+		from = rpc.BlockNumber(head)
+	}
+	if to == rpc.LatestBlockNumber || to == rpc.PendingBlockNumber {
+		to = rpc.BlockNumber(head)
+	}
+	if from < 0 || to < from {
+		return nil, fmt.Errorf("invalid block range [%d, %d]", from, to)
+	}
+	return ReadPreemptions(api.clique.db, uint64(from), uint64(to))
+}
+
+// ValidatorSetChanges creates a subscription that is notified with the validator
+// set of every new span committed in the canonical chain.
+func (api *API) ValidatorSetChanges(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		changes := make(chan *ValidatorSetChange, chainHeadChanSize)
+		sub := api.clique.SubscribeValidatorSetChanges(changes)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case change := <-changes:
+				notifier.Notify(rpcSub.ID, change)
+			case <-sub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
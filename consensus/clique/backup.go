@@ -0,0 +1,100 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// defaultBackupDelay is the number of seconds between two backup sealers if the
+// chain config doesn't specify it. It exceeds the official node waiting time so
+// the official node keeps precedence over the backup sealers.
+const defaultBackupDelay = 3
+
+// errBackupTooEarly is returned if a backup sealer sealed a block before its
+// slot in the backup ordering opened.
+var errBackupTooEarly = errors.New("backup sealer sealed before its slot")
+
+// backupRank returns the position of signer in the backup sealer ordering of the
+// given block, starting from 1, or 0 if the signer is not a backup sealer. The
+// backup sealers are the next distinct validators of the span schedule after the
+// in-turn one.
+func (s *Snapshot) backupRank(number uint64, signer common.Address) uint64 {
+	if !s.config.IsChaophrayaBackup(new(big.Int).SetUint64(number)) || len(s.Validators) == 0 {
+		return 0
+	}
+	var (
+		inturn = s.getInturnSigner(number)
+		seen   = map[common.Address]struct{}{inturn: {}}
+		rank   uint64
+	)
+	for i := 1; i < len(s.Validators) && rank < s.config.Clique.BackupSealers; i++ {
+		val := s.Validators[(number+uint64(i))%uint64(len(s.Validators))]
+		if _, ok := seen[val]; ok {
+			continue
+		}
+		seen[val] = struct{}{}
+		rank++
+		if val == signer {
+			return rank
+		}
+	}
+	return 0
+}
+
+// backupTime returns the earliest timestamp a backup sealer of the given rank
+// may seal the child of parent with.
+func backupTime(config *params.CliqueConfig, parent *types.Header, rank uint64) uint64 {
+	delay := config.BackupDelay
+	if delay == 0 {
+		delay = defaultBackupDelay
+	}
+	return parent.Time + config.PeriodAt(parent.Number.Uint64()+1) + rank*delay
+}
+
+// isBackupSealer returns whether signer is allowed to seal the given block as a
+// backup sealer, i.e. the backup fork is active and the signer is in the backup
+// ordering.
+func (s *Snapshot) isBackupSealer(number uint64, signer common.Address) bool {
+	return signer != s.SystemContracts.OfficialNode && s.backupRank(number, signer) > 0
+}
+
+// verifyBackupSeal checks that a block sealed out of turn by a validator other
+// than the official node was sealed by a backup sealer in its slot.
+func (c *Clique) verifyBackupSeal(snap *Snapshot, header, parent *types.Header) error {
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return err
+	}
+	number := header.Number.Uint64()
+	if signer == snap.SystemContracts.OfficialNode || snap.inturn(number, signer) {
+		return nil
+	}
+	rank := snap.backupRank(number, signer)
+	if rank == 0 {
+		return errUnauthorizedSigner
+	}
+	if header.Time < backupTime(c.config.Clique, parent, rank) {
+		return errBackupTooEarly
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestBackupRank(t *testing.T) {
+	config := &params.ChainConfig{
+		ChaophrayaBlock:       big.NewInt(0),
+		ChaophrayaBackupBlock: big.NewInt(10),
+		Clique:                &params.CliqueConfig{Period: 5, Span: 5, BackupSealers: 2},
+	}
+
+	var (
+		a = common.HexToAddress("0x000000000000000000000000000000000000000a")
+		b = common.HexToAddress("0x000000000000000000000000000000000000000b")
+		c = common.HexToAddress("0x000000000000000000000000000000000000000c")
+		d = common.HexToAddress("0x000000000000000000000000000000000000000d")
+	)
+	snap := &Snapshot{config: config, Validators: []common.Address{a, b, a, c, d}}
+
+	tests := []struct {
+		number uint64
+		signer common.Address
+		rank   uint64
+	}{
+		{5, b, 0},  // fork not yet active
+		{10, a, 0}, // in-turn signer
+		{10, b, 1},
+		{10, c, 2}, // a is skipped as duplicate of the in-turn signer
+		{10, d, 0}, // beyond the backup limit
+		{11, a, 1},
+		{11, c, 2},
+		{11, d, 0},
+		{12, c, 1},
+		{12, d, 2},
+		{12, b, 0},
+	}
+	for i, tt := range tests {
+		if rank := snap.backupRank(tt.number, tt.signer); rank != tt.rank {
+			t.Errorf("test %d: backup rank mismatch: have %d, want %d", i, rank, tt.rank)
+		}
+	}
+	parent := &types.Header{Number: big.NewInt(9), Time: 100}
+	if have, want := backupTime(config.Clique, parent, 2), 100+config.Clique.Period+2*defaultBackupDelay; have != want {
+		t.Errorf("backup time mismatch: have %d, want %d", have, want)
+	}
+}
+
+func TestVerifyBackupSeal(t *testing.T) {
+	accounts := newTesterAccountPool()
+	config := &params.ChainConfig{
+		ChaophrayaBlock:       big.NewInt(0),
+		ChaophrayaBackupBlock: big.NewInt(10),
+		Clique:                &params.CliqueConfig{Period: 5, Span: 5, BackupSealers: 2, BackupDelay: 2},
+	}
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	engine := &Clique{config: config, signatures: signatures}
+
+	var (
+		a, b, c, d = accounts.address("A"), accounts.address("B"), accounts.address("C"), accounts.address("D")
+		official   = accounts.address("O")
+	)
+	snap := &Snapshot{
+		config:          config,
+		Validators:      []common.Address{a, b, c, d},
+		SystemContracts: ctypes.SystemContracts{OfficialNode: official},
+	}
+	// Block 14 is due to C, backed up by D and then A
+	tests := []struct {
+		number uint64
+		signer string
+		time   uint64
+		err    error
+	}{
+		{14, "D", 106, errBackupTooEarly},
+		{14, "D", 107, nil},
+		{14, "A", 108, errBackupTooEarly},
+		{14, "A", 109, nil},
+		{14, "B", 120, errUnauthorizedSigner}, // beyond the backup limit
+		{14, "C", 105, nil},                   // in-turn signer is not delayed
+		{14, "O", 105, nil},                   // official node is checked separately
+	}
+	for i, tt := range tests {
+		parent := &types.Header{Number: new(big.Int).SetUint64(tt.number - 1), Time: 100}
+		header := &types.Header{Number: new(big.Int).SetUint64(tt.number), Time: tt.time, Difficulty: diffNoTurn, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, tt.signer)
+		if err := engine.verifyBackupSeal(snap, header, parent); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Out of turn seals are accepted on finalization from the backup sealers only
+	for signer, want := range map[string]bool{"D": true, "A": true, "B": false, "C": false, "O": false} {
+		if have := snap.isBackupSealer(14, accounts.address(signer)); have != want {
+			t.Errorf("signer %s: backup sealer mismatch: have %v, want %v", signer, have, want)
+		}
+	}
+	if snap.isBackupSealer(8, d) {
+		t.Errorf("backup sealer accepted before the fork")
+	}
+}
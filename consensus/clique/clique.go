@@ -41,6 +41,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -56,9 +57,8 @@ const (
 	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
 
 	validatorBytesLength = 40                     // Validator has 20 bytes for an address and 20 for a power
-	contractBytesLength  = 60                     // Bytes length of 3 PoS contracts (20 each)
-	totalPosContracts    = 3                      // Number of PoS contracts checked when retrieving from the validator set contract
 	wiggleTime           = 500 * time.Millisecond // Random delay (per signer) to allow concurrent signers
+	contractCallTimeout  = 5 * time.Second        // Time the contract calls made while mining or serving the API may take
 )
 
 // Clique proof-of-authority protocol constants.
@@ -156,17 +156,24 @@ var (
 
 	// Invalid span
 	errInvalidSpan = errors.New("invalid span")
+
+	// errUnknownSpan is returned if the validators of a span are requested before
+	// they have been committed to the local chain.
+	errUnknownSpan = errors.New("unknown span")
+
+	// errNotPoSBlock is returned if span data is requested for a block before
+	// the Chaophraya fork.
+	errNotPoSBlock = errors.New("block is not in proof-of-stake period")
 )
 
 func (c *Clique) isToSystemContract(to common.Address, snap *Snapshot) bool {
-	// Map system contracts
-	systemContracts := map[common.Address]bool{
-		c.config.Clique.ValidatorContractV2: true,
-		c.config.Clique.ValidatorContract:   true,
-		snap.SystemContracts.StakeManager:   true,
-		snap.SystemContracts.SlashManager:   true,
-	}
-	return systemContracts[to]
+	for _, validatorSet := range validatorSetContracts(c.config.Clique) {
+		if to == validatorSet {
+			return true
+		}
+	}
+	version, err := ctypes.RegistryVersionOf(&snap.SystemContracts)
+	return err == nil && version.IsCalled(&snap.SystemContracts, to)
 }
 
 // ecrecover extracts the Ethereum account address from a signed header.
@@ -221,6 +228,17 @@ type Clique struct {
 
 	// Contract client
 	contractClient ContractClient
+
+	validatorSource ValidatorSetSource // Source of the validator sets span headers are verified against
+	evidence        *EvidencePool      // Double sign evidence seen from the network
+	preemptions     *preemptionPool    // Official node blocks sealed over in-turn siblings
+	checkpoints     *lru.ARCCache      // Voting power of the span validators by checkpoint hash
+	finalityLock    sync.Mutex         // Serializes the safe and finalized block updates
+
+	validatorSetFeed event.Feed              // Feed of the validator sets committed in the canonical chain
+	scope            event.SubscriptionScope // Subscriptions to the validator set feed
+	quit             chan struct{}           // Channel to stop the validator set tracker
+	closeOnce        sync.Once
 }
 
 // New creates a Clique proof-of-authority consensus engine with the initial
@@ -239,19 +257,25 @@ func New(
 	// Allocate the snapshot caches and create the engine
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	signatures, _ := lru.NewARC(inmemorySignatures)
+	checkpoints, _ := lru.NewARC(inmemoryCheckpoints)
 
 	defaultSigner := types.NewEIP155Signer(config.ChainID)
 	contractClient.SetSigner(defaultSigner)
 
 	return &Clique{
-		config:         &conf,
-		db:             db,
-		recents:        recents,
-		signatures:     signatures,
-		ethAPI:         ethAPI,
-		contractClient: contractClient,
-		proposals:      make(map[common.Address]bool),
-		signer:         defaultSigner,
+		config:          &conf,
+		db:              db,
+		recents:         recents,
+		signatures:      signatures,
+		ethAPI:          ethAPI,
+		contractClient:  contractClient,
+		validatorSource: &contractValidatorSource{contractClient: contractClient},
+		evidence:        newEvidencePool(),
+		preemptions:     newPreemptionPool(),
+		checkpoints:     checkpoints,
+		proposals:       make(map[common.Address]bool),
+		signer:          defaultSigner,
+		quit:            make(chan struct{}),
 	}
 }
 
@@ -358,7 +382,7 @@ func (c *Clique) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 		checkpoint = needToUpdateValidatorList(c.config, header.Number)
 		if checkpoint {
 			signerBytesLength = common.AddressLength * 2
-			signersBytes -= contractBytesLength
+			signersBytes -= ctypes.RegistryVersionAt(c.config, header.Number).Size()
 		}
 	}
 
@@ -414,7 +438,7 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
 		return consensus.ErrUnknownAncestor
 	}
-	if parent.Time+c.config.Clique.Period > header.Time {
+	if parent.Time+c.config.Clique.PeriodAt(number) > header.Time {
 		return errInvalidTimestamp
 	}
 	// Verify that the gasUsed is <= gasLimit
@@ -453,6 +477,28 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 	}
 	// All basic checks passed, verify the seal and return
 	if c.config.IsChaophraya(header.Number) {
+		if needToUpdateValidatorList(c.config, header.Number) {
+			c.lock.RLock()
+			_, headerOnly := c.validatorSource.(headerValidatorSource)
+			c.lock.RUnlock()
+
+			// Without the state to finalize against, prove the span header on its own
+			if headerOnly {
+				if err := verifySpanHeader(chain, header, parents); err != nil {
+					return err
+				}
+			}
+		}
+		if c.config.IsChaophrayaBackup(header.Number) {
+			if err := c.verifyBackupSeal(snap, header, parent); err != nil {
+				return err
+			}
+		}
+		if c.config.IsChaophrayaOfficial(header.Number) {
+			if err := c.verifyOfficialSeal(snap, header, parent); err != nil {
+				return err
+			}
+		}
 		return c.verifySealPoS(snap, header, parents)
 	}
 	return c.verifySeal(snap, header, parents)
@@ -685,7 +731,9 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 	}
 	if number > 0 && isNextBlockPoS(c.config, header.Number) {
 		if needToUpdateValidatorList(c.config, header.Number) {
-			newValidators, systemContracts, err := c.contractClient.GetCurrentValidators(header.ParentHash, new(big.Int).SetUint64(number+1))
+			ctx, cancel := c.callContext(nil, contractCallTimeout)
+			newValidators, systemContracts, err := c.contractClient.GetCurrentValidators(ctx, header.ParentHash, new(big.Int).SetUint64(number+1))
+			cancel()
 			if err != nil {
 				log.Error("GetCurrentValidators", "err", err.Error())
 				return errors.New("unknown validators")
@@ -693,12 +741,8 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 			for _, validator := range newValidators {
 				header.Extra = append(header.Extra, validator.HeaderBytes()...)
 			}
-			// // Add StakeManager bytes to header.Extra
-			header.Extra = append(header.Extra, systemContracts.StakeManager.Bytes()...)
-			// // Add SlashManager bytes to header.Extra
-			header.Extra = append(header.Extra, systemContracts.SlashManager.Bytes()...)
-			// // Add OfficialNode bytes to header.Extra
-			header.Extra = append(header.Extra, systemContracts.OfficialNode.Bytes()...)
+			// Add the system contract registry to header.Extra
+			header.Extra = append(header.Extra, ctypes.RegistryVersionAt(c.config, header.Number).Encode(systemContracts)...)
 		}
 	}
 
@@ -710,27 +754,22 @@ func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 
 	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
 
-	header.Time = parent.Time + c.config.Clique.Period
+	header.Time = parent.Time + c.config.Clique.PeriodAt(number)
+	if c.val != snap.SystemContracts.OfficialNode && !snap.inturn(number, c.val) {
+		// Backup sealers may only seal once their slot opened
+		if rank := snap.backupRank(number, c.val); rank > 0 {
+			header.Time = backupTime(c.config.Clique, parent, rank)
+		}
+	} else if c.config.IsChaophrayaOfficial(header.Number) && snap.isOfficialSeal(number, c.val) {
+		// The official node may only seal once the in-turn validator had its time
+		header.Time = ctypes.OfficialTime(c.config.Clique, parent)
+	}
 	if header.Time < uint64(time.Now().Unix()) {
 		header.Time = uint64(time.Now().Unix())
 	}
 	return nil
 }
 
-func ParseAddressBytes(b []byte) ([]*common.Address, error) {
-	if len(b)%20 != 0 {
-		return nil, errors.New("invalid address bytes")
-	}
-	result := make([]*common.Address, len(b)/20)
-	for i := 0; i < len(b); i += 20 {
-		address := make([]byte, 20)
-		copy(address, b[i:i+20])
-		addr := common.BytesToAddress(address)
-		result[i/20] = &addr
-	}
-	return result, nil
-}
-
 // Finalize implements consensus.Engine, ensuring no uncles are set, nor block
 // rewards given.
 func (c *Clique) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs *[]*types.Transaction,
@@ -746,14 +785,25 @@ func (c *Clique) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 		if err != nil {
 			panic(err)
 		}
-		number := header.Number.Uint64()
+		ctx, cancel := c.callContext(nil, 0)
+		defer cancel()
+
 		blockSigner, _ := ecrecover(header, c.signatures)
-		if isNoturnDifficulty(header.Difficulty) && blockSigner != snap.SystemContracts.OfficialNode {
+		if isNoturnDifficulty(header.Difficulty) && blockSigner != snap.SystemContracts.OfficialNode && !snap.isBackupSealer(header.Number.Uint64(), blockSigner) {
 			return errInvalidDifficulty
 		}
+		if c.config.IsChaophrayaSystemTx(header.Number) {
+			if err := c.verifySystemTxs(header, snap, *systemTxs); err != nil {
+				return err
+			}
+		}
 
 		if needToUpdateValidatorList(c.config, header.Number) {
-			newValidators, _, err := c.contractClient.GetCurrentValidators(header.ParentHash, new(big.Int).SetUint64(number+1))
+			c.lock.RLock()
+			source := c.validatorSource
+			c.lock.RUnlock()
+
+			newValidators, err := source.SpanValidators(ctx, chain, header)
 			if err != nil {
 				return err
 			}
@@ -763,7 +813,7 @@ func (c *Clique) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 				copy(validatorsBytes[i*validatorBytesLength:], validator.HeaderBytes())
 			}
 
-			extraSuffix := len(header.Extra) - extraSeal - contractBytesLength
+			extraSuffix := len(header.Extra) - extraSeal - ctypes.RegistryVersionAt(c.config, header.Number).Size()
 			if !bytes.Equal(header.Extra[extraVanity:extraSuffix], validatorsBytes) {
 				return errMismatchingSpanValidators
 			}
@@ -772,14 +822,14 @@ func (c *Clique) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 		cx := chainContext{Chain: chain, clique: c}
 
 		if isSpanCommitmentBlock(c.config, header.Number) {
-			err := c.commitSpan(c.val, state, header, cx, txs, receipts, systemTxs, usedGas, false)
+			err := c.commitSpan(ctx, c.val, state, header, cx, txs, receipts, systemTxs, usedGas, false)
 			if err != nil {
 				return errInvalidSpan
 			}
 		}
 
-		// noturn is only permitted from official node
-		if !isInturnDifficulty(header.Difficulty) && header.Coinbase != snap.SystemContracts.OfficialNode {
+		// noturn is only permitted from official node and, after the backup fork, from backup sealers
+		if !isInturnDifficulty(header.Difficulty) && header.Coinbase != snap.SystemContracts.OfficialNode && !snap.isBackupSealer(header.Number.Uint64(), header.Coinbase) {
 			return errUnauthorizedSigner
 		}
 
@@ -788,21 +838,26 @@ func (c *Clique) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 			log.Debug("ℹ️  Commited by official node", "validator", header.Coinbase, "diff", header.Difficulty, "number", header.Number)
 			inturnSigner := snap.getInturnSigner(header.Number.Uint64())
 			log.Debug("🗡️  Slashing validator", "signer", inturnSigner, "diff", header.Difficulty, "number", header.Number)
-			err = c.slash(inturnSigner, chain, state, header, cx, txs, receipts, systemTxs, usedGas, false, snap)
+			err = c.slash(ctx, inturnSigner, chain, state, header, cx, txs, receipts, systemTxs, usedGas, false, snap)
 			if err != nil {
 				return err
 			}
 		}
 
+		if c.config.IsChaophrayaEvidence(header.Number) {
+			if err := c.slashDoubleSigns(ctx, chain, state, header, cx, txs, receipts, systemTxs, usedGas, false, snap); err != nil {
+				return err
+			}
+		}
+
 		val := header.Coinbase
 		err = c.distributeIncoming(val, state, header, cx, txs, receipts, systemTxs, usedGas, false, snap)
 		if err != nil {
 			return err
 		}
 		if len(*systemTxs) > 0 {
-			return errors.New("the length of systemTxs do not match")
+			return fmt.Errorf("%w: %d left", errExtraSystemTxs, len(*systemTxs))
 		}
-
 	}
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -819,6 +874,9 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 		if err != nil {
 			panic(err)
 		}
+		ctx, cancel := c.callContext(nil, contractCallTimeout)
+		defer cancel()
+
 		cx := chainContext{Chain: chain, clique: c}
 		if txs == nil {
 			txs = make([]*types.Transaction, 0)
@@ -827,7 +885,7 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 			receipts = make([]*types.Receipt, 0)
 		}
 		if isSpanCommitmentBlock(c.config, header.Number) {
-			err := c.commitSpan(c.val, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
+			err := c.commitSpan(ctx, c.val, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true)
 			if err != nil {
 				return nil, nil, errInvalidSpan
 			}
@@ -836,12 +894,17 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 		if !isInturnDifficulty(header.Difficulty) && header.Coinbase == snap.SystemContracts.OfficialNode {
 			inturnSigner := snap.getInturnSigner(header.Number.Uint64())
 			log.Debug("🗡️  Slashing validator (FAA)", "signer", inturnSigner, "diff", header.Difficulty, "number", header.Number)
-			err = c.slash(inturnSigner, chain, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true, snap)
+			err = c.slash(ctx, inturnSigner, chain, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true, snap)
 			if err != nil {
 				return nil, nil, err
 			}
 
 		}
+		if c.config.IsChaophrayaEvidence(header.Number) {
+			if err := c.slashDoubleSigns(ctx, chain, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true, snap); err != nil {
+				return nil, nil, err
+			}
+		}
 		err = c.distributeIncoming(c.val, state, header, cx, &txs, &receipts, nil, &header.GasUsed, true, snap)
 		if err != nil {
 			return nil, nil, err
@@ -856,20 +919,15 @@ func (c *Clique) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 }
 
 // slash spoiled validators
-func (c *Clique) slash(spoiledVal common.Address, chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
+func (c *Clique) slash(ctx context.Context, spoiledVal common.Address, chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
 	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool, snap *Snapshot) error {
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	currentSpan, err := c.contractClient.GetCurrentSpan(ctx, header)
+	currentSpan, err := c.spanNumber(ctx, header)
 	if err != nil {
 		return err
 	}
-	if isSpanFirstBlock(c.config, header.Number) {
-		currentSpan = new(big.Int).Add(currentSpan, common.Big1)
-	}
 
-	slashed, err := c.contractClient.IsSlashed(snap.SystemContracts.SlashManager, chain, spoiledVal, currentSpan, header)
+	slashed, err := c.contractClient.IsSlashed(ctx, snap.SystemContracts.SlashManager, chain, spoiledVal, currentSpan, header)
 
 	if err != nil {
 		return err
@@ -880,7 +938,20 @@ func (c *Clique) slash(spoiledVal common.Address, chain consensus.ChainHeaderRea
 	}
 
 	return c.contractClient.Slash(snap.SystemContracts.SlashManager, spoiledVal, chain, state, header, cx, txs, receipts, receivedTxs, usedGas, mining, currentSpan)
+}
 
+// spanNumber retrieves the number of the span the given block belongs to, as
+// tracked by the validator set contract. The contract is read at the parent
+// state, which is still in the previous span for the first block of a span.
+func (c *Clique) spanNumber(ctx context.Context, header *types.Header) (*big.Int, error) {
+	span, err := c.contractClient.GetCurrentSpan(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	if isSpanFirstBlock(c.config, header.Number) {
+		span = new(big.Int).Add(span, common.Big1)
+	}
+	return span, nil
 }
 
 func (c *Clique) distributeIncoming(val common.Address, state *state.StateDB, header *types.Header, chain core.ChainContext,
@@ -897,16 +968,14 @@ func (c *Clique) distributeIncoming(val common.Address, state *state.StateDB, he
 	return c.contractClient.DistributeToValidator(snap.SystemContracts.StakeManager, balance, val, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
 }
 
-func (c *Clique) commitSpan(val common.Address, state *state.StateDB, header *types.Header, chain core.ChainContext,
+func (c *Clique) commitSpan(ctx context.Context, val common.Address, state *state.StateDB, header *types.Header, chain core.ChainContext,
 	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error {
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
 
 	confirmBlockNr, _ := c.ethAPI.GetHeaderTypeByNumber(ctx, rpc.BlockNumber(parent.Number.Uint64()-5))
 
-	newValidators, _ := c.selectNextValidatorSet(parent, confirmBlockNr)
+	newValidators, _ := c.selectNextValidatorSet(ctx, parent, confirmBlockNr)
 
 	// get validators bytes
 	var validators []ctypes.MinimalVal
@@ -930,6 +999,11 @@ func (c *Clique) Authorize(val common.Address, signFn ctypes.SignerFn, signTxFn
 	c.contractClient.Inject(c.val, c.signTxFn)
 }
 
+// ContractClient returns the client the engine calls the system contracts with.
+func (c *Clique) ContractClient() ContractClient {
+	return c.contractClient
+}
+
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
@@ -942,7 +1016,7 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 		return errUnknownBlock
 	}
 	// For 0-period chains, refuse to seal empty blocks (no reward but would spin sealing)
-	if c.config.Clique.Period == 0 && len(block.Transactions()) == 0 {
+	if c.config.Clique.PeriodAt(number) == 0 && len(block.Transactions()) == 0 {
 		return errors.New("sealing paused while waiting for transactions")
 	}
 	// Don't hold the signer fields for the entire sealing procedure
@@ -998,16 +1072,15 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 		if isNoturnDifficulty(header.Difficulty) {
 			delay += time.Duration(rand.Int63n(int64(wiggleTime)))
 		}
-		ctx := context.Background()
+		ctx, cancel := c.callContext(stop, contractCallTimeout)
+		defer cancel()
+
 		inturnSigner := snap.getInturnSigner(header.Number.Uint64())
-		currentSpan, err := c.contractClient.GetCurrentSpan(ctx, header)
+		currentSpan, err := c.spanNumber(ctx, header)
 		if err != nil {
 			return err
 		}
-		if isSpanFirstBlock(c.config, header.Number) {
-			currentSpan = new(big.Int).Add(currentSpan, common.Big1)
-		}
-		slashed, err = c.contractClient.IsSlashed(snap.SystemContracts.SlashManager, chain, inturnSigner, currentSpan, header)
+		slashed, err = c.contractClient.IsSlashed(ctx, snap.SystemContracts.SlashManager, chain, inturnSigner, currentSpan, header)
 		if err != nil {
 			return err
 		}
@@ -1029,7 +1102,10 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 			return
 		case <-time.After(delay):
 		}
-		if c.config.IsChaophraya(header.Number) && (!isInturnDifficulty(header.Difficulty) || slashed) {
+		// After the official node fork, the official node waiting time is enforced
+		// by the block timestamp instead
+		official := val == snap.SystemContracts.OfficialNode && c.config.IsChaophrayaOfficial(header.Number)
+		if c.config.IsChaophraya(header.Number) && !official && (!isInturnDifficulty(header.Difficulty) || slashed) {
 			defaultWaitTime := time.Duration(2)
 			if slashed {
 				defaultWaitTime = time.Duration(0)
@@ -1038,7 +1114,7 @@ func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 			case <-stop:
 				return
 			case <-time.After(defaultWaitTime * time.Second):
-				if val != snap.SystemContracts.OfficialNode {
+				if val != snap.SystemContracts.OfficialNode && !snap.isBackupSealer(number, val) {
 					<-stop
 					return
 				}
@@ -1078,11 +1154,42 @@ func (c *Clique) SealHash(header *types.Header) common.Hash {
 	return SealHash(header)
 }
 
-// Close implements consensus.Engine. It's a noop for clique as there are no background threads.
+// Close implements consensus.Engine, stopping the validator set tracker if it's
+// running and closing the validator set subscriptions.
 func (c *Clique) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		c.scope.Close()
+	})
 	return nil
 }
 
+// callContext returns the context of the contract calls made by an engine
+// operation, which is cancelled once the engine is closed or the given stop
+// channel is. A non-zero timeout bounds the time the calls may take, which is
+// only done while mining or serving the API: the calls made while verifying a
+// block must complete for the block to be imported.
+func (c *Clique) callContext(stop <-chan struct{}, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	go func() {
+		select {
+		case <-c.quit:
+		case <-stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
 // APIs implements consensus.Engine, returning the user facing RPC API to allow
 // controlling the signer voting.
 func (c *Clique) APIs(chain consensus.ChainHeaderReader) []rpc.API {
@@ -1104,7 +1211,7 @@ func (c *Clique) IsInturn(chain consensus.ChainHeaderReader, header *types.Heade
 	}
 
 	if c.config.IsChaophraya(big.NewInt(int64(number))) {
-		if c.val != snap.getInturnSigner(number) && c.val != snap.SystemContracts.OfficialNode {
+		if c.val != snap.getInturnSigner(number) && c.val != snap.SystemContracts.OfficialNode && !snap.isBackupSealer(number, c.val) {
 			return false
 		}
 		return true
@@ -1112,17 +1219,28 @@ func (c *Clique) IsInturn(chain consensus.ChainHeaderReader, header *types.Heade
 	return snap.inturn(number, signer)
 }
 
-func (c *Clique) selectNextValidatorSet(parent *types.Header, seedBlock *types.Header) ([]ctypes.Validator, error) {
-	selectedProducers := make([]ctypes.Validator, 0)
+func (c *Clique) selectNextValidatorSet(ctx context.Context, parent *types.Header, seedBlock *types.Header) ([]ctypes.Validator, error) {
+	newValidators, _ := c.contractClient.GetEligibleValidators(ctx, parent.Hash(), parent.Number.Uint64())
+
+	// the next span may have a different length if an override takes effect there
+	_, start, length := c.config.Clique.SpanAt(parent.Number.Uint64() + 1)
+	_, _, nextLength := c.config.Clique.SpanAt(start + length)
 
 	// seed hash will be from parent hash to seed block hash
-	seedBytes := ToBytes32(seedBlock.Hash().Bytes()[:32])
+	return SelectValidators(newValidators, seedBlock.Hash(), nextLength), nil
+}
+
+// SelectValidators picks count validators from the eligible ones by weighted
+// random selection on their voting power, seeded from the given hash. This is
+// the selection the engine runs when committing the validators of a span.
+func SelectValidators(newValidators []*ctypes.Validator, seedHash common.Hash, count uint64) []ctypes.Validator {
+	selectedProducers := make([]ctypes.Validator, 0)
+
+	seedBytes := ToBytes32(seedHash.Bytes()[:32])
 	seed := int64(binary.BigEndian.Uint64(seedBytes[:]))
 
 	r := rand.New(rand.NewSource(seed))
 
-	newValidators, _ := c.contractClient.GetEligibleValidators(parent.Hash(), parent.Number.Uint64())
-
 	// weighted range from validators' voting power
 	votingPower := make([]uint64, len(newValidators))
 	for idx, validator := range newValidators {
@@ -1131,7 +1249,7 @@ func (c *Clique) selectNextValidatorSet(parent *types.Header, seedBlock *types.H
 
 	weightedRanges, totalVotingPower := createWeightedRanges(votingPower)
 
-	for i := uint64(0); i < c.config.Clique.Span; i++ {
+	for i := uint64(0); i < count; i++ {
 		/*
 			random must be in [1, totalVotingPower] to avoid situation such as
 			2 validators with 1 staking power each.
@@ -1142,7 +1260,7 @@ func (c *Clique) selectNextValidatorSet(parent *types.Header, seedBlock *types.H
 		index := binarySearch(weightedRanges, targetWeight)
 		selectedProducers = append(selectedProducers, *newValidators[index])
 	}
-	return selectedProducers[:c.config.Clique.Span], nil
+	return selectedProducers[:count]
 }
 
 func binarySearch(array []uint64, search uint64) int {
@@ -1275,8 +1393,7 @@ func (c chainContext) Config() *params.ChainConfig {
 
 // Check whether the given block is in the first block of an epoch
 func isOnEpochStart(config *params.ChainConfig, number *big.Int) bool {
-	n := number.Uint64()
-	return n%config.Clique.Epoch == 0
+	return config.Clique.IsEpochStart(number.Uint64())
 }
 
 // Check whether the next block of the given block is in proof-of-stake period.
@@ -1286,33 +1403,57 @@ func isNextBlockPoS(config *params.ChainConfig, number *big.Int) bool {
 
 // Check whether the given block is the commitment block (mid-span).
 func isSpanCommitmentBlock(config *params.ChainConfig, number *big.Int) bool {
-	bigSpan := new(big.Int).SetUint64(config.Clique.Span)
-
-	// number % span
-	mod := new(big.Int).Mod(number, bigSpan)
-	// span / 2 + 1
-	midSpan := new(big.Int).Div(bigSpan, common.Big2)
-	midSpan = midSpan.Add(midSpan, common.Big1)
-
-	// is pos && number % span = span / 2 + 1
-	return config.IsChaophraya(number) && mod.Cmp(midSpan) == 0
+	// is pos && number - span start = span / 2 + 1
+	_, start, length := config.Clique.SpanAt(number.Uint64())
+	return config.IsChaophraya(number) && number.Uint64()-start == length/2+1
 }
 
 // Check whether the given block is the first block of the span.
 func isSpanFirstBlock(config *params.ChainConfig, number *big.Int) bool {
-	bigSpan := new(big.Int).SetUint64(config.Clique.Span)
-	mod := new(big.Int).Mod(number, bigSpan)
-	return config.IsChaophraya(number) && mod.Cmp(common.Big0) == 0
+	_, start, _ := config.Clique.SpanAt(number.Uint64())
+	return config.IsChaophraya(number) && number.Uint64() == start
+}
+
+// spanRange returns the first and last block sealed by the validators of the
+// span the given block belongs to. The first span starts at the Chaophraya block
+// even if it is not aligned to the span length.
+func spanRange(config *params.ChainConfig, number uint64) (uint64, uint64) {
+	_, start, length := config.Clique.SpanAt(number)
+	end := start + length - 1
+	if fork := config.ChaophrayaBlock; fork != nil && start < fork.Uint64() {
+		start = fork.Uint64()
+	}
+	return start, end
+}
+
+// spanStartAt returns the first block of the span with the given number, as
+// tracked by the validator set contract. The contract counts the spans since
+// its deployment, so the numbering is anchored by a block whose span number is
+// known. False is returned if the span starts before the genesis block.
+func spanStartAt(config *params.ChainConfig, anchor uint64, anchorSpan uint64, span uint64) (uint64, bool) {
+	index, _, _ := config.Clique.SpanAt(anchor)
+	if span < anchorSpan {
+		if anchorSpan-span > index {
+			return 0, false
+		}
+		index -= anchorSpan - span
+	} else {
+		index += span - anchorSpan
+	}
+	start, _ := config.Clique.SpanStart(index)
+	return start, true
+}
+
+// spanCommitment returns the commitment block of the span the given block
+// belongs to, which commits the validators of the following span.
+func spanCommitment(config *params.ChainConfig, number uint64) uint64 {
+	_, start, length := config.Clique.SpanAt(number)
+	return start + length/2 + 1
 }
 
 // Check whether the next block of the given block is the first block of the span.
 func isNextBlockASpanFirstBlock(config *params.ChainConfig, number *big.Int) bool {
-	bigSpan := new(big.Int).SetUint64(config.Clique.Span)
-	nextBlock := new(big.Int).Add(number, common.Big1)
-	// (number + 1) % span
-	mod := new(big.Int).Mod(nextBlock, bigSpan)
-	// is pos && (number + 1) % span == 0
-	return config.IsChaophraya(nextBlock) && mod.Cmp(common.Big0) == 0
+	return isSpanFirstBlock(config, new(big.Int).Add(number, common.Big1))
 }
 
 // Check whether geth should update the validator list or not
@@ -18,6 +18,7 @@ package clique
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"math/big"
 	"testing"
@@ -238,6 +239,7 @@ func TestCommitSpan(t *testing.T) {
 		mockContractClient.EXPECT().GetCurrentValidators(
 			gomock.Any(),
 			gomock.Any(),
+			gomock.Any(),
 		).Return(getCurrentValidatorsReturns...).Times(1),
 	)
 
@@ -261,7 +263,7 @@ func TestCommitSpan(t *testing.T) {
 	mockEthAPI.EXPECT().GetHeaderTypeByNumber(gomock.Any(), gomock.Any()).Return(seedBlock, nil).Times(2)
 
 	// Mock the ContractClient calls
-	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any()).Return(signers, nil).Times(2)
+	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any(), gomock.Any()).Return(signers, nil).Times(2)
 	mockContractClient.EXPECT().CommitSpan(
 		gomock.Any(),
 		gomock.Any(),
@@ -370,6 +372,7 @@ func TestCommitSpan_NoEligibleValidator(t *testing.T) {
 	mockContractClient.EXPECT().GetCurrentValidators(
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(getCurrentValidatorsReturns...).Times(1)
 
 	err = testChain.Roll(t, setPoSValidatorAtBlock)
@@ -481,6 +484,7 @@ func TestSlashing_Call(t *testing.T) {
 	mockContractClient.EXPECT().GetCurrentValidators(
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(getCurrentValidatorsReturns...).Times(1)
 
 	err = testChain.Roll(t, int(chaophrayaBlock-1))
@@ -513,6 +517,7 @@ func TestSlashing_Call(t *testing.T) {
 		gomock.Any(),
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(false, nil).Times(1)
 
 	mockContractClient.EXPECT().Slash(
@@ -638,6 +643,7 @@ func TestSlashing_ShouldNotBeCalledWhenSlashed(t *testing.T) {
 	mockContractClient.EXPECT().GetCurrentValidators(
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(getCurrentValidatorsReturns...).Times(1)
 
 	err = testChain.Roll(t, int(chaophrayaBlock-1))
@@ -670,6 +676,7 @@ func TestSlashing_ShouldNotBeCalledWhenSlashed(t *testing.T) {
 		gomock.Any(),
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(true, nil).Times(1)
 
 	mockContractClient.EXPECT().Slash(
@@ -946,6 +953,7 @@ func TestRandomValidator(t *testing.T) {
 	mockContractClient.EXPECT().GetCurrentValidators(
 		gomock.Any(),
 		gomock.Any(),
+		gomock.Any(),
 	).Return(getCurrentValidatorsReturns...).Times(1)
 
 	err = testChain.Roll(t, setPoSValidatorAtBlock)
@@ -959,12 +967,12 @@ func TestRandomValidator(t *testing.T) {
 	header.Number = big.NewInt(int64(seedBlockNumber))
 
 	// Mock the ContractClient calls
-	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any()).Return(signers, nil).Times(1)
+	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any(), gomock.Any()).Return(signers, nil).Times(1)
 
 	want := []*ctypes.Validator{
 		{common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), 50}, {common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), 20}, {common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), 30}}
 
-	have, _ := c.selectNextValidatorSet(&header, &header)
+	have, _ := c.selectNextValidatorSet(context.Background(), &header, &header)
 
 	failed := false
 
@@ -981,3 +989,128 @@ func TestRandomValidator(t *testing.T) {
 	}
 
 }
+
+func TestSelectValidators(t *testing.T) {
+	var (
+		a = &ctypes.Validator{Address: common.Address{0x01}, VotingPower: 10}
+		b = &ctypes.Validator{Address: common.Address{0x02}, VotingPower: 10}
+		c = &ctypes.Validator{Address: common.Address{0x03}, VotingPower: 0}
+		d = &ctypes.Validator{Address: common.Address{0x04}, VotingPower: 30}
+
+		seed = common.HexToHash("0x715b9a1539844f85889e8bf8ef5c570c4cef0111863b5bf3dde16ae004b544d1")
+	)
+	tests := []struct {
+		validators []*ctypes.Validator
+		seed       common.Hash
+		count      uint64
+		want       []*ctypes.Validator
+	}{
+		// A single validator takes every slot
+		{[]*ctypes.Validator{d}, seed, 3, []*ctypes.Validator{d, d, d}},
+		// No slots, no validators
+		{[]*ctypes.Validator{a, b}, seed, 0, nil},
+		// Equal powers
+		{[]*ctypes.Validator{a, b}, common.Hash{}, 10, []*ctypes.Validator{a, b, a, a, b, b, b, a, b, a}},
+		// Validators without power are never selected
+		{[]*ctypes.Validator{a, b, c, d}, common.Hash{}, 10, []*ctypes.Validator{a, a, d, a, b, d, a, b, d, d}},
+		// The selection depends on the seed
+		{[]*ctypes.Validator{a, b, c, d}, seed, 10, []*ctypes.Validator{a, d, b, a, b, b, b, a, a, a}},
+	}
+	for i, tt := range tests {
+		have := SelectValidators(tt.validators, tt.seed, tt.count)
+		if len(have) != len(tt.want) {
+			t.Errorf("test %d: selection length mismatch: have %d, want %d", i, len(have), len(tt.want))
+			continue
+		}
+		for j := range have {
+			if have[j] != *tt.want[j] {
+				t.Errorf("test %d: slot %d mismatch: have %x, want %x", i, j, have[j].Address, tt.want[j].Address)
+			}
+		}
+	}
+}
+
+func TestSpanRange(t *testing.T) {
+	config := *test.NewDefaultConfig()
+	config.ChaophrayaBlock = big.NewInt(70)
+
+	tests := []struct {
+		number     uint64
+		start, end uint64
+	}{
+		{70, 70, 99},
+		{99, 70, 99},
+		{100, 100, 149},
+		{125, 100, 149},
+		{150, 150, 199},
+	}
+	for i, tt := range tests {
+		start, end := spanRange(&config, tt.number)
+		if start != tt.start || end != tt.end {
+			t.Errorf("test %d: span range mismatch: have [%d, %d], want [%d, %d]", i, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestSpanOverride(t *testing.T) {
+	config := &params.ChainConfig{
+		ChaophrayaBlock: big.NewInt(70),
+		Clique: &params.CliqueConfig{
+			Epoch:     30000,
+			Span:      50,
+			Overrides: []params.CliqueOverride{{Block: big.NewInt(200), Span: 20}},
+		},
+	}
+	if start, end := spanRange(config, 199); start != 150 || end != 199 {
+		t.Errorf("span range before override mismatch: have [%d, %d], want [150, 199]", start, end)
+	}
+	if start, end := spanRange(config, 205); start != 200 || end != 219 {
+		t.Errorf("span range after override mismatch: have [%d, %d], want [200, 219]", start, end)
+	}
+	if !needToUpdateValidatorList(config, big.NewInt(199)) || !needToUpdateValidatorList(config, big.NewInt(219)) {
+		t.Errorf("span header not detected around override")
+	}
+	if needToUpdateValidatorList(config, big.NewInt(249)) {
+		t.Errorf("span header detected at stale span length")
+	}
+	for number, want := range map[int64]bool{176: true, 211: true, 226: false, 231: true} {
+		if have := isSpanCommitmentBlock(config, big.NewInt(number)); have != want {
+			t.Errorf("block %d: commitment mismatch: have %v, want %v", number, have, want)
+		}
+	}
+	if commitment := spanCommitment(config, 219); commitment != 211 {
+		t.Errorf("commitment block mismatch: have %d, want 211", commitment)
+	}
+}
+
+func TestSpanStartAt(t *testing.T) {
+	config := &params.ChainConfig{
+		ChaophrayaBlock: big.NewInt(70),
+		Clique: &params.CliqueConfig{
+			Epoch:     30000,
+			Span:      50,
+			Overrides: []params.CliqueOverride{{Block: big.NewInt(200), Span: 20}},
+		},
+	}
+	// Anchor the contract numbering after the override, lagging one span behind
+	// the configured one
+	tests := []struct {
+		span  uint64
+		start uint64
+	}{
+		{0, 50},
+		{2, 150},
+		{3, 200},
+		{5, 240},
+		{6, 260},
+	}
+	for i, tt := range tests {
+		start, ok := spanStartAt(config, 245, 5, tt.span)
+		if !ok || start != tt.start {
+			t.Errorf("test %d: span start mismatch: have %d (%v), want %d", i, start, ok, tt.start)
+		}
+	}
+	if _, ok := spanStartAt(config, 245, 8, 1); ok {
+		t.Errorf("span before genesis resolved")
+	}
+}
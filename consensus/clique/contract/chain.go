@@ -0,0 +1,156 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// errCallByNumber is returned if an in-process contract call isn't pinned to
+	// a block hash.
+	errCallByNumber = errors.New("in-process contract calls require a block hash")
+
+	// errCallOverrides is returned if an in-process contract call carries state
+	// overrides, which are only supported through the RPC API.
+	errCallOverrides = errors.New("in-process contract calls don't support state overrides")
+
+	// errNoChain is returned if an in-process contract call is made before the
+	// chain is attached.
+	errNoChain = errors.New("no chain attached for in-process contract calls")
+)
+
+// StateChain is the local chain in-process contract calls are executed against,
+// as implemented by core.BlockChain.
+type StateChain interface {
+	core.ChainContext
+
+	// GetHeaderByHash retrieves a block header from the database by its hash.
+	GetHeaderByHash(hash common.Hash) *types.Header
+
+	// StateAt returns a mutable state based on a particular point in time.
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// ChainCaller executes read-only contract calls directly against the state of
+// the local chain, standing in for the RPC API. As the consensus engine, and so
+// the contract client, is created before the chain, the chain is attached once
+// it's available, the calls failing until then.
+//
+// ChainCaller is meant for the consensus-critical reads of the system contracts.
+// Unlike eth_call, it runs the call on the EVM directly instead of through
+// core.ApplyMessage, skipping the intrinsic gas charge, the access list warm-up
+// and the sender checks. Neither changes the result of the contracts' getters,
+// which don't depend on gasleft(), so the results match the ones of eth_call,
+// without depending on the RPC API being available.
+type ChainCaller struct {
+	config *params.ChainConfig
+	chain  StateChain
+	lock   sync.RWMutex
+}
+
+// NewChainCaller creates a caller executing contract calls against the chain
+// attached later on.
+func NewChainCaller(config *params.ChainConfig) *ChainCaller {
+	return &ChainCaller{config: config}
+}
+
+// Attach sets the chain the contract calls are executed against.
+func (c *ChainCaller) Attach(chain StateChain) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.chain = chain
+}
+
+// Call implements EthAPI, executing the call on top of the state of the block
+// the way eth_call does.
+func (c *ChainCaller) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	c.lock.RLock()
+	chain := c.chain
+	c.lock.RUnlock()
+
+	if chain == nil {
+		return nil, errNoChain
+	}
+	if overrides != nil {
+		return nil, errCallOverrides
+	}
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		return nil, errCallByNumber
+	}
+	header := chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, fmt.Errorf("unknown block %x", hash)
+	}
+	statedb, err := chain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	if args.To == nil {
+		return nil, errors.New("contract call without recipient")
+	}
+	var data []byte
+	if args.Data != nil {
+		data = *args.Data
+	}
+	msg := getSystemMessage(common.Address{}, *args.To, data, new(big.Int))
+	if args.Gas != nil {
+		msg.CallMsg.Gas = uint64(*args.Gas)
+	}
+	blockContext := core.NewEVMBlockContext(header, chain, nil)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{Origin: msg.From(), GasPrice: new(big.Int)}, statedb, c.config, vm.Config{NoBaseFee: true})
+
+	// Abort the execution once the call is cancelled or times out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		vmenv.Cancel()
+	}()
+	ret, _, err := vmenv.Call(vm.AccountRef(msg.From()), *msg.To(), msg.Data(), msg.Gas(), msg.Value())
+	if vmenv.Cancelled() || ctx.Err() != nil {
+		return nil, fmt.Errorf("execution aborted: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewWithChain creates a contract client executing its read-only calls in
+// process against the state of the given chain, bypassing the RPC API.
+func NewWithChain(config *params.ChainConfig, chain StateChain) (*ContractClient, error) {
+	caller := NewChainCaller(config)
+	caller.Attach(chain)
+	return New(config, caller)
+}
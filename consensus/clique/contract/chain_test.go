@@ -0,0 +1,165 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package contract
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestChainCaller(t *testing.T) {
+	var (
+		validatorSet = common.HexToAddress("0x0000000000000000000000000000000000001000")
+		config       = *params.TestChainConfig
+		db           = rawdb.NewMemoryDatabase()
+	)
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000, ValidatorContract: validatorSet}
+
+	// The validator set answers every call with 7, the current span number
+	genesis := (&core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, 32+common.AddressLength+65),
+		Alloc: core.GenesisAlloc{
+			validatorSet: {Balance: new(big.Int), Code: common.FromHex("0x600760005260206000f3")},
+		},
+	}).MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, &config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	client, err := NewWithChain(&config, chain)
+	if err != nil {
+		t.Fatalf("failed to create contract client: %v", err)
+	}
+	header := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1)}
+	span, err := client.GetCurrentSpan(context.Background(), header)
+	if err != nil {
+		t.Fatalf("failed to get current span: %v", err)
+	}
+	if span.Uint64() != 7 {
+		t.Errorf("span mismatch: have %d, want 7", span)
+	}
+	// Calls on unknown blocks fail instead of falling back to another state
+	header.ParentHash = common.HexToHash("0xdeadbeef")
+	if _, err := client.GetCurrentSpan(context.Background(), header); err == nil {
+		t.Errorf("call on unknown block succeeded")
+	}
+	// Calls made before the chain is attached fail
+	caller := NewChainCaller(&config)
+	if _, err := caller.Call(context.Background(), ethapi.TransactionArgs{To: &validatorSet}, rpc.BlockNumberOrHashWithHash(genesis.Hash(), false), nil); err != errNoChain {
+		t.Errorf("error mismatch: have %v, want %v", err, errNoChain)
+	}
+	// Cancelled calls are aborted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	header.ParentHash = genesis.Hash()
+	client.calls.Purge()
+	if _, err := client.GetCurrentSpan(ctx, header); err == nil {
+		t.Errorf("cancelled call succeeded")
+	}
+}
+
+// Tests that the calls executed by the chain caller return the same results as
+// the ones executed through core.ApplyMessage, as eth_call does.
+func TestChainCallerApplyMessage(t *testing.T) {
+	var (
+		echo   = common.HexToAddress("0x0000000000000000000000000000000000001000")
+		revert = common.HexToAddress("0x0000000000000000000000000000000000001001")
+		store  = common.HexToAddress("0x0000000000000000000000000000000000001002")
+		config = *params.TestChainConfig
+		db     = rawdb.NewMemoryDatabase()
+	)
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000}
+
+	genesis := (&core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, 32+common.AddressLength+65),
+		Alloc: core.GenesisAlloc{
+			// Returns the call data
+			echo: {Balance: new(big.Int), Code: common.FromHex("0x366000600037366000f3")},
+			// Reverts every call
+			revert: {Balance: new(big.Int), Code: common.FromHex("0x60006000fd")},
+			// Returns the value stored in the slot of the call data
+			store: {
+				Balance: new(big.Int),
+				Code:    common.FromHex("0x6000355460005260206000f3"),
+				Storage: map[common.Hash]common.Hash{{}: common.HexToHash("0x2a")},
+			},
+		},
+	}).MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, &config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	caller := NewChainCaller(&config)
+	caller.Attach(chain)
+
+	tests := []struct {
+		to   common.Address
+		data []byte
+	}{
+		{echo, nil},
+		{echo, common.FromHex("0xdeadbeef")},
+		{revert, nil},
+		{store, make([]byte, 32)},
+		{store, common.LeftPadBytes([]byte{0x01}, 32)},
+	}
+	for i, tt := range tests {
+		var (
+			to   = tt.to
+			data = hexutil.Bytes(tt.data)
+			gas  = hexutil.Uint64(50000000)
+		)
+		have, haveErr := caller.Call(context.Background(), ethapi.TransactionArgs{To: &to, Data: &data, Gas: &gas}, rpc.BlockNumberOrHashWithHash(genesis.Hash(), false), nil)
+
+		statedb, err := chain.StateAt(genesis.Root())
+		if err != nil {
+			t.Fatalf("failed to open state: %v", err)
+		}
+		msg := types.NewMessage(common.Address{}, &to, 0, new(big.Int), uint64(gas), new(big.Int), new(big.Int), new(big.Int), tt.data, nil, true)
+		vmenv := vm.NewEVM(core.NewEVMBlockContext(genesis.Header(), chain, nil), core.NewEVMTxContext(msg), statedb, &config, vm.Config{NoBaseFee: true})
+		result, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(uint64(gas)))
+		if err != nil {
+			t.Fatalf("test %d: failed to apply message: %v", i, err)
+		}
+		if haveErr != result.Err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, haveErr, result.Err)
+		}
+		if result.Err == nil && !bytes.Equal(have, result.ReturnData) {
+			t.Errorf("test %d: result mismatch: have %x, want %x", i, have, result.ReturnData)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"math"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
@@ -21,12 +22,36 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
 )
 
+// callCacheSize is the number of read-only contract call results to cache.
+const callCacheSize = 256
+
+var (
+	// ErrCallTimeout is returned if a read-only contract call is aborted as the
+	// deadline of its context expired.
+	ErrCallTimeout = errors.New("contract call timed out")
+
+	callTimer          = metrics.NewRegisteredTimer("clique/contract/call", nil)
+	callTimeoutMeter   = metrics.NewRegisteredMeter("clique/contract/call/timeout", nil)
+	callCacheHitMeter  = metrics.NewRegisteredMeter("clique/contract/cache/hit", nil)
+	callCacheMissMeter = metrics.NewRegisteredMeter("clique/contract/cache/miss", nil)
+)
+
+// callKey identifies a read-only contract call executed on the state of a block.
+type callKey struct {
+	block common.Hash
+	to    common.Address
+	data  common.Hash // Hash of the calldata
+}
+
 type ContractClient struct {
 	stakeManagerABI abi.ABI
 	slashManagerABI abi.ABI
@@ -36,9 +61,12 @@ type ContractClient struct {
 	val             common.Address
 	signTxFn        ctypes.SignerTxFn
 	ethAPI          EthAPI
+	calls           *lru.Cache // Results of read-only contract calls by callKey, nil if not caching
 }
 
-func New(config *params.ChainConfig, ethAPI *ethapi.PublicBlockChainAPI) (*ContractClient, error) {
+// New creates a contract client executing its read-only calls through the given
+// API, typically a ChainCaller.
+func New(config *params.ChainConfig, ethAPI EthAPI) (*ContractClient, error) {
 	vABI, err := abi.JSON(strings.NewReader(validatorSetABI))
 	if err != nil {
 		return &ContractClient{}, err
@@ -52,12 +80,15 @@ func New(config *params.ChainConfig, ethAPI *ethapi.PublicBlockChainAPI) (*Contr
 		return &ContractClient{}, err
 	}
 
+	calls, _ := lru.New(callCacheSize)
+
 	return &ContractClient{
 		stakeManagerABI: sABI,
 		slashManagerABI: slABI,
 		validatorSetABI: vABI,
 		ethAPI:          ethAPI,
 		config:          config,
+		calls:           calls,
 	}, nil
 }
 
@@ -91,8 +122,29 @@ func (cc *ContractClient) Slash(contract common.Address, spoiledVal common.Addre
 	return cc.applyTransaction(msg, state, header, cx, txs, receipts, receivedTxs, usedGas, mining)
 }
 
+// SlashDoubleSign slashes a double signer through the slash method, as the
+// SlashManager has no dedicated entrypoint. The evidence is appended to the call
+// data, ignored by the contract but verified by the nodes importing the block.
+func (cc *ContractClient) SlashDoubleSign(contract common.Address, signer common.Address, span *big.Int, evidence []byte, state *state.StateDB, header *types.Header, cx core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error {
+	method := "slash"
+	// get packed data
+	data, err := cc.slashManagerABI.Pack(method,
+		signer,
+		span,
+	)
+	if err != nil {
+		log.Error("Unable to pack tx for slash", "error", err)
+		return err
+	}
+	data = append(data, evidence...)
+	// get system message
+	msg := getSystemMessage(header.Coinbase, contract, data, common.Big0)
+	// apply message
+	return cc.applyTransaction(msg, state, header, cx, txs, receipts, receivedTxs, usedGas, mining)
+}
+
 func (cc *ContractClient) GetCurrentSpan(ctx context.Context, header *types.Header) (*big.Int, error) {
-	blockNr := rpc.BlockNumberOrHashWithHash(header.ParentHash, false)
 	method := "currentSpanNumber"
 	// get packed data
 	data, err := cc.validatorSetABI.Pack(method)
@@ -100,15 +152,7 @@ func (cc *ContractClient) GetCurrentSpan(ctx context.Context, header *types.Head
 		log.Error("Unable to pack tx for deposit", "error", err)
 		return nil, err
 	}
-
-	msgData := (hexutil.Bytes)(data)
-	toAddress := cc.getValidatorContract(header.Number)
-	gas := (hexutil.Uint64)(uint64(math.MaxUint64 / 2))
-	result, err := cc.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		Gas:  &gas,
-		To:   &toAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	result, err := cc.call(ctx, header.ParentHash, cc.getValidatorContract(header.Number), data)
 	if err != nil {
 		return nil, err
 	}
@@ -154,14 +198,9 @@ func (cc *ContractClient) CommitSpan(val common.Address, state *state.StateDB, h
 	return cc.applyTransaction(msg, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
 }
 
-func (cc *ContractClient) IsSlashed(contract common.Address, chain consensus.ChainHeaderReader, signer common.Address, span *big.Int, header *types.Header) (bool, error) {
-	blockNr := rpc.BlockNumberOrHashWithHash(header.ParentHash, false)
-
+func (cc *ContractClient) IsSlashed(ctx context.Context, contract common.Address, chain consensus.ChainHeaderReader, signer common.Address, span *big.Int, header *types.Header) (bool, error) {
 	method := "isSignerSlashed"
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
 	// get packed data
 	data, err := cc.slashManagerABI.Pack(
 		method,
@@ -173,16 +212,7 @@ func (cc *ContractClient) IsSlashed(contract common.Address, chain consensus.Cha
 		log.Error("Unable to pack tx for isSignerSlashed", "error", err)
 		return false, err
 	}
-
-	// call
-	msgData := (hexutil.Bytes)(data)
-	toAddress := contract
-	gas := (hexutil.Uint64)(uint64(math.MaxUint64 / 2))
-	result, err := cc.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		Gas:  &gas,
-		To:   &toAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	result, err := cc.call(ctx, header.ParentHash, contract, data)
 	if err != nil {
 		return false, err
 	}
@@ -193,15 +223,9 @@ func (cc *ContractClient) IsSlashed(contract common.Address, chain consensus.Cha
 	return out, nil
 }
 
-func (cc *ContractClient) GetCurrentValidators(headerHash common.Hash, blockNumber *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error) {
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(headerHash, false)
-
+func (cc *ContractClient) GetCurrentValidators(ctx context.Context, headerHash common.Hash, blockNumber *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error) {
 	method := "getValidators"
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
 	// get packed data
 	data, err := cc.validatorSetABI.Pack(
 		method,
@@ -211,16 +235,7 @@ func (cc *ContractClient) GetCurrentValidators(headerHash common.Hash, blockNumb
 		log.Error("Unable to pack tx for getValidators", "error", err)
 		return nil, nil, err
 	}
-
-	// call
-	msgData := (hexutil.Bytes)(data)
-	toAddress := cc.getValidatorContract(blockNumber)
-	gas := (hexutil.Uint64)(uint64(math.MaxUint64 / 2))
-	result, err := cc.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		Gas:  &gas,
-		To:   &toAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	result, err := cc.call(ctx, headerHash, cc.getValidatorContract(blockNumber), data)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -255,15 +270,10 @@ func (cc *ContractClient) GetCurrentValidators(headerHash common.Hash, blockNumb
 	return valz, ca, nil
 }
 
-// GetCurrentValidators get current validators
-func (cc *ContractClient) GetEligibleValidators(headerHash common.Hash, blockNumber uint64) ([]*ctypes.Validator, error) {
-	blockNr := rpc.BlockNumberOrHashWithHash(headerHash, false)
-
+// GetEligibleValidators get the validators eligible for the next span
+func (cc *ContractClient) GetEligibleValidators(ctx context.Context, headerHash common.Hash, blockNumber uint64) ([]*ctypes.Validator, error) {
 	method := "getEligibleValidators"
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	// get packed data
 	data, err := cc.validatorSetABI.Pack(
 		method,
@@ -272,26 +282,21 @@ func (cc *ContractClient) GetEligibleValidators(headerHash common.Hash, blockNum
 		log.Error("Unable to pack tx for getValidator", "error", err)
 		return nil, err
 	}
-
-	// call
-	msgData := (hexutil.Bytes)(data)
-	toAddress := cc.getValidatorContract(big.NewInt(int64(blockNumber)))
-	gas := (hexutil.Uint64)(uint64(math.MaxUint64 / 2))
-	result, err := cc.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		Gas:  &gas,
-		To:   &toAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	result, err := cc.call(ctx, headerHash, cc.getValidatorContract(new(big.Int).SetUint64(blockNumber)), data)
 	if err != nil {
 		return nil, err
 	}
 
+	return cc.unpackEligibleValidators(result)
+}
+
+func (cc *ContractClient) unpackEligibleValidators(result []byte) ([]*ctypes.Validator, error) {
 	var ret0 = new([]struct {
 		Address     common.Address
 		VotingPower *big.Int
 	})
 
-	if err := cc.validatorSetABI.UnpackIntoInterface(ret0, method, result); err != nil {
+	if err := cc.validatorSetABI.UnpackIntoInterface(ret0, "getEligibleValidators", result); err != nil {
 		return nil, err
 	}
 	valz := make([]*ctypes.Validator, len(*ret0))
@@ -305,6 +310,47 @@ func (cc *ContractClient) GetEligibleValidators(headerHash common.Hash, blockNum
 	return valz, nil
 }
 
+// call executes a read-only contract call on the state of the given block. The
+// result only depends on the block and the call, so repeated calls, issued for
+// the same parent while preparing, finalizing and sealing, are served from the
+// cache. Calls are aborted once the context is done, the callers bounding the
+// time the calls may take by the deadline of the context.
+//
+// The cache holds its own copy of the results and returns copies, so that the
+// callers may freely modify them.
+func (cc *ContractClient) call(ctx context.Context, block common.Hash, to common.Address, data []byte) ([]byte, error) {
+	key := callKey{block: block, to: to, data: crypto.Keccak256Hash(data)}
+	if cc.calls != nil {
+		if result, ok := cc.calls.Get(key); ok {
+			callCacheHitMeter.Mark(1)
+			return common.CopyBytes(result.(hexutil.Bytes)), nil
+		}
+		callCacheMissMeter.Mark(1)
+	}
+	msgData := (hexutil.Bytes)(data)
+	gas := (hexutil.Uint64)(uint64(math.MaxUint64 / 2))
+
+	start := time.Now()
+	result, err := cc.ethAPI.Call(ctx, ethapi.TransactionArgs{
+		Gas:  &gas,
+		To:   &to,
+		Data: &msgData,
+	}, rpc.BlockNumberOrHashWithHash(block, false), nil)
+	callTimer.UpdateSince(start)
+
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			callTimeoutMeter.Mark(1)
+			return nil, fmt.Errorf("%w: %v", ErrCallTimeout, err)
+		}
+		return nil, err
+	}
+	if cc.calls != nil {
+		cc.calls.Add(key, hexutil.Bytes(common.CopyBytes(result)))
+	}
+	return result, nil
+}
+
 func (cc *ContractClient) getValidatorContract(number *big.Int) common.Address {
 	validatorContract := cc.config.Clique.ValidatorContract
 	if cc.config.ChaophrayaBangkokBlock != nil && cc.config.IsChaophrayaBangkok(number) {
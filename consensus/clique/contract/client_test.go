@@ -0,0 +1,148 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package contract
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testEthAPI answers calls with a span number, counting the calls made and
+// optionally blocking until the call is cancelled.
+type testEthAPI struct {
+	calls int
+	block bool
+}
+
+func (api *testEthAPI) Call(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *ethapi.StateOverride) (hexutil.Bytes, error) {
+	api.calls++
+	if api.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return common.LeftPadBytes([]byte{7}, 32), nil
+}
+
+func TestCallCache(t *testing.T) {
+	config := &params.ChainConfig{Clique: &params.CliqueConfig{ValidatorContract: common.HexToAddress("0x1000")}}
+	client, err := New(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create contract client: %v", err)
+	}
+	api := new(testEthAPI)
+	client.ethAPI = api
+
+	header := &types.Header{ParentHash: common.HexToHash("0x01"), Number: big.NewInt(10)}
+	for i := 0; i < 3; i++ {
+		span, err := client.GetCurrentSpan(context.Background(), header)
+		if err != nil {
+			t.Fatalf("failed to get current span: %v", err)
+		}
+		if span.Uint64() != 7 {
+			t.Errorf("span mismatch: have %d, want 7", span)
+		}
+	}
+	if api.calls != 1 {
+		t.Errorf("repeated calls on the same parent not cached: have %d calls, want 1", api.calls)
+	}
+	header.ParentHash = common.HexToHash("0x02")
+	if _, err := client.GetCurrentSpan(context.Background(), header); err != nil {
+		t.Fatalf("failed to get current span: %v", err)
+	}
+	if api.calls != 2 {
+		t.Errorf("call on another parent served from the cache: have %d calls, want 2", api.calls)
+	}
+}
+
+// Tests that the callers modifying the call results don't corrupt the cache.
+func TestCallCacheCopy(t *testing.T) {
+	config := &params.ChainConfig{Clique: &params.CliqueConfig{ValidatorContract: common.HexToAddress("0x1000")}}
+	client, err := New(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create contract client: %v", err)
+	}
+	client.ethAPI = new(testEthAPI)
+
+	block, to := common.HexToHash("0x01"), common.HexToAddress("0x1000")
+	for i := 0; i < 3; i++ {
+		result, err := client.call(context.Background(), block, to, nil)
+		if err != nil {
+			t.Fatalf("failed to call contract: %v", err)
+		}
+		if want := common.LeftPadBytes([]byte{7}, 32); !bytes.Equal(result, want) {
+			t.Fatalf("call %d: result mismatch: have %x, want %x", i, result, want)
+		}
+		result[31] = 0xff
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	config := &params.ChainConfig{Clique: &params.CliqueConfig{ValidatorContract: common.HexToAddress("0x1000")}}
+	client, err := New(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create contract client: %v", err)
+	}
+	api := &testEthAPI{block: true}
+	client.ethAPI = api
+
+	header := &types.Header{ParentHash: common.HexToHash("0x01"), Number: big.NewInt(10)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetCurrentSpan(ctx, header); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrCallTimeout)
+	}
+	// Cancelled calls are not timeouts, and failed calls aren't cached
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetCurrentSpan(ctx, header); err == nil || errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("error mismatch: have %v, want cancellation", err)
+	}
+	if api.calls != 2 {
+		t.Errorf("failed call cached: have %d calls, want 2", api.calls)
+	}
+}
+
+func TestCallWithoutCache(t *testing.T) {
+	config := &params.ChainConfig{Clique: &params.CliqueConfig{ValidatorContract: common.HexToAddress("0x1000")}}
+	client, err := New(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create contract client: %v", err)
+	}
+	api := new(testEthAPI)
+	client.ethAPI, client.calls = api, nil
+
+	header := &types.Header{ParentHash: common.HexToHash("0x01"), Number: big.NewInt(10)}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetCurrentSpan(context.Background(), header); err != nil {
+			t.Fatalf("failed to get current span: %v", err)
+		}
+	}
+	if api.calls != 2 {
+		t.Errorf("call count mismatch: have %d, want 2", api.calls)
+	}
+}
@@ -27,6 +27,10 @@ type ContractClient interface {
 	Slash(contract common.Address, spoiledVal common.Address, chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
 		txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool, currentSpan *big.Int) error
 
+	// Send slash transaction for a double sign in the given span, carrying the evidence
+	SlashDoubleSign(contract common.Address, signer common.Address, span *big.Int, evidence []byte, state *state.StateDB, header *types.Header, cx core.ChainContext,
+		txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error
+
 	// Call for a current span number
 	GetCurrentSpan(ctx context.Context, header *types.Header) (*big.Int, error)
 
@@ -40,11 +44,11 @@ type ContractClient interface {
 		txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool, validatorBytes []byte) error
 
 	// Call is signer slashed
-	IsSlashed(contract common.Address, chain consensus.ChainHeaderReader, signer common.Address, span *big.Int, header *types.Header) (bool, error)
+	IsSlashed(ctx context.Context, contract common.Address, chain consensus.ChainHeaderReader, signer common.Address, span *big.Int, header *types.Header) (bool, error)
 
 	// Call for  current commited validators
-	GetCurrentValidators(headerHash common.Hash, blockNumber *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error)
+	GetCurrentValidators(ctx context.Context, headerHash common.Hash, blockNumber *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error)
 
 	// Call for eligible validators
-	GetEligibleValidators(headerHash common.Hash, blockNumber uint64) ([]*ctypes.Validator, error)
+	GetEligibleValidators(ctx context.Context, headerHash common.Hash, blockNumber uint64) ([]*ctypes.Validator, error)
 }
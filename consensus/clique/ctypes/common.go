@@ -12,12 +12,53 @@ import (
 type SignerFn func(signer accounts.Account, mimeType string, message []byte) ([]byte, error)
 type SignerTxFn func(accounts.Account, *types.Transaction, *big.Int) (*types.Transaction, error)
 
+// SystemContract names an entry of the system contract registry.
+type SystemContract string
+
+const (
+	StakeManager SystemContract = "stakeManager"
+	SlashManager SystemContract = "slashManager"
+	OfficialNode SystemContract = "officialNode"
+)
+
+// SystemContracts is the system contract registry committed in a span header.
 type SystemContracts struct {
+	Version      uint64         `json:"version,omitempty"` // Registry version the addresses were committed with
 	StakeManager common.Address `json:"stakeManager"`
 	SlashManager common.Address `json:"slashManager"`
 	OfficialNode common.Address `json:"officialNode"`
 }
 
+// Address returns the address of a system contract, or false if the contract
+// isn't part of the registry.
+func (s *SystemContracts) Address(name SystemContract) (common.Address, bool) {
+	switch name {
+	case StakeManager:
+		return s.StakeManager, true
+	case SlashManager:
+		return s.SlashManager, true
+	case OfficialNode:
+		return s.OfficialNode, true
+	}
+	return common.Address{}, false
+}
+
+// SetAddress sets the address of a system contract, returning false if the
+// contract isn't part of the registry.
+func (s *SystemContracts) SetAddress(name SystemContract, address common.Address) bool {
+	switch name {
+	case StakeManager:
+		s.StakeManager = address
+	case SlashManager:
+		s.SlashManager = address
+	case OfficialNode:
+		s.OfficialNode = address
+	default:
+		return false
+	}
+	return true
+}
+
 // Validator represets Volatile state for each Validator
 type Validator struct {
 	Address     common.Address `json:"signer"`
@@ -0,0 +1,42 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ctypes
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DefaultOfficialDelay is the number of seconds the official node waits after the
+// block period before sealing out of turn, if the chain config doesn't specify
+// it.
+const DefaultOfficialDelay = 2
+
+// OfficialDelay returns the number of seconds the official node waits after the
+// block period before sealing out of turn.
+func OfficialDelay(config *params.CliqueConfig) uint64 {
+	if config.OfficialDelay == 0 {
+		return DefaultOfficialDelay
+	}
+	return config.OfficialDelay
+}
+
+// OfficialTime returns the earliest timestamp the official node may seal the
+// child of parent with out of turn.
+func OfficialTime(config *params.CliqueConfig, parent *types.Header) uint64 {
+	return parent.Time + config.PeriodAt(parent.Number.Uint64()+1) + OfficialDelay(config)
+}
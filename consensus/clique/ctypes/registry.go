@@ -0,0 +1,119 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ctypes
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// ErrUnknownRegistryVersion is returned if a system contract registry version
+	// isn't known by the node.
+	ErrUnknownRegistryVersion = errors.New("unknown system contract registry version")
+
+	// ErrInvalidRegistry is returned if a committed registry doesn't match the
+	// layout of its version.
+	ErrInvalidRegistry = errors.New("invalid system contract registry")
+)
+
+// RegistryVersion is a layout of the system contract registry committed at the
+// end of the span headers, right before the seal. A system contract is added by
+// appending a version listing it, activated by a fork, and a field to
+// SystemContracts.
+type RegistryVersion struct {
+	Version   uint64
+	Contracts []SystemContract                                    // Contracts in the order their addresses are committed
+	Called    []SystemContract                                    // Contracts the system transactions are sent to
+	Activated func(config *params.ChainConfig, num *big.Int) bool // Whether span headers at num commit this version
+}
+
+// RegistryVersions are the known registry versions, in activation order.
+var RegistryVersions = []*RegistryVersion{
+	{
+		Version:   1,
+		Contracts: []SystemContract{StakeManager, SlashManager, OfficialNode},
+		Called:    []SystemContract{StakeManager, SlashManager},
+		Activated: (*params.ChainConfig).IsChaophraya,
+	},
+}
+
+// RegistryVersionAt returns the registry version committed by the span header
+// with the given number.
+func RegistryVersionAt(config *params.ChainConfig, number *big.Int) *RegistryVersion {
+	for i := len(RegistryVersions) - 1; i > 0; i-- {
+		if RegistryVersions[i].Activated(config, number) {
+			return RegistryVersions[i]
+		}
+	}
+	return RegistryVersions[0]
+}
+
+// RegistryVersionOf returns the registry version the given contracts were
+// committed with. Registries persisted before versioning are of the first one.
+func RegistryVersionOf(contracts *SystemContracts) (*RegistryVersion, error) {
+	if contracts.Version == 0 {
+		return RegistryVersions[0], nil
+	}
+	for _, version := range RegistryVersions {
+		if version.Version == contracts.Version {
+			return version, nil
+		}
+	}
+	return nil, ErrUnknownRegistryVersion
+}
+
+// Size returns the number of bytes the registry takes in a span header.
+func (v *RegistryVersion) Size() int {
+	return len(v.Contracts) * common.AddressLength
+}
+
+// Encode serializes the registry into its span header representation.
+func (v *RegistryVersion) Encode(contracts *SystemContracts) []byte {
+	blob := make([]byte, 0, v.Size())
+	for _, name := range v.Contracts {
+		address, _ := contracts.Address(name)
+		blob = append(blob, address.Bytes()...)
+	}
+	return blob
+}
+
+// Decode parses the registry from its span header representation.
+func (v *RegistryVersion) Decode(blob []byte) (SystemContracts, error) {
+	contracts := SystemContracts{Version: v.Version}
+	if len(blob) != v.Size() {
+		return contracts, ErrInvalidRegistry
+	}
+	for i, name := range v.Contracts {
+		contracts.SetAddress(name, common.BytesToAddress(blob[i*common.AddressLength:(i+1)*common.AddressLength]))
+	}
+	return contracts, nil
+}
+
+// IsCalled reports whether the system transactions may be sent to the given
+// address of the registry.
+func (v *RegistryVersion) IsCalled(contracts *SystemContracts, to common.Address) bool {
+	for _, name := range v.Called {
+		if address, ok := contracts.Address(name); ok && address == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ctypes
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestRegistryEncoding(t *testing.T) {
+	config := &params.ChainConfig{ChaophrayaBlock: big.NewInt(10), Clique: &params.CliqueConfig{Epoch: 30000, Span: 50}}
+	contracts := SystemContracts{
+		StakeManager: common.HexToAddress("0x0000000000000000000000000000000000001001"),
+		SlashManager: common.HexToAddress("0x0000000000000000000000000000000000001002"),
+		OfficialNode: common.HexToAddress("0x0000000000000000000000000000000000001003"),
+	}
+	version := RegistryVersionAt(config, big.NewInt(59))
+	if version.Version != 1 || version.Size() != 3*common.AddressLength {
+		t.Fatalf("registry version mismatch: have v%d with %d bytes, want v1 with %d bytes", version.Version, version.Size(), 3*common.AddressLength)
+	}
+	blob := version.Encode(&contracts)
+	if len(blob) != version.Size() {
+		t.Fatalf("encoded registry size mismatch: have %d, want %d", len(blob), version.Size())
+	}
+	decoded, err := version.Decode(blob)
+	if err != nil {
+		t.Fatalf("failed to decode registry: %v", err)
+	}
+	contracts.Version = 1
+	if decoded != contracts {
+		t.Errorf("decoded registry mismatch: have %+v, want %+v", decoded, contracts)
+	}
+	if _, err := version.Decode(blob[1:]); !errors.Is(err, ErrInvalidRegistry) {
+		t.Errorf("short registry error mismatch: have %v, want %v", err, ErrInvalidRegistry)
+	}
+	// Only the contracts receiving system transactions are called
+	if !version.IsCalled(&decoded, contracts.StakeManager) || !version.IsCalled(&decoded, contracts.SlashManager) {
+		t.Errorf("system contract not called")
+	}
+	if version.IsCalled(&decoded, contracts.OfficialNode) {
+		t.Errorf("official node called")
+	}
+	// Registries persisted before versioning are of the first version
+	if version, err := RegistryVersionOf(&SystemContracts{}); err != nil || version.Version != 1 {
+		t.Errorf("legacy registry version mismatch: have %v, %v", version, err)
+	}
+	if _, err := RegistryVersionOf(&SystemContracts{Version: 1 << 32}); !errors.Is(err, ErrUnknownRegistryVersion) {
+		t.Errorf("unknown registry version error mismatch: have %v, want %v", err, ErrUnknownRegistryVersion)
+	}
+}
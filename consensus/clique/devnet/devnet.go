@@ -0,0 +1,298 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package devnet generates the genesis of local Chaophraya proof-of-stake
+// networks, along with the keys of their validators.
+package devnet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
+	extraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signer seal
+)
+
+// Default addresses the system contracts are allocated at.
+var (
+	DefaultValidatorSet = common.HexToAddress("0x0000000000000000000000000000000000001000")
+	DefaultStakeManager = common.HexToAddress("0x0000000000000000000000000000000000001001")
+	DefaultSlashManager = common.HexToAddress("0x0000000000000000000000000000000000001002")
+)
+
+var (
+	// errNoValidators is returned if a devnet without validators is requested.
+	errNoValidators = errors.New("devnet requires at least one validator")
+
+	// errNoSpan is returned if a devnet without a span length is requested.
+	errNoSpan = errors.New("devnet requires a span length")
+
+	// errNoAuthorityPhase is returned if proof-of-stake is requested from the
+	// genesis on, while the first span is selected by the authority validators.
+	errNoAuthorityPhase = errors.New("devnet requires the Chaophraya block to follow the genesis")
+
+	// errMissingBytecode is returned if a system contract artifact carries no
+	// bytecode.
+	errMissingBytecode = errors.New("system contract artifact without bytecode")
+)
+
+// Artifact is a compiled system contract, as emitted by hardhat or truffle, or
+// written as a genesis account. Unless an initial storage is given, the creation
+// bytecode is run at the contract address to initialize its storage, otherwise
+// the deployed bytecode is allocated in the genesis along with the storage.
+type Artifact struct {
+	Bytecode         hexutil.Bytes               `json:"bytecode"` // Creation bytecode, without constructor arguments
+	DeployedBytecode hexutil.Bytes               `json:"deployedBytecode"`
+	Code             hexutil.Bytes               `json:"code"` // Genesis account form of DeployedBytecode
+	Storage          map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// deploy returns whether the contract is deployed by running its constructor.
+func (a *Artifact) deploy() bool {
+	return len(a.Bytecode) > 0 && len(a.Storage) == 0
+}
+
+// LoadArtifact reads a compiled system contract from the given file.
+func LoadArtifact(path string) (*Artifact, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	artifact := new(Artifact)
+	if err := json.Unmarshal(blob, artifact); err != nil {
+		return nil, fmt.Errorf("invalid artifact %s: %v", path, err)
+	}
+	if len(artifact.DeployedBytecode) == 0 {
+		artifact.DeployedBytecode = artifact.Code
+	}
+	if len(artifact.DeployedBytecode) == 0 && !artifact.deploy() {
+		return nil, fmt.Errorf("%w: %s", errMissingBytecode, path)
+	}
+	return artifact, nil
+}
+
+// Staker is an initial staker of the network along with its voting power, in
+// whole coins staked.
+type Staker struct {
+	Address common.Address `json:"address"`
+	Power   uint64         `json:"power"`
+}
+
+// Config is the layout of a devnet.
+type Config struct {
+	ChainID  *big.Int
+	Period   uint64 // Number of seconds between blocks
+	Epoch    uint64 // Number of blocks after which to checkpoint
+	Span     uint64 // Number of blocks of a span
+	GasLimit uint64
+
+	Validators      int      // Number of validator keys to generate
+	ChaophrayaBlock uint64   // First proof-of-stake block, the validators seal by authority before
+	Stakers         []Staker // Initial stakers, the validators with a power of one if empty
+	OfficialNode    common.Address
+	Funds           *big.Int // Balance allocated to every validator and staker on top of its stake
+
+	ValidatorSet, StakeManager, SlashManager                      *Artifact
+	ValidatorSetAddress, StakeManagerAddress, SlashManagerAddress common.Address
+
+	Setup       []Call // Calls applied once the system contracts are deployed, e.g. to register the official node
+	StakeMethod string // StakeManager method each staker calls with its stake, e.g. "stake(address)"
+}
+
+// Devnet is a generated network.
+type Devnet struct {
+	Genesis      *core.Genesis
+	Validators   []*ecdsa.PrivateKey // Keys of the validators, in ascending address order
+	Stakers      []Staker
+	ValidatorSet common.Address
+	Contracts    ctypes.SystemContracts // Contracts the validator set is expected to report
+}
+
+// Generate creates a devnet with freshly generated validator keys.
+func Generate(config *Config) (*Devnet, error) {
+	keys := make([]*ecdsa.PrivateKey, config.Validators)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return New(config, keys)
+}
+
+// New creates a devnet sealed by the given validators. The validators seal by
+// authority until the Chaophraya block, from which on the span validators are
+// selected among the stakers by the system contracts. The contracts are set up
+// in the genesis state, with the stakers staked if a stake method is given, so
+// the network turns to proof-of-stake without further transactions.
+func New(config *Config, keys []*ecdsa.PrivateKey) (*Devnet, error) {
+	if len(keys) == 0 {
+		return nil, errNoValidators
+	}
+	if config.Span == 0 {
+		return nil, errNoSpan
+	}
+	if config.ChaophrayaBlock == 0 {
+		return nil, errNoAuthorityPhase
+	}
+	// Clique requires the genesis signers in ascending order
+	keys = append([]*ecdsa.PrivateKey{}, keys...)
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	validators := make([]common.Address, len(keys))
+	for i, key := range keys {
+		validators[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	stakers := config.Stakers
+	if len(stakers) == 0 {
+		for _, validator := range validators {
+			stakers = append(stakers, Staker{Address: validator, Power: 1})
+		}
+	}
+	official := config.OfficialNode
+	if official == (common.Address{}) {
+		official = validators[0]
+	}
+	var (
+		validatorSet = orDefault(config.ValidatorSetAddress, DefaultValidatorSet)
+		stakeManager = orDefault(config.StakeManagerAddress, DefaultStakeManager)
+		slashManager = orDefault(config.SlashManagerAddress, DefaultSlashManager)
+	)
+	chainConfig := &params.ChainConfig{
+		ChainID:                 config.ChainID,
+		HomesteadBlock:          big.NewInt(0),
+		EIP150Block:             big.NewInt(0),
+		EIP155Block:             big.NewInt(0),
+		EIP158Block:             big.NewInt(0),
+		ByzantiumBlock:          big.NewInt(0),
+		ConstantinopleBlock:     big.NewInt(0),
+		PetersburgBlock:         big.NewInt(0),
+		IstanbulBlock:           big.NewInt(0),
+		ErawanBlock:             big.NewInt(0),
+		ChaophrayaBlock:         new(big.Int).SetUint64(config.ChaophrayaBlock),
+		ChaophrayaBangkokBlock:  new(big.Int).SetUint64(config.ChaophrayaBlock),
+		ChaophrayaSystemTxBlock: new(big.Int).SetUint64(config.ChaophrayaBlock),
+		Clique: &params.CliqueConfig{
+			Period:              config.Period,
+			Epoch:               config.Epoch,
+			Span:                config.Span,
+			ValidatorContract:   validatorSet,
+			ValidatorContractV2: validatorSet,
+		},
+	}
+	genesis := &core.Genesis{
+		Config:     chainConfig,
+		GasLimit:   config.GasLimit,
+		Difficulty: big.NewInt(1),
+		ExtraData:  make([]byte, extraVanity, extraVanity+len(validators)*common.AddressLength+extraSeal),
+		Alloc:      make(core.GenesisAlloc),
+	}
+	for _, validator := range validators {
+		genesis.ExtraData = append(genesis.ExtraData, validator.Bytes()...)
+	}
+	genesis.ExtraData = append(genesis.ExtraData, make([]byte, extraSeal)...)
+
+	// Fund the validators to pay for their transactions, the stakers to cover
+	// their stake as well, and the official node
+	fund := func(address common.Address, amount *big.Int) {
+		account := genesis.Alloc[address]
+		if account.Balance == nil {
+			account.Balance = new(big.Int)
+		}
+		account.Balance = new(big.Int).Add(account.Balance, amount)
+		genesis.Alloc[address] = account
+	}
+	funds := config.Funds
+	if funds == nil {
+		funds = new(big.Int)
+	}
+	for _, validator := range validators {
+		fund(validator, funds)
+	}
+	for _, staker := range stakers {
+		stake := new(big.Int).Mul(new(big.Int).SetUint64(staker.Power), big.NewInt(params.Ether))
+		if _, ok := genesis.Alloc[staker.Address]; ok {
+			fund(staker.Address, stake)
+		} else {
+			fund(staker.Address, new(big.Int).Add(stake, funds))
+		}
+	}
+	if _, ok := genesis.Alloc[official]; !ok {
+		fund(official, funds)
+	}
+	// Allocate the system contracts which were supplied
+	contracts := make(map[common.Address]*Artifact)
+	for _, contract := range []struct {
+		address  common.Address
+		artifact *Artifact
+	}{
+		{validatorSet, config.ValidatorSet},
+		{stakeManager, config.StakeManager},
+		{slashManager, config.SlashManager},
+	} {
+		if contract.artifact == nil {
+			continue
+		}
+		account := genesis.Alloc[contract.address]
+		if account.Balance == nil {
+			account.Balance = new(big.Int)
+		}
+		account.Code = contract.artifact.DeployedBytecode
+		account.Storage = contract.artifact.Storage
+		genesis.Alloc[contract.address] = account
+		contracts[contract.address] = contract.artifact
+	}
+	net := &Devnet{
+		Genesis:      genesis,
+		Validators:   keys,
+		Stakers:      stakers,
+		ValidatorSet: validatorSet,
+		Contracts: ctypes.SystemContracts{
+			StakeManager: stakeManager,
+			SlashManager: slashManager,
+			OfficialNode: official,
+		},
+	}
+	if err := net.setup(config, contracts); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// orDefault returns the address, or the fallback if it's unset.
+func orDefault(address common.Address, fallback common.Address) common.Address {
+	if address == (common.Address{}) {
+		return fallback
+	}
+	return address
+}
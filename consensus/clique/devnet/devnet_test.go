@@ -0,0 +1,187 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package devnet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// returnCode returns the bytecode running the given prefix, then returning the
+// given blob.
+func returnCode(prefix []byte, blob []byte) []byte {
+	size := []byte{byte(len(blob) >> 8), byte(len(blob))}
+	code := append(append([]byte{}, prefix...), 0x61, size[0], size[1]) // PUSH2 size
+	code = append(code, 0x60, byte(len(prefix)+14), 0x60, 0x00, 0x39)   // PUSH1 offset, PUSH1 0, CODECOPY
+	code = append(code, 0x61, size[0], size[1], 0x60, 0x00, 0xf3)       // PUSH2 size, PUSH1 0, RETURN
+	return append(code, blob...)
+}
+
+// eligibleValidators returns the encoded result of getEligibleValidators.
+func eligibleValidators(stakers []Staker) []byte {
+	blob := append(common.LeftPadBytes([]byte{0x20}, 32), common.LeftPadBytes([]byte{byte(len(stakers))}, 32)...)
+	for _, staker := range stakers {
+		power := new(big.Int).Mul(new(big.Int).SetUint64(staker.Power), big.NewInt(params.Ether))
+		blob = append(blob, common.LeftPadBytes(staker.Address.Bytes(), 32)...)
+		blob = append(blob, common.LeftPadBytes(power.Bytes(), 32)...)
+	}
+	return blob
+}
+
+func TestGenerate(t *testing.T) {
+	var (
+		staker  = Staker{Address: common.HexToAddress("0x01"), Power: 5}
+		runtime = returnCode(nil, eligibleValidators([]Staker{staker}))
+	)
+	config := &Config{
+		ChainID:         big.NewInt(1337),
+		Period:          1,
+		Epoch:           30000,
+		Span:            10,
+		GasLimit:        10_000_000,
+		Validators:      3,
+		ChaophrayaBlock: 10,
+		Stakers:         []Staker{staker},
+		Funds:           big.NewInt(params.Ether),
+		// The validator set constructor stores the deployer in slot 0
+		ValidatorSet: &Artifact{Bytecode: returnCode([]byte{0x33, 0x60, 0x00, 0x55}, runtime)},
+		// The stake manager stores the first argument keyed by the caller
+		StakeManager: &Artifact{DeployedBytecode: common.FromHex("0x60043533550000")},
+		// The slash manager stores the first calldata word in slot 1
+		SlashManager: &Artifact{DeployedBytecode: common.FromHex("0x6000356001550000")},
+		Setup:        []Call{{To: DefaultSlashManager, Data: common.LeftPadBytes([]byte{0x2a}, 32)}},
+		StakeMethod:  "stake(address)",
+	}
+	net, err := Generate(config)
+	if err != nil {
+		t.Fatalf("failed to generate devnet: %v", err)
+	}
+	if len(net.Validators) != 3 {
+		t.Fatalf("validator count mismatch: have %d, want 3", len(net.Validators))
+	}
+	// The genesis must carry the validators as sorted authority signers
+	extra := net.Genesis.ExtraData
+	if len(extra) != extraVanity+3*common.AddressLength+extraSeal {
+		t.Fatalf("extra data length mismatch: have %d", len(extra))
+	}
+	signers := extra[extraVanity : len(extra)-extraSeal]
+	for i := 1; i < 3; i++ {
+		prev, next := signers[(i-1)*common.AddressLength:i*common.AddressLength], signers[i*common.AddressLength:(i+1)*common.AddressLength]
+		if bytes.Compare(prev, next) >= 0 {
+			t.Errorf("signers not in ascending order: %x", signers)
+		}
+	}
+	official := common.BytesToAddress(signers[:common.AddressLength])
+	if net.Contracts.OfficialNode != official {
+		t.Errorf("official node mismatch: have %x, want the first validator", net.Contracts.OfficialNode)
+	}
+	// The genesis must be loadable, with the contracts set up and the funds allocated
+	db := rawdb.NewMemoryDatabase()
+	block := net.Genesis.MustCommit(db)
+	statedb, err := state.New(block.Root(), state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	if have := statedb.GetCode(DefaultValidatorSet); !bytes.Equal(have, runtime) {
+		t.Errorf("validator set code mismatch: have %x, want %x", have, runtime)
+	}
+	if have := statedb.GetState(DefaultValidatorSet, common.Hash{}); have != common.BytesToHash(official.Bytes()) {
+		t.Errorf("validator set deployer mismatch: have %x, want %x", have, official)
+	}
+	if have := statedb.GetState(DefaultSlashManager, common.BigToHash(common.Big1)); have != common.BigToHash(big.NewInt(0x2a)) {
+		t.Errorf("setup call not applied: have %x", have)
+	}
+	stake := new(big.Int).Mul(big.NewInt(5), big.NewInt(params.Ether))
+	if have := statedb.GetBalance(DefaultStakeManager); have.Cmp(stake) != 0 {
+		t.Errorf("staked balance mismatch: have %v, want %v", have, stake)
+	}
+	if have := statedb.GetState(DefaultStakeManager, common.BytesToHash(staker.Address.Bytes())); have != common.BytesToHash(staker.Address.Bytes()) {
+		t.Errorf("staker not registered: have %x", have)
+	}
+	if have := statedb.GetBalance(staker.Address); have.Cmp(config.Funds) != 0 {
+		t.Errorf("staker balance mismatch: have %v, want %v", have, config.Funds)
+	}
+	if have := statedb.GetBalance(common.BytesToAddress(signers[common.AddressLength : 2*common.AddressLength])); have.Cmp(config.Funds) != 0 {
+		t.Errorf("validator balance mismatch: have %v, want %v", have, config.Funds)
+	}
+	if cfg := net.Genesis.Config; !cfg.IsChaophraya(big.NewInt(10)) || cfg.IsChaophraya(big.NewInt(9)) || cfg.Clique.ValidatorContractV2 != DefaultValidatorSet {
+		t.Errorf("chain config mismatch: %v", cfg)
+	}
+	// The first span can't be committed without eligible validators
+	config.ValidatorSet = &Artifact{DeployedBytecode: returnCode(nil, eligibleValidators(nil))}
+	if _, err := Generate(config); !errors.Is(err, errNoEligibleValidators) {
+		t.Errorf("error mismatch: have %v, want %v", err, errNoEligibleValidators)
+	}
+	// Proof-of-stake needs an authority phase to select the first span
+	config.ChaophrayaBlock = 0
+	if _, err := Generate(config); !errors.Is(err, errNoAuthorityPhase) {
+		t.Errorf("error mismatch: have %v, want %v", err, errNoAuthorityPhase)
+	}
+}
+
+func TestPackStakeCall(t *testing.T) {
+	staker, stake := common.HexToAddress("0x01"), big.NewInt(5)
+	data, err := packStakeCall("stake(address,uint256)", staker, stake)
+	if err != nil {
+		t.Fatalf("failed to pack stake call: %v", err)
+	}
+	want := append(crypto.Keccak256([]byte("stake(address,uint256)"))[:4], append(common.LeftPadBytes(staker.Bytes(), 32), common.LeftPadBytes(stake.Bytes(), 32)...)...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("packed call mismatch: have %x, want %x", data, want)
+	}
+	for _, method := range []string{"stake", "(address)", "stake(bytes)", "stake(address"} {
+		if _, err := packStakeCall(method, staker, stake); !errors.Is(err, errInvalidStakeMethod) {
+			t.Errorf("method %q: error mismatch: have %v, want %v", method, err, errInvalidStakeMethod)
+		}
+	}
+}
+
+func TestLoadArtifact(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		blob string
+		code string
+		err  error
+	}{
+		{blob: `{"contractName": "ValidatorSet", "abi": [], "bytecode": "0x6080", "deployedBytecode": "0x600760005260206000f3"}`, code: "0x600760005260206000f3"},
+		{blob: `{"code": "0x6007", "storage": {"0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000002"}}`, code: "0x6007"},
+		{blob: `{"abi": []}`, err: errMissingBytecode},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "artifact.json")
+		if err := ioutil.WriteFile(path, []byte(tt.blob), 0600); err != nil {
+			t.Fatal(err)
+		}
+		artifact, err := LoadArtifact(path)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if err == nil && !bytes.Equal(artifact.DeployedBytecode, common.FromHex(tt.code)) {
+			t.Errorf("test %d: code mismatch: have %x, want %s", i, artifact.DeployedBytecode, tt.code)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package devnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique/contract"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errNoEligibleValidators is returned if the validator set of a generated
+	// genesis reports no eligible validator, so no span could be committed.
+	errNoEligibleValidators = errors.New("validator set reports no eligible validators")
+
+	// errInvalidStakeMethod is returned if the stake method isn't a signature
+	// taking the staker address and the stake only.
+	errInvalidStakeMethod = errors.New("invalid stake method")
+)
+
+// Call is a contract call applied to the genesis state while generating a devnet.
+type Call struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value,omitempty"`
+	Data  hexutil.Bytes  `json:"data,omitempty"`
+}
+
+// LoadCalls reads a list of genesis calls from the given file.
+func LoadCalls(path string) ([]Call, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calls []Call
+	if err := json.Unmarshal(blob, &calls); err != nil {
+		return nil, fmt.Errorf("invalid calls %s: %v", path, err)
+	}
+	return calls, nil
+}
+
+// genesisContext is the chain context of the calls applied to the genesis state,
+// which has no ancestors. It serves the genesis header and its state to the
+// contract calls checking the outcome of the setup, the official node standing
+// in as the block author.
+type genesisContext struct {
+	config *params.ChainConfig
+	header *types.Header
+	db     state.Database
+}
+
+func (c genesisContext) Config() *params.ChainConfig               { return c.config }
+func (genesisContext) Engine() consensus.Engine                    { return ethash.NewFaker() }
+func (genesisContext) GetHeader(common.Hash, uint64) *types.Header { return nil }
+
+func (c genesisContext) GetHeaderByHash(hash common.Hash) *types.Header {
+	if hash != c.header.Hash() {
+		return nil
+	}
+	return c.header
+}
+
+func (c genesisContext) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, c.db, nil)
+}
+
+// packStakeCall packs the call of the stake method, given as a signature such as
+// "stake(address)", for the staker. Address arguments are set to the staker and
+// uint256 arguments to the stake.
+func packStakeCall(method string, staker common.Address, stake *big.Int) ([]byte, error) {
+	open, end := strings.IndexByte(method, '('), len(method)-1
+	if open <= 0 || method[end] != ')' {
+		return nil, fmt.Errorf("%w: %q", errInvalidStakeMethod, method)
+	}
+	var (
+		args   abi.Arguments
+		values []interface{}
+	)
+	if list := method[open+1 : end]; list != "" {
+		for _, param := range strings.Split(list, ",") {
+			typ, err := abi.NewType(param, "", nil)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %v", errInvalidStakeMethod, method, err)
+			}
+			switch param {
+			case "address":
+				values = append(values, staker)
+			case "uint256":
+				values = append(values, stake)
+			default:
+				return nil, fmt.Errorf("%w: %q: unsupported argument %s", errInvalidStakeMethod, method, param)
+			}
+			args = append(args, abi.Argument{Type: typ})
+		}
+	}
+	packed, err := args.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	return append(crypto.Keccak256([]byte(method))[:4], packed...), nil
+}
+
+// setup runs the constructors of the system contracts supplied as creation code
+// at their genesis addresses, then applies the setup calls and the stake of the
+// stakers, replacing the genesis allocation with the resulting state. The
+// validator set, if supplied, must then report eligible validators for the first
+// span to be committed.
+func (d *Devnet) setup(config *Config, contracts map[common.Address]*Artifact) error {
+	genesis := d.Genesis
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		return err
+	}
+	for address, account := range genesis.Alloc {
+		if account.Balance != nil {
+			statedb.AddBalance(address, account.Balance)
+		}
+		statedb.SetCode(address, account.Code)
+		statedb.SetNonce(address, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(address, key, value)
+		}
+	}
+	header := &types.Header{
+		Number:     new(big.Int),
+		Time:       genesis.Timestamp,
+		GasLimit:   genesis.GasLimit,
+		Difficulty: genesis.Difficulty,
+		Coinbase:   d.Contracts.OfficialNode,
+	}
+	chain := genesisContext{config: genesis.Config, header: header, db: statedb.Database()}
+	blockContext := core.NewEVMBlockContext(header, chain, &header.Coinbase)
+	apply := func(call Call) error {
+		value := new(big.Int)
+		if call.Value != nil {
+			value = call.Value.ToInt()
+		}
+		vmenv := vm.NewEVM(blockContext, vm.TxContext{Origin: call.From, GasPrice: new(big.Int)}, statedb, genesis.Config, vm.Config{})
+		if _, _, err := vmenv.Call(vm.AccountRef(call.From), call.To, call.Data, math.MaxUint64/2, value); err != nil {
+			return fmt.Errorf("genesis call from %x to %x failed: %v", call.From, call.To, err)
+		}
+		return nil
+	}
+	// Run the constructors at the contract addresses, deployed by the official node
+	for address, artifact := range contracts {
+		if !artifact.deploy() {
+			continue
+		}
+		statedb.SetCode(address, artifact.Bytecode)
+		vmenv := vm.NewEVM(blockContext, vm.TxContext{Origin: d.Contracts.OfficialNode, GasPrice: new(big.Int)}, statedb, genesis.Config, vm.Config{})
+		code, _, err := vmenv.Call(vm.AccountRef(d.Contracts.OfficialNode), address, nil, math.MaxUint64/2, new(big.Int))
+		if err != nil {
+			return fmt.Errorf("constructor of %x failed: %v", address, err)
+		}
+		statedb.SetCode(address, code)
+	}
+	for _, call := range config.Setup {
+		if err := apply(call); err != nil {
+			return err
+		}
+	}
+	if config.StakeMethod != "" {
+		for _, staker := range d.Stakers {
+			stake := new(big.Int).Mul(new(big.Int).SetUint64(staker.Power), big.NewInt(params.Ether))
+			data, err := packStakeCall(config.StakeMethod, staker.Address, stake)
+			if err != nil {
+				return err
+			}
+			if err := apply(Call{From: staker.Address, To: d.Contracts.StakeManager, Value: (*hexutil.Big)(stake), Data: data}); err != nil {
+				return err
+			}
+		}
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		return err
+	}
+	if config.ValidatorSet != nil {
+		header.Root = root
+
+		client, err := contract.NewWithChain(genesis.Config, chain)
+		if err != nil {
+			return err
+		}
+		eligible, err := client.GetEligibleValidators(context.Background(), header.Hash(), header.Number.Uint64())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve eligible validators: %v", err)
+		}
+		if len(eligible) == 0 {
+			return errNoEligibleValidators
+		}
+	}
+	// Replace the allocation with the resulting state
+	alloc := make(core.GenesisAlloc)
+	for address, account := range statedb.RawDump(&state.DumpConfig{OnlyWithAddresses: true}).Accounts {
+		balance, ok := new(big.Int).SetString(account.Balance, 10)
+		if !ok {
+			return fmt.Errorf("invalid balance of %x: %s", address, account.Balance)
+		}
+		genesisAccount := core.GenesisAccount{Balance: balance, Nonce: account.Nonce, Code: account.Code}
+		if len(account.Storage) > 0 {
+			genesisAccount.Storage = make(map[common.Hash]common.Hash, len(account.Storage))
+			for key, value := range account.Storage {
+				genesisAccount.Storage[key] = common.HexToHash(value)
+			}
+		}
+		alloc[address] = genesisAccount
+	}
+	genesis.Alloc = alloc
+	return nil
+}
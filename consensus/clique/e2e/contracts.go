@@ -0,0 +1,375 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package e2e
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/devnet"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// The system contracts below implement the ABI the consensus engine calls with
+// the bare minimum of logic, in EVM assembly, standing in for the compiled
+// contracts missing from Config.Contracts. Methods called by system
+// transactions may only be called by the coinbase of the block.
+
+// Storage layout of the system contracts.
+var (
+	SpanLengthSlot      = common.BigToHash(big.NewInt(0)) // Validator set: span length, the span number is the block number divided by it
+	CommitmentCountSlot = common.BigToHash(big.NewInt(1)) // Validator set: number of commitSpan calls
+	CommitmentHashSlot  = common.BigToHash(big.NewInt(2)) // Validator set: Keccak256 hash of the last committed validator bytes
+	SlashCountSlot      = common.BigToHash(big.NewInt(0)) // Slash manager: number of slash calls
+	RewardSlot          = common.BigToHash(big.NewInt(0)) // Stake manager: total reward distributed
+
+	validatorsSlot = big.NewInt(0x100) // Validator set: ABI encoded getValidators result
+	eligibleSlot   = big.NewInt(0x200) // Validator set: ABI encoded getEligibleValidators result
+)
+
+const validatorSetSource = `
+;; Dispatch on the method selector
+push 0
+calldataload
+push 0xe0
+shr
+dup1
+;; currentSpanNumber()
+push 0x4dbc959f
+eq
+jumpi @currentSpanNumber
+dup1
+;; commitSpan(bytes)
+push 0x69f5285e
+eq
+jumpi @commitSpan
+dup1
+;; getValidators(uint256)
+push 0x471f40fb
+eq
+jumpi @getValidators
+dup1
+;; getEligibleValidators()
+push 0x72672ae4
+eq
+jumpi @getEligibleValidators
+jump @fail
+
+currentSpanNumber:
+push 0
+sload
+number
+div
+push 0
+mstore
+push 0x20
+push 0
+return
+
+commitSpan:
+coinbase
+caller
+eq
+iszero
+jumpi @fail
+;; Record the hash of the committed bytes and count the commitment
+push 0x24
+calldataload
+dup1
+push 0x44
+push 0
+calldatacopy
+push 0
+keccak256
+push 2
+sstore
+push 1
+sload
+push 1
+add
+push 1
+sstore
+stop
+
+getValidators:
+push 0x100
+jump @blob
+
+getEligibleValidators:
+push 0x200
+jump @blob
+
+;; Return the blob stored from the slot on top of the stack on, its length in
+;; the slot itself followed by its words
+blob:
+dup1
+sload
+push 0
+loop:
+dup2
+dup2
+lt
+iszero
+jumpi @done
+push 0x20
+dup2
+div
+dup4
+add
+push 1
+add
+sload
+dup2
+mstore
+push 0x20
+add
+jump @loop
+done:
+pop
+push 0
+return
+
+fail:
+push 0
+dup1
+revert
+`
+
+const slashManagerSource = `
+;; Dispatch on the method selector
+push 0
+calldataload
+push 0xe0
+shr
+dup1
+;; isSignerSlashed(address,uint256)
+push 0x8ed681ad
+eq
+jumpi @isSignerSlashed
+dup1
+;; slash(address,uint256), the evidence of double sign slashes following
+push 0x02fb4d85
+eq
+jumpi @slash
+jump @fail
+
+;; The slashed flags are stored at keccak256(signer, span)
+isSignerSlashed:
+push 0x40
+push 4
+push 0
+calldatacopy
+push 0x40
+push 0
+keccak256
+sload
+push 0
+mstore
+push 0x20
+push 0
+return
+
+slash:
+coinbase
+caller
+eq
+iszero
+jumpi @fail
+push 0x40
+push 4
+push 0
+calldatacopy
+push 1
+push 0x40
+push 0
+keccak256
+sstore
+push 0
+sload
+push 1
+add
+push 0
+sstore
+push 1
+push 0
+mstore
+push 0x20
+push 0
+return
+
+fail:
+push 0
+dup1
+revert
+`
+
+const stakeManagerSource = `
+;; Dispatch on the method selector
+push 0
+calldataload
+push 0xe0
+shr
+;; distributeReward()
+push 0x8f73c5ae
+eq
+jumpi @distributeReward
+jump @fail
+
+;; Keep the reward and account for it
+distributeReward:
+coinbase
+caller
+eq
+iszero
+jumpi @fail
+callvalue
+push 0
+sload
+add
+push 0
+sstore
+push 1
+sload
+push 1
+add
+push 1
+sstore
+stop
+
+fail:
+push 0
+dup1
+revert
+`
+
+// compile assembles the given EVM assembly into bytecode.
+func compile(source string) ([]byte, error) {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(source), false))
+
+	bin, errs := compiler.Compile()
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return nil, errors.New(strings.Join(msgs, "; "))
+	}
+	return hexutil.Decode("0x" + bin)
+}
+
+// ValidatorSetArtifact assembles the validator set contract. Its getValidators
+// reports the given validators and system contracts for every span, while its
+// getEligibleValidators reports the given stakers. Committed spans are counted
+// and the hash of the last one recorded, but not decoded.
+func ValidatorSetArtifact(span uint64, validators []*ctypes.Validator, contracts ctypes.SystemContracts, stakers []devnet.Staker) (*devnet.Artifact, error) {
+	code, err := compile(validatorSetSource)
+	if err != nil {
+		return nil, fmt.Errorf("validator set: %v", err)
+	}
+	addressSlice, _ := abi.NewType("address[]", "", nil)
+	uintSlice, _ := abi.NewType("uint256[]", "", nil)
+	addressArray, _ := abi.NewType("address[3]", "", nil)
+	minimalValidators, _ := abi.NewType("tuple[]", "struct MinimalValidator[]", []abi.ArgumentMarshaling{
+		{Name: "signer", Type: "address"},
+		{Name: "power", Type: "uint256"},
+	})
+
+	var (
+		addresses = make([]common.Address, len(validators))
+		powers    = make([]*big.Int, len(validators))
+	)
+	for i, validator := range validators {
+		addresses[i] = validator.Address
+		powers[i] = new(big.Int).SetUint64(validator.VotingPower)
+	}
+	current, err := abi.Arguments{{Type: addressSlice}, {Type: uintSlice}, {Type: addressArray}}.Pack(
+		addresses, powers, [3]common.Address{contracts.StakeManager, contracts.SlashManager, contracts.OfficialNode},
+	)
+	if err != nil {
+		return nil, err
+	}
+	type minimalValidator struct {
+		Signer common.Address
+		Power  *big.Int
+	}
+	eligible := make([]minimalValidator, len(stakers))
+	for i, staker := range stakers {
+		eligible[i] = minimalValidator{
+			Signer: staker.Address,
+			Power:  new(big.Int).Mul(new(big.Int).SetUint64(staker.Power), big.NewInt(params.Ether)),
+		}
+	}
+	eligibleBlob, err := abi.Arguments{{Type: minimalValidators}}.Pack(eligible)
+	if err != nil {
+		return nil, err
+	}
+	storage := map[common.Hash]common.Hash{
+		SpanLengthSlot: common.BigToHash(new(big.Int).SetUint64(span)),
+	}
+	storeBlob(storage, validatorsSlot, current)
+	storeBlob(storage, eligibleSlot, eligibleBlob)
+
+	return &devnet.Artifact{DeployedBytecode: code, Storage: storage}, nil
+}
+
+// SlashManagerArtifact assembles the slash manager contract, which flags the
+// slashed signers of every span.
+func SlashManagerArtifact() (*devnet.Artifact, error) {
+	code, err := compile(slashManagerSource)
+	if err != nil {
+		return nil, fmt.Errorf("slash manager: %v", err)
+	}
+	return &devnet.Artifact{DeployedBytecode: code}, nil
+}
+
+// StakeManagerArtifact assembles the stake manager contract, which keeps the
+// distributed rewards.
+func StakeManagerArtifact() (*devnet.Artifact, error) {
+	code, err := compile(stakeManagerSource)
+	if err != nil {
+		return nil, fmt.Errorf("stake manager: %v", err)
+	}
+	return &devnet.Artifact{DeployedBytecode: code}, nil
+}
+
+// SlashedSlot returns the slot the slash manager flags the given signer as
+// slashed in for the span.
+func SlashedSlot(signer common.Address, span uint64) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(signer.Bytes(), common.HashLength), common.BigToHash(new(big.Int).SetUint64(span)).Bytes())
+}
+
+// storeBlob lays the blob out in storage from the given slot on, its length in
+// the slot itself followed by its words.
+func storeBlob(storage map[common.Hash]common.Hash, slot *big.Int, blob []byte) {
+	storage[common.BigToHash(slot)] = common.BigToHash(big.NewInt(int64(len(blob))))
+	for i := 0; i < len(blob); i += common.HashLength {
+		word := make([]byte, common.HashLength)
+		copy(word, blob[i:])
+
+		key := new(big.Int).Add(slot, big.NewInt(int64(1+i/common.HashLength)))
+		storage[common.BigToHash(key)] = common.BytesToHash(word)
+	}
+}
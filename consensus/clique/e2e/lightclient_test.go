@@ -0,0 +1,96 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package e2e
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/clique/lightclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestSealProofs(t *testing.T) {
+	const span = 8
+
+	net, err := New(&Config{Validators: 3, Span: span, ChaophrayaBlock: span})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer net.Close()
+
+	if err := net.MineTo(2*span - 2); err != nil {
+		t.Fatalf("failed to seal blocks: %v", err)
+	}
+	// Have the official node seal the span header of the third span
+	if _, err := net.MineBy(net.Official); err != nil {
+		t.Fatalf("failed to seal block by official node: %v", err)
+	}
+	if err := net.MineTo(3*span + 2); err != nil {
+		t.Fatalf("failed to seal blocks: %v", err)
+	}
+	node := net.Validators[0]
+	api := node.Engine.APIs(node.Chain)[0].Service.(*clique.API)
+	proof := func(number uint64) *lightclient.SealProof {
+		p, err := api.GetSealProof(rpc.BlockNumber(number))
+		if err != nil {
+			t.Fatalf("failed to retrieve proof of block #%d: %v", number, err)
+		}
+		return p
+	}
+	if _, err := api.GetSealProof(rpc.BlockNumber(span - 1)); err == nil {
+		t.Fatalf("proof of authority block retrieved")
+	}
+	var (
+		config = net.Devnet.Genesis.Config
+		anchor = node.Chain.GetHeaderByNumber(span - 1)
+		spans  = []*lightclient.SealProof{proof(2*span - 1), proof(3*span - 1)}
+		head   = proof(3*span + 2)
+	)
+	signer, err := lightclient.VerifyChain(config, anchor, spans, head)
+	if err != nil {
+		t.Fatalf("failed to verify proof: %v", err)
+	}
+	if want := node.Chain.GetHeaderByNumber(3*span + 2).Coinbase; signer != want {
+		t.Errorf("signer mismatch: have %x, want %x", signer, want)
+	}
+	// Proofs may not skip span headers
+	if _, err := lightclient.VerifyChain(config, anchor, spans[1:], head); err == nil {
+		t.Errorf("proof verified without the span headers in between")
+	}
+	if _, err := lightclient.VerifyChain(config, anchor, nil, proof(span+2)); err != nil {
+		t.Errorf("failed to verify proof of the first span: %v", err)
+	}
+	// Proofs of blocks in another span than the one of their span header fail
+	forged := *head
+	forged.SpanHeader, forged.Validators = spans[0].SpanHeader, spans[0].Validators
+	if _, err := lightclient.VerifyChain(config, anchor, spans, &forged); err == nil {
+		t.Errorf("proof verified against the span header of another span")
+	}
+	// Tampered headers and seals fail
+	forged = *head
+	forged.Header = append(append([]byte{}, head.Header[:len(head.Header)-1]...), head.Header[len(head.Header)-1]^0x01)
+	if _, err := lightclient.VerifyChain(config, anchor, spans, &forged); err == nil {
+		t.Errorf("proof with tampered header verified")
+	}
+	forged = *head
+	forged.Signature = append([]byte{}, head.Signature...)
+	forged.Signature[0] ^= 0x01
+	if _, err := lightclient.VerifyChain(config, anchor, spans, &forged); err == nil {
+		t.Errorf("proof with tampered seal verified")
+	}
+}
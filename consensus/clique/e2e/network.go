@@ -0,0 +1,352 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package e2e runs Chaophraya proof-of-stake networks of several in-memory
+// nodes against compiled system contracts, or minimal implementations of them,
+// exercising the consensus engine end to end: the authority phase, the
+// transition to proof-of-stake, span commitments, slashing and reward
+// distribution.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/clique/contract"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/devnet"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	diffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
+	diffNoTurn = big.NewInt(1) // Block difficulty for out-of-turn signatures
+
+	// errNoInturnNode is returned if none of the nodes is in turn to seal the
+	// next block.
+	errNoInturnNode = errors.New("no node in turn")
+)
+
+// Config is the layout of a test network.
+type Config struct {
+	Validators      int    // Number of validator nodes
+	Span            uint64 // Number of blocks of a span
+	ChaophrayaBlock uint64 // First proof-of-stake block
+	GasLimit        uint64
+
+	// Contracts is the directory of the compiled system contracts deployed in
+	// the genesis, laid out as taken by geth pos devnet, along with the calls
+	// setting them up in setup.json. The minimal implementations are deployed
+	// in place of the missing ones.
+	Contracts   string
+	StakeMethod string // StakeManager method the stakers stake through, if any
+}
+
+// Node is a validator or official node of the network, running its own engine
+// and chain on top of its own database.
+type Node struct {
+	Key     *ecdsa.PrivateKey
+	Address common.Address
+	Engine  *clique.Clique
+	Chain   *core.BlockChain
+}
+
+// Network is a set of nodes importing every block sealed by any of them, as if
+// connected by a lossless network.
+type Network struct {
+	Devnet     *devnet.Devnet
+	Validators []*Node // Validator nodes, in ascending address order
+	Official   *Node   // Official node, sealing instead of absent validators
+
+	// Stubs holds the names of the system contracts missing from the contracts
+	// directory, deployed from their minimal implementations instead.
+	Stubs map[string]bool
+
+	nodes []*Node
+}
+
+// New creates a network of validator nodes sealing by authority until the
+// Chaophraya block, along with an official node. The validator set contract
+// selects the validators for every span, and reports all of them as eligible
+// for the following ones.
+func New(config *Config) (*Network, error) {
+	keys := make([]*ecdsa.PrivateKey, config.Validators+1)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	validatorKeys, officialKey := keys[:config.Validators], keys[config.Validators]
+	sort.Slice(validatorKeys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(validatorKeys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(validatorKeys[j].PublicKey).Bytes()) < 0
+	})
+	var (
+		validators = make([]*ctypes.Validator, len(validatorKeys))
+		stakers    = make([]devnet.Staker, len(validatorKeys))
+		contracts  = ctypes.SystemContracts{
+			StakeManager: devnet.DefaultStakeManager,
+			SlashManager: devnet.DefaultSlashManager,
+			OfficialNode: crypto.PubkeyToAddress(officialKey.PublicKey),
+		}
+	)
+	for i, key := range validatorKeys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		validators[i] = &ctypes.Validator{Address: address, VotingPower: 1}
+		stakers[i] = devnet.Staker{Address: address, Power: 1}
+	}
+	stubs := make(map[string]bool)
+	validatorSet, err := loadArtifact(config.Contracts, "ValidatorSet", stubs, func() (*devnet.Artifact, error) {
+		return ValidatorSetArtifact(config.Span, validators, contracts, stakers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stakeManager, err := loadArtifact(config.Contracts, "StakeManager", stubs, StakeManagerArtifact)
+	if err != nil {
+		return nil, err
+	}
+	slashManager, err := loadArtifact(config.Contracts, "SlashManager", stubs, SlashManagerArtifact)
+	if err != nil {
+		return nil, err
+	}
+	var setup []devnet.Call
+	if config.Contracts != "" {
+		if path := filepath.Join(config.Contracts, "setup.json"); common.FileExist(path) {
+			if setup, err = devnet.LoadCalls(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	gasLimit := config.GasLimit
+	if gasLimit == 0 {
+		gasLimit = 10000000
+	}
+	net, err := devnet.New(&devnet.Config{
+		ChainID:         big.NewInt(1337),
+		Epoch:           30000,
+		Span:            config.Span,
+		GasLimit:        gasLimit,
+		ChaophrayaBlock: config.ChaophrayaBlock,
+		Stakers:         stakers,
+		OfficialNode:    contracts.OfficialNode,
+		Funds:           new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether)),
+		ValidatorSet:    validatorSet,
+		StakeManager:    stakeManager,
+		SlashManager:    slashManager,
+		Setup:           setup,
+		StakeMethod:     config.StakeMethod,
+	}, validatorKeys)
+	if err != nil {
+		return nil, err
+	}
+	network := &Network{Devnet: net, Stubs: stubs}
+	for _, key := range keys {
+		node, err := newNode(net.Genesis, key)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+		network.nodes = append(network.nodes, node)
+	}
+	network.Validators, network.Official = network.nodes[:config.Validators], network.nodes[config.Validators]
+	return network, nil
+}
+
+// loadArtifact loads the compiled system contract of the given name from the
+// contracts directory, falling back to its minimal implementation and marking
+// it in stubs.
+func loadArtifact(dir string, name string, stubs map[string]bool, fallback func() (*devnet.Artifact, error)) (*devnet.Artifact, error) {
+	if dir != "" {
+		if path := filepath.Join(dir, name+".json"); common.FileExist(path) {
+			return devnet.LoadArtifact(path)
+		}
+	}
+	stubs[name] = true
+	return fallback()
+}
+
+// newNode creates a node with its own database, engine and chain, authorized to
+// seal with the given key. The engine calls the system contracts in process.
+func newNode(genesis *core.Genesis, key *ecdsa.PrivateKey) (*Node, error) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	caller := contract.NewChainCaller(genesis.Config)
+	client, err := contract.New(genesis.Config, caller)
+	if err != nil {
+		return nil, err
+	}
+	api := new(headerAPI)
+	engine := clique.New(genesis.Config, db, api, client)
+
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	api.chain = chain
+	caller.Attach(chain)
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	signFn := func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}
+	engine.Authorize(address, signFn, clique.SystemTxSignerFn(signFn))
+
+	return &Node{Key: key, Address: address, Engine: engine, Chain: chain}, nil
+}
+
+// headerAPI serves the headers the engine seeds the span selection with from
+// the local chain.
+type headerAPI struct {
+	chain *core.BlockChain
+}
+
+func (api *headerAPI) GetHeaderTypeByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	header := api.chain.GetHeaderByNumber(uint64(number))
+	if header == nil {
+		return nil, fmt.Errorf("header #%d not found", number)
+	}
+	return header, nil
+}
+
+// Close stops the chains and engines of all nodes.
+func (n *Network) Close() {
+	for _, node := range n.nodes {
+		node.Chain.Stop()
+		node.Engine.Close()
+	}
+}
+
+// Head returns the head of the network, on which all nodes agree.
+func (n *Network) Head() *types.Header {
+	return n.nodes[0].Chain.CurrentHeader()
+}
+
+// State returns the state at the head of the network.
+func (n *Network) State() (*state.StateDB, error) {
+	return n.nodes[0].Chain.StateAt(n.Head().Root)
+}
+
+// Inturn returns the validator node in turn to seal the next block.
+func (n *Network) Inturn() (*Node, error) {
+	for _, node := range n.Validators {
+		parent := node.Chain.CurrentHeader()
+		if diff := node.Engine.CalcDifficulty(node.Chain, parent.Time+1, parent); diff != nil && diff.Cmp(diffInTurn) == 0 {
+			return node, nil
+		}
+	}
+	return nil, errNoInturnNode
+}
+
+// Mine seals the next block by the node in turn, including the given
+// transactions, and imports it on all nodes.
+func (n *Network) Mine(txs ...*types.Transaction) (*types.Block, error) {
+	node, err := n.Inturn()
+	if err != nil {
+		return nil, err
+	}
+	return n.MineBy(node, txs...)
+}
+
+// MineTo seals blocks by the nodes in turn until the head reaches the given
+// number.
+func (n *Network) MineTo(number uint64) error {
+	for n.Head().Number.Uint64() < number {
+		if _, err := n.Mine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MineBy seals the next block by the given node, including the given
+// transactions, and imports it on all nodes. The block is signed right away,
+// skipping the delays the engine waits before propagating out-of-turn blocks.
+func (n *Network) MineBy(node *Node, txs ...*types.Transaction) (*types.Block, error) {
+	parent := node.Chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Coinbase:   node.Address,
+	}
+	if err := node.Engine.Prepare(node.Chain, header); err != nil {
+		return nil, fmt.Errorf("failed to prepare block #%d: %w", header.Number, err)
+	}
+	statedb, err := node.Chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		receipts = make([]*types.Receipt, 0, len(txs))
+	)
+	for i, tx := range txs {
+		statedb.Prepare(tx.Hash(), i)
+		receipt, err := core.ApplyTransaction(node.Chain.Config(), node.Chain, &header.Coinbase, gp, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply transaction %d: %w", i, err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	block, _, err := node.Engine.FinalizeAndAssemble(node.Chain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble block #%d: %w", header.Number, err)
+	}
+	header = block.Header()
+	sig, err := crypto.Sign(node.Engine.SealHash(header).Bytes(), node.Key)
+	if err != nil {
+		return nil, err
+	}
+	copy(header.Extra[len(header.Extra)-crypto.SignatureLength:], sig)
+	block = block.WithSeal(header)
+
+	for _, node := range n.nodes {
+		if _, err := node.Chain.InsertChain(types.Blocks{block}); err != nil {
+			return nil, fmt.Errorf("node %x failed to import block #%d: %w", node.Address, block.Number(), err)
+		}
+	}
+	return block, nil
+}
+
+// Transfer creates a value transfer from the given node, paying the given gas
+// price.
+func (n *Network) Transfer(from *Node, to common.Address, value *big.Int, gasPrice *big.Int) (*types.Transaction, error) {
+	statedb, err := n.State()
+	if err != nil {
+		return nil, err
+	}
+	tx := types.NewTransaction(statedb.GetNonce(from.Address), to, value, params.TxGas, gasPrice, nil)
+	return types.SignTx(tx, types.NewEIP155Signer(n.Devnet.Genesis.Config.ChainID), from.Key)
+}
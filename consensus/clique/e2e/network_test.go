@@ -0,0 +1,254 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/devnet"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// contractsDir is the directory of the compiled system contracts the network
+// tests run against, the minimal implementations standing in for the missing
+// ones.
+var contractsDir = filepath.Join("testdata", "contracts")
+
+func TestProofOfStake(t *testing.T) {
+	const (
+		span       = 8
+		chaophraya = 8
+		commitment = chaophraya + span/2 + 1
+	)
+	net, err := New(&Config{Validators: 3, Span: span, ChaophrayaBlock: chaophraya, Contracts: contractsDir})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer net.Close()
+
+	for _, name := range []string{"ValidatorSet", "StakeManager", "SlashManager"} {
+		if net.Stubs[name] {
+			t.Logf("compiled %s missing from %s, running against its minimal implementation", name, contractsDir)
+		}
+	}
+
+	// Seal by authority up to the span header before the transition
+	if err := net.MineTo(chaophraya - 1); err != nil {
+		t.Fatalf("failed to seal authority blocks: %v", err)
+	}
+	head := net.Head()
+	registry := 3 * common.AddressLength
+	if have, want := len(head.Extra), 32+3*40+registry+65; have != want {
+		t.Fatalf("span header extra length mismatch: have %d, want %d", have, want)
+	}
+	seed := head
+
+	// Seal the first proof-of-stake blocks up to the span commitment
+	if err := net.MineTo(commitment); err != nil {
+		t.Fatalf("failed to seal proof-of-stake blocks: %v", err)
+	}
+	block := net.Validators[0].Chain.GetBlockByNumber(commitment)
+	if block.Coinbase() == (common.Address{}) {
+		t.Fatalf("proof-of-stake block without coinbase")
+	}
+	if len(block.Transactions()) != 1 {
+		t.Fatalf("span commitment block transaction count mismatch: have %d, want 1", len(block.Transactions()))
+	}
+	data := block.Transactions()[0].Data()
+	if to := block.Transactions()[0].To(); to == nil || *to != net.Devnet.ValidatorSet {
+		t.Fatalf("span commitment sent to %v, want %x", to, net.Devnet.ValidatorSet)
+	}
+	committed := data[4+64 : 4+64+new(big.Int).SetBytes(data[4+32:4+64]).Uint64()]
+
+	eligible := make([]*ctypes.Validator, len(net.Validators))
+	for i, node := range net.Validators {
+		eligible[i] = &ctypes.Validator{Address: node.Address, VotingPower: 1}
+	}
+	var selected []ctypes.MinimalVal
+	for _, validator := range clique.SelectValidators(eligible, seed.Hash(), span) {
+		selected = append(selected, validator.MinimalVal())
+	}
+	want, _ := rlp.EncodeToBytes(selected)
+	if !bytes.Equal(committed, want) {
+		t.Fatalf("committed validators mismatch: have %x, want %x", committed, want)
+	}
+	statedb, err := net.State()
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if net.Stubs["ValidatorSet"] {
+		if count := statedb.GetState(net.Devnet.ValidatorSet, CommitmentCountSlot); count.Big().Uint64() != 1 {
+			t.Errorf("commitment count mismatch: have %d, want 1", count.Big())
+		}
+		if hash := statedb.GetState(net.Devnet.ValidatorSet, CommitmentHashSlot); hash != crypto.Keccak256Hash(want) {
+			t.Errorf("commitment hash mismatch: have %x, want %x", hash, crypto.Keccak256Hash(want))
+		}
+	}
+
+	// Pay fees in a block and check they're distributed to the stake manager
+	gasPrice := big.NewInt(params.GWei)
+	tx, err := net.Transfer(net.Validators[0], common.Address{0xaa}, big.NewInt(1), gasPrice)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	if block, err = net.Mine(tx); err != nil {
+		t.Fatalf("failed to seal block with fees: %v", err)
+	}
+	if len(block.Transactions()) != 2 {
+		t.Fatalf("fee block transaction count mismatch: have %d, want 2", len(block.Transactions()))
+	}
+	fees := new(big.Int).Mul(new(big.Int).SetUint64(params.TxGas), gasPrice)
+	if statedb, err = net.State(); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	stakeManager := net.Devnet.Contracts.StakeManager
+	if balance := statedb.GetBalance(stakeManager); balance.Cmp(fees) != 0 {
+		t.Errorf("stake manager balance mismatch: have %v, want %v", balance, fees)
+	}
+	if net.Stubs["StakeManager"] {
+		if reward := statedb.GetState(stakeManager, RewardSlot); reward.Big().Cmp(fees) != 0 {
+			t.Errorf("distributed reward mismatch: have %v, want %v", reward.Big(), fees)
+		}
+	}
+
+	// Seal a block by the official node in place of the validator in turn
+	inturn, err := net.Inturn()
+	if err != nil {
+		t.Fatalf("failed to find validator in turn: %v", err)
+	}
+	if block, err = net.MineBy(net.Official); err != nil {
+		t.Fatalf("failed to seal block by official node: %v", err)
+	}
+	if block.Difficulty().Cmp(diffNoTurn) != 0 {
+		t.Errorf("official block difficulty mismatch: have %v, want %v", block.Difficulty(), diffNoTurn)
+	}
+	spanNumber := block.NumberU64() / span
+	slashed, err := net.Validators[1].Engine.ContractClient().IsSlashed(context.Background(), net.Devnet.Contracts.SlashManager, nil, inturn.Address,
+		new(big.Int).SetUint64(spanNumber), &types.Header{ParentHash: block.Hash(), Number: new(big.Int).Add(block.Number(), common.Big1)})
+	if err != nil {
+		t.Fatalf("failed to check slashing: %v", err)
+	}
+	if !slashed {
+		t.Errorf("validator in turn %x not slashed", inturn.Address)
+	}
+	if net.Stubs["SlashManager"] {
+		if statedb, err = net.State(); err != nil {
+			t.Fatalf("failed to open state: %v", err)
+		}
+		if count := statedb.GetState(net.Devnet.Contracts.SlashManager, SlashCountSlot); count.Big().Uint64() != 1 {
+			t.Errorf("slash count mismatch: have %d, want 1", count.Big())
+		}
+		if flag := statedb.GetState(net.Devnet.Contracts.SlashManager, SlashedSlot(inturn.Address, spanNumber)); flag.Big().Uint64() != 1 {
+			t.Errorf("slashed flag mismatch: have %d, want 1", flag.Big())
+		}
+	}
+
+	// Cross into the next span and check all nodes agree on the chain
+	if err := net.MineTo(3 * span); err != nil {
+		t.Fatalf("failed to seal the next span: %v", err)
+	}
+	head = net.Head()
+	for _, node := range append(net.Validators, net.Official) {
+		if have := node.Chain.CurrentHeader(); have.Hash() != head.Hash() {
+			t.Errorf("node %x head mismatch: have #%d %x, want #%d %x", node.Address, have.Number, have.Hash(), head.Number, head.Hash())
+		}
+	}
+}
+
+// creationCode returns the creation bytecode deploying the given runtime code.
+func creationCode(runtime []byte) []byte {
+	size := []byte{byte(len(runtime) >> 8), byte(len(runtime))}
+	code := []byte{0x61, size[0], size[1], 0x60, 14, 0x60, 0x00, 0x39} // PUSH2 size, PUSH1 offset, PUSH1 0, CODECOPY
+	code = append(code, 0x61, size[0], size[1], 0x60, 0x00, 0xf3)      // PUSH2 size, PUSH1 0, RETURN
+	return append(code, runtime...)
+}
+
+// Tests that compiled system contracts are deployed from the contracts directory
+// by their constructors.
+func TestCompiledContracts(t *testing.T) {
+	const span = 8
+
+	dir := t.TempDir()
+	for name, fn := range map[string]func() (*devnet.Artifact, error){"StakeManager": StakeManagerArtifact, "SlashManager": SlashManagerArtifact} {
+		artifact, err := fn()
+		if err != nil {
+			t.Fatalf("failed to assemble %s: %v", name, err)
+		}
+		blob, _ := json.Marshal(map[string]interface{}{
+			"contractName": name,
+			"bytecode":     hexutil.Bytes(creationCode(artifact.DeployedBytecode)),
+		})
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".json"), blob, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	net, err := New(&Config{Validators: 3, Span: span, ChaophrayaBlock: span, Contracts: dir})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer net.Close()
+
+	if net.Stubs["StakeManager"] || net.Stubs["SlashManager"] || !net.Stubs["ValidatorSet"] {
+		t.Fatalf("stubbed contracts mismatch: have %v, want ValidatorSet only", net.Stubs)
+	}
+	stakeManager := net.Devnet.Contracts.StakeManager
+	statedb, err := net.State()
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	artifact, _ := StakeManagerArtifact()
+	if code := statedb.GetCode(stakeManager); !bytes.Equal(code, artifact.DeployedBytecode) {
+		t.Fatalf("deployed code mismatch: have %x, want %x", code, artifact.DeployedBytecode)
+	}
+	if err := net.MineTo(2 * span); err != nil {
+		t.Fatalf("failed to seal proof-of-stake blocks: %v", err)
+	}
+	gasPrice := big.NewInt(params.GWei)
+	tx, err := net.Transfer(net.Validators[0], common.Address{0xaa}, big.NewInt(1), gasPrice)
+	if err != nil {
+		t.Fatalf("failed to create transaction: %v", err)
+	}
+	if _, err := net.Mine(tx); err != nil {
+		t.Fatalf("failed to seal block with fees: %v", err)
+	}
+	if _, err := net.MineBy(net.Official); err != nil {
+		t.Fatalf("failed to seal block by official node: %v", err)
+	}
+	if statedb, err = net.State(); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	fees := new(big.Int).Mul(new(big.Int).SetUint64(params.TxGas), gasPrice)
+	if reward := statedb.GetState(stakeManager, RewardSlot); reward.Big().Cmp(fees) != 0 {
+		t.Errorf("distributed reward mismatch: have %v, want %v", reward.Big(), fees)
+	}
+	if count := statedb.GetState(net.Devnet.Contracts.SlashManager, SlashCountSlot); count.Big().Uint64() != 1 {
+		t.Errorf("slash count mismatch: have %d, want 1", count.Big())
+	}
+}
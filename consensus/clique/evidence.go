@@ -0,0 +1,420 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	evidenceMaxAge      = 256 // Number of blocks double sign evidence can be included for
+	maxEvidencePerBlock = 4   // Maximum number of double sign slashes in a single block
+)
+
+var (
+	// errInvalidEvidence is returned if a block includes double sign evidence
+	// which doesn't prove a validator signed two headers at the same height.
+	errInvalidEvidence = errors.New("invalid double sign evidence")
+
+	// errStaleEvidence is returned if a block includes double sign evidence
+	// older than evidenceMaxAge blocks.
+	errStaleEvidence = errors.New("stale double sign evidence")
+
+	// errTooManyEvidence is returned if a block includes more than
+	// maxEvidencePerBlock double sign slashes.
+	errTooManyEvidence = errors.New("too many double sign evidence")
+
+	// errDuplicateEvidence is returned if a block includes double sign evidence
+	// already slashed in the block or one of its ancestors.
+	errDuplicateEvidence = errors.New("double sign already slashed")
+
+	equivocationCounter = metrics.NewRegisteredCounter("clique/equivocations", nil)
+)
+
+// Evidence is a proof of a validator signing two different headers at the same
+// height. The headers are ordered by hash so every equivocation has a single
+// encoding.
+type Evidence struct {
+	Validator common.Address `json:"validator"` // Signer of both headers
+	Number    uint64         `json:"number"`    // Height the validator double signed
+	First     *types.Header  `json:"first"`     // Header with the lower hash
+	Second    *types.Header  `json:"second"`    // Header with the higher hash
+}
+
+// newEvidence creates the evidence of the given validator signing both headers.
+func newEvidence(validator common.Address, a, b *types.Header) *Evidence {
+	if bytes.Compare(a.Hash().Bytes(), b.Hash().Bytes()) > 0 {
+		a, b = b, a
+	}
+	return &Evidence{Validator: validator, Number: a.Number.Uint64(), First: a, Second: b}
+}
+
+// encode returns the RLP encoding of the conflicting headers, as passed to the
+// SlashManager.
+func (ev *Evidence) encode() ([]byte, error) {
+	return rlp.EncodeToBytes([]*types.Header{ev.First, ev.Second})
+}
+
+// decodeEvidence decodes the conflicting headers of double sign evidence and
+// checks they're both signed by the same signer at the same height.
+func decodeEvidence(blob []byte, sigcache *lru.ARCCache) (*Evidence, error) {
+	var headers []*types.Header
+	if err := rlp.DecodeBytes(blob, &headers); err != nil || len(headers) != 2 {
+		return nil, errInvalidEvidence
+	}
+	first, second := headers[0], headers[1]
+	if first.Number == nil || second.Number == nil || first.Number.Cmp(second.Number) != 0 {
+		return nil, errInvalidEvidence
+	}
+	if bytes.Compare(first.Hash().Bytes(), second.Hash().Bytes()) >= 0 {
+		return nil, errInvalidEvidence
+	}
+	signer, err := ecrecover(first, sigcache)
+	if err != nil {
+		return nil, errInvalidEvidence
+	}
+	if other, err := ecrecover(second, sigcache); err != nil || other != signer {
+		return nil, errInvalidEvidence
+	}
+	return &Evidence{Validator: signer, Number: first.Number.Uint64(), First: first, Second: second}, nil
+}
+
+// isSlashDoubleSign returns whether the transaction slashes a double sign on the
+// given SlashManager, that is calls slash with the evidence appended.
+func isSlashDoubleSign(tx *types.Transaction, slashManager common.Address) bool {
+	data := tx.Data()
+	return tx.To() != nil && *tx.To() == slashManager && len(data) > 4+2*common.HashLength && bytes.Equal(data[:4], slashSelector)
+}
+
+// unpackSlashDoubleSign decodes the slashed validator and span of a double sign
+// slash, along with the evidence following them.
+func unpackSlashDoubleSign(data []byte) (common.Address, *big.Int, []byte, error) {
+	if len(data) <= 2*common.HashLength {
+		return common.Address{}, nil, nil, errInvalidEvidence
+	}
+	validator := common.BytesToAddress(data[:common.HashLength])
+	span := new(big.Int).SetBytes(data[common.HashLength : 2*common.HashLength])
+	return validator, span, data[2*common.HashLength:], nil
+}
+
+// evidenceKey identifies the header a validator signed at a given height.
+type evidenceKey struct {
+	validator common.Address
+	number    uint64
+}
+
+// EvidencePool collects the headers signed by each validator over the recent
+// blocks, detecting validators signing two different headers at the same height.
+// Whether an evidence was already slashed is decided from the chain it's to be
+// included in, not tracked by the pool.
+type EvidencePool struct {
+	seen     map[evidenceKey]*types.Header // First header seen from a validator at a height
+	evidence map[evidenceKey]*Evidence     // Equivocations detected
+	head     uint64                        // Highest height seen, to expire old entries
+
+	lock sync.RWMutex
+}
+
+// newEvidencePool creates an empty double sign evidence pool.
+func newEvidencePool() *EvidencePool {
+	return &EvidencePool{
+		seen:     make(map[evidenceKey]*types.Header),
+		evidence: make(map[evidenceKey]*Evidence),
+	}
+}
+
+// add records a header signed by the given validator, returning the evidence if
+// the validator already signed a different header at the same height.
+func (p *EvidencePool) add(validator common.Address, header *types.Header) *Evidence {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	number := header.Number.Uint64()
+	if number+evidenceMaxAge < p.head {
+		return nil
+	}
+	if number > p.head {
+		p.head = number
+		p.expire()
+	}
+	key := evidenceKey{validator, number}
+	if _, ok := p.evidence[key]; ok {
+		return nil
+	}
+	prev, ok := p.seen[key]
+	if !ok {
+		p.seen[key] = header
+		return nil
+	}
+	if prev.Hash() == header.Hash() {
+		return nil
+	}
+	ev := newEvidence(validator, prev, header)
+	p.evidence[key] = ev
+	return ev
+}
+
+// expire drops the entries too old to be included in a block. The caller must
+// hold the write lock.
+func (p *EvidencePool) expire() {
+	for key := range p.seen {
+		if key.number+evidenceMaxAge < p.head {
+			delete(p.seen, key)
+		}
+	}
+	for key := range p.evidence {
+		if key.number+evidenceMaxAge < p.head {
+			delete(p.evidence, key)
+		}
+	}
+}
+
+// all returns every evidence in the pool, ordered by height and validator.
+func (p *EvidencePool) all() []*Evidence {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	evidence := make([]*Evidence, 0, len(p.evidence))
+	for _, ev := range p.evidence {
+		evidence = append(evidence, ev)
+	}
+	sortEvidence(evidence)
+	return evidence
+}
+
+// sortEvidence orders evidence by height and validator.
+func sortEvidence(evidence []*Evidence) {
+	sort.Slice(evidence, func(i, j int) bool {
+		if evidence[i].Number != evidence[j].Number {
+			return evidence[i].Number < evidence[j].Number
+		}
+		return bytes.Compare(evidence[i].Validator[:], evidence[j].Validator[:]) < 0
+	})
+}
+
+// ReportHeader checks a header received from the network, which already passed
+// header verification, against the headers seen from the same signer at the same
+// height, including the local canonical one. Equivocations are logged and kept
+// as evidence. After the official node fork, official node blocks competing with
+// an in-turn sibling are recorded for audit as well.
+func (c *Clique) ReportHeader(chain consensus.ChainHeaderReader, header *types.Header) {
+	if header.Number == nil || !c.config.IsChaophraya(header.Number) {
+		return
+	}
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return
+	}
+	local := chain.GetHeaderByNumber(header.Number.Uint64())
+	if local != nil && local.Hash() != header.Hash() {
+		if localSigner, err := ecrecover(local, c.signatures); err == nil {
+			if localSigner == signer {
+				c.evidence.add(signer, local)
+			}
+			if c.config.IsChaophrayaOfficial(header.Number) && local.ParentHash == header.ParentHash {
+				c.auditOfficialSeal(chain, local, localSigner)
+			}
+		}
+	}
+	if c.config.IsChaophrayaOfficial(header.Number) {
+		c.auditOfficialSeal(chain, header, signer)
+	}
+	if ev := c.evidence.add(signer, header); ev != nil {
+		log.Warn("Validator double signed", "validator", signer, "number", ev.Number, "first", ev.First.Hash(), "second", ev.Second.Hash())
+		equivocationCounter.Inc(1)
+	}
+}
+
+// verifyEvidence checks that the evidence proves a span validator of the chain
+// of the given header double signed, recently enough to be slashed in it and
+// not slashed yet by one of its ancestors. Evidence can only be included for
+// evidenceMaxAge blocks, so the ancestors above the evidence height are all the
+// blocks which may have slashed it already.
+func (c *Clique) verifyEvidence(chain consensus.ChainHeaderReader, header *types.Header, slashManager common.Address, ev *Evidence) error {
+	number := header.Number.Uint64()
+	if ev.Number >= number || !c.config.IsChaophraya(new(big.Int).SetUint64(ev.Number)) {
+		return errInvalidEvidence
+	}
+	if ev.Number+evidenceMaxAge < number {
+		return errStaleEvidence
+	}
+	reader, ok := chain.(consensus.ChainReader)
+	if !ok {
+		return errMissingBlockBody
+	}
+	// Ensure no ancestor slashed the double sign already, then retrieve the
+	// validator set at the evidence height on the chain of the header
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	for parent != nil && parent.Number.Uint64() >= ev.Number {
+		if parent.Number.Uint64() > ev.Number && c.config.IsChaophrayaEvidence(parent.Number) {
+			block := reader.GetBlock(parent.Hash(), parent.Number.Uint64())
+			if block == nil {
+				return errMissingBlockBody
+			}
+			if c.hasDoubleSignSlash(block, slashManager, ev) {
+				return errDuplicateEvidence
+			}
+		}
+		parent = chain.GetHeader(parent.ParentHash, parent.Number.Uint64()-1)
+	}
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	snap, err := c.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Signers[ev.Validator]; !ok {
+		return errInvalidEvidence
+	}
+	return nil
+}
+
+// hasDoubleSignSlash returns whether the block slashes the double sign of the
+// evidence. Only the system transactions of the block, sent by the sealer for
+// free and validated on import, are considered.
+func (c *Clique) hasDoubleSignSlash(block *types.Block, slashManager common.Address, ev *Evidence) bool {
+	for _, tx := range block.Transactions() {
+		if tx.GasPrice().Sign() != 0 || !isSlashDoubleSign(tx, slashManager) {
+			continue
+		}
+		validator, _, blob, err := unpackSlashDoubleSign(tx.Data()[4:])
+		if err != nil || validator != ev.Validator {
+			continue
+		}
+		if slashed, err := decodeEvidence(blob, c.signatures); err != nil || slashed.Validator != ev.Validator || slashed.Number != ev.Number {
+			continue
+		}
+		if sender, err := types.Sender(c.signer, tx); err == nil && sender == block.Coinbase() {
+			return true
+		}
+	}
+	return false
+}
+
+// slashDoubleSigns applies the double sign slashes of a block. When mining, the
+// pending evidence of the pool is included, otherwise the evidence carried by
+// the received system transactions is verified and applied.
+//
+// The deployed SlashManager has no dedicated double sign entrypoint, so double
+// signs are slashed through slash(address,uint256), the method the official
+// node slashes the validators missing their turn with. The slash is issued for
+// the current span, in which the contract slashes a validator at most once, and
+// the RLP encoded evidence is appended to the call data past the arguments: the
+// contract ignores it, while it lets every node verify the slash on import. As
+// the contract is only known to accept slashes from the official node, double
+// signs are only slashed in the blocks it seals.
+func (c *Clique) slashDoubleSigns(ctx context.Context, chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool, snap *Snapshot) error {
+
+	if header.Coinbase != snap.SystemContracts.OfficialNode {
+		return nil
+	}
+	slashManager := snap.SystemContracts.SlashManager
+
+	span, err := c.spanNumber(ctx, header)
+	if err != nil {
+		return err
+	}
+	// A validator can't be slashed again in the span, nor if the block already
+	// slashes it for missing its turn
+	slashed := make(map[common.Address]bool)
+	if !isInturnDifficulty(header.Difficulty) {
+		slashed[snap.getInturnSigner(header.Number.Uint64())] = true
+	}
+	slashable := func(validator common.Address) (bool, error) {
+		if slashed[validator] {
+			return false, nil
+		}
+		done, err := c.contractClient.IsSlashed(ctx, slashManager, chain, validator, span, header)
+		return !done, err
+	}
+	var evidence []*Evidence
+	if mining {
+		for _, ev := range c.evidence.all() {
+			if len(evidence) == maxEvidencePerBlock {
+				break
+			}
+			if err := c.verifyEvidence(chain, header, slashManager, ev); err != nil {
+				continue
+			}
+			if ok, err := slashable(ev.Validator); err != nil || !ok {
+				continue
+			}
+			slashed[ev.Validator] = true
+			evidence = append(evidence, ev)
+		}
+	} else {
+		for _, tx := range *receivedTxs {
+			if !isSlashDoubleSign(tx, slashManager) {
+				break
+			}
+			if len(evidence) == maxEvidencePerBlock {
+				return errTooManyEvidence
+			}
+			validator, number, blob, err := unpackSlashDoubleSign(tx.Data()[4:])
+			if err != nil {
+				return err
+			}
+			ev, err := decodeEvidence(blob, c.signatures)
+			if err != nil {
+				return err
+			}
+			if ev.Validator != validator || number.Cmp(span) != 0 {
+				return errInvalidEvidence
+			}
+			if err := c.verifyEvidence(chain, header, slashManager, ev); err != nil {
+				return err
+			}
+			ok, err := slashable(ev.Validator)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errDuplicateEvidence
+			}
+			slashed[ev.Validator] = true
+			evidence = append(evidence, ev)
+		}
+	}
+	for _, ev := range evidence {
+		blob, err := ev.encode()
+		if err != nil {
+			return err
+		}
+		if err := c.contractClient.SlashDoubleSign(slashManager, ev.Validator, span, blob, state, header, cx, txs, receipts, receivedTxs, usedGas, mining); err != nil {
+			return err
+		}
+		log.Info("🗡️  Slashing double signer", "validator", ev.Validator, "height", ev.Number, "number", header.Number)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestEvidencePool(t *testing.T) {
+	accounts := newTesterAccountPool()
+	header := func(number int64, signer string, time uint64) *types.Header {
+		header := &types.Header{Number: big.NewInt(number), Time: time, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, signer)
+		return header
+	}
+	pool := newEvidencePool()
+	a, b := accounts.address("A"), accounts.address("B")
+
+	if ev := pool.add(a, header(10, "A", 1)); ev != nil {
+		t.Fatalf("evidence on first header: %v", ev)
+	}
+	if ev := pool.add(a, header(10, "A", 1)); ev != nil {
+		t.Fatalf("evidence on duplicate header: %v", ev)
+	}
+	if ev := pool.add(b, header(10, "B", 2)); ev != nil {
+		t.Fatalf("evidence on header from another signer: %v", ev)
+	}
+	ev := pool.add(a, header(10, "A", 2))
+	if ev == nil {
+		t.Fatalf("double sign not detected")
+	}
+	if ev.Validator != a || ev.Number != 10 {
+		t.Errorf("evidence mismatch: have %x at %d, want %x at 10", ev.Validator, ev.Number, a)
+	}
+	if ev := pool.add(a, header(10, "A", 3)); ev != nil {
+		t.Errorf("evidence reported twice: %v", ev)
+	}
+	if all := pool.all(); len(all) != 1 {
+		t.Fatalf("evidence count mismatch: have %d, want 1", len(all))
+	}
+	// Advance the pool past the evidence age, the old entries must be dropped
+	pool.add(b, header(10+evidenceMaxAge+1, "B", 1))
+	if all := pool.all(); len(all) != 0 {
+		t.Errorf("stale evidence not expired: %v", all)
+	}
+	if ev := pool.add(a, header(10, "A", 4)); ev != nil {
+		t.Errorf("evidence on stale header: %v", ev)
+	}
+}
+
+func TestDecodeEvidence(t *testing.T) {
+	accounts := newTesterAccountPool()
+	header := func(number int64, signer string, time uint64) *types.Header {
+		header := &types.Header{Number: big.NewInt(number), Time: time, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, signer)
+		return header
+	}
+	sigcache, _ := lru.NewARC(inmemorySignatures)
+
+	ev := newEvidence(accounts.address("A"), header(10, "A", 2), header(10, "A", 1))
+	blob, err := ev.encode()
+	if err != nil {
+		t.Fatalf("failed to encode evidence: %v", err)
+	}
+	decoded, err := decodeEvidence(blob, sigcache)
+	if err != nil {
+		t.Fatalf("failed to decode evidence: %v", err)
+	}
+	if decoded.Validator != ev.Validator || decoded.Number != 10 || decoded.First.Hash() != ev.First.Hash() {
+		t.Errorf("decoded evidence mismatch: have %+v, want %+v", decoded, ev)
+	}
+	ordered := func(a, b *types.Header) []*types.Header {
+		ev := newEvidence(ev.Validator, a, b)
+		return []*types.Header{ev.First, ev.Second}
+	}
+	invalid := map[string][]*types.Header{
+		"unordered":        {ev.Second, ev.First},
+		"same header":      {ev.First, ev.First},
+		"different height": ordered(header(10, "A", 1), header(11, "A", 1)),
+		"different signer": ordered(header(10, "A", 1), header(10, "B", 1)),
+		"single header":    {ev.First},
+	}
+	for name, headers := range invalid {
+		blob, _ := rlp.EncodeToBytes(headers)
+		if _, err := decodeEvidence(blob, sigcache); !errors.Is(err, errInvalidEvidence) {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, errInvalidEvidence)
+		}
+	}
+}
+
+func TestHasDoubleSignSlash(t *testing.T) {
+	var (
+		accounts     = newTesterAccountPool()
+		sealerKey, _ = crypto.GenerateKey()
+		otherKey, _  = crypto.GenerateKey()
+		sealer       = crypto.PubkeyToAddress(sealerKey.PublicKey)
+		slashManager = common.HexToAddress("0x0000000000000000000000000000000000001002")
+		validator    = accounts.address("A")
+		signer       = types.NewEIP155Signer(big.NewInt(96))
+		sigcache, _  = lru.NewARC(inmemorySignatures)
+		engine       = &Clique{signer: signer, signatures: sigcache}
+		ev           = &Evidence{Validator: validator, Number: 10}
+	)
+	header := func(number int64, signer string, time uint64) *types.Header {
+		header := &types.Header{Number: big.NewInt(number), Time: time, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, signer)
+		return header
+	}
+	slash := func(validator common.Address, number int64, to common.Address, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+		evidence, _ := newEvidence(accounts.address("A"), header(number, "A", 1), header(number, "A", 2)).encode()
+		data := append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(validator.Bytes(), 32)...), common.LeftPadBytes([]byte{1}, 32)...)
+		tx := types.NewTransaction(0, to, common.Big0, systemTxGas, big.NewInt(price), append(data, evidence...))
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return signed
+	}
+	tests := []struct {
+		tx   *types.Transaction
+		want bool
+	}{
+		{slash(validator, 10, slashManager, 0, sealerKey), true},
+		// Slash of another validator or height
+		{slash(sealer, 10, slashManager, 0, sealerKey), false},
+		{slash(validator, 11, slashManager, 0, sealerKey), false},
+		// Regular transactions slashing the double sign
+		{slash(validator, 10, slashManager, 1, sealerKey), false},
+		{slash(validator, 10, slashManager, 0, otherKey), false},
+		{slash(validator, 10, common.HexToAddress("0x1003"), 0, sealerKey), false},
+	}
+	for i, tt := range tests {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(11), Coinbase: sealer}).WithBody(types.Transactions{tt.tx}, nil)
+		if have := engine.hasDoubleSignSlash(block, slashManager, ev); have != tt.want {
+			t.Errorf("test %d: slash mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
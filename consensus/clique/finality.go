@@ -0,0 +1,381 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// voteInterval is the number of blocks between two checkpoints voted
+	// on by the span validators.
+	voteInterval = 16
+
+	// inmemoryCheckpoints is the number of checkpoints the span voting power is
+	// kept in memory for.
+	inmemoryCheckpoints = 128
+)
+
+var (
+	// errNotCheckpoint is returned if a vote is cast for a block which is not a
+	// checkpoint.
+	errNotCheckpoint = errors.New("block is not a checkpoint")
+
+	// errInvalidVoteSignature is returned if the signature of a checkpoint vote is not
+	// made by the validator it claims to be from.
+	errInvalidVoteSignature = errors.New("invalid checkpoint vote signature")
+
+	// errUnauthorizedVoter is returned if a checkpoint vote is cast by an account
+	// which is not a validator of the checkpoint span.
+	errUnauthorizedVoter = errors.New("unauthorized checkpoint voter")
+
+	// errFinalityUnavailable is returned if the finality of a chain which can't
+	// track safe and finalized blocks is requested.
+	errFinalityUnavailable = errors.New("finality not tracked by the chain")
+
+	// errStaleVote is returned if a checkpoint vote is cast at or below the
+	// finalized block.
+	errStaleVote = errors.New("checkpoint vote below the finalized block")
+
+	checkpointVotePrefix = []byte("clique-vote-") // checkpointVotePrefix + num (uint64 big endian) + hash + validator -> signature
+
+	// checkpointVoteDomain prefixes the data signed by checkpoint votes, so a vote
+	// is never a valid seal.
+	checkpointVoteDomain = []byte("clique-checkpoint-vote")
+)
+
+// CheckpointVote is the signature of a span validator attesting a checkpoint,
+// a block whose number is a multiple of the checkpoint interval.
+type CheckpointVote struct {
+	Number    uint64         `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	Validator common.Address `json:"validator"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// CheckpointVoteData returns the data signed by a vote for the given checkpoint.
+func CheckpointVoteData(number uint64, hash common.Hash) []byte {
+	data := make([]byte, len(checkpointVoteDomain)+8+common.HashLength)
+	copy(data, checkpointVoteDomain)
+	binary.BigEndian.PutUint64(data[len(checkpointVoteDomain):], number)
+	copy(data[len(checkpointVoteDomain)+8:], hash[:])
+	return data
+}
+
+// ParseCheckpointVoteData decodes the checkpoint signed by a vote.
+func ParseCheckpointVoteData(data []byte) (uint64, common.Hash, error) {
+	if len(data) != len(checkpointVoteDomain)+8+common.HashLength || !bytes.HasPrefix(data, checkpointVoteDomain) {
+		return 0, common.Hash{}, errors.New("invalid checkpoint vote data")
+	}
+	number := binary.BigEndian.Uint64(data[len(checkpointVoteDomain):])
+	return number, common.BytesToHash(data[len(checkpointVoteDomain)+8:]), nil
+}
+
+// signer recovers the account which signed the vote.
+func (v *CheckpointVote) signer() (common.Address, error) {
+	if len(v.Signature) != crypto.SignatureLength {
+		return common.Address{}, errInvalidVoteSignature
+	}
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(CheckpointVoteData(v.Number, v.Hash)), v.Signature)
+	if err != nil {
+		return common.Address{}, errInvalidVoteSignature
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// checkpointVoteKey = checkpointVotePrefix + num (uint64 big endian) + hash + validator
+func checkpointVoteKey(number uint64, hash common.Hash, validator common.Address) []byte {
+	key := make([]byte, len(checkpointVotePrefix)+8+common.HashLength+common.AddressLength)
+	copy(key, checkpointVotePrefix)
+	binary.BigEndian.PutUint64(key[len(checkpointVotePrefix):], number)
+	copy(key[len(checkpointVotePrefix)+8:], hash[:])
+	copy(key[len(checkpointVotePrefix)+8+common.HashLength:], validator[:])
+	return key
+}
+
+// ReadCheckpointVotes retrieves the votes stored for the checkpoint with the
+// given number, for any hash if hash is the zero hash.
+func ReadCheckpointVotes(db ethdb.Iteratee, number uint64, hash common.Hash) ([]*CheckpointVote, error) {
+	prefix := checkpointVoteKey(number, hash, common.Address{})[:len(checkpointVotePrefix)+8+common.HashLength]
+	if hash == (common.Hash{}) {
+		prefix = prefix[:len(checkpointVotePrefix)+8]
+	}
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var votes []*CheckpointVote
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(checkpointVotePrefix)+8+common.HashLength+common.AddressLength {
+			continue
+		}
+		votes = append(votes, &CheckpointVote{
+			Number:    number,
+			Hash:      common.BytesToHash(key[len(checkpointVotePrefix)+8 : len(checkpointVotePrefix)+8+common.HashLength]),
+			Validator: common.BytesToAddress(key[len(checkpointVotePrefix)+8+common.HashLength:]),
+			Signature: common.CopyBytes(it.Value()),
+		})
+	}
+	return votes, it.Error()
+}
+
+// writeCheckpointVote stores a verified checkpoint vote.
+func writeCheckpointVote(db ethdb.KeyValueWriter, vote *CheckpointVote) error {
+	return db.Put(checkpointVoteKey(vote.Number, vote.Hash, vote.Validator), vote.Signature)
+}
+
+// Checkpoint is a block along with the span validators which voted for it.
+type Checkpoint struct {
+	Number     uint64           `json:"number"`
+	Hash       common.Hash      `json:"hash"`
+	Voters     []common.Address `json:"voters"`     // Span validators which voted for the checkpoint
+	Power      uint64           `json:"power"`      // Voting power of the voters
+	TotalPower uint64           `json:"totalPower"` // Voting power of the span validators
+}
+
+// Finality is the latest safe and finalized checkpoints of a chain. A checkpoint
+// is safe once voted for by more than half of the voting power of its span, and
+// final once voted for by more than two thirds of it. The fork choice never
+// reverts the finalized checkpoint.
+type Finality struct {
+	Head      uint64      `json:"head"`
+	Safe      *Checkpoint `json:"safe"`
+	Finalized *Checkpoint `json:"finalized"`
+}
+
+// FinalityChain is the chain the finality gadget follows and reports the safe
+// and finalized blocks to.
+type FinalityChain interface {
+	HeadChain
+	GetBlock(hash common.Hash, number uint64) *types.Block
+	CurrentFinalizedBlock() *types.Block
+	CurrentSafeBlock() *types.Block
+	SetFinalized(block *types.Block)
+	SetSafe(block *types.Block)
+}
+
+// isCheckpoint returns whether the span validators vote on the given block.
+func (c *Clique) isCheckpoint(number uint64) bool {
+	return number > 0 && number%voteInterval == 0 && c.config.IsChaophraya(new(big.Int).SetUint64(number))
+}
+
+// checkpointPowers returns the voting power of the validators of the span the
+// given checkpoint belongs to, as committed in the header before the span.
+func (c *Clique) checkpointPowers(chain consensus.ChainHeaderReader, header *types.Header) (map[common.Address]uint64, error) {
+	if powers, ok := c.checkpoints.Get(header.Hash()); ok {
+		return powers.(map[common.Address]uint64), nil
+	}
+	start, _ := spanRange(c.config, header.Number.Uint64())
+	span := header
+	for span != nil && span.Number.Uint64() >= start {
+		span = chain.GetHeader(span.ParentHash, span.Number.Uint64()-1)
+	}
+	if span == nil || span.Number.Uint64()+1 != start {
+		return nil, errUnknownSpan
+	}
+	validators, err := parseSpanValidators(c.config, span)
+	if err != nil {
+		return nil, err
+	}
+	powers := make(map[common.Address]uint64, len(validators))
+	for _, validator := range validators {
+		powers[validator.Address] += validator.VotingPower
+	}
+	c.checkpoints.Add(header.Hash(), powers)
+	return powers, nil
+}
+
+// tallyCheckpoint sums the voting power of the stored votes for a checkpoint.
+func (c *Clique) tallyCheckpoint(chain consensus.ChainHeaderReader, header *types.Header) (*Checkpoint, error) {
+	powers, err := c.checkpointPowers(chain, header)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := ReadCheckpointVotes(c.db, header.Number.Uint64(), header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{Number: header.Number.Uint64(), Hash: header.Hash()}
+	for _, power := range powers {
+		checkpoint.TotalPower += power
+	}
+	for _, vote := range votes {
+		if power, ok := powers[vote.Validator]; ok {
+			checkpoint.Voters = append(checkpoint.Voters, vote.Validator)
+			checkpoint.Power += power
+		}
+	}
+	return checkpoint, nil
+}
+
+// AddCheckpointVote verifies a vote of a span validator for a known checkpoint
+// and stores it, moving the safe and finalized blocks of the chain once the
+// checkpoint gathers enough voting power.
+func (c *Clique) AddCheckpointVote(chain FinalityChain, vote *CheckpointVote) error {
+	if !c.isCheckpoint(vote.Number) {
+		return errNotCheckpoint
+	}
+	header := chain.GetHeader(vote.Hash, vote.Number)
+	if header == nil {
+		return errUnknownBlock
+	}
+	if finalized := chain.CurrentFinalizedBlock(); finalized != nil && vote.Number <= finalized.NumberU64() {
+		return errStaleVote
+	}
+	signer, err := vote.signer()
+	if err != nil {
+		return err
+	}
+	if signer != vote.Validator {
+		return errInvalidVoteSignature
+	}
+	powers, err := c.checkpointPowers(chain, header)
+	if err != nil {
+		return err
+	}
+	if _, ok := powers[signer]; !ok {
+		return errUnauthorizedVoter
+	}
+	if err := writeCheckpointVote(c.db, vote); err != nil {
+		return err
+	}
+	return c.updateFinality(chain, header)
+}
+
+// updateFinality tallies the votes for a checkpoint, making it the safe or the
+// finalized block of the chain if it's canonical and voted for by enough of its
+// span validators.
+func (c *Clique) updateFinality(chain FinalityChain, header *types.Header) error {
+	c.finalityLock.Lock()
+	defer c.finalityLock.Unlock()
+
+	checkpoint, err := c.tallyCheckpoint(chain, header)
+	if err != nil {
+		return err
+	}
+	if 2*checkpoint.Power <= checkpoint.TotalPower {
+		return nil
+	}
+	if canonical := chain.GetHeaderByNumber(checkpoint.Number); canonical == nil || canonical.Hash() != checkpoint.Hash {
+		log.Debug("Voted checkpoint not canonical", "number", checkpoint.Number, "hash", checkpoint.Hash, "power", checkpoint.Power)
+		return nil
+	}
+	block := chain.GetBlock(checkpoint.Hash, checkpoint.Number)
+	if block == nil {
+		return nil
+	}
+	if 3*checkpoint.Power > 2*checkpoint.TotalPower {
+		if finalized := chain.CurrentFinalizedBlock(); finalized == nil || finalized.NumberU64() < checkpoint.Number {
+			log.Info("Finalized checkpoint", "number", checkpoint.Number, "hash", checkpoint.Hash, "voters", len(checkpoint.Voters))
+			chain.SetFinalized(block)
+		}
+	}
+	if safe := chain.CurrentSafeBlock(); safe == nil || safe.NumberU64() < checkpoint.Number {
+		chain.SetSafe(block)
+	}
+	return nil
+}
+
+// voteCheckpoint signs a vote for the checkpoint if the local signer is one of
+// its span validators and didn't vote at the checkpoint height yet.
+func (c *Clique) voteCheckpoint(chain FinalityChain, header *types.Header) error {
+	c.lock.RLock()
+	val, signFn := c.val, c.signFn
+	c.lock.RUnlock()
+
+	number := header.Number.Uint64()
+	if finalized := chain.CurrentFinalizedBlock(); signFn == nil || (finalized != nil && finalized.NumberU64() >= number) {
+		return nil
+	}
+	powers, err := c.checkpointPowers(chain, header)
+	if err != nil {
+		return err
+	}
+	if _, ok := powers[val]; !ok {
+		return nil
+	}
+	votes, err := ReadCheckpointVotes(c.db, number, common.Hash{})
+	if err != nil {
+		return err
+	}
+	for _, vote := range votes {
+		if vote.Validator == val {
+			return nil
+		}
+	}
+	sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeCliqueVote, CheckpointVoteData(number, header.Hash()))
+	if err != nil {
+		return err
+	}
+	return c.AddCheckpointVote(chain, &CheckpointVote{Number: number, Hash: header.Hash(), Validator: val, Signature: sig})
+}
+
+// StartFinalityTracker starts following the head of the given chain, voting for
+// the new checkpoints with the local signer and tallying the votes collected for
+// them. The votes of the other validators are submitted through the API.
+func (c *Clique) StartFinalityTracker(chain FinalityChain) {
+	heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := chain.SubscribeChainHeadEvent(heads)
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		var last common.Hash // Latest checkpoint handled
+		for {
+			select {
+			case head := <-heads:
+				number := head.Block.NumberU64()
+				if number < voteInterval {
+					continue
+				}
+				header := chain.GetHeaderByNumber(number - number%voteInterval)
+				if header == nil || header.Hash() == last || !c.isCheckpoint(header.Number.Uint64()) {
+					continue
+				}
+				last = header.Hash()
+
+				if err := c.voteCheckpoint(chain, header); err != nil {
+					log.Warn("Failed to vote for checkpoint", "number", header.Number, "hash", last, "err", err)
+				}
+				// Votes may have been collected while the checkpoint was on a side chain
+				if err := c.updateFinality(chain, header); err != nil {
+					log.Debug("Failed to tally checkpoint votes", "number", header.Number, "err", err)
+				}
+
+			case <-sub.Err():
+				return
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
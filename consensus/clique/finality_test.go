@@ -0,0 +1,279 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// testerHeaderChain is a header chain backed by a map, used to walk back from a
+// head without a database.
+type testerHeaderChain struct {
+	config  *params.ChainConfig
+	headers map[common.Hash]*types.Header
+	head    *types.Header
+}
+
+func (c *testerHeaderChain) Config() *params.ChainConfig  { return c.config }
+func (c *testerHeaderChain) CurrentHeader() *types.Header { return c.head }
+func (c *testerHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return c.headers[hash]
+}
+func (c *testerHeaderChain) GetHeaderByNumber(number uint64) *types.Header { return nil }
+func (c *testerHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+func (c *testerHeaderChain) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
+
+// testerFinalityChain is a header chain with a canonical index, tracking its safe
+// and finalized blocks.
+type testerFinalityChain struct {
+	testerHeaderChain
+	canonical map[uint64]*types.Header
+	finalized *types.Block
+	safe      *types.Block
+	feed      event.Feed
+}
+
+func (c *testerFinalityChain) GetHeaderByNumber(number uint64) *types.Header {
+	return c.canonical[number]
+}
+func (c *testerFinalityChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	if header := c.headers[hash]; header != nil {
+		return types.NewBlockWithHeader(header)
+	}
+	return nil
+}
+func (c *testerFinalityChain) CurrentFinalizedBlock() *types.Block { return c.finalized }
+func (c *testerFinalityChain) CurrentSafeBlock() *types.Block      { return c.safe }
+func (c *testerFinalityChain) SetFinalized(block *types.Block)     { c.finalized = block }
+func (c *testerFinalityChain) SetSafe(block *types.Block)          { c.safe = block }
+func (c *testerFinalityChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// newTesterFinalityChain creates a canonical chain of the given length whose
+// genesis commits validators A, B, C and D with voting powers 3, 1, 1 and 1.
+func newTesterFinalityChain(accounts *testerAccountPool, length int) *testerFinalityChain {
+	config := &params.ChainConfig{ChaophrayaBlock: big.NewInt(1), Clique: &params.CliqueConfig{Epoch: 30000, Span: 100}}
+
+	extra := make([]byte, extraVanity)
+	for name, power := range map[string]uint64{"A": 3, "B": 1, "C": 1, "D": 1} {
+		extra = append(extra, (&ctypes.Validator{Address: accounts.address(name), VotingPower: power}).HeaderBytes()...)
+	}
+	extra = append(extra, make([]byte, ctypes.RegistryVersionAt(config, common.Big0).Size()+extraSeal)...)
+
+	chain := &testerFinalityChain{
+		testerHeaderChain: testerHeaderChain{config: config, headers: make(map[common.Hash]*types.Header)},
+		canonical:         make(map[uint64]*types.Header),
+	}
+	parent := &types.Header{Number: big.NewInt(0), Extra: extra}
+	chain.add(parent)
+	for i := 1; i <= length; i++ {
+		parent = &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(int64(i)), Extra: make([]byte, extraVanity+extraSeal)}
+		chain.add(parent)
+	}
+	return chain
+}
+
+// add inserts a header, making it canonical at its height.
+func (c *testerFinalityChain) add(header *types.Header) {
+	c.headers[header.Hash()] = header
+	c.canonical[header.Number.Uint64()] = header
+	c.head = header
+}
+
+// vote creates the vote of a tester account for the given checkpoint.
+func (ap *testerAccountPool) vote(header *types.Header, validator string) *CheckpointVote {
+	address := ap.address(validator)
+	data := CheckpointVoteData(header.Number.Uint64(), header.Hash())
+	sig, _ := crypto.Sign(crypto.Keccak256(data), ap.accounts[validator])
+	return &CheckpointVote{Number: header.Number.Uint64(), Hash: header.Hash(), Validator: address, Signature: sig}
+}
+
+func newFinalityTester(config *params.ChainConfig) *Clique {
+	checkpoints, _ := lru.NewARC(inmemoryCheckpoints)
+	return &Clique{config: config, db: rawdb.NewMemoryDatabase(), checkpoints: checkpoints, quit: make(chan struct{})}
+}
+
+func blockNumber(block *types.Block) uint64 {
+	if block == nil {
+		return 0
+	}
+	return block.NumberU64()
+}
+
+// Tests that checkpoints are made safe and final by the voting power of the span
+// validators which signed votes for them.
+func TestFinality(t *testing.T) {
+	accounts := newTesterAccountPool()
+	chain := newTesterFinalityChain(accounts, 50)
+	engine := newFinalityTester(chain.config)
+
+	// Malformed votes are rejected
+	side := &types.Header{ParentHash: chain.canonical[47].Hash(), Number: big.NewInt(48), Time: 1, Extra: make([]byte, extraVanity+extraSeal)}
+	forged := accounts.vote(chain.canonical[16], "B")
+	forged.Validator = accounts.address("A")
+
+	invalid := []struct {
+		vote *CheckpointVote
+		err  error
+	}{
+		{accounts.vote(chain.canonical[17], "A"), errNotCheckpoint},
+		{accounts.vote(side, "A"), errUnknownBlock},
+		{accounts.vote(chain.canonical[16], "E"), errUnauthorizedVoter},
+		{forged, errInvalidVoteSignature},
+	}
+	for i, tt := range invalid {
+		if err := engine.AddCheckpointVote(chain, tt.vote); err != tt.err {
+			t.Errorf("invalid vote %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	chain.headers[side.Hash()] = side
+
+	tests := []struct {
+		number    uint64
+		voter     string
+		safe      uint64
+		finalized uint64
+	}{
+		// B, C and D are most validators but only half of the voting power
+		{16, "B", 0, 0},
+		{16, "C", 0, 0},
+		{16, "D", 0, 0},
+		{16, "A", 16, 16},
+		// A holds half of the voting power, B makes it a majority, C over two thirds
+		{32, "A", 16, 16},
+		{32, "B", 32, 16},
+		{32, "C", 32, 32},
+	}
+	for i, tt := range tests {
+		if err := engine.AddCheckpointVote(chain, accounts.vote(chain.canonical[tt.number], tt.voter)); err != nil {
+			t.Fatalf("test %d: failed to add vote: %v", i, err)
+		}
+		if have := blockNumber(chain.safe); have != tt.safe {
+			t.Errorf("test %d: safe block mismatch: have %d, want %d", i, have, tt.safe)
+		}
+		if have := blockNumber(chain.finalized); have != tt.finalized {
+			t.Errorf("test %d: finalized block mismatch: have %d, want %d", i, have, tt.finalized)
+		}
+	}
+	if err := engine.AddCheckpointVote(chain, accounts.vote(chain.canonical[16], "A")); err != errStaleVote {
+		t.Errorf("stale vote error mismatch: have %v, want %v", err, errStaleVote)
+	}
+	// Votes for a side chain checkpoint are kept until it becomes canonical
+	for _, voter := range []string{"A", "B", "C"} {
+		if err := engine.AddCheckpointVote(chain, accounts.vote(side, voter)); err != nil {
+			t.Fatalf("failed to add side chain vote: %v", err)
+		}
+	}
+	if have := blockNumber(chain.finalized); have != 32 {
+		t.Errorf("side chain checkpoint finalized: have %d, want 32", have)
+	}
+	chain.add(side)
+	if err := engine.updateFinality(chain, side); err != nil {
+		t.Fatalf("failed to update finality: %v", err)
+	}
+	if chain.finalized == nil || chain.finalized.Hash() != side.Hash() {
+		t.Errorf("reorged in checkpoint not finalized: have %d", blockNumber(chain.finalized))
+	}
+	// The votes are persisted
+	reopened := newFinalityTester(chain.config)
+	reopened.db = engine.db
+
+	checkpoint, err := reopened.tallyCheckpoint(chain, chain.canonical[32])
+	if err != nil {
+		t.Fatalf("failed to tally persisted votes: %v", err)
+	}
+	if len(checkpoint.Voters) != 3 || checkpoint.Power != 5 || checkpoint.TotalPower != 6 {
+		t.Errorf("persisted tally mismatch: have %d voters, power %d/%d, want 3 voters, power 5/6", len(checkpoint.Voters), checkpoint.Power, checkpoint.TotalPower)
+	}
+}
+
+// Tests that the finality tracker votes once for the checkpoints reached by the
+// chain head with the local signer.
+func TestFinalityTracker(t *testing.T) {
+	testAccounts := newTesterAccountPool()
+	chain := newTesterFinalityChain(testAccounts, 20)
+	engine := newFinalityTester(chain.config)
+	defer close(engine.quit)
+
+	signed := make(chan uint64, 4)
+	engine.val = testAccounts.address("A")
+	engine.signFn = func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		number, _, err := ParseCheckpointVoteData(data)
+		if err != nil || mimeType != accounts.MimetypeCliqueVote {
+			t.Errorf("unexpected signing request: %s %x", mimeType, data)
+		}
+		signed <- number
+		return crypto.Sign(crypto.Keccak256(data), testAccounts.accounts["A"])
+	}
+	if err := engine.AddCheckpointVote(chain, testAccounts.vote(chain.canonical[16], "B")); err != nil {
+		t.Fatalf("failed to add vote: %v", err)
+	}
+	engine.StartFinalityTracker(chain)
+
+	for _, number := range []uint64{15, 17, 20} {
+		chain.feed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(chain.canonical[number])})
+	}
+	select {
+	case number := <-signed:
+		if number != 16 {
+			t.Fatalf("voted checkpoint mismatch: have %d, want 16", number)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("checkpoint not voted")
+	}
+	select {
+	case number := <-signed:
+		t.Fatalf("checkpoint %d voted twice", number)
+	case <-time.After(100 * time.Millisecond):
+	}
+	votes, err := ReadCheckpointVotes(engine.db, 16, chain.canonical[16].Hash())
+	if err != nil || len(votes) != 2 {
+		t.Fatalf("stored votes mismatch: have %d, want 2 (err %v)", len(votes), err)
+	}
+	// A and B hold exactly two thirds of the voting power, the checkpoint is only safe
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		engine.finalityLock.Lock()
+		safe, finalized := chain.safe, chain.finalized
+		engine.finalityLock.Unlock()
+
+		if finalized != nil {
+			t.Fatalf("checkpoint finalized without more than two thirds of the voting power: #%d", finalized.NumberU64())
+		}
+		if blockNumber(safe) == 16 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("safe block mismatch: have %d, want 16", blockNumber(safe))
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package lightclient verifies that Chaophraya proof-of-stake blocks were sealed
+// by the validators of their span without access to the chain. Starting from a
+// trusted span header, the validator sets of the following spans are trusted
+// once their span headers are proven to be sealed by the validators of the
+// span before, so bridges can follow the chain from its span headers alone.
+package lightclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
+	extraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signer seal
+
+	validatorBytesLength = common.AddressLength * 2 // Length of a validator and its power in a span header
+)
+
+var (
+	diffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
+	diffNoTurn = big.NewInt(1) // Block difficulty for out-of-turn signatures
+
+	// errNotPoSBlock is returned if a proof of a block before the Chaophraya fork
+	// is verified.
+	errNotPoSBlock = errors.New("block is not in proof-of-stake period")
+
+	// errHashMismatch is returned if the proven header doesn't hash to the hash
+	// claimed by the proof.
+	errHashMismatch = errors.New("header hash mismatch")
+
+	// errInvalidSignature is returned if the seal of the proven header is not a
+	// valid signature.
+	errInvalidSignature = errors.New("invalid seal signature")
+
+	// errWrongSpanHeader is returned if the span header of a proof is not the one
+	// committing the validators of the span of the proven block.
+	errWrongSpanHeader = errors.New("span header of a different span")
+
+	// errInvalidSpanHeader is returned if a span header doesn't carry the span
+	// validators and the system contract registry.
+	errInvalidSpanHeader = errors.New("invalid span header")
+
+	// errValidatorsMismatch is returned if the validators of a proof are not the
+	// ones committed in its span header.
+	errValidatorsMismatch = errors.New("validators mismatch span header")
+
+	// errUntrustedSpan is returned if the span header of a proof wasn't proven to
+	// the verifier yet.
+	errUntrustedSpan = errors.New("untrusted span header")
+
+	// errUnauthorizedSigner is returned if the proven header was sealed by neither
+	// a validator of its span nor the official node.
+	errUnauthorizedSigner = errors.New("unauthorized signer")
+
+	// errWrongDifficulty is returned if the difficulty of the proven header
+	// doesn't match the turn-ness of its sealer.
+	errWrongDifficulty = errors.New("wrong difficulty")
+
+	// errMissingParent is returned if the proof of a block sealed out of turn by
+	// the official node doesn't carry its parent header.
+	errMissingParent = errors.New("missing parent header")
+
+	// errOfficialTooEarly is returned if the official node sealed the proven
+	// block out of turn before its waiting time after the parent elapsed.
+	errOfficialTooEarly = errors.New("official node sealed before its waiting time")
+)
+
+// SealProof proves a block was sealed by a validator of its span. It carries the
+// signed part of the header, its seal and the span header committing the span
+// validators, so it can be verified without the chain. Blocks sealed out of turn
+// also carry their parent header, as the official node may only seal them once
+// its waiting time after the parent elapsed.
+type SealProof struct {
+	Number     uint64        `json:"number"`
+	Hash       common.Hash   `json:"hash"`
+	Header     hexutil.Bytes `json:"header"`           // Header without its seal, as signed by the sealer
+	Signature  hexutil.Bytes `json:"signature"`        // Seal of the header
+	Validators hexutil.Bytes `json:"validators"`       // Span validators and powers, as committed in the span header
+	SpanHeader hexutil.Bytes `json:"spanHeader"`       // RLP of the span header the validators were committed in
+	Parent     hexutil.Bytes `json:"parent,omitempty"` // RLP of the parent header of blocks sealed out of turn
+}
+
+// NewSealProof creates the proof of a header sealed by a validator of the span
+// committed in the given span header. sealRLP is the signed part of the header,
+// as returned by clique.CliqueRLP. The parent header is only included in the
+// proof if the block was sealed out of turn.
+func NewSealProof(config *params.ChainConfig, header *types.Header, sealRLP []byte, parent *types.Header, spanHeader *types.Header) (*SealProof, error) {
+	validators, err := spanValidators(config, spanHeader)
+	if err != nil {
+		return nil, err
+	}
+	span, err := rlp.EncodeToBytes(spanHeader)
+	if err != nil {
+		return nil, err
+	}
+	proof := &SealProof{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		Header:     sealRLP,
+		Signature:  common.CopyBytes(header.Extra[len(header.Extra)-extraSeal:]),
+		Validators: validators,
+		SpanHeader: span,
+	}
+	if header.Difficulty.Cmp(diffInTurn) != 0 {
+		if proof.Parent, err = rlp.EncodeToBytes(parent); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// header reassembles the proven header along with its seal.
+func (p *SealProof) header() (*types.Header, error) {
+	if len(p.Signature) != extraSeal {
+		return nil, errInvalidSignature
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(p.Header, header); err != nil {
+		return nil, fmt.Errorf("invalid header: %v", err)
+	}
+	header.Extra = append(header.Extra, p.Signature...)
+	if header.Hash() != p.Hash || header.Number == nil || header.Number.Uint64() != p.Number {
+		return nil, errHashMismatch
+	}
+	return header, nil
+}
+
+// signer recovers the sealer of the proven header.
+func (p *SealProof) signer() (common.Address, error) {
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(p.Header), p.Signature)
+	if err != nil {
+		return common.Address{}, errInvalidSignature
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// parent decodes the parent header carried by the proof, checking it is the
+// parent of the proven header.
+func (p *SealProof) parent(header *types.Header) (*types.Header, error) {
+	if len(p.Parent) == 0 {
+		return nil, errMissingParent
+	}
+	parent := new(types.Header)
+	if err := rlp.DecodeBytes(p.Parent, parent); err != nil {
+		return nil, fmt.Errorf("invalid parent header: %v", err)
+	}
+	if parent.Hash() != header.ParentHash || parent.Number == nil || parent.Number.Uint64()+1 != p.Number {
+		return nil, errHashMismatch
+	}
+	return parent, nil
+}
+
+// spanValidators returns the validator bytes committed in a span header.
+func spanValidators(config *params.ChainConfig, header *types.Header) ([]byte, error) {
+	size := len(header.Extra) - extraVanity - extraSeal - ctypes.RegistryVersionAt(config, header.Number).Size()
+	if size <= 0 || size%validatorBytesLength != 0 {
+		return nil, errInvalidSpanHeader
+	}
+	return common.CopyBytes(header.Extra[extraVanity : extraVanity+size]), nil
+}
+
+// spanRegistry returns the system contract registry committed in a span header.
+func spanRegistry(config *params.ChainConfig, header *types.Header) (ctypes.SystemContracts, error) {
+	version := ctypes.RegistryVersionAt(config, header.Number)
+	if len(header.Extra) < extraVanity+extraSeal+version.Size() {
+		return ctypes.SystemContracts{}, errInvalidSpanHeader
+	}
+	return version.Decode(header.Extra[len(header.Extra)-extraSeal-version.Size() : len(header.Extra)-extraSeal])
+}
+
+// spanStart returns the first block of the span the given block belongs to. The
+// first span starts at the Chaophraya block even if it is not aligned to the
+// span length.
+func spanStart(config *params.ChainConfig, number uint64) uint64 {
+	_, start, _ := config.Clique.SpanAt(number)
+	if fork := config.ChaophrayaBlock; fork != nil && start < fork.Uint64() {
+		start = fork.Uint64()
+	}
+	return start
+}
+
+// span is a validator set trusted by the verifier.
+type span struct {
+	number     uint64                      // Number of the span header committing the validators
+	validators []common.Address            // Validators in sealing order
+	signers    map[common.Address]struct{} // Validators for quick lookup
+	official   common.Address
+}
+
+// newSpan parses the validator set committed in a span header.
+func newSpan(config *params.ChainConfig, header *types.Header) (*span, error) {
+	blob, err := spanValidators(config, header)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := utils.ParseValidatorsAndPower(blob)
+	if err != nil {
+		return nil, errInvalidSpanHeader
+	}
+	contracts, err := spanRegistry(config, header)
+	if err != nil {
+		return nil, errInvalidSpanHeader
+	}
+	s := &span{
+		number:     header.Number.Uint64(),
+		validators: make([]common.Address, 0, len(validators)),
+		signers:    make(map[common.Address]struct{}, len(validators)),
+		official:   contracts.OfficialNode,
+	}
+	for _, validator := range validators {
+		s.validators = append(s.validators, validator.Address)
+		s.signers[validator.Address] = struct{}{}
+	}
+	return s, nil
+}
+
+// inturn returns whether the signer is in turn to seal the given block, as
+// scheduled by the engine.
+func (s *span) inturn(number uint64, signer common.Address) bool {
+	return s.validators[number%uint64(len(s.validators))] == signer
+}
+
+// Verifier checks seal proofs against the span headers it trusts.
+type Verifier struct {
+	config  *params.ChainConfig
+	trusted map[common.Hash]*span // Trusted span headers by hash
+}
+
+// NewVerifier creates a verifier trusting the given span header, usually the
+// last block before the Chaophraya fork or a span header obtained from a
+// trusted source.
+func NewVerifier(config *params.ChainConfig, anchor *types.Header) (*Verifier, error) {
+	v := &Verifier{config: config, trusted: make(map[common.Hash]*span)}
+	if err := v.trust(anchor); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// trust adds a span header to the trusted ones.
+func (v *Verifier) trust(header *types.Header) error {
+	s, err := newSpan(v.config, header)
+	if err != nil {
+		return err
+	}
+	v.trusted[header.Hash()] = s
+	return nil
+}
+
+// Verify checks the proof against the trusted span headers, returning the
+// sealer of the proven block.
+func (v *Verifier) Verify(proof *SealProof) (common.Address, error) {
+	if _, err := v.verify(proof); err != nil {
+		return common.Address{}, err
+	}
+	return proof.signer()
+}
+
+// verify checks the proof, returning the proven header.
+func (v *Verifier) verify(proof *SealProof) (*types.Header, error) {
+	if !v.config.IsChaophraya(new(big.Int).SetUint64(proof.Number)) {
+		return nil, errNotPoSBlock
+	}
+	header, err := proof.header()
+	if err != nil {
+		return nil, err
+	}
+	spanHeader := new(types.Header)
+	if err := rlp.DecodeBytes(proof.SpanHeader, spanHeader); err != nil {
+		return nil, fmt.Errorf("invalid span header: %v", err)
+	}
+	s, ok := v.trusted[spanHeader.Hash()]
+	if !ok {
+		return nil, errUntrustedSpan
+	}
+	if s.number+1 != spanStart(v.config, proof.Number) {
+		return nil, errWrongSpanHeader
+	}
+	validators, err := spanValidators(v.config, spanHeader)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(validators, proof.Validators) {
+		return nil, errValidatorsMismatch
+	}
+	signer, err := proof.signer()
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifySeal(s, proof, header, signer); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// verifySeal checks the sealer of the proven header against the schedule of its
+// span the way the engine does: the sealer must be a validator of the span or
+// the official node, the difficulty must match its turn-ness, and the official
+// node may only seal out of turn once its waiting time after the parent elapsed.
+func (v *Verifier) verifySeal(s *span, proof *SealProof, header *types.Header, signer common.Address) error {
+	if _, ok := s.signers[signer]; !ok && signer != s.official {
+		return errUnauthorizedSigner
+	}
+	inturn := s.inturn(proof.Number, signer)
+	if inturn && header.Difficulty.Cmp(diffInTurn) != 0 {
+		return errWrongDifficulty
+	}
+	if !inturn && header.Difficulty.Cmp(diffNoTurn) != 0 {
+		return errWrongDifficulty
+	}
+	if !inturn && signer == s.official && v.config.IsChaophrayaOfficial(header.Number) {
+		parent, err := proof.parent(header)
+		if err != nil {
+			return err
+		}
+		if header.Time < ctypes.OfficialTime(v.config.Clique, parent) {
+			return errOfficialTooEarly
+		}
+	}
+	return nil
+}
+
+// AddSpan verifies the proof of a span header, the last block of a span, and
+// trusts the validators it commits for the following span.
+func (v *Verifier) AddSpan(proof *SealProof) error {
+	header, err := v.verify(proof)
+	if err != nil {
+		return err
+	}
+	if spanStart(v.config, proof.Number+1) != proof.Number+1 {
+		return errInvalidSpanHeader
+	}
+	return v.trust(header)
+}
+
+// VerifyChain checks the proof of a block starting from a trusted span header,
+// following the proven span headers in between.
+func VerifyChain(config *params.ChainConfig, anchor *types.Header, spans []*SealProof, proof *SealProof) (common.Address, error) {
+	v, err := NewVerifier(config, anchor)
+	if err != nil {
+		return common.Address{}, err
+	}
+	for i, span := range spans {
+		if err := v.AddSpan(span); err != nil {
+			return common.Address{}, fmt.Errorf("span %d (block #%d): %w", i, span.Number, err)
+		}
+	}
+	return v.Verify(proof)
+}
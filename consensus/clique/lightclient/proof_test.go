@@ -0,0 +1,242 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package lightclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testChain seals headers on top of a trusted span header committing the given
+// validators, the way the engine lays them out.
+type testChain struct {
+	t        *testing.T
+	config   *params.ChainConfig
+	keys     []*ecdsa.PrivateKey // Validator keys, in sealing order
+	official *ecdsa.PrivateKey
+	outsider *ecdsa.PrivateKey
+	anchor   *types.Header
+}
+
+func newTestChain(t *testing.T) *testChain {
+	generate := func() *ecdsa.PrivateKey {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		return key
+	}
+	c := &testChain{
+		t: t,
+		config: &params.ChainConfig{
+			ChaophrayaBlock:         big.NewInt(8),
+			ChaophrayaOfficialBlock: big.NewInt(8),
+			Clique:                  &params.CliqueConfig{Period: 3, Epoch: 30000, Span: 8},
+		},
+		keys:     []*ecdsa.PrivateKey{generate(), generate(), generate()},
+		official: generate(),
+		outsider: generate(),
+	}
+	c.anchor = &types.Header{Number: big.NewInt(7), Time: 700, Difficulty: diffInTurn, Extra: c.spanExtra(7, c.keys)}
+	return c
+}
+
+// address returns the address of a key.
+func address(key *ecdsa.PrivateKey) common.Address {
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// spanExtra returns the unsealed extra-data of the span header with the given
+// number, committing the given validators and the system contract registry.
+func (c *testChain) spanExtra(number uint64, keys []*ecdsa.PrivateKey) []byte {
+	extra := make([]byte, extraVanity)
+	for _, key := range keys {
+		validator := &ctypes.Validator{Address: address(key), VotingPower: 1}
+		extra = append(extra, validator.HeaderBytes()...)
+	}
+	contracts := &ctypes.SystemContracts{OfficialNode: address(c.official)}
+	extra = append(extra, ctypes.RegistryVersionAt(c.config, new(big.Int).SetUint64(number)).Encode(contracts)...)
+	return append(extra, make([]byte, extraSeal)...)
+}
+
+// header creates the child of parent with the given difficulty and time offset.
+func (c *testChain) header(parent *types.Header, diff *big.Int, delay uint64) *types.Header {
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Time:       parent.Time + delay,
+		Difficulty: diff,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+}
+
+// seal signs the header with the given key, returning its signed part.
+func (c *testChain) seal(header *types.Header, key *ecdsa.PrivateKey) []byte {
+	unsealed := types.CopyHeader(header)
+	unsealed.Extra = unsealed.Extra[:len(unsealed.Extra)-extraSeal]
+	sealRLP, err := rlp.EncodeToBytes(unsealed)
+	if err != nil {
+		c.t.Fatalf("failed to encode header: %v", err)
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(sealRLP), key)
+	if err != nil {
+		c.t.Fatalf("failed to sign header: %v", err)
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+	return sealRLP
+}
+
+// proof seals the header with the given key and proves it against the span
+// header.
+func (c *testChain) proof(header *types.Header, key *ecdsa.PrivateKey, parent, span *types.Header) *SealProof {
+	sealRLP := c.seal(header, key)
+	proof, err := NewSealProof(c.config, header, sealRLP, parent, span)
+	if err != nil {
+		c.t.Fatalf("failed to create proof of block #%d: %v", header.Number, err)
+	}
+	return proof
+}
+
+// chain creates the headers on top of the anchor up to the given number, sealed
+// in turn.
+func (c *testChain) chain(number uint64) []*types.Header {
+	headers := []*types.Header{c.anchor}
+	for parent := c.anchor; parent.Number.Uint64() < number; parent = headers[len(headers)-1] {
+		header := c.header(parent, diffInTurn, c.config.Clique.Period)
+		c.seal(header, c.keys[header.Number.Uint64()%uint64(len(c.keys))])
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestVerifySeal(t *testing.T) {
+	c := newTestChain(t)
+	parent := c.chain(9)[2]
+
+	verifier, err := NewVerifier(c.config, c.anchor)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	inturn, noturn := c.keys[10%3], c.keys[(10+1)%3]
+	officialTime := ctypes.OfficialTime(c.config.Clique, parent) - parent.Time
+
+	tests := []struct {
+		name  string
+		key   *ecdsa.PrivateKey
+		diff  *big.Int
+		delay uint64
+		strip bool // Drop the parent header from the proof
+		err   error
+	}{
+		{name: "in-turn", key: inturn, diff: diffInTurn, delay: 3},
+		{name: "out-of-turn", key: noturn, diff: diffNoTurn, delay: 3},
+		{name: "outsider", key: c.outsider, diff: diffNoTurn, delay: 3, err: errUnauthorizedSigner},
+		{name: "in-turn with no-turn difficulty", key: inturn, diff: diffNoTurn, delay: 3, err: errWrongDifficulty},
+		{name: "out-of-turn with in-turn difficulty", key: noturn, diff: diffInTurn, delay: 3, err: errWrongDifficulty},
+		{name: "official", key: c.official, diff: diffNoTurn, delay: officialTime},
+		{name: "official too early", key: c.official, diff: diffNoTurn, delay: officialTime - 1, err: errOfficialTooEarly},
+		{name: "official without parent", key: c.official, diff: diffNoTurn, delay: officialTime, strip: true, err: errMissingParent},
+	}
+	for _, tt := range tests {
+		proof := c.proof(c.header(parent, tt.diff, tt.delay), tt.key, parent, c.anchor)
+		if tt.strip {
+			proof.Parent = nil
+		}
+		signer, err := verifier.Verify(proof)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && signer != address(tt.key) {
+			t.Errorf("%s: signer mismatch: have %x, want %x", tt.name, signer, address(tt.key))
+		}
+	}
+}
+
+func TestVerifySpans(t *testing.T) {
+	c := newTestChain(t)
+	headers := c.chain(14)
+
+	// Seal the span header committing the next validators
+	next := []*ecdsa.PrivateKey{c.keys[2], c.keys[0]}
+	spanHeader := c.header(headers[len(headers)-1], diffInTurn, 3)
+	spanHeader.Extra = c.spanExtra(15, next)
+	spanProof := c.proof(spanHeader, c.keys[15%3], nil, c.anchor)
+
+	verifier, err := NewVerifier(c.config, c.anchor)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	// Blocks past the trusted span fail until their span header is proven
+	header := c.header(spanHeader, diffInTurn, 3)
+	proof := c.proof(header, next[16%2], nil, spanHeader)
+	if _, err := verifier.Verify(proof); !errors.Is(err, errUntrustedSpan) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errUntrustedSpan)
+	}
+	// Span headers must be the last block of a span and sealed by its validators
+	if err := verifier.AddSpan(c.proof(types.CopyHeader(headers[5]), c.keys[12%3], nil, c.anchor)); !errors.Is(err, errInvalidSpanHeader) {
+		t.Errorf("mid-span header error mismatch: have %v, want %v", err, errInvalidSpanHeader)
+	}
+	if err := verifier.AddSpan(c.proof(types.CopyHeader(spanHeader), c.outsider, nil, c.anchor)); !errors.Is(err, errUnauthorizedSigner) {
+		t.Errorf("outsider span header error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if err := verifier.AddSpan(spanProof); err != nil {
+		t.Fatalf("failed to add span: %v", err)
+	}
+	if signer, err := verifier.Verify(proof); err != nil || signer != address(next[0]) {
+		t.Fatalf("proof verification mismatch: have %x, %v, want %x", signer, err, address(next[0]))
+	}
+	// Validators of the previous span may not seal in the new one
+	if _, err := verifier.Verify(c.proof(c.header(spanHeader, diffNoTurn, 3), c.keys[1], nil, spanHeader)); !errors.Is(err, errUnauthorizedSigner) {
+		t.Errorf("previous validator error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	// Proofs against the span header of another span fail
+	wrong := *proof
+	wrong.SpanHeader, wrong.Validators = spanProof.SpanHeader, spanProof.Validators
+	if _, err := verifier.Verify(&wrong); !errors.Is(err, errWrongSpanHeader) {
+		t.Errorf("wrong span error mismatch: have %v, want %v", err, errWrongSpanHeader)
+	}
+	// Validators not matching the span header fail
+	tampered := *proof
+	tampered.Validators = bytes.Repeat([]byte{0x01}, len(proof.Validators))
+	if _, err := verifier.Verify(&tampered); !errors.Is(err, errValidatorsMismatch) {
+		t.Errorf("tampered validators error mismatch: have %v, want %v", err, errValidatorsMismatch)
+	}
+	// Span headers with tampered validators are not trusted
+	forged := types.CopyHeader(spanHeader)
+	copy(forged.Extra[extraVanity:], address(c.outsider).Bytes())
+	blob, err := rlp.EncodeToBytes(forged)
+	if err != nil {
+		t.Fatalf("failed to encode span header: %v", err)
+	}
+	tampered = *proof
+	tampered.SpanHeader = blob
+	copy(tampered.Validators, address(c.outsider).Bytes())
+	if _, err := verifier.Verify(&tampered); !errors.Is(err, errUntrustedSpan) {
+		t.Errorf("tampered span header error mismatch: have %v, want %v", err, errUntrustedSpan)
+	}
+}
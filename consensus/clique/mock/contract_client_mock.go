@@ -85,9 +85,9 @@ func (mr *MockContractClientMockRecorder) GetCurrentSpan(arg0, arg1 interface{})
 }
 
 // GetCurrentValidators mocks base method.
-func (m *MockContractClient) GetCurrentValidators(arg0 common.Hash, arg1 *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error) {
+func (m *MockContractClient) GetCurrentValidators(arg0 context.Context, arg1 common.Hash, arg2 *big.Int) ([]*ctypes.Validator, *ctypes.SystemContracts, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCurrentValidators", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetCurrentValidators", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]*ctypes.Validator)
 	ret1, _ := ret[1].(*ctypes.SystemContracts)
 	ret2, _ := ret[2].(error)
@@ -95,24 +95,24 @@ func (m *MockContractClient) GetCurrentValidators(arg0 common.Hash, arg1 *big.In
 }
 
 // GetCurrentValidators indicates an expected call of GetCurrentValidators.
-func (mr *MockContractClientMockRecorder) GetCurrentValidators(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockContractClientMockRecorder) GetCurrentValidators(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentValidators", reflect.TypeOf((*MockContractClient)(nil).GetCurrentValidators), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentValidators", reflect.TypeOf((*MockContractClient)(nil).GetCurrentValidators), arg0, arg1, arg2)
 }
 
 // GetEligibleValidators mocks base method.
-func (m *MockContractClient) GetEligibleValidators(arg0 common.Hash, arg1 uint64) ([]*ctypes.Validator, error) {
+func (m *MockContractClient) GetEligibleValidators(arg0 context.Context, arg1 common.Hash, arg2 uint64) ([]*ctypes.Validator, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetEligibleValidators", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetEligibleValidators", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]*ctypes.Validator)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetEligibleValidators indicates an expected call of GetEligibleValidators.
-func (mr *MockContractClientMockRecorder) GetEligibleValidators(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockContractClientMockRecorder) GetEligibleValidators(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEligibleValidators", reflect.TypeOf((*MockContractClient)(nil).GetEligibleValidators), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEligibleValidators", reflect.TypeOf((*MockContractClient)(nil).GetEligibleValidators), arg0, arg1, arg2)
 }
 
 // Inject mocks base method.
@@ -128,18 +128,18 @@ func (mr *MockContractClientMockRecorder) Inject(arg0, arg1 interface{}) *gomock
 }
 
 // IsSlashed mocks base method.
-func (m *MockContractClient) IsSlashed(arg0 common.Address, arg1 consensus.ChainHeaderReader, arg2 common.Address, arg3 *big.Int, arg4 *types.Header) (bool, error) {
+func (m *MockContractClient) IsSlashed(arg0 context.Context, arg1 common.Address, arg2 consensus.ChainHeaderReader, arg3 common.Address, arg4 *big.Int, arg5 *types.Header) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsSlashed", arg0, arg1, arg2, arg3, arg4)
+	ret := m.ctrl.Call(m, "IsSlashed", arg0, arg1, arg2, arg3, arg4, arg5)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // IsSlashed indicates an expected call of IsSlashed.
-func (mr *MockContractClientMockRecorder) IsSlashed(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockContractClientMockRecorder) IsSlashed(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSlashed", reflect.TypeOf((*MockContractClient)(nil).IsSlashed), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSlashed", reflect.TypeOf((*MockContractClient)(nil).IsSlashed), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
 // SetSigner mocks base method.
@@ -167,3 +167,17 @@ func (mr *MockContractClientMockRecorder) Slash(arg0, arg1, arg2, arg3, arg4, ar
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Slash", reflect.TypeOf((*MockContractClient)(nil).Slash), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10, arg11)
 }
+
+// SlashDoubleSign mocks base method.
+func (m *MockContractClient) SlashDoubleSign(arg0, arg1 common.Address, arg2 *big.Int, arg3 []byte, arg4 *state.StateDB, arg5 *types.Header, arg6 core.ChainContext, arg7 *[]*types.Transaction, arg8 *[]*types.Receipt, arg9 *[]*types.Transaction, arg10 *uint64, arg11 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SlashDoubleSign", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10, arg11)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SlashDoubleSign indicates an expected call of SlashDoubleSign.
+func (mr *MockContractClientMockRecorder) SlashDoubleSign(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10, arg11 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SlashDoubleSign", reflect.TypeOf((*MockContractClient)(nil).SlashDoubleSign), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10, arg11)
+}
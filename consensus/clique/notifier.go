@@ -0,0 +1,148 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+const chainHeadChanSize = 10
+
+// ValidatorSetChange is the validator set of a new span, committed in the header
+// preceding the span.
+type ValidatorSetChange struct {
+	Span            uint64                 `json:"span"`        // Number of the span the validators seal, as by GetSpan and GetSpanValidators
+	StartBlock      uint64                 `json:"startBlock"`  // First block of the span
+	EndBlock        uint64                 `json:"endBlock"`    // Last block of the span
+	BlockNumber     uint64                 `json:"blockNumber"` // Header committing the validator set
+	BlockHash       common.Hash            `json:"blockHash"`   // Hash of the header committing the validator set
+	Validators      []*ctypes.Validator    `json:"validators"`
+	SystemContracts ctypes.SystemContracts `json:"systemContracts"`
+}
+
+// HeadChain is the chain validator set changes are tracked on.
+type HeadChain interface {
+	consensus.ChainHeaderReader
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// newValidatorSetChange parses the validator set change committed in the given
+// span header, the span being numbered as by the validator set contract.
+func newValidatorSetChange(config *params.ChainConfig, header *types.Header, span uint64) (*ValidatorSetChange, error) {
+	validators, err := parseSpanValidators(config, header)
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := parseSystemContracts(config, header)
+	if err != nil {
+		return nil, err
+	}
+	start, end := spanRange(config, header.Number.Uint64()+1)
+
+	return &ValidatorSetChange{
+		Span:            span,
+		StartBlock:      start,
+		EndBlock:        end,
+		BlockNumber:     header.Number.Uint64(),
+		BlockHash:       header.Hash(),
+		Validators:      validators,
+		SystemContracts: contracts,
+	}, nil
+}
+
+// validatorSetChange parses the validator set change committed in the given span
+// header, numbering the span it's committed for as GetSpan does.
+func (c *Clique) validatorSetChange(header *types.Header) (*ValidatorSetChange, error) {
+	ctx, cancel := c.callContext(nil, contractCallTimeout)
+	defer cancel()
+
+	next := &types.Header{ParentHash: header.Hash(), Number: new(big.Int).Add(header.Number, common.Big1)}
+	span, err := c.spanNumber(ctx, next)
+	if err != nil {
+		return nil, err
+	}
+	return newValidatorSetChange(c.config, header, span.Uint64())
+}
+
+// latestSpanHeader returns the number of the last header up to head committing
+// the validator set of a span, if any.
+func latestSpanHeader(config *params.ChainConfig, head uint64) (uint64, bool) {
+	if needToUpdateValidatorList(config, new(big.Int).SetUint64(head)) {
+		return head, true
+	}
+	if !config.IsChaophraya(new(big.Int).SetUint64(head)) {
+		return 0, false
+	}
+	start, _ := spanRange(config, head)
+	return start - 1, start > 0
+}
+
+// SubscribeValidatorSetChanges registers a subscription for the validator sets
+// committed in the canonical chain. Events are only delivered once the tracker
+// is started with StartValidatorSetTracker.
+func (c *Clique) SubscribeValidatorSetChanges(ch chan<- *ValidatorSetChange) event.Subscription {
+	return c.scope.Track(c.validatorSetFeed.Subscribe(ch))
+}
+
+// StartValidatorSetTracker starts following the head of the given chain, sending
+// the validator set of every new span to the subscribers. If the head moves over
+// several spans at once, e.g. while syncing, only the latest one is delivered.
+func (c *Clique) StartValidatorSetTracker(chain HeadChain) {
+	heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := chain.SubscribeChainHeadEvent(heads)
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		var last common.Hash
+		for {
+			select {
+			case head := <-heads:
+				number, ok := latestSpanHeader(c.config, head.Block.NumberU64())
+				if !ok {
+					continue
+				}
+				header := chain.GetHeaderByNumber(number)
+				if header == nil || header.Hash() == last {
+					continue
+				}
+				change, err := c.validatorSetChange(header)
+				if err != nil {
+					log.Warn("Failed to parse validator set change", "number", number, "err", err)
+					continue
+				}
+				last = header.Hash()
+				c.validatorSetFeed.Send(change)
+
+			case <-sub.Err():
+				return
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestValidatorSetChange(t *testing.T) {
+	config := &params.ChainConfig{
+		ChaophrayaBlock: big.NewInt(70),
+		Clique:          &params.CliqueConfig{Epoch: 30000, Span: 50},
+	}
+	var (
+		val       = &ctypes.Validator{Address: common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), VotingPower: 50}
+		contracts = ctypes.SystemContracts{
+			StakeManager: common.HexToAddress("0x0000000000000000000000000000000000001001"),
+			SlashManager: common.HexToAddress("0x0000000000000000000000000000000000001002"),
+			OfficialNode: common.HexToAddress("0x0000000000000000000000000000000000001003"),
+		}
+	)
+	extra := make([]byte, extraVanity)
+	extra = append(extra, val.HeaderBytes()...)
+	extra = append(extra, contracts.StakeManager.Bytes()...)
+	extra = append(extra, contracts.SlashManager.Bytes()...)
+	extra = append(extra, contracts.OfficialNode.Bytes()...)
+	extra = append(extra, make([]byte, extraSeal)...)
+
+	header := &types.Header{Number: big.NewInt(99), Extra: extra}
+	change, err := newValidatorSetChange(config, header, 1)
+	if err != nil {
+		t.Fatalf("failed to parse validator set change: %v", err)
+	}
+	contracts.Version = 1
+	want := &ValidatorSetChange{
+		Span:            1,
+		StartBlock:      100,
+		EndBlock:        149,
+		BlockNumber:     99,
+		BlockHash:       header.Hash(),
+		Validators:      []*ctypes.Validator{val},
+		SystemContracts: contracts,
+	}
+	if !reflect.DeepEqual(change, want) {
+		t.Errorf("validator set change mismatch: have %+v, want %+v", change, want)
+	}
+	// The span header is looked up from any head in the span
+	for head, want := range map[uint64]uint64{69: 69, 70: 69, 98: 69, 99: 99, 120: 99, 149: 149} {
+		if have, ok := latestSpanHeader(config, head); !ok || have != want {
+			t.Errorf("head %d: span header mismatch: have %d (%v), want %d", head, have, ok, want)
+		}
+	}
+	if _, ok := latestSpanHeader(config, 10); ok {
+		t.Errorf("span header found before the Chaophraya fork")
+	}
+}
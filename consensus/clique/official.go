@@ -0,0 +1,226 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// preemptionMaxAge is the number of blocks the sealed headers are kept in memory
+// to detect official node preemptions.
+const preemptionMaxAge = 1024
+
+var (
+	// errOfficialTooEarly is returned if the official node sealed a block out of
+	// turn before its waiting time after the parent elapsed.
+	errOfficialTooEarly = errors.New("official node sealed before its waiting time")
+
+	preemptionPrefix = []byte("clique-preemption-") // preemptionPrefix + num (uint64 big endian) + hash -> preemption
+
+	preemptionCounter = metrics.NewRegisteredCounter("clique/official/preemptions", nil)
+)
+
+// isOfficialSeal returns whether the block was sealed out of turn by the
+// official node.
+func (s *Snapshot) isOfficialSeal(number uint64, signer common.Address) bool {
+	return signer == s.SystemContracts.OfficialNode && !s.inturn(number, signer)
+}
+
+// verifyOfficialSeal checks that a block sealed out of turn by the official node
+// leaves the in-turn validator its waiting time after the parent.
+func (c *Clique) verifyOfficialSeal(snap *Snapshot, header, parent *types.Header) error {
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return err
+	}
+	if !snap.isOfficialSeal(header.Number.Uint64(), signer) {
+		return nil
+	}
+	if header.Time < ctypes.OfficialTime(c.config.Clique, parent) {
+		return errOfficialTooEarly
+	}
+	return nil
+}
+
+// Preemption is a block sealed out of turn by the official node, slashing the
+// in-turn validator, while a block sealed by the in-turn validator on the same
+// parent was seen.
+type Preemption struct {
+	Number    uint64         `json:"number"`
+	Validator common.Address `json:"validator"` // In-turn validator preempted by the official node
+	Official  *types.Header  `json:"official"`  // Header sealed by the official node
+	Inturn    *types.Header  `json:"inturn"`    // Header sealed by the in-turn validator
+}
+
+// preemptionKey = preemptionPrefix + num (uint64 big endian) + hash
+func preemptionKey(number uint64, hash common.Hash) []byte {
+	key := make([]byte, len(preemptionPrefix)+8+common.HashLength)
+	copy(key, preemptionPrefix)
+	binary.BigEndian.PutUint64(key[len(preemptionPrefix):], number)
+	copy(key[len(preemptionPrefix)+8:], hash[:])
+	return key
+}
+
+// ReadPreemptions retrieves the official node preemptions recorded at the heights
+// of the range [from, to], ordered by height.
+func ReadPreemptions(db ethdb.Iteratee, from, to uint64) ([]*Preemption, error) {
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, from)
+
+	it := db.NewIterator(preemptionPrefix, start)
+	defer it.Release()
+
+	var preemptions []*Preemption
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(preemptionPrefix)+8+common.HashLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(preemptionPrefix):]) > to {
+			break
+		}
+		preemption := new(Preemption)
+		if err := rlp.DecodeBytes(it.Value(), preemption); err != nil {
+			return nil, err
+		}
+		preemptions = append(preemptions, preemption)
+	}
+	return preemptions, it.Error()
+}
+
+// writePreemption stores an official node preemption, keyed by the height and
+// the hash of the official node block.
+func writePreemption(db ethdb.KeyValueWriter, preemption *Preemption) error {
+	blob, err := rlp.EncodeToBytes(preemption)
+	if err != nil {
+		return err
+	}
+	return db.Put(preemptionKey(preemption.Number, preemption.Official.Hash()), blob)
+}
+
+// preemptionPool collects the headers sealed on the recent parents by the
+// official node out of turn and by the in-turn validators, detecting official
+// node blocks competing with a valid in-turn sibling. The pool only matches the
+// siblings in memory, the detected preemptions are persisted by the engine.
+type preemptionPool struct {
+	official    map[common.Hash]*types.Header // Official node header by parent hash
+	inturn      map[common.Hash]*types.Header // In-turn header by parent hash
+	preemptions map[common.Hash]*Preemption   // Preemptions detected by parent hash
+	head        uint64                        // Highest height seen, to expire old entries
+
+	lock sync.RWMutex
+}
+
+// newPreemptionPool creates an empty official node preemption pool.
+func newPreemptionPool() *preemptionPool {
+	return &preemptionPool{
+		official:    make(map[common.Hash]*types.Header),
+		inturn:      make(map[common.Hash]*types.Header),
+		preemptions: make(map[common.Hash]*Preemption),
+	}
+}
+
+// add records a header sealed by the official node out of turn or by the
+// in-turn validator, returning the preemption if its sibling was already seen.
+func (p *preemptionPool) add(header *types.Header, official bool, validator common.Address) *Preemption {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	number := header.Number.Uint64()
+	if number+preemptionMaxAge < p.head {
+		return nil
+	}
+	if number > p.head {
+		p.head = number
+		p.expire()
+	}
+	parent := header.ParentHash
+	if _, ok := p.preemptions[parent]; ok {
+		return nil
+	}
+	if official {
+		if _, ok := p.official[parent]; !ok {
+			p.official[parent] = header
+		}
+	} else {
+		if _, ok := p.inturn[parent]; !ok {
+			p.inturn[parent] = header
+		}
+	}
+	officialHeader, inturnHeader := p.official[parent], p.inturn[parent]
+	if officialHeader == nil || inturnHeader == nil {
+		return nil
+	}
+	preemption := &Preemption{Number: number, Validator: validator, Official: officialHeader, Inturn: inturnHeader}
+	p.preemptions[parent] = preemption
+	return preemption
+}
+
+// expire drops the entries older than preemptionMaxAge. The caller must hold the
+// write lock.
+func (p *preemptionPool) expire() {
+	for parent, header := range p.official {
+		if header.Number.Uint64()+preemptionMaxAge < p.head {
+			delete(p.official, parent)
+		}
+	}
+	for parent, header := range p.inturn {
+		if header.Number.Uint64()+preemptionMaxAge < p.head {
+			delete(p.inturn, parent)
+		}
+	}
+	for parent, preemption := range p.preemptions {
+		if preemption.Number+preemptionMaxAge < p.head {
+			delete(p.preemptions, parent)
+		}
+	}
+}
+
+// auditOfficialSeal records a verified header sealed either out of turn by the
+// official node or by the in-turn validator, logging and persisting the official
+// node blocks sealed while an in-turn sibling existed.
+func (c *Clique) auditOfficialSeal(chain consensus.ChainHeaderReader, header *types.Header, signer common.Address) {
+	number := header.Number.Uint64()
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil || len(snap.Validators) == 0 {
+		return
+	}
+	official := snap.isOfficialSeal(number, signer)
+	if !official && (!snap.inturn(number, signer) || !isInturnDifficulty(header.Difficulty)) {
+		return
+	}
+	if preemption := c.preemptions.add(header, official, snap.getInturnSigner(number)); preemption != nil {
+		log.Warn("Official node sealed over an in-turn block", "number", number, "validator", preemption.Validator,
+			"official", preemption.Official.Hash(), "inturn", preemption.Inturn.Hash())
+		preemptionCounter.Inc(1)
+
+		if err := writePreemption(c.db, preemption); err != nil {
+			log.Error("Failed to store official node preemption", "number", number, "err", err)
+		}
+	}
+}
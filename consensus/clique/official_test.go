@@ -0,0 +1,180 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestVerifyOfficialSeal(t *testing.T) {
+	accounts := newTesterAccountPool()
+	config := &params.ChainConfig{
+		ChaophrayaBlock:         big.NewInt(0),
+		ChaophrayaOfficialBlock: big.NewInt(0),
+		Clique:                  &params.CliqueConfig{Period: 5, Span: 5},
+	}
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	engine := &Clique{config: config, signatures: signatures}
+
+	var (
+		a, b     = accounts.address("A"), accounts.address("B")
+		official = accounts.address("O")
+	)
+	snap := &Snapshot{
+		config:          config,
+		Validators:      []common.Address{a, b},
+		SystemContracts: ctypes.SystemContracts{OfficialNode: official},
+	}
+	parent := &types.Header{Number: big.NewInt(9), Time: 100}
+	if have, want := ctypes.OfficialTime(config.Clique, parent), 100+config.Clique.Period+ctypes.DefaultOfficialDelay; have != want {
+		t.Fatalf("official time mismatch: have %d, want %d", have, want)
+	}
+	tests := []struct {
+		signer string
+		time   uint64
+		err    error
+	}{
+		{"O", 105, errOfficialTooEarly},
+		{"O", 106, errOfficialTooEarly},
+		{"O", 107, nil},
+		{"B", 105, nil}, // in-turn validator is not delayed
+		{"A", 105, nil}, // backup sealers are checked separately
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: big.NewInt(10), Time: tt.time, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, tt.signer)
+		if err := engine.verifyOfficialSeal(snap, header, parent); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	config.Clique.OfficialDelay = 4
+	if have, want := ctypes.OfficialTime(config.Clique, parent), uint64(109); have != want {
+		t.Errorf("configured official time mismatch: have %d, want %d", have, want)
+	}
+}
+
+func TestPreemptionPool(t *testing.T) {
+	accounts := newTesterAccountPool()
+	header := func(number int64, parent common.Hash, signer string) *types.Header {
+		header := &types.Header{Number: big.NewInt(number), ParentHash: parent, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, signer)
+		return header
+	}
+	pool := newPreemptionPool()
+	inturn := accounts.address("A")
+
+	if p := pool.add(header(10, common.Hash{0x01}, "O"), true, inturn); p != nil {
+		t.Fatalf("preemption on first header: %+v", p)
+	}
+	if p := pool.add(header(10, common.Hash{0x02}, "A"), false, inturn); p != nil {
+		t.Fatalf("preemption on in-turn header of another parent: %+v", p)
+	}
+	p := pool.add(header(10, common.Hash{0x01}, "A"), false, inturn)
+	if p == nil {
+		t.Fatalf("preemption not detected")
+	}
+	if p.Validator != inturn || p.Number != 10 || p.Official.ParentHash != p.Inturn.ParentHash {
+		t.Errorf("preemption mismatch: %+v", p)
+	}
+	if p := pool.add(header(10, common.Hash{0x01}, "O"), true, inturn); p != nil {
+		t.Errorf("preemption reported twice: %+v", p)
+	}
+	// The in-turn block may also be seen first
+	pool.add(header(11, common.Hash{0x03}, "B"), false, accounts.address("B"))
+	if p := pool.add(header(11, common.Hash{0x03}, "O"), true, accounts.address("B")); p == nil {
+		t.Fatalf("preemption of an earlier in-turn block not detected")
+	}
+	if len(pool.preemptions) != 2 {
+		t.Fatalf("preemptions mismatch: have %d, want 2", len(pool.preemptions))
+	}
+	// Advance the pool past the audit age, the old entries must be dropped
+	pool.add(header(11+preemptionMaxAge+1, common.Hash{0x04}, "A"), false, inturn)
+	if len(pool.preemptions) != 0 || len(pool.official) != 0 || len(pool.inturn) != 1 {
+		t.Errorf("stale entries not expired: %d preemptions, %d official, %d in-turn", len(pool.preemptions), len(pool.official), len(pool.inturn))
+	}
+}
+
+// Tests that the detected preemptions are persisted and read back by height,
+// regardless of the entries expired from the in-memory pool.
+func TestPreemptionDatabase(t *testing.T) {
+	accounts := newTesterAccountPool()
+	header := func(number int64, parent common.Hash, signer string) *types.Header {
+		header := &types.Header{Number: big.NewInt(number), ParentHash: parent, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, signer)
+		return header
+	}
+	db := rawdb.NewMemoryDatabase()
+	pool := newPreemptionPool()
+
+	var written []*Preemption
+	for _, number := range []int64{10, 10, 12, 2000} {
+		parent := common.Hash{byte(len(written) + 1)}
+		pool.add(header(number, parent, "A"), false, accounts.address("A"))
+		preemption := pool.add(header(number, parent, "O"), true, accounts.address("A"))
+		if preemption == nil {
+			t.Fatalf("preemption at %d not detected", number)
+		}
+		if err := writePreemption(db, preemption); err != nil {
+			t.Fatalf("failed to write preemption: %v", err)
+		}
+		written = append(written, preemption)
+	}
+	tests := []struct {
+		from, to uint64
+		want     int
+	}{
+		{0, 9, 0},
+		{10, 10, 2},
+		{11, 12, 1},
+		{0, 3000, 4},
+		{2001, 3000, 0},
+	}
+	for i, tt := range tests {
+		preemptions, err := ReadPreemptions(db, tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to read preemptions: %v", i, err)
+		}
+		if len(preemptions) != tt.want {
+			t.Errorf("test %d: preemption count mismatch: have %d, want %d", i, len(preemptions), tt.want)
+		}
+		for _, preemption := range preemptions {
+			if preemption.Number < tt.from || preemption.Number > tt.to {
+				t.Errorf("test %d: preemption at %d out of range", i, preemption.Number)
+			}
+		}
+	}
+	// The preemptions expired from the pool must survive in the database
+	preemptions, err := ReadPreemptions(db, 12, 12)
+	if err != nil {
+		t.Fatalf("failed to read preemptions: %v", err)
+	}
+	if len(preemptions) != 1 {
+		t.Fatalf("expired preemption not persisted")
+	}
+	have, want := preemptions[0], written[2]
+	if have.Validator != want.Validator || have.Official.Hash() != want.Official.Hash() || have.Inturn.Hash() != want.Inturn.Hash() {
+		t.Errorf("persisted preemption mismatch: have %+v, want %+v", have, want)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// validatorSetContracts returns the validator set contracts of the config, which
+// receive the span commitments.
+func validatorSetContracts(config *params.CliqueConfig) []common.Address {
+	return []common.Address{config.ValidatorContract, config.ValidatorContractV2}
+}
+
+// validatorSetContractAt returns the validator set contract in use at the given
+// block.
+func validatorSetContractAt(config *params.ChainConfig, number *big.Int) common.Address {
+	if config.ChaophrayaBangkokBlock != nil && config.IsChaophrayaBangkok(number) {
+		return config.Clique.ValidatorContractV2
+	}
+	return config.Clique.ValidatorContract
+}
+
+// Registry is the system contract registry in effect at a block.
+type Registry struct {
+	Version      uint64                                   `json:"version"`
+	Contracts    map[ctypes.SystemContract]common.Address `json:"contracts"`
+	ValidatorSet common.Address                           `json:"validatorSet"` // Validator set contract receiving the span commitments
+}
+
+// registryEntries returns the addresses of the registry by contract name.
+func registryEntries(contracts *ctypes.SystemContracts) (map[ctypes.SystemContract]common.Address, error) {
+	version, err := ctypes.RegistryVersionOf(contracts)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[ctypes.SystemContract]common.Address, len(version.Contracts))
+	for _, name := range version.Contracts {
+		entries[name], _ = contracts.Address(name)
+	}
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// errMissingBlockBody is returned if the body or the receipts of a block aren't
+// available locally.
+var errMissingBlockBody = errors.New("missing block body")
+
+// Reward is the distribution of the fees collected in a single block.
+type Reward struct {
+	BlockNumber  uint64          `json:"blockNumber"`
+	BlockHash    common.Hash     `json:"blockHash"`
+	Validator    common.Address  `json:"validator"`    // Validator credited with the fees (block coinbase)
+	Amount       *hexutil.Big    `json:"amount"`       // Fees collected in the block and sent to the StakeManager
+	StakeManager common.Address  `json:"stakeManager"` // StakeManager the fees were distributed through
+	TxHash       *common.Hash    `json:"txHash"`       // Hash of the distributeReward system transaction, nil if no fees were collected
+	Status       *hexutil.Uint64 `json:"status"`       // Receipt status of the distributeReward call
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`      // Gas used by the distributeReward call
+}
+
+// ValidatorReward is the aggregate of the fees credited to a single validator.
+type ValidatorReward struct {
+	Blocks uint64       `json:"blocks"` // Number of blocks the validator was credited for
+	Amount *hexutil.Big `json:"amount"` // Total fees distributed for the validator
+}
+
+// RewardSummary is the aggregate of the fees distributed over a block range.
+type RewardSummary struct {
+	From       uint64                              `json:"fromBlock"`
+	To         uint64                              `json:"toBlock"`
+	Total      *hexutil.Big                        `json:"total"`
+	Validators map[common.Address]*ValidatorReward `json:"validators"`
+}
+
+// reward reconstructs the fee distribution of a block from its distributeReward
+// system transaction and the matching receipt.
+func (c *Clique) reward(chain consensus.ChainHeaderReader, header *types.Header) (*Reward, error) {
+	if !c.config.IsChaophraya(header.Number) {
+		return nil, errNotPoSBlock
+	}
+	number, hash := header.Number.Uint64(), header.Hash()
+
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	body := rawdb.ReadBody(c.db, hash, number)
+	if body == nil {
+		return nil, errMissingBlockBody
+	}
+	reward := &Reward{
+		BlockNumber:  number,
+		BlockHash:    hash,
+		Validator:    header.Coinbase,
+		Amount:       new(hexutil.Big),
+		StakeManager: snap.SystemContracts.StakeManager,
+	}
+	index := findRewardTx(body.Transactions, snap.SystemContracts.StakeManager, header.Coinbase, types.MakeSigner(c.config, header.Number))
+	if index < 0 {
+		return reward, nil
+	}
+	receipts := rawdb.ReadRawReceipts(c.db, hash, number)
+	if len(receipts) != len(body.Transactions) {
+		return nil, errMissingBlockBody
+	}
+	tx, receipt := body.Transactions[index], receipts[index]
+
+	txHash, status := tx.Hash(), hexutil.Uint64(receipt.Status)
+	reward.Amount = (*hexutil.Big)(tx.Value())
+	reward.TxHash = &txHash
+	reward.Status = &status
+
+	// Raw receipts only carry the cumulative gas, derive the gas of the call
+	gasUsed := receipt.CumulativeGasUsed
+	if index > 0 {
+		gasUsed -= receipts[index-1].CumulativeGasUsed
+	}
+	reward.GasUsed = hexutil.Uint64(gasUsed)
+	return reward, nil
+}
+
+// findRewardTx returns the index of the distributeReward system transaction sent
+// by the sealer to the StakeManager, or -1 if the block didn't distribute fees.
+// The system transactions are appended last, so the search starts at the end.
+func findRewardTx(txs types.Transactions, stakeManager, sealer common.Address, signer types.Signer) int {
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		if tx.To() == nil || *tx.To() != stakeManager || tx.GasPrice().Sign() != 0 {
+			continue
+		}
+		if !bytes.Equal(tx.Data(), distributeRewardSelector) {
+			continue
+		}
+		if from, err := types.Sender(signer, tx); err != nil || from != sealer {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// add accounts a block reward into the summary.
+func (s *RewardSummary) add(reward *Reward) {
+	validator, ok := s.Validators[reward.Validator]
+	if !ok {
+		validator = &ValidatorReward{Amount: new(hexutil.Big)}
+		s.Validators[reward.Validator] = validator
+	}
+	validator.Blocks++
+	validator.Amount = (*hexutil.Big)(new(big.Int).Add(validator.Amount.ToInt(), reward.Amount.ToInt()))
+	s.Total = (*hexutil.Big)(new(big.Int).Add(s.Total.ToInt(), reward.Amount.ToInt()))
+}
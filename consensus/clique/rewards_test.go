@@ -0,0 +1,89 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestFindRewardTx(t *testing.T) {
+	var (
+		sealerKey, _ = crypto.GenerateKey()
+		otherKey, _  = crypto.GenerateKey()
+		sealer       = crypto.PubkeyToAddress(sealerKey.PublicKey)
+		stakeManager = common.HexToAddress("0x0000000000000000000000000000000000001001")
+		signer       = types.NewEIP155Signer(big.NewInt(96))
+	)
+	sign := func(tx *types.Transaction, key *ecdsa.PrivateKey) *types.Transaction {
+		signed, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return signed
+	}
+	reward := types.NewTransaction(1, stakeManager, big.NewInt(100), systemTxGas, common.Big0, distributeRewardSelector)
+
+	tests := []struct {
+		txs  types.Transactions
+		want int
+	}{
+		{nil, -1},
+		{types.Transactions{sign(reward, sealerKey)}, 0},
+		// Regular transfer to the StakeManager
+		{types.Transactions{sign(types.NewTransaction(0, stakeManager, big.NewInt(1), 21000, big.NewInt(1), nil), sealerKey)}, -1},
+		// distributeReward called by someone else than the sealer
+		{types.Transactions{sign(reward, otherKey)}, -1},
+		// distributeReward sent by the sealer after regular transactions
+		{types.Transactions{sign(types.NewTransaction(0, stakeManager, big.NewInt(1), 21000, big.NewInt(1), nil), sealerKey), sign(reward, sealerKey)}, 1},
+	}
+	for i, tt := range tests {
+		if have := findRewardTx(tt.txs, stakeManager, sealer, signer); have != tt.want {
+			t.Errorf("test %d: reward tx index mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+}
+
+func TestRewardSummary(t *testing.T) {
+	var (
+		a = common.HexToAddress("0x000000000000000000000000000000000000000a")
+		b = common.HexToAddress("0x000000000000000000000000000000000000000b")
+	)
+	summary := &RewardSummary{Total: new(hexutil.Big), Validators: make(map[common.Address]*ValidatorReward)}
+	for _, reward := range []*Reward{
+		{Validator: a, Amount: (*hexutil.Big)(big.NewInt(10))},
+		{Validator: b, Amount: (*hexutil.Big)(big.NewInt(5))},
+		{Validator: a, Amount: new(hexutil.Big)},
+	} {
+		summary.add(reward)
+	}
+	if summary.Total.ToInt().Int64() != 15 {
+		t.Errorf("total mismatch: have %v, want 15", summary.Total)
+	}
+	if have := summary.Validators[a]; have.Blocks != 2 || have.Amount.ToInt().Int64() != 10 {
+		t.Errorf("validator a mismatch: have %d blocks, %v", have.Blocks, have.Amount)
+	}
+	if have := summary.Validators[b]; have.Blocks != 1 || have.Amount.ToInt().Int64() != 5 {
+		t.Errorf("validator b mismatch: have %d blocks, %v", have.Blocks, have.Amount)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	slashIndexSectionSize = 256                    // Number of blocks in a slash index section
+	slashIndexConfirms    = 64                     // Number of confirmations before a section is indexed
+	slashIndexThrottling  = 100 * time.Millisecond // Time to wait between processing two consecutive sections
+)
+
+var (
+	slashEventPrefix = []byte("clique-slash-")    // slashEventPrefix + num (uint64 big endian) -> slash events
+	slashIndexPrefix = []byte("clique-slashidx-") // slashIndexPrefix is the data table of the slash indexer
+
+	// slashSelector is the method id of slash(address,uint256) on the SlashManager.
+	slashSelector = crypto.Keccak256([]byte("slash(address,uint256)"))[:4]
+)
+
+// SlashEvent is a slashing of an in-turn validator executed by the official node
+// sealing a block out of turn.
+type SlashEvent struct {
+	Validator    common.Address `json:"validator"`    // Validator which has been slashed
+	Span         uint64         `json:"span"`         // Span the validator has been slashed in
+	BlockNumber  uint64         `json:"blockNumber"`  // Block containing the slash transaction
+	BlockHash    common.Hash    `json:"blockHash"`    // Hash of the block containing the slash transaction
+	TxHash       common.Hash    `json:"txHash"`       // Hash of the slash system transaction
+	OfficialNode common.Address `json:"officialNode"` // Official node which sealed the block
+}
+
+// slashEventKey = slashEventPrefix + num (uint64 big endian)
+func slashEventKey(number uint64) []byte {
+	key := make([]byte, len(slashEventPrefix)+8)
+	copy(key, slashEventPrefix)
+	binary.BigEndian.PutUint64(key[len(slashEventPrefix):], number)
+	return key
+}
+
+// ReadSlashEvents retrieves the slash events recorded in the canonical blocks of
+// the range [from, to].
+func ReadSlashEvents(db ethdb.Iteratee, from, to uint64) ([]*SlashEvent, error) {
+	it := db.NewIterator(slashEventPrefix, slashEventKey(from)[len(slashEventPrefix):])
+	defer it.Release()
+
+	var events []*SlashEvent
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(slashEventPrefix)+8 {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(slashEventPrefix):]) > to {
+			break
+		}
+		var blockEvents []*SlashEvent
+		if err := rlp.DecodeBytes(it.Value(), &blockEvents); err != nil {
+			return nil, err
+		}
+		events = append(events, blockEvents...)
+	}
+	return events, it.Error()
+}
+
+// writeSlashEvents stores the slash events of a single block.
+func writeSlashEvents(db ethdb.KeyValueWriter, number uint64, events []*SlashEvent) error {
+	blob, err := rlp.EncodeToBytes(events)
+	if err != nil {
+		return err
+	}
+	return db.Put(slashEventKey(number), blob)
+}
+
+// SlashIndexer implements a core.ChainIndexer, recording the slash events of the
+// canonical chain so they can be audited without decoding contract logs.
+type SlashIndexer struct {
+	db     ethdb.Database
+	chain  consensus.ChainHeaderReader
+	clique *Clique
+
+	section uint64                   // Section is the section number being processed currently
+	events  map[uint64][]*SlashEvent // Slash events of the section, grouped by block number
+}
+
+// NewSlashIndexer returns a chain indexer that records the slash events of the
+// canonical chain.
+func NewSlashIndexer(db ethdb.Database, chain consensus.ChainHeaderReader, clique *Clique) *core.ChainIndexer {
+	backend := &SlashIndexer{
+		db:     db,
+		chain:  chain,
+		clique: clique,
+	}
+	table := rawdb.NewTable(db, string(slashIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, slashIndexSectionSize, slashIndexConfirms, slashIndexThrottling, "slashes")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new slash index section.
+func (s *SlashIndexer) Reset(ctx context.Context, section uint64, prevHead common.Hash) error {
+	s.section, s.events = section, make(map[uint64][]*SlashEvent)
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, collecting the slash transactions
+// of a block sealed out of turn by the official node.
+func (s *SlashIndexer) Process(ctx context.Context, header *types.Header) error {
+	if !s.clique.config.IsChaophraya(header.Number) || !isNoturnDifficulty(header.Difficulty) {
+		return nil
+	}
+	number, hash := header.Number.Uint64(), header.Hash()
+
+	body := rawdb.ReadBody(s.db, hash, number)
+	if body == nil {
+		log.Warn("Missing block body for slash indexing", "number", number, "hash", hash)
+		return nil
+	}
+	snap, err := s.clique.snapshot(s.chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	sealer, err := s.clique.Author(header)
+	if err != nil {
+		return err
+	}
+	for _, tx := range body.Transactions {
+		validator, span, ok := parseSlashTx(tx, snap.SystemContracts.SlashManager)
+		if !ok {
+			continue
+		}
+		s.events[number] = append(s.events[number], &SlashEvent{
+			Validator:    validator,
+			Span:         span.Uint64(),
+			BlockNumber:  number,
+			BlockHash:    hash,
+			TxHash:       tx.Hash(),
+			OfficialNode: sealer,
+		})
+	}
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, replacing any slash events stored
+// for the section with the ones collected.
+func (s *SlashIndexer) Commit() error {
+	batch := s.db.NewBatch()
+
+	it := s.db.NewIterator(slashEventPrefix, slashEventKey(s.section * slashIndexSectionSize)[len(slashEventPrefix):])
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(slashEventPrefix)+8 {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(slashEventPrefix):]) >= (s.section+1)*slashIndexSectionSize {
+			break
+		}
+		batch.Delete(common.CopyBytes(key))
+	}
+	it.Release()
+
+	for number, events := range s.events {
+		if err := writeSlashEvents(batch, number, events); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (s *SlashIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// parseSlashTx decodes the slashed validator and span from a slash system
+// transaction sent to the given SlashManager.
+func parseSlashTx(tx *types.Transaction, slashManager common.Address) (common.Address, *big.Int, bool) {
+	if tx.To() == nil || *tx.To() != slashManager {
+		return common.Address{}, nil, false
+	}
+	data := tx.Data()
+	if len(data) != 4+2*common.HashLength || !bytes.Equal(data[:4], slashSelector) {
+		return common.Address{}, nil, false
+	}
+	validator := common.BytesToAddress(data[4 : 4+common.HashLength])
+	span := new(big.Int).SetBytes(data[4+common.HashLength:])
+	return validator, span, true
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/mock"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/golang/mock/gomock"
+)
+
+func TestParseSlashTx(t *testing.T) {
+	var (
+		slashManager = common.HexToAddress("0x0000000000000000000000000000000000001001")
+		validator    = common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032")
+	)
+	data := append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(validator.Bytes(), 32)...), common.LeftPadBytes(big.NewInt(7).Bytes(), 32)...)
+
+	tx := types.NewTransaction(0, slashManager, common.Big0, 0, common.Big0, data)
+	have, span, ok := parseSlashTx(tx, slashManager)
+	if !ok {
+		t.Fatal("slash transaction not detected")
+	}
+	if have != validator || span.Uint64() != 7 {
+		t.Errorf("slash mismatch: have %x/%d, want %x/%d", have, span, validator, 7)
+	}
+	if _, _, ok := parseSlashTx(tx, common.Address{}); ok {
+		t.Error("slash transaction to foreign contract detected")
+	}
+	tx = types.NewTransaction(0, slashManager, common.Big0, 0, common.Big0, data[:36])
+	if _, _, ok := parseSlashTx(tx, slashManager); ok {
+		t.Error("truncated slash transaction detected")
+	}
+}
+
+func TestReadSlashEvents(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	for _, number := range []uint64{10, 20, 300} {
+		events := []*SlashEvent{{Validator: common.BytesToAddress([]byte{byte(number)}), BlockNumber: number}}
+		if err := writeSlashEvents(db, number, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Add an unrelated key extending an event key within the range to ensure
+	// it's skipped
+	db.Put(append(slashEventKey(100), 0x00), []byte{0x01})
+
+	events, err := ReadSlashEvents(db, 15, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].BlockNumber != 20 || events[1].BlockNumber != 300 {
+		t.Fatalf("slash events mismatch: have %v", events)
+	}
+}
+
+// testerIndexerChain is a chain head feed driving a chain indexer.
+type testerIndexerChain struct {
+	head *types.Header
+	feed event.Feed
+}
+
+func (c *testerIndexerChain) CurrentHeader() *types.Header { return c.head }
+func (c *testerIndexerChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// setHead makes the given header the chain head, notifying the indexer.
+func (c *testerIndexerChain) setHead(header *types.Header) {
+	c.head = header
+	c.feed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(header)})
+}
+
+// Tests that the slash indexer records the slash events of the canonical chain
+// through the chain indexer, replacing the events of the reorged out blocks.
+func TestSlashIndexer(t *testing.T) {
+	var (
+		accounts     = newTesterAccountPool()
+		slashManager = common.HexToAddress("0x0000000000000000000000000000000000001001")
+		official     = accounts.address("official")
+	)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockContractClient := mock.NewMockContractClient(mockCtl)
+	mockContractClient.EXPECT().SetSigner(gomock.Any()).AnyTimes()
+
+	config := *params.TestChainConfig
+	config.ChaophrayaBlock = common.Big0
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 300, Span: 50}
+
+	db := rawdb.NewMemoryDatabase()
+	engine := New(&config, db, nil, mockContractClient)
+
+	genesis := &types.Header{Number: common.Big0, Difficulty: diffInTurn, Extra: make([]byte, extraVanity+extraSeal)}
+	rawdb.WriteHeader(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+
+	// generate extends the canonical chain with blocks sealed by the official
+	// node, the ones in slashes sealed out of turn and slashing the validator.
+	generate := func(parent *types.Header, count int, fork byte, slashes map[uint64]common.Address) *types.Header {
+		for i := 0; i < count; i++ {
+			header := &types.Header{
+				ParentHash: parent.Hash(),
+				Number:     new(big.Int).Add(parent.Number, common.Big1),
+				Difficulty: diffInTurn,
+				Time:       parent.Time + 1,
+				Extra:      make([]byte, extraVanity+extraSeal),
+			}
+			header.Extra[0] = fork
+
+			var txs []*types.Transaction
+			if validator, ok := slashes[header.Number.Uint64()]; ok {
+				data := append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(validator.Bytes(), 32)...), common.LeftPadBytes(header.Number.Bytes(), 32)...)
+				txs = append(txs, types.NewTransaction(0, slashManager, common.Big0, 0, common.Big0, data))
+
+				header.Difficulty = diffNoTurn
+				engine.recents.Add(parent.Hash(), &Snapshot{SystemContracts: ctypes.SystemContracts{SlashManager: slashManager, OfficialNode: official}})
+			}
+			accounts.sign(header, "official")
+
+			rawdb.WriteHeader(db, header)
+			rawdb.WriteBody(db, header.Hash(), header.Number.Uint64(), &types.Body{Transactions: txs})
+			rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+			parent = header
+		}
+		return parent
+	}
+	var (
+		slashedA = common.HexToAddress("0x000000000000000000000000000000000000000a")
+		slashedB = common.HexToAddress("0x000000000000000000000000000000000000000b")
+		slashedC = common.HexToAddress("0x000000000000000000000000000000000000000c")
+	)
+	chain := &testerIndexerChain{head: genesis}
+	indexer := NewSlashIndexer(db, &testerHeaderChain{config: &config}, engine)
+	indexer.Start(chain)
+	defer indexer.Close()
+
+	// Index a first section holding two slashes
+	fork := generate(genesis, 100, 0, map[uint64]common.Address{10: slashedA})
+	chain.setHead(generate(fork, slashIndexSectionSize+slashIndexConfirms-100, 0, map[uint64]common.Address{150: slashedB}))
+	waitSlashIndexer(t, db, indexer, 1)
+
+	checkSlashEvents(t, db, []*SlashEvent{{Validator: slashedA, BlockNumber: 10}, {Validator: slashedB, BlockNumber: 150}}, official)
+
+	// Reorg the second slash out, replacing it by another one
+	for n := fork.Number.Uint64() + 1; n <= chain.head.Number.Uint64(); n++ {
+		rawdb.DeleteCanonicalHash(db, n)
+	}
+	chain.setHead(generate(fork, slashIndexSectionSize+slashIndexConfirms-100+10, 1, map[uint64]common.Address{200: slashedC}))
+	waitSlashIndexer(t, db, indexer, 1)
+
+	checkSlashEvents(t, db, []*SlashEvent{{Validator: slashedA, BlockNumber: 10}, {Validator: slashedC, BlockNumber: 200}}, official)
+}
+
+// waitSlashIndexer waits until the indexer processed the given number of
+// sections up to the current canonical chain.
+func waitSlashIndexer(t *testing.T, db ethdb.Database, indexer *core.ChainIndexer, sections uint64) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		if stored, _, head := indexer.Sections(); stored == sections && head == rawdb.ReadCanonicalHash(db, sections*slashIndexSectionSize-1) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("slash indexer didn't process %d sections", sections)
+}
+
+// checkSlashEvents checks that the indexed slash events match the expected
+// validators and blocks, and were recorded from the canonical blocks.
+func checkSlashEvents(t *testing.T, db ethdb.Database, want []*SlashEvent, official common.Address) {
+	t.Helper()
+
+	have, err := ReadSlashEvents(db, 0, slashIndexSectionSize)
+	if err != nil {
+		t.Fatalf("failed to read slash events: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("slash event count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i, event := range have {
+		if event.Validator != want[i].Validator || event.BlockNumber != want[i].BlockNumber {
+			t.Errorf("slash event %d mismatch: have %x at %d, want %x at %d", i, event.Validator, event.BlockNumber, want[i].Validator, want[i].BlockNumber)
+		}
+		if event.BlockHash != rawdb.ReadCanonicalHash(db, event.BlockNumber) {
+			t.Errorf("slash event %d recorded from non-canonical block %x", i, event.BlockHash)
+		}
+		if event.OfficialNode != official || event.Span != event.BlockNumber {
+			t.Errorf("slash event %d mismatch: official node %x, span %d", i, event.OfficialNode, event.Span)
+		}
+	}
+}
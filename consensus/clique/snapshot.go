@@ -26,7 +26,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
-	"github.com/ethereum/go-ethereum/consensus/clique/utils"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
@@ -219,7 +218,7 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 	for i, header := range headers {
 		// Remove any votes on checkpoint blocks
 		number := header.Number.Uint64()
-		if number%s.config.Clique.Epoch == 0 {
+		if s.config.Clique.IsEpochStart(number) {
 			snap.Votes = nil
 			snap.Tally = make(map[common.Address]Tally)
 		}
@@ -325,24 +324,12 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 
 		if isNextBlockPoS(s.config, header.Number) {
 			if number > 0 && needToUpdateValidatorList(s.config, header.Number) {
-				posBytes := header.Extra[extraVanity : len(header.Extra)-extraSeal]
-				if len(posBytes) < contractBytesLength {
-					log.Error("posBytes error", "bytes", posBytes)
-					// panic("invalid consensus bytes")
-				}
-				validatorBytes := posBytes[:len(posBytes)-contractBytesLength]
-				addressBytes := posBytes[len(posBytes)-contractBytesLength:]
-				contracts, err := ParseAddressBytes(addressBytes)
+				// get validators and system contracts from headers and use that for new validator set
+				newValArr, err := parseSpanValidators(s.config, header)
 				if err != nil {
-					log.Error("posBytes error", "posBytes", posBytes, "validatorBytes", validatorBytes, "addressBytes", addressBytes)
-					// panic(err)
-				}
-				if len(contracts) < totalPosContracts {
-					log.Error("some PoS contracts are missing", "require", totalPosContracts, "have", len(contracts), "contracts", contracts)
+					return nil, err
 				}
-				// get validators from headers and use that for new validator set
-				newValArr, err := utils.ParseValidatorsAndPower(validatorBytes)
-
+				contracts, err := parseSystemContracts(s.config, header)
 				if err != nil {
 					return nil, err
 				}
@@ -363,9 +350,7 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 
 				snap.Signers = newVals
 				snap.Validators = validators
-				snap.SystemContracts.StakeManager = *contracts[0]
-				snap.SystemContracts.SlashManager = *contracts[1]
-				snap.SystemContracts.OfficialNode = *contracts[2]
+				snap.SystemContracts = contracts
 			}
 		}
 		// If we're taking too much time (ecrecover), notify the user once a while
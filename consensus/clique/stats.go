@@ -0,0 +1,170 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// livenessWindow is the maximum number of canonical blocks accounted for on a
+// single head event, bounding the work after a long sync.
+const livenessWindow = 1024
+
+var (
+	officialSealCounter = metrics.NewRegisteredCounter("clique/official/sealed", nil)
+	backupSealCounter   = metrics.NewRegisteredCounter("clique/backup/sealed", nil)
+	slashCounter        = metrics.NewRegisteredCounter("clique/slashed", nil)
+)
+
+// ValidatorRecord is the sealing record of a single validator.
+type ValidatorRecord struct {
+	Inturn  uint64 `json:"inturn"`  // Number of blocks sealed in turn
+	Missed  uint64 `json:"missed"`  // Number of in-turn slots sealed by the official node or a backup sealer instead
+	Slashed uint64 `json:"slashed"` // Number of times the validator has been slashed
+}
+
+// ValidatorStats is the sealing record of all validators over a block range.
+type ValidatorStats struct {
+	From         uint64                              `json:"fromBlock"`
+	To           uint64                              `json:"toBlock"`
+	OfficialNode uint64                              `json:"officialNode"` // Number of blocks sealed by the official node
+	Backup       uint64                              `json:"backup"`       // Number of blocks sealed by backup sealers
+	Validators   map[common.Address]*ValidatorRecord `json:"validators"`
+}
+
+// LivenessChain is the chain the validator liveness metrics are collected on.
+type LivenessChain interface {
+	HeadChain
+	GetBlock(hash common.Hash, number uint64) *types.Block
+}
+
+// validatorCounter retrieves the counter of the given kind for a validator,
+// registering it on first use.
+func validatorCounter(validator common.Address, kind string) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("clique/validators/%s/%s", strings.ToLower(validator.Hex()), kind), nil)
+}
+
+// markInturn records a block sealed in turn by the given validator.
+func markInturn(validator common.Address) {
+	validatorCounter(validator, "inturn").Inc(1)
+}
+
+// markMissed records an in-turn slot of the given validator sealed by the
+// official node or a backup sealer instead.
+func markMissed(validator common.Address) {
+	validatorCounter(validator, "missed").Inc(1)
+}
+
+// markSlashed records a slashing of the given validator.
+func markSlashed(validator common.Address) {
+	validatorCounter(validator, "slashed").Inc(1)
+	slashCounter.Inc(1)
+}
+
+// markSealed records the sealing of a block which became part of the canonical
+// chain, along with the slashes it executes.
+func (c *Clique) markSealed(chain consensus.ChainHeaderReader, block *types.Block) error {
+	header := block.Header()
+	if !c.config.IsChaophraya(header.Number) {
+		return nil
+	}
+	number := header.Number.Uint64()
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	sealer, err := c.Author(header)
+	if err != nil {
+		return err
+	}
+	if isInturnDifficulty(header.Difficulty) {
+		markInturn(sealer)
+	} else {
+		markMissed(snap.getInturnSigner(number))
+		if sealer == snap.SystemContracts.OfficialNode {
+			officialSealCounter.Inc(1)
+		} else {
+			backupSealCounter.Inc(1)
+		}
+	}
+	for _, tx := range block.Transactions() {
+		if validator, _, ok := parseSlashTx(tx, snap.SystemContracts.SlashManager); ok {
+			markSlashed(validator)
+			continue
+		}
+		if !isSlashDoubleSign(tx, snap.SystemContracts.SlashManager) {
+			continue
+		}
+		if validator, _, _, err := unpackSlashDoubleSign(tx.Data()[4:]); err == nil {
+			markSlashed(validator)
+		}
+	}
+	return nil
+}
+
+// StartLivenessTracker starts following the head of the given chain, recording
+// the validator liveness metrics of every block becoming canonical. Blocks are
+// only accounted for once they are part of the canonical chain, so side chains
+// and re-executions don't count. Nothing is tracked if metrics are disabled.
+func (c *Clique) StartLivenessTracker(chain LivenessChain) {
+	if !metrics.Enabled {
+		return
+	}
+	heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := chain.SubscribeChainHeadEvent(heads)
+
+	counted, _ := lru.New(livenessWindow)
+	counted.Add(chain.CurrentHeader().Hash(), nil)
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case head := <-heads:
+				// Collect the new canonical blocks down to the last one counted
+				var blocks []*types.Block
+				for block := head.Block; block != nil && block.NumberU64() > 0 && len(blocks) < livenessWindow; block = chain.GetBlock(block.ParentHash(), block.NumberU64()-1) {
+					if counted.Contains(block.Hash()) {
+						break
+					}
+					blocks = append(blocks, block)
+				}
+				for i := len(blocks) - 1; i >= 0; i-- {
+					if err := c.markSealed(chain, blocks[i]); err != nil {
+						log.Debug("Failed to record validator liveness", "number", blocks[i].Number(), "err", err)
+					}
+					counted.Add(blocks[i].Hash(), nil)
+				}
+
+			case <-sub.Err():
+				return
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestMarkSealed(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	config := &params.ChainConfig{
+		ChaophrayaBlock: big.NewInt(1),
+		Clique:          &params.CliqueConfig{Epoch: 30000, Span: 100},
+	}
+	accounts := newTesterAccountPool()
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	engine := &Clique{config: config, recents: recents, signatures: signatures}
+
+	var (
+		a, b, c      = accounts.address("LA"), accounts.address("LB"), accounts.address("LC")
+		slashManager = common.HexToAddress("0x0000000000000000000000000000000000001002")
+		snap         = &Snapshot{
+			config:     config,
+			Validators: []common.Address{a, b, c},
+			SystemContracts: ctypes.SystemContracts{
+				SlashManager: slashManager,
+				OfficialNode: accounts.address("LO"),
+			},
+		}
+		chain = &testerHeaderChain{config: config, headers: make(map[common.Hash]*types.Header)}
+	)
+	// Block 1 is sealed in turn by B, block 2 by the official node slashing C
+	// and block 3 by backup sealer B instead of A
+	parent := &types.Header{Number: big.NewInt(0)}
+	recents.Add(parent.Hash(), snap)
+
+	slash := append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(c.Bytes(), 32)...), common.LeftPadBytes([]byte{1}, 32)...)
+	for i, seal := range []struct {
+		signer     string
+		difficulty *big.Int
+		txs        []*types.Transaction
+	}{
+		{"LB", diffInTurn, nil},
+		{"LO", diffNoTurn, []*types.Transaction{types.NewTransaction(0, slashManager, common.Big0, 0, common.Big0, slash)}},
+		{"LB", diffNoTurn, nil},
+	} {
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(int64(i + 1)), Difficulty: seal.difficulty, Extra: make([]byte, extraVanity+extraSeal)}
+		accounts.sign(header, seal.signer)
+		recents.Add(header.Hash(), snap)
+
+		if err := engine.markSealed(chain, types.NewBlockWithHeader(header).WithBody(seal.txs, nil)); err != nil {
+			t.Fatalf("block %d: failed to record liveness: %v", i+1, err)
+		}
+		parent = header
+	}
+	for _, tt := range []struct {
+		validator common.Address
+		kind      string
+		want      int64
+	}{
+		{a, "missed", 1},
+		{b, "inturn", 1},
+		{b, "missed", 0},
+		{c, "missed", 1},
+		{c, "slashed", 1},
+	} {
+		if have := validatorCounter(tt.validator, tt.kind).Count(); have != tt.want {
+			t.Errorf("validator %x: %s count mismatch: have %d, want %d", tt.validator, tt.kind, have, tt.want)
+		}
+	}
+}
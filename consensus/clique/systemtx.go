@@ -0,0 +1,282 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// systemTxGas is the gas allowance of every system transaction.
+const systemTxGas = math.MaxUint64 / 2
+
+var (
+	// distributeRewardSelector is the method id of distributeReward() on the StakeManager.
+	distributeRewardSelector = crypto.Keccak256([]byte("distributeReward()"))[:4]
+
+	// errMalformedSystemTx is returned if a system transaction signing request
+	// doesn't match any of the system transactions the consensus engine issues.
+	errMalformedSystemTx = errors.New("malformed system transaction")
+
+	// errUnknownSystemContract is returned if a system transaction signing request
+	// targets a contract which isn't a known system contract.
+	errUnknownSystemContract = errors.New("unknown system contract")
+)
+
+// SystemTx is a system transaction as presented for signing with the
+// accounts.MimetypeCliqueSystemTx content type. Its RLP encoding is the EIP-155
+// signing preimage of the transaction, so signing keccak256 of the encoding
+// yields the transaction signature.
+type SystemTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       *common.Address `rlp:"nil"`
+	Value    *big.Int
+	Data     []byte
+	ChainID  *big.Int
+	R, S     uint // EIP-155 placeholders, always zero
+}
+
+// SystemTxRLP returns the signing preimage of a system transaction.
+func SystemTxRLP(tx *types.Transaction, chainID *big.Int) ([]byte, error) {
+	return rlp.EncodeToBytes(&SystemTx{
+		Nonce:    tx.Nonce(),
+		GasPrice: tx.GasPrice(),
+		Gas:      tx.Gas(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+		ChainID:  chainID,
+	})
+}
+
+// DecodeSystemTx decodes the signing preimage of a system transaction.
+func DecodeSystemTx(data []byte) (*SystemTx, error) {
+	tx := new(SystemTx)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return nil, err
+	}
+	if tx.R != 0 || tx.S != 0 {
+		return nil, errMalformedSystemTx
+	}
+	return tx, nil
+}
+
+// Verify checks that the transaction is a well-formed system transaction sent
+// to one of the given contracts, returning the name of the called method.
+func (tx *SystemTx) Verify(contracts map[common.Address]struct{}) (string, error) {
+	if tx.To == nil {
+		return "", errMalformedSystemTx
+	}
+	if _, ok := contracts[*tx.To]; !ok {
+		return "", errUnknownSystemContract
+	}
+	if tx.GasPrice == nil || tx.GasPrice.Sign() != 0 || tx.Gas != systemTxGas || tx.Value == nil || len(tx.Data) < 4 {
+		return "", errMalformedSystemTx
+	}
+	switch selector := tx.Data[:4]; {
+	case bytes.Equal(selector, slashSelector):
+		if len(tx.Data) < 4+2*common.HashLength || tx.Value.Sign() != 0 {
+			return "", errMalformedSystemTx
+		}
+		// Double sign slashes carry the evidence past the slash arguments
+		if len(tx.Data) > 4+2*common.HashLength {
+			return "slashDoubleSign", nil
+		}
+		return "slash", nil
+
+	case bytes.Equal(selector, commitSpanSelector):
+		if tx.Value.Sign() != 0 {
+			return "", errMalformedSystemTx
+		}
+		if _, err := unpackCommitSpan(tx.Data[4:]); err != nil {
+			return "", err
+		}
+		return "commitSpan", nil
+
+	case bytes.Equal(selector, distributeRewardSelector):
+		if len(tx.Data) != 4 {
+			return "", errMalformedSystemTx
+		}
+		return "distributeReward", nil
+
+	default:
+		return "", fmt.Errorf("%w: unknown method %x", errMalformedSystemTx, selector)
+	}
+}
+
+// SigHash returns the signature hash of the system transaction along with the
+// preimage it's computed from.
+func (tx *SystemTx) SigHash() (common.Hash, []byte, error) {
+	blob, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return crypto.Keccak256Hash(blob), blob, nil
+}
+
+// SystemTxSignerFn wraps a data signer into a system transaction signer, which
+// presents the transactions with the accounts.MimetypeCliqueSystemTx content
+// type. This allows signers which refuse arbitrary transactions, like clef with
+// a ruleset, to tell the system transactions apart.
+func SystemTxSignerFn(signFn ctypes.SignerFn) ctypes.SignerTxFn {
+	return func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		if tx.Type() != types.LegacyTxType {
+			return nil, errMalformedSystemTx
+		}
+		preimage, err := SystemTxRLP(tx, chainID)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := signFn(account, accounts.MimetypeCliqueSystemTx, preimage)
+		if err != nil {
+			return nil, err
+		}
+		return tx.WithSignature(types.NewEIP155Signer(chainID), sig)
+	}
+}
+
+var (
+	// errSystemTxSender is returned if a received system transaction isn't sent
+	// by the coinbase of the block.
+	errSystemTxSender = errors.New("system transaction not sent by the coinbase")
+
+	// errSystemTxGasPrice is returned if a received system transaction has a
+	// non-zero gas price.
+	errSystemTxGasPrice = errors.New("system transaction with non-zero gas price")
+
+	// errSystemTxCalldata is returned if the calldata of a received system
+	// transaction doesn't match the call it's expected to make.
+	errSystemTxCalldata = errors.New("invalid system transaction calldata")
+
+	// errSystemTxRecipient is returned if a received system transaction is sent to
+	// another system contract than the one its method belongs to.
+	errSystemTxRecipient = errors.New("system transaction sent to the wrong contract")
+
+	// errSystemTxOrder is returned if the received system transactions aren't in
+	// the order the consensus engine issues them.
+	errSystemTxOrder = errors.New("system transactions out of order")
+
+	// errUnexpectedSystemTx is returned if a block carries a system transaction
+	// the consensus engine doesn't issue for it.
+	errUnexpectedSystemTx = errors.New("unexpected system transaction")
+
+	// errExtraSystemTxs is returned if received system transactions are left over
+	// after all the system calls of a block were applied.
+	errExtraSystemTxs = errors.New("unconsumed system transactions")
+)
+
+// systemCall is a kind of system transaction a block may carry.
+type systemCall struct {
+	method   string
+	contract common.Address // Contract the method is called on
+	max      int            // Maximum number of calls in the block, zero if not allowed
+}
+
+// systemCalls returns the system calls the block may carry, in the order the
+// consensus engine issues them.
+func (c *Clique) systemCalls(header *types.Header, snap *Snapshot) []systemCall {
+	calls := []systemCall{
+		{method: "commitSpan", contract: validatorSetContractAt(c.config, header.Number)},
+		{method: "slash", contract: snap.SystemContracts.SlashManager},
+		{method: "slashDoubleSign", contract: snap.SystemContracts.SlashManager},
+		{method: "distributeReward", contract: snap.SystemContracts.StakeManager, max: 1},
+	}
+	if isSpanCommitmentBlock(c.config, header.Number) {
+		calls[0].max = 1
+	}
+	if !isInturnDifficulty(header.Difficulty) && header.Coinbase == snap.SystemContracts.OfficialNode {
+		calls[1].max = 1
+	}
+	if c.config.IsChaophrayaEvidence(header.Number) && header.Coinbase == snap.SystemContracts.OfficialNode {
+		calls[2].max = maxEvidencePerBlock
+	}
+	return calls
+}
+
+// verifySystemTxs checks the structure of the system transactions received with
+// a block before any of them is applied: each must be sent by the coinbase with
+// a zero gas price, to the contract of its method, with well-formed calldata,
+// and the calls must come in the order and number the engine issues them.
+func (c *Clique) verifySystemTxs(header *types.Header, snap *Snapshot, txs []*types.Transaction) error {
+	var (
+		calls  = c.systemCalls(header, snap)
+		counts = make([]int, len(calls))
+		known  = make(map[common.Address]struct{})
+		last   int
+	)
+	for _, call := range calls {
+		known[call.contract] = struct{}{}
+	}
+	for i, tx := range txs {
+		fail := func(err error) error {
+			return fmt.Errorf("system tx %d (%s): %w", i, tx.Hash().TerminalString(), err)
+		}
+		if sender, err := types.Sender(c.signer, tx); err != nil || sender != header.Coinbase {
+			return fail(errSystemTxSender)
+		}
+		if tx.GasPrice().Sign() != 0 {
+			return fail(errSystemTxGasPrice)
+		}
+		if tx.Type() != types.LegacyTxType {
+			return fail(errSystemTxCalldata)
+		}
+		method, err := (&SystemTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: tx.GasPrice(),
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		}).Verify(known)
+		if err != nil {
+			return fail(fmt.Errorf("%w: %v", errSystemTxCalldata, err))
+		}
+		index := 0
+		for calls[index].method != method {
+			index++
+		}
+		call := calls[index]
+		switch {
+		case index < last:
+			return fail(fmt.Errorf("%w: %s after %s", errSystemTxOrder, method, calls[last].method))
+		case counts[index] == call.max:
+			return fail(fmt.Errorf("%w: %s", errUnexpectedSystemTx, method))
+		case *tx.To() != call.contract:
+			return fail(fmt.Errorf("%w: %s on %x, want %x", errSystemTxRecipient, method, *tx.To(), call.contract))
+		}
+		if method == "slash" {
+			if validator, _, _ := parseSlashTx(tx, call.contract); validator != snap.getInturnSigner(header.Number.Uint64()) {
+				return fail(fmt.Errorf("%w: slash of %x, not the in-turn validator", errSystemTxCalldata, validator))
+			}
+		}
+		counts[index]++
+		last = index
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSystemTxSignerFn(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(96)
+
+	// Sign the way a keystore or clef does, hashing the presented data
+	signFn := func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		if mimeType != accounts.MimetypeCliqueSystemTx {
+			t.Fatalf("mimetype mismatch: have %s, want %s", mimeType, accounts.MimetypeCliqueSystemTx)
+		}
+		return crypto.Sign(crypto.Keccak256(data), key)
+	}
+	slashManager := common.HexToAddress("0x0000000000000000000000000000000000001002")
+	data := append(append(append([]byte{}, slashSelector...), common.LeftPadBytes(addr.Bytes(), 32)...), common.LeftPadBytes([]byte{7}, 32)...)
+	tx := types.NewTransaction(3, slashManager, common.Big0, systemTxGas, common.Big0, data)
+
+	signed, err := SystemTxSignerFn(signFn)(accounts.Account{Address: addr}, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign system transaction: %v", err)
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), signed)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if sender != addr {
+		t.Errorf("sender mismatch: have %x, want %x", sender, addr)
+	}
+	// Ensure the signing side sees the same transaction and accepts it
+	preimage, _ := SystemTxRLP(tx, chainID)
+	decoded, err := DecodeSystemTx(preimage)
+	if err != nil {
+		t.Fatalf("failed to decode system transaction: %v", err)
+	}
+	if hash, _, _ := decoded.SigHash(); hash != types.NewEIP155Signer(chainID).Hash(tx) {
+		t.Errorf("signature hash mismatch: have %x, want %x", hash, types.NewEIP155Signer(chainID).Hash(tx))
+	}
+	contracts := map[common.Address]struct{}{slashManager: {}}
+	if method, err := decoded.Verify(contracts); err != nil || method != "slash" {
+		t.Errorf("verification mismatch: have %q, %v, want slash", method, err)
+	}
+	if _, err := decoded.Verify(map[common.Address]struct{}{}); !errors.Is(err, errUnknownSystemContract) {
+		t.Errorf("unknown contract error mismatch: have %v, want %v", err, errUnknownSystemContract)
+	}
+	decoded.GasPrice = big.NewInt(1)
+	if _, err := decoded.Verify(contracts); !errors.Is(err, errMalformedSystemTx) {
+		t.Errorf("gas price error mismatch: have %v, want %v", err, errMalformedSystemTx)
+	}
+	decoded.GasPrice, decoded.Data = common.Big0, []byte{0xde, 0xad, 0xbe, 0xef}
+	if _, err := decoded.Verify(contracts); !errors.Is(err, errMalformedSystemTx) {
+		t.Errorf("unknown method error mismatch: have %v, want %v", err, errMalformedSystemTx)
+	}
+}
+
+func TestVerifySystemTxs(t *testing.T) {
+	var (
+		key, _     = crypto.GenerateKey()
+		coinbase   = crypto.PubkeyToAddress(key.PublicKey)
+		other, _   = crypto.GenerateKey()
+		validator  = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		chainID    = big.NewInt(96)
+		signer     = types.NewEIP155Signer(chainID)
+		contracts  = testSystemContracts(coinbase)
+		config     = &params.ChainConfig{ChainID: chainID, ChaophrayaBlock: big.NewInt(1), Clique: &params.CliqueConfig{Epoch: 30000, Span: 100, ValidatorContract: common.HexToAddress("0x1000")}}
+		engine     = &Clique{config: config, signer: signer}
+		snap       = &Snapshot{config: config, SystemContracts: contracts, Validators: []common.Address{validator}}
+		slashData  = append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(validator.Bytes(), 32)...), common.LeftPadBytes([]byte{1}, 32)...)
+		wrongSlash = append(append(common.CopyBytes(slashSelector), common.LeftPadBytes(coinbase.Bytes(), 32)...), common.LeftPadBytes([]byte{1}, 32)...)
+	)
+	sign := func(key *ecdsa.PrivateKey, to common.Address, value int64, gasPrice int64, data []byte) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(0, to, big.NewInt(value), systemTxGas, big.NewInt(gasPrice), data), signer, key)
+		return tx
+	}
+	var (
+		slash      = sign(key, contracts.SlashManager, 0, 0, slashData)
+		distribute = sign(key, contracts.StakeManager, 10, 0, distributeRewardSelector)
+	)
+	// Block 10 is sealed out of turn by the official node, so it may slash
+	header := &types.Header{Number: big.NewInt(10), Coinbase: coinbase, Difficulty: diffNoTurn}
+
+	tests := []struct {
+		txs []*types.Transaction
+		err error
+	}{
+		{txs: nil},
+		{txs: []*types.Transaction{slash, distribute}},
+		{txs: []*types.Transaction{distribute}},
+		{txs: []*types.Transaction{sign(other, contracts.StakeManager, 10, 0, distributeRewardSelector)}, err: errSystemTxSender},
+		{txs: []*types.Transaction{sign(key, contracts.StakeManager, 10, 1, distributeRewardSelector)}, err: errSystemTxGasPrice},
+		{txs: []*types.Transaction{sign(key, contracts.StakeManager, 10, 0, []byte{0xde, 0xad, 0xbe, 0xef})}, err: errSystemTxCalldata},
+		{txs: []*types.Transaction{sign(key, contracts.SlashManager, 0, 0, wrongSlash)}, err: errSystemTxCalldata},
+		{txs: []*types.Transaction{sign(key, contracts.SlashManager, 10, 0, distributeRewardSelector)}, err: errSystemTxRecipient},
+		{txs: []*types.Transaction{distribute, slash}, err: errSystemTxOrder},
+		{txs: []*types.Transaction{distribute, distribute}, err: errUnexpectedSystemTx},
+		{txs: []*types.Transaction{slash, slash}, err: errUnexpectedSystemTx},
+	}
+	for i, tt := range tests {
+		if err := engine.verifySystemTxs(header, snap, tt.txs); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// In-turn blocks don't slash, and span commitments only happen mid-span
+	inturn := &types.Header{Number: big.NewInt(10), Coinbase: coinbase, Difficulty: diffInTurn}
+	if err := engine.verifySystemTxs(inturn, snap, []*types.Transaction{slash}); !errors.Is(err, errUnexpectedSystemTx) {
+		t.Errorf("in-turn slash error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+	// Double signs are slashed by the official node after the evidence fork, the
+	// evidence following the slash arguments
+	doubleSign := sign(key, contracts.SlashManager, 0, 0, append(common.CopyBytes(slashData), 0xc0))
+	if err := engine.verifySystemTxs(header, snap, []*types.Transaction{slash, doubleSign}); !errors.Is(err, errUnexpectedSystemTx) {
+		t.Errorf("pre-fork double sign slash error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+	config.ChaophrayaEvidenceBlock = big.NewInt(1)
+	if err := engine.verifySystemTxs(header, snap, []*types.Transaction{slash, doubleSign, doubleSign, distribute}); err != nil {
+		t.Errorf("double sign slash rejected: %v", err)
+	}
+	if err := engine.verifySystemTxs(header, snap, []*types.Transaction{doubleSign, slash}); !errors.Is(err, errSystemTxOrder) {
+		t.Errorf("double sign slash order error mismatch: have %v, want %v", err, errSystemTxOrder)
+	}
+	unofficial := &Snapshot{config: config, SystemContracts: testSystemContracts(common.Address{}), Validators: []common.Address{validator}}
+	if err := engine.verifySystemTxs(inturn, unofficial, []*types.Transaction{doubleSign}); !errors.Is(err, errUnexpectedSystemTx) {
+		t.Errorf("non-official double sign slash error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+	config.ChaophrayaEvidenceBlock = nil
+
+	commit := sign(key, config.Clique.ValidatorContract, 0, 0, append(append(append(common.CopyBytes(commitSpanSelector), common.LeftPadBytes([]byte{0x20}, 32)...), common.LeftPadBytes([]byte{1}, 32)...), common.RightPadBytes([]byte{0xc0}, 32)...))
+	if err := engine.verifySystemTxs(header, snap, []*types.Transaction{commit}); !errors.Is(err, errUnexpectedSystemTx) {
+		t.Errorf("commit span error mismatch: have %v, want %v", err, errUnexpectedSystemTx)
+	}
+}
+
+func testSystemContracts(official common.Address) ctypes.SystemContracts {
+	return ctypes.SystemContracts{
+		StakeManager: common.HexToAddress("0x0000000000000000000000000000000000001001"),
+		SlashManager: common.HexToAddress("0x0000000000000000000000000000000000001002"),
+		OfficialNode: official,
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/consensus/clique/lightclient"
+	"github.com/ethereum/go-ethereum/consensus/clique/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Validator set sources selectable through SetValidatorSetSource.
+const (
+	ValidatorSetContract = "contract" // Call the validator set contract against the parent state
+	ValidatorSetHeader   = "header"   // Prove the span header seal against the validators of the previous span
+	ValidatorSetProof    = "proof"    // Check the span header against the commitSpan transaction of the span
+)
+
+var (
+	// errMissingSpanCommitment is returned if the block committing the validators
+	// of a span is not available locally.
+	errMissingSpanCommitment = errors.New("missing span commitment block")
+
+	// errInvalidSpanCommitment is returned if the block committing the validators
+	// of a span does not contain a well-formed commitSpan transaction.
+	errInvalidSpanCommitment = errors.New("invalid span commitment block")
+
+	// commitSpanSelector is the method id of commitSpan(bytes) on the validator set.
+	commitSpanSelector = crypto.Keccak256([]byte("commitSpan(bytes)"))[:4]
+)
+
+// ValidatorSetSource provides the validator set a span header is required to
+// commit to. It's consulted when finalizing the last block before a new span.
+type ValidatorSetSource interface {
+	// SpanValidators returns the validators the given header must contain.
+	SpanValidators(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) ([]*ctypes.Validator, error)
+}
+
+// newValidatorSetSource creates the validator set source of the given kind.
+func newValidatorSetSource(kind string, contractClient ContractClient) (ValidatorSetSource, error) {
+	switch kind {
+	case "", ValidatorSetContract:
+		return &contractValidatorSource{contractClient: contractClient}, nil
+	case ValidatorSetHeader:
+		return headerValidatorSource{}, nil
+	case ValidatorSetProof:
+		return proofValidatorSource{}, nil
+	default:
+		return nil, fmt.Errorf("unknown validator set source %q", kind)
+	}
+}
+
+// contractValidatorSource retrieves the validator set from the validator set
+// contract, which requires the state of the parent block.
+type contractValidatorSource struct {
+	contractClient ContractClient
+}
+
+func (s *contractValidatorSource) SpanValidators(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) ([]*ctypes.Validator, error) {
+	validators, _, err := s.contractClient.GetCurrentValidators(ctx, header.ParentHash, new(big.Int).SetUint64(header.Number.Uint64()+1))
+	return validators, err
+}
+
+// headerValidatorSource takes the validator set committed in the span header once
+// the header is proven, the way the lightclient package does, to be sealed by a
+// validator of the span committed in the previous span header. Only headers are
+// required, so light clients can follow the validator sets without state or
+// block bodies.
+type headerValidatorSource struct{}
+
+func (headerValidatorSource) SpanValidators(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) ([]*ctypes.Validator, error) {
+	if err := verifySpanHeader(chain, header, nil); err != nil {
+		return nil, err
+	}
+	return parseSpanValidators(chain.Config(), header)
+}
+
+// verifySpanHeader proves the span header to be sealed by a validator of its
+// span, trusting the span header committing them. The ancestors are looked up
+// in the batch of parents being verified before the chain.
+func verifySpanHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	config := chain.Config()
+	number := header.Number.Uint64()
+	start, _ := spanRange(config, number)
+	if start == 0 {
+		return errMissingSpanCommitment
+	}
+	var (
+		parent *types.Header
+		span   *types.Header
+	)
+	for ancestor := header; ancestor != nil && ancestor.Number.Uint64() >= start; {
+		if len(parents) > 0 && parents[len(parents)-1].Hash() == ancestor.ParentHash {
+			ancestor, parents = parents[len(parents)-1], parents[:len(parents)-1]
+		} else {
+			ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+		}
+		if parent == nil {
+			parent = ancestor
+		}
+		span = ancestor
+	}
+	if parent == nil || span == nil || span.Number.Uint64() != start-1 {
+		return errMissingSpanCommitment
+	}
+	proof, err := lightclient.NewSealProof(config, header, CliqueRLP(header), parent, span)
+	if err != nil {
+		return err
+	}
+	verifier, err := lightclient.NewVerifier(config, span)
+	if err != nil {
+		return err
+	}
+	return verifier.AddSpan(proof)
+}
+
+// proofValidatorSource checks the validator set committed in the span header
+// against the commitSpan system transaction included in the commitment block
+// of the previous span. The transaction is proven against the transaction root
+// of the commitment header, so only headers and the commitment block bodies are
+// required.
+type proofValidatorSource struct{}
+
+func (proofValidatorSource) SpanValidators(ctx context.Context, chain consensus.ChainHeaderReader, header *types.Header) ([]*ctypes.Validator, error) {
+	config := chain.Config()
+	validators, err := parseSpanValidators(config, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The validators of the first span are set up in the contract, there is no
+	// commitment to check them against.
+	commitment := spanCommitment(config, header.Number.Uint64())
+	if commitment > header.Number.Uint64() || !isSpanCommitmentBlock(config, new(big.Int).SetUint64(commitment)) {
+		log.Debug("Trusting validators of initial span", "number", header.Number)
+		return validators, nil
+	}
+	committed, err := committedValidators(chain, header, commitment)
+	if err != nil {
+		return nil, err
+	}
+	if len(committed) != len(validators) {
+		return nil, errMismatchingSpanValidators
+	}
+	for i, val := range committed {
+		if val.Signer != validators[i].Address || val.VotingPower != validators[i].VotingPower {
+			return nil, errMismatchingSpanValidators
+		}
+	}
+	return validators, nil
+}
+
+// committedValidators retrieves the validators committed by the commitSpan
+// transaction of the given ancestor block of header.
+func committedValidators(chain consensus.ChainHeaderReader, header *types.Header, number uint64) ([]ctypes.MinimalVal, error) {
+	reader, ok := chain.(consensus.ChainReader)
+	if !ok {
+		return nil, errMissingSpanCommitment
+	}
+	ancestor := header
+	for ancestor != nil && ancestor.Number.Uint64() > number {
+		ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+	}
+	if ancestor == nil {
+		return nil, errMissingSpanCommitment
+	}
+	block := reader.GetBlock(ancestor.Hash(), number)
+	if block == nil {
+		return nil, errMissingSpanCommitment
+	}
+	if types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)) != ancestor.TxHash {
+		return nil, errInvalidSpanCommitment
+	}
+	config := chain.Config()
+	signer := types.MakeSigner(config, block.Number())
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil || (*tx.To() != config.Clique.ValidatorContract && *tx.To() != config.Clique.ValidatorContractV2) {
+			continue
+		}
+		if tx.GasPrice().Sign() != 0 || len(tx.Data()) < 4 || !bytes.Equal(tx.Data()[:4], commitSpanSelector) {
+			continue
+		}
+		if sender, err := types.Sender(signer, tx); err != nil || sender != ancestor.Coinbase {
+			continue
+		}
+		return unpackCommitSpan(tx.Data()[4:])
+	}
+	return nil, errInvalidSpanCommitment
+}
+
+// unpackCommitSpan decodes the validators from the arguments of a commitSpan call.
+func unpackCommitSpan(data []byte) ([]ctypes.MinimalVal, error) {
+	bytesTy, _ := abi.NewType("bytes", "", nil)
+	args, err := abi.Arguments{{Type: bytesTy}}.Unpack(data)
+	if err != nil || len(args) != 1 {
+		return nil, errInvalidSpanCommitment
+	}
+	blob, ok := args[0].([]byte)
+	if !ok {
+		return nil, errInvalidSpanCommitment
+	}
+	var validators []ctypes.MinimalVal
+	if err := rlp.DecodeBytes(blob, &validators); err != nil {
+		return nil, errInvalidSpanCommitment
+	}
+	return validators, nil
+}
+
+// parseSpanValidators parses the validator set committed in a span header.
+func parseSpanValidators(config *params.ChainConfig, header *types.Header) ([]*ctypes.Validator, error) {
+	registry := ctypes.RegistryVersionAt(config, header.Number).Size()
+	if len(header.Extra) < extraVanity+extraSeal+registry {
+		return nil, errInvalidSpan
+	}
+	return utils.ParseValidatorsAndPower(header.Extra[extraVanity : len(header.Extra)-extraSeal-registry])
+}
+
+// parseSystemContracts parses the system contract registry committed in a span
+// header.
+func parseSystemContracts(config *params.ChainConfig, header *types.Header) (ctypes.SystemContracts, error) {
+	version := ctypes.RegistryVersionAt(config, header.Number)
+	if len(header.Extra) < extraVanity+extraSeal+version.Size() {
+		return ctypes.SystemContracts{}, errInvalidSpan
+	}
+	return version.Decode(header.Extra[len(header.Extra)-extraSeal-version.Size() : len(header.Extra)-extraSeal])
+}
+
+// SetValidatorSetSource selects the source of the validator sets span headers
+// are verified against: "contract", "header" or "proof".
+func (c *Clique) SetValidatorSetSource(kind string) error {
+	source, err := newValidatorSetSource(kind, c.contractClient)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.validatorSource = source
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique/ctypes"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestUnpackCommitSpan(t *testing.T) {
+	want := []ctypes.MinimalVal{
+		{Signer: common.HexToAddress("0xD79663c4EF106dF66c138C9b93edb449BEea4032"), VotingPower: 30},
+		{Signer: common.HexToAddress("0x7709a41Cae3e1b7Ac83815E6A216A4c40B25Ed0A"), VotingPower: 20},
+	}
+	blob, err := rlp.EncodeToBytes(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytesTy, _ := abi.NewType("bytes", "", nil)
+	data, err := abi.Arguments{{Type: bytesTy}}.Pack(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := unpackCommitSpan(data)
+	if err != nil {
+		t.Fatalf("failed to unpack commit span: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("validator count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("validator %d mismatch: have %v, want %v", i, have[i], want[i])
+		}
+	}
+	if _, err := unpackCommitSpan(data[:40]); err != errInvalidSpanCommitment {
+		t.Errorf("truncated commit span error mismatch: have %v, want %v", err, errInvalidSpanCommitment)
+	}
+}
+
+func TestProofValidatorSource(t *testing.T) {
+	val := &ctypes.Validator{Address: common.HexToAddress("0xB55B31B204Cdf1Ca281B571C2dC131682A052B89"), VotingPower: 50}
+
+	extra := make([]byte, extraVanity)
+	extra = append(extra, val.HeaderBytes()...)
+	extra = append(extra, make([]byte, ctypes.RegistryVersions[0].Size()+extraSeal)...)
+	header := &types.Header{Number: big.NewInt(49), Extra: extra}
+
+	source, err := newValidatorSetSource(ValidatorSetProof, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The validators of the initial span have no commitment to be checked against
+	chain := &testerHeaderChain{config: &params.ChainConfig{ChaophrayaBlock: big.NewInt(30), Clique: &params.CliqueConfig{Epoch: 30000, Span: 50}}}
+	have, err := source.SpanValidators(context.Background(), chain, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 1 || *have[0] != *val {
+		t.Errorf("validators mismatch: have %v, want %v", have, val)
+	}
+	// Later validators must never be taken from the header alone
+	chain.config = &params.ChainConfig{ChaophrayaBlock: big.NewInt(0), Clique: &params.CliqueConfig{Epoch: 30000, Span: 50}}
+	if _, err := source.SpanValidators(context.Background(), chain, header); err != errMissingSpanCommitment {
+		t.Errorf("unproven validators error mismatch: have %v, want %v", err, errMissingSpanCommitment)
+	}
+	if _, err := newValidatorSetSource("unknown", nil); err == nil {
+		t.Error("unknown validator set source accepted")
+	}
+}
+
+// Tests that the header validator source proves span headers on a chain of
+// headers alone, where the proof source can't find the commitment blocks.
+func TestHeaderValidatorSource(t *testing.T) {
+	config := &params.ChainConfig{ChaophrayaBlock: big.NewInt(8), Clique: &params.CliqueConfig{Period: 3, Epoch: 30000, Span: 8}}
+	accounts := newTesterAccountPool()
+
+	spanExtra := func(number int64, validators ...string) []byte {
+		extra := make([]byte, extraVanity)
+		for _, name := range validators {
+			extra = append(extra, (&ctypes.Validator{Address: accounts.address(name), VotingPower: 1}).HeaderBytes()...)
+		}
+		version := ctypes.RegistryVersionAt(config, big.NewInt(number))
+		extra = append(extra, version.Encode(&ctypes.SystemContracts{OfficialNode: accounts.address("O")})...)
+		return append(extra, make([]byte, extraSeal)...)
+	}
+	// Blocks 8..15 are sealed in turn by the validators committed in block 7,
+	// block 15 commits the validators of the next span
+	chain := &testerHeaderChain{config: config, headers: make(map[common.Hash]*types.Header)}
+	parent := &types.Header{Number: big.NewInt(7), Time: 700, Difficulty: diffInTurn, Extra: spanExtra(7, "A", "B", "C")}
+	accounts.sign(parent, "A")
+	chain.headers[parent.Hash()] = parent
+
+	validators := []string{"A", "B", "C"}
+	for number := int64(8); number <= 15; number++ {
+		header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(number), Time: parent.Time + 3, Difficulty: diffInTurn, Extra: make([]byte, extraVanity+extraSeal)}
+		if number == 15 {
+			header.Extra = spanExtra(15, "D", "E")
+		}
+		accounts.sign(header, validators[number%3])
+		chain.headers[header.Hash()] = header
+		parent = header
+	}
+	span := parent
+
+	source, err := newValidatorSetSource(ValidatorSetHeader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := source.SpanValidators(context.Background(), chain, span)
+	if err != nil {
+		t.Fatalf("failed to prove span header: %v", err)
+	}
+	if len(have) != 2 || have[0].Address != accounts.address("D") || have[1].Address != accounts.address("E") {
+		t.Errorf("validators mismatch: have %v", have)
+	}
+	// The proof source needs the commitment block body, missing from the chain
+	proof, _ := newValidatorSetSource(ValidatorSetProof, nil)
+	if _, err := proof.SpanValidators(context.Background(), chain, span); err != errMissingSpanCommitment {
+		t.Errorf("proof source error mismatch: have %v, want %v", err, errMissingSpanCommitment)
+	}
+	// A span header sealed by a validator of another span must be rejected
+	forged := types.CopyHeader(span)
+	accounts.sign(forged, "D")
+	if _, err := source.SpanValidators(context.Background(), chain, forged); err == nil {
+		t.Error("span header sealed by an outsider accepted")
+	}
+	// The span header can be proven while its ancestors are still being verified
+	batch := []*types.Header{chain.headers[span.ParentHash]}
+	delete(chain.headers, span.ParentHash)
+	if _, err := source.SpanValidators(context.Background(), chain, span); err != errMissingSpanCommitment {
+		t.Errorf("missing ancestor error mismatch: have %v, want %v", err, errMissingSpanCommitment)
+	}
+	if err := verifySpanHeader(chain, span, batch); err != nil {
+		t.Errorf("failed to prove span header against the verified batch: %v", err)
+	}
+}
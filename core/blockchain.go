@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"sort"
 	"sync"
@@ -33,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -50,6 +52,8 @@ var (
 	headBlockGauge     = metrics.NewRegisteredGauge("chain/head/block", nil)
 	headHeaderGauge    = metrics.NewRegisteredGauge("chain/head/header", nil)
 	headFastBlockGauge = metrics.NewRegisteredGauge("chain/head/receipt", nil)
+	headFinalizedGauge = metrics.NewRegisteredGauge("chain/head/finalized", nil)
+	headSafeGauge      = metrics.NewRegisteredGauge("chain/head/safe", nil)
 
 	accountReadTimer   = metrics.NewRegisteredTimer("chain/account/reads", nil)
 	accountHashTimer   = metrics.NewRegisteredTimer("chain/account/hashes", nil)
@@ -80,6 +84,11 @@ var (
 
 	errInsertionInterrupted = errors.New("insertion is interrupted")
 	errChainStopped         = errors.New("blockchain is stopped")
+	errReorgFinalized       = errors.New("reorg would revert finalized block")
+	errPruneArchive         = errors.New("state pruning unavailable in archive mode")
+	errPruneDisabled        = errors.New("online state pruning disabled")
+	errPrunePathScheme      = errors.New("state pruning unavailable with the path state scheme")
+	errPathSchemeArchive    = errors.New("archive mode unavailable with the path state scheme")
 )
 
 const (
@@ -129,6 +138,7 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	OnlinePruning       bool          // Whether the stale state may be pruned while the chain is running
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -161,10 +171,11 @@ type BlockChain struct {
 	chainConfig *params.ChainConfig // Chain & network configuration
 	cacheConfig *CacheConfig        // Cache configuration for pruning
 
-	db     ethdb.Database // Low level persistent database to store final content in
-	snaps  *snapshot.Tree // Snapshot tree for fast trie leaf access
-	triegc *prque.Prque   // Priority queue mapping block numbers to tries to gc
-	gcproc time.Duration  // Accumulates canonical block processing for trie dumping
+	db     ethdb.Database       // Low level persistent database to store final content in
+	snaps  *snapshot.Tree       // Snapshot tree for fast trie leaf access
+	pruner *pruner.OnlinePruner // Online pruner of the stale state, nil if disabled
+	triegc *prque.Prque         // Priority queue mapping block numbers to tries to gc
+	gcproc time.Duration        // Accumulates canonical block processing for trie dumping
 
 	// txLookupLimit is the maximum number of blocks from head whose tx indices
 	// are reserved:
@@ -187,8 +198,10 @@ type BlockChain struct {
 	// Readers don't need to take it, they can just read the database.
 	chainmu *syncx.ClosableMutex
 
-	currentBlock     atomic.Value // Current head of the block chain
-	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
+	currentBlock          atomic.Value // Current head of the block chain
+	currentFastBlock      atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
+	currentFinalizedBlock atomic.Value // Latest block finalized by the consensus engine
+	currentSafeBlock      atomic.Value // Latest block considered safe by the consensus engine
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
@@ -225,12 +238,23 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 
+	// The state is only written through the online pruner if it's enabled or
+	// an interrupted pruning has to be resumed, sparing the other nodes the
+	// overhead on the commit path.
+	var (
+		statePruner *pruner.OnlinePruner
+		stateDb     = db
+	)
+	if p := pruner.NewOnlinePruner(db); cacheConfig.OnlinePruning || p.Interrupted() {
+		statePruner, stateDb = p, p.Database()
+	}
 	bc := &BlockChain{
 		chainConfig: chainConfig,
 		cacheConfig: cacheConfig,
 		db:          db,
+		pruner:      statePruner,
 		triegc:      prque.New(nil),
-		stateCache: state.NewDatabaseWithConfig(db, &trie.Config{
+		stateCache: state.NewDatabaseWithConfig(stateDb, &trie.Config{
 			Cache:     cacheConfig.TrieCleanLimit,
 			Journal:   cacheConfig.TrieCleanJournal,
 			Preimages: cacheConfig.Preimages,
@@ -246,6 +270,9 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		engine:        engine,
 		vmConfig:      vmConfig,
 	}
+	if bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme && cacheConfig.TrieDirtyDisabled {
+		return nil, errPathSchemeArchive
+	}
 	bc.forker = NewForkChoice(bc, shouldPreserve)
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
@@ -264,6 +291,8 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	var nilBlock *types.Block
 	bc.currentBlock.Store(nilBlock)
 	bc.currentFastBlock.Store(nilBlock)
+	bc.currentFinalizedBlock.Store(nilBlock)
+	bc.currentSafeBlock.Store(nilBlock)
 
 	// Initialize the chain with ancient data if it isn't empty.
 	var txIndexBlock uint64
@@ -378,6 +407,18 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		bc.snaps, _ = snapshot.New(bc.db, bc.stateCache.TrieDB(), bc.cacheConfig.SnapshotLimit, head.Root(), !bc.cacheConfig.SnapshotWait, true, recover)
 	}
 
+	// Resume any state pruning interrupted by the last shutdown
+	if bc.pruner != nil && bc.pruner.Interrupted() {
+		if bc.cacheConfig.TrieDirtyDisabled {
+			log.Warn("Discarding interrupted state pruning in archive mode")
+			bc.pruner.Discard()
+		} else if bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme {
+			log.Warn("Discarding interrupted state pruning with the path state scheme")
+			bc.pruner.Discard()
+		} else if err := bc.startPruning(0); err != nil {
+			log.Error("Failed to resume state pruning", "err", err)
+		}
+	}
 	// Start future block processor.
 	bc.wg.Add(1)
 	go bc.updateFutureBlocks()
@@ -460,6 +501,16 @@ func (bc *BlockChain) loadLastState() error {
 			headFastBlockGauge.Update(int64(block.NumberU64()))
 		}
 	}
+	// Restore the last known finalized block. The safe block isn't persisted,
+	// it's reset to the finalized one until the consensus engine updates it.
+	if head := rawdb.ReadFinalizedBlockHash(bc.db); head != (common.Hash{}) {
+		if block := bc.GetBlockByHash(head); block != nil {
+			bc.currentFinalizedBlock.Store(block)
+			headFinalizedGauge.Update(int64(block.NumberU64()))
+			bc.currentSafeBlock.Store(block)
+			headSafeGauge.Update(int64(block.NumberU64()))
+		}
+	}
 	// Issue a status log for the user
 	currentFastBlock := bc.CurrentFastBlock()
 
@@ -470,12 +521,37 @@ func (bc *BlockChain) loadLastState() error {
 	log.Info("Loaded most recent local header", "number", currentHeader.Number, "hash", currentHeader.Hash(), "td", headerTd, "age", common.PrettyAge(time.Unix(int64(currentHeader.Time), 0)))
 	log.Info("Loaded most recent local full block", "number", currentBlock.Number(), "hash", currentBlock.Hash(), "td", blockTd, "age", common.PrettyAge(time.Unix(int64(currentBlock.Time()), 0)))
 	log.Info("Loaded most recent local fast block", "number", currentFastBlock.Number(), "hash", currentFastBlock.Hash(), "td", fastTd, "age", common.PrettyAge(time.Unix(int64(currentFastBlock.Time()), 0)))
+	if finalized := bc.CurrentFinalizedBlock(); finalized != nil {
+		log.Info("Loaded most recent finalized block", "number", finalized.Number(), "hash", finalized.Hash(), "age", common.PrettyAge(time.Unix(int64(finalized.Time()), 0)))
+	}
 	if pivot := rawdb.ReadLastPivotNumber(bc.db); pivot != nil {
 		log.Info("Loaded last fast-sync pivot marker", "number", *pivot)
 	}
 	return nil
 }
 
+// SetFinalized sets the finalized block, persisting it in the database.
+func (bc *BlockChain) SetFinalized(block *types.Block) {
+	bc.currentFinalizedBlock.Store(block)
+	if block != nil {
+		rawdb.WriteFinalizedBlockHash(bc.db, block.Hash())
+		headFinalizedGauge.Update(int64(block.NumberU64()))
+	} else {
+		rawdb.WriteFinalizedBlockHash(bc.db, common.Hash{})
+		headFinalizedGauge.Update(0)
+	}
+}
+
+// SetSafe sets the safe block.
+func (bc *BlockChain) SetSafe(block *types.Block) {
+	bc.currentSafeBlock.Store(block)
+	if block != nil {
+		headSafeGauge.Update(int64(block.NumberU64()))
+	} else {
+		headSafeGauge.Update(0)
+	}
+}
+
 // SetHead rewinds the local chain to a new head. Depending on whether the node
 // was fast synced or full synced and in which state, the method will try to
 // delete minimal data from disk whilst retaining chain consistency.
@@ -626,6 +702,14 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, root common.Hash, repair bo
 	bc.txLookupCache.Purge()
 	bc.futureBlocks.Purge()
 
+	// Clear the finalized block if it has been rewound
+	if finalized := bc.CurrentFinalizedBlock(); finalized != nil && bc.CurrentBlock().NumberU64() < finalized.NumberU64() {
+		log.Warn("SetHead invalidated finalized block", "number", finalized.Number(), "hash", finalized.Hash())
+		bc.SetFinalized(nil)
+	}
+	if safe := bc.CurrentSafeBlock(); safe != nil && bc.CurrentBlock().NumberU64() < safe.NumberU64() {
+		bc.SetSafe(nil)
+	}
 	return rootNumber, bc.loadLastState()
 }
 
@@ -781,6 +865,11 @@ func (bc *BlockChain) Stop() {
 	bc.chainmu.Close()
 	bc.wg.Wait()
 
+	// Interrupt the state pruning, it's resumed on the next startup
+	if bc.pruner != nil {
+		bc.pruner.Stop()
+	}
+
 	// Ensure that the entirety of the state snapshot is journalled to disk.
 	var snapBase common.Hash
 	if bc.snaps != nil {
@@ -795,7 +884,15 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
+	//
+	// With the path scheme only a single state is stored on disk, the layers of
+	// the recent ones are journalled instead and restored on the next startup.
+	// They're lost on a crash, the head is then rewound to the disk state.
+	if triedb := bc.stateCache.TrieDB(); triedb.Scheme() == rawdb.PathScheme {
+		if err := triedb.Journal(bc.CurrentBlock().Root()); err != nil {
+			log.Error("Failed to journal trie layers", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		triedb := bc.stateCache.TrieDB()
 
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
@@ -1200,6 +1297,16 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	}
 	triedb := bc.stateCache.TrieDB()
 
+	// With the path scheme, the layers beyond the retained recent states are
+	// flattened into disk, deleting the stale nodes in place. The state of the
+	// snapshot disk layer is kept around for the snapshot generator.
+	if triedb.Scheme() == rawdb.PathScheme {
+		var keep common.Hash
+		if bc.snaps != nil {
+			keep = bc.snaps.DiskRoot()
+		}
+		return triedb.CapLayers(root, TriesInMemory, keep)
+	}
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.TrieDirtyDisabled {
 		return triedb.Commit(root, false, nil)
@@ -1263,6 +1370,21 @@ func (bc *BlockChain) WriteBlockAndSetHead(block *types.Block, receipts []*types
 	return bc.writeBlockAndSetHead(block, receipts, logs, state, emitHeadEvent)
 }
 
+// revertsFinalized reports whether making the given block the chain head would
+// revert the finalized block.
+func (bc *BlockChain) revertsFinalized(block *types.Block) bool {
+	finalized := bc.CurrentFinalizedBlock()
+	if finalized == nil {
+		return false
+	}
+	if block.NumberU64() <= finalized.NumberU64() {
+		return block.Hash() != finalized.Hash()
+	}
+	maxNonCanonical := uint64(math.MaxUint64)
+	hash, _ := bc.GetAncestor(block.Hash(), block.NumberU64(), block.NumberU64()-finalized.NumberU64(), &maxNonCanonical)
+	return hash != finalized.Hash()
+}
+
 // writeBlockAndSetHead writes the block and all associated state to the database,
 // and also it applies the given block as the new chain head. This function expects
 // the chain mutex to be held.
@@ -1275,6 +1397,10 @@ func (bc *BlockChain) writeBlockAndSetHead(block *types.Block, receipts []*types
 	if err != nil {
 		return NonStatTy, err
 	}
+	if reorg && bc.revertsFinalized(block) {
+		log.Warn("Rejected reorg below finalized block", "number", block.Number(), "hash", block.Hash(), "finalized", bc.CurrentFinalizedBlock().Number())
+		reorg = false
+	}
 	if reorg {
 		// Reorganise the chain if the parent is not the head block
 		if block.ParentHash() != currentBlock.Hash() {
@@ -1987,6 +2113,14 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			return fmt.Errorf("invalid new chain")
 		}
 	}
+	// Never revert the finalized block, the fork choice should have prevented it
+	if finalized := bc.CurrentFinalizedBlock(); finalized != nil && commonBlock.NumberU64() < finalized.NumberU64() {
+		return errReorgFinalized
+	}
+	// The safe block may be reverted, the engine moves it on top of the new chain
+	if safe := bc.CurrentSafeBlock(); safe != nil && commonBlock.NumberU64() < safe.NumberU64() {
+		bc.SetSafe(nil)
+	}
 	// Ensure the user sees large reorgs
 	if len(oldChain) > 0 && len(newChain) > 0 {
 		logFn := log.Info
@@ -2181,6 +2315,9 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 		if bc.txLookupLimit != 0 && ancients > bc.txLookupLimit {
 			from = ancients - bc.txLookupLimit
 		}
+		if pruned := rawdb.ReadHistoryTail(bc.db); from < pruned {
+			from = pruned
+		}
 		rawdb.IndexTransactions(bc.db, from, ancients, bc.quit)
 	}
 
@@ -2210,14 +2347,20 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 				if end > head+1 {
 					end = head + 1
 				}
-				rawdb.IndexTransactions(bc.db, 0, end, bc.quit)
+				// Block bodies below the history tail were pruned, there is
+				// nothing to index there.
+				rawdb.IndexTransactions(bc.db, rawdb.ReadHistoryTail(bc.db), end, bc.quit)
 			}
 			return
 		}
 		// Update the transaction index to the new chain state
 		if head-bc.txLookupLimit+1 < *tail {
 			// Reindex a part of missing indices and rewind index tail to HEAD-limit
-			rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+			from := head - bc.txLookupLimit + 1
+			if pruned := rawdb.ReadHistoryTail(bc.db); from < pruned {
+				from = pruned
+			}
+			rawdb.IndexTransactions(bc.db, from, *tail, bc.quit)
 		} else {
 			// Unindex a part of stale indices and forward index tail to HEAD-limit
 			rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
@@ -2254,6 +2397,65 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	}
 }
 
+// PruneState starts deleting the stale state from the database in the background,
+// retaining the state of the current head and the ones imported after it. The
+// states older than the head become unavailable. The bloomSize is the size of
+// the bloom filter of the retained state in megabytes, zero for the default.
+func (bc *BlockChain) PruneState(bloomSize uint64) error {
+	if bc.cacheConfig.TrieDirtyDisabled {
+		return errPruneArchive
+	}
+	if bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme {
+		return errPrunePathScheme
+	}
+	if bc.pruner == nil {
+		return errPruneDisabled
+	}
+	if !bc.chainmu.TryLock() {
+		return errChainStopped
+	}
+	defer bc.chainmu.Unlock()
+
+	return bc.startPruning(bloomSize)
+}
+
+// StatePruningProgress returns the progress of the running state pruning, nil if
+// the state is not being pruned.
+func (bc *BlockChain) StatePruningProgress() *pruner.Progress {
+	if bc.pruner == nil {
+		return nil
+	}
+	return bc.pruner.Progress()
+}
+
+// startPruning persists the state of the current head and starts pruning all
+// the other states. The caller must hold the chain mutex.
+func (bc *BlockChain) startPruning(bloomSize uint64) error {
+	if bc.pruner.Progress() != nil {
+		return pruner.ErrPruningRunning
+	}
+	var (
+		root   = bc.CurrentBlock().Root()
+		triedb = bc.stateCache.TrieDB()
+	)
+	// Persist the head state and drop the older tries from memory, none of
+	// them may reach the disk after their nodes were pruned.
+	if err := triedb.Commit(root, true, nil); err != nil {
+		return err
+	}
+	for !bc.triegc.Empty() {
+		triedb.Dereference(bc.triegc.PopItem().(common.Hash))
+	}
+	// Flatten the snapshot into the head state, so a crash can't rewind the
+	// chain beyond it looking for the state of the snapshot disk layer.
+	if bc.snaps != nil && bc.snaps.Snapshot(root) != nil && bc.snaps.DiskRoot() != root {
+		if err := bc.snaps.Cap(root, 0); err != nil {
+			return err
+		}
+	}
+	return bc.pruner.Start(root, bloomSize)
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	rawdb.WriteBadBlock(bc.db, block)
@@ -23,6 +23,7 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -34,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -2637,6 +2639,98 @@ func TestTransactionIndices(t *testing.T) {
 	}
 }
 
+// Tests that a chain whose history was pruned from the ancients can be reopened,
+// the genesis block remaining readable.
+func TestPruneHistoryReopen(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(100000000000000000)
+		gspec   = &Genesis{
+			Config:  params.TestChainConfig,
+			Alloc:   GenesisAlloc{address: {Balance: funds}},
+			BaseFee: big.NewInt(params.InitialBaseFee),
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 128, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, block.header.BaseFee, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	datadir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	open := func() ethdb.Database {
+		db, err := rawdb.NewLevelDBDatabaseWithFreezer(datadir, 0, 0, filepath.Join(datadir, "ancient"), "", false)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		return db
+	}
+	// Import all blocks into the ancients
+	db := open()
+	gspec.MustCommit(db)
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 0); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, 128); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	chain.Stop()
+
+	if err := rawdb.PruneHistory(db, 64); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	db.Close()
+
+	// Reopen the pruned chain
+	db = open()
+	defer db.Close()
+	if tail := rawdb.ReadHistoryTail(db); tail != 64 {
+		t.Fatalf("history tail mismatch: have %d, want 64", tail)
+	}
+	chain, err = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen pruned chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentFastBlock().NumberU64(); head != 128 {
+		t.Fatalf("head mismatch: have %d, want 128", head)
+	}
+	if block := chain.GetBlockByNumber(0); block == nil || block.Hash() != genesis.Hash() {
+		t.Fatalf("genesis block not readable")
+	}
+	if receipts := rawdb.ReadReceiptsRLP(db, genesis.Hash(), 0); len(receipts) == 0 {
+		t.Fatalf("genesis receipts not readable")
+	}
+	if body := chain.GetBodyRLP(blocks[62].Hash()); len(body) != 0 {
+		t.Fatalf("pruned body of block #63 readable")
+	}
+	if body := chain.GetBody(blocks[63].Hash()); body == nil || len(body.Transactions) != 1 {
+		t.Fatalf("body of block #64 not readable")
+	}
+	if receipts := chain.GetReceiptsByHash(blocks[63].Hash()); len(receipts) != 1 {
+		t.Fatalf("receipts of block #64 not readable")
+	}
+}
+
 func TestSkipStaleTxIndicesInSnapSync(t *testing.T) {
 	// Configure and generate a sample block chain
 	var (
@@ -3704,3 +3798,301 @@ func TestEIP1559Transition(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that the finalized block is persisted across restarts, that a heavier
+// fork conflicting with it is not made canonical while one above it reverts the
+// safe block only, and that rewinding below it clears it.
+func TestReorgBelowFinalized(t *testing.T) {
+	db, blockchain, err := newCanonical(ethash.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	genesis := blockchain.CurrentBlock()
+	easyBlocks, _ := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 8, func(i int, b *BlockGen) {
+		b.OffsetTime(60)
+	})
+	if _, err := blockchain.InsertChain(easyBlocks); err != nil {
+		t.Fatalf("failed to insert easy chain: %v", err)
+	}
+	blockchain.SetFinalized(easyBlocks[4])
+
+	// A heavier fork branching off below the finalized block must be rejected
+	diffBlocks, _ := GenerateChain(params.TestChainConfig, easyBlocks[1], ethash.NewFaker(), db, 8, func(i int, b *BlockGen) {
+		b.OffsetTime(-9)
+	})
+	if _, err := blockchain.InsertChain(diffBlocks); err != nil {
+		t.Fatalf("failed to insert difficult chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != easyBlocks[7].Hash() {
+		t.Fatalf("head mismatch: have #%d [%x], want #%d [%x]", head.Number(), head.Hash(), easyBlocks[7].Number(), easyBlocks[7].Hash())
+	}
+	// A heavier fork branching off above the finalized block is accepted, only
+	// reverting the safe block
+	blockchain.SetSafe(easyBlocks[6])
+
+	forkBlocks, _ := GenerateChain(params.TestChainConfig, easyBlocks[4], ethash.NewFaker(), db, 8, func(i int, b *BlockGen) {
+		b.OffsetTime(-9)
+		b.SetCoinbase(common.Address{0x01})
+	})
+	if _, err := blockchain.InsertChain(forkBlocks); err != nil {
+		t.Fatalf("failed to insert fork chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock(); head.Hash() != forkBlocks[7].Hash() {
+		t.Fatalf("head mismatch: have #%d [%x], want #%d [%x]", head.Number(), head.Hash(), forkBlocks[7].Number(), forkBlocks[7].Hash())
+	}
+	if safe := blockchain.CurrentSafeBlock(); safe != nil {
+		t.Fatalf("reverted safe block not cleared: #%d", safe.Number())
+	}
+	// The finalized block is persisted
+	blockchain.Stop()
+	blockchain, _ = NewBlockChain(db, nil, params.AllEthashProtocolChanges, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer blockchain.Stop()
+
+	if finalized := blockchain.CurrentFinalizedBlock(); finalized == nil || finalized.Hash() != easyBlocks[4].Hash() {
+		t.Fatalf("finalized block mismatch after restart: have %v, want %x", finalized, easyBlocks[4].Hash())
+	}
+	if safe := blockchain.CurrentSafeBlock(); safe == nil || safe.Hash() != easyBlocks[4].Hash() {
+		t.Fatalf("safe block mismatch after restart: have %v, want %x", safe, easyBlocks[4].Hash())
+	}
+	// Rewinding below the finalized block clears it
+	if err := blockchain.SetHead(3); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if finalized := blockchain.CurrentFinalizedBlock(); finalized != nil {
+		t.Fatalf("finalized block not cleared: #%d", finalized.Number())
+	}
+}
+
+// Tests that the state can be pruned while blocks are imported, retaining the
+// state of the head at the start and every state imported afterwards.
+func TestOnlineStatePruning(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	// Send funds to a fresh account in every block, so every block has a new state
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 2*TriesInMemory+16, func(i int, b *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{byte(i), byte(i >> 8), 0x01}, big.NewInt(1000), params.TxGas, b.header.BaseFee, nil), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	// Import the chain committing every state older than the in-memory ones
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+
+	config := *defaultCacheConfig
+	config.TrieTimeLimit = 0
+	config.OnlinePruning = true
+	chain, err := NewBlockChain(db, &config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks[:2*TriesInMemory]); err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	stale := blocks[9].Root()
+	if !rawdb.HasTrieNode(db, stale) {
+		t.Fatalf("stale state not persisted")
+	}
+	// Prune the state, importing the remaining blocks meanwhile
+	if err := chain.PruneState(0); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	if err := chain.PruneState(0); err != pruner.ErrPruningRunning {
+		t.Fatalf("second pruning error mismatch: have %v, want %v", err, pruner.ErrPruningRunning)
+	}
+	if _, err := chain.InsertChain(blocks[2*TriesInMemory:]); err != nil {
+		t.Fatalf("failed to import blocks while pruning: %v", err)
+	}
+	for deadline := time.Now().Add(time.Minute); chain.StatePruningProgress() != nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("pruning not finished: %+v", chain.StatePruningProgress())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rawdb.HasTrieNode(db, stale) {
+		t.Errorf("stale state not pruned")
+	}
+	if blob := rawdb.ReadStatePruning(db); len(blob) != 0 {
+		t.Errorf("pruning progress not deleted")
+	}
+	chain.Stop()
+
+	// Restart the chain and check the retained states are complete
+	chain, err = NewBlockChain(db, &config, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock(); head.Hash() != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head mismatch: have #%d, want #%d", head.NumberU64(), len(blocks))
+	}
+	for _, number := range []int{2 * TriesInMemory, len(blocks)} {
+		root := blocks[number-1].Root()
+		tr, err := trie.NewSecure(root, trie.NewDatabase(db))
+		if err != nil {
+			t.Fatalf("state of block #%d missing: %v", number, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if err := it.Error(); err != nil {
+			t.Fatalf("state of block #%d incomplete: %v", number, err)
+		}
+	}
+}
+
+// Tests that the state is only written through the online pruner if online
+// pruning is enabled or an interrupted pruning has to be resumed.
+func TestOnlineStatePruningDisabled(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if chain.StateCache().TrieDB().DiskDB() != db {
+		t.Fatalf("state written through the pruner while disabled")
+	}
+	if err := chain.PruneState(0); err != errPruneDisabled {
+		t.Fatalf("pruning error mismatch: have %v, want %v", err, errPruneDisabled)
+	}
+	chain.Stop()
+
+	// Pretend a pruning was interrupted, it must be resumed regardless
+	rawdb.WriteStatePruning(db, []byte{0x01})
+
+	chain, err = NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if chain.StateCache().TrieDB().DiskDB() == db {
+		t.Fatalf("state not written through the pruner while resuming")
+	}
+	for deadline := time.Now().Add(time.Minute); chain.StatePruningProgress() != nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("pruning not finished: %+v", chain.StatePruningProgress())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if blob := rawdb.ReadStatePruning(db); len(blob) != 0 {
+		t.Errorf("pruning progress not deleted")
+	}
+}
+
+// Tests that with the state trie nodes stored by path, only the state of the
+// recent blocks is retained and it survives a restart.
+func TestPathSchemeStateRetention(t *testing.T) {
+	var (
+		engine = ethash.NewFaker()
+		gspec  = &Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}
+		config = &CacheConfig{
+			TrieCleanLimit: 256,
+			TrieDirtyLimit: 256,
+			TrieTimeLimit:  5 * time.Minute,
+		}
+		db = rawdb.NewMemoryDatabase()
+	)
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+	genesis := gspec.MustCommit(db)
+
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, rawdb.NewMemoryDatabase(), 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{byte(i)})
+	})
+	chain, err := NewBlockChain(db, config, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, block := range blocks {
+		if recent := i >= len(blocks)-TriesInMemory-1; chain.HasState(block.Root()) != recent {
+			t.Fatalf("block #%d: state availability mismatch: have %v, want %v", block.NumberU64(), !recent, recent)
+		}
+	}
+	if err := chain.PruneState(0); err != errPrunePathScheme {
+		t.Fatalf("state pruning error mismatch: have %v, want %v", err, errPrunePathScheme)
+	}
+	chain.Stop()
+
+	// Reopen the chain, the recent states must be restored from the journal
+	chain, err = NewBlockChain(db, config, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock(); head.Hash() != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head block mismatch: have #%d, want #%d", head.NumberU64(), blocks[len(blocks)-1].NumberU64())
+	}
+	for _, block := range blocks[len(blocks)-TriesInMemory:] {
+		if !chain.HasState(block.Root()) {
+			t.Fatalf("block #%d: state missing after restart", block.NumberU64())
+		}
+	}
+	// Archive mode can't be used with the path scheme
+	if _, err := NewBlockChain(db, &CacheConfig{TrieDirtyDisabled: true}, params.TestChainConfig, engine, vm.Config{}, nil, nil); err != errPathSchemeArchive {
+		t.Fatalf("archive mode error mismatch: have %v, want %v", err, errPathSchemeArchive)
+	}
+}
+
+// Tests that with the state trie nodes stored by path, the chain is rewound to
+// the state on disk after a crash, as the diff layers are only journalled on a
+// clean shutdown.
+func TestPathSchemeCrashRecovery(t *testing.T) {
+	var (
+		engine = ethash.NewFaker()
+		gspec  = &Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}
+		config = &CacheConfig{
+			TrieCleanLimit: 256,
+			TrieDirtyLimit: 256,
+			TrieTimeLimit:  5 * time.Minute,
+		}
+		db = rawdb.NewMemoryDatabase()
+	)
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+	genesis := gspec.MustCommit(db)
+
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, rawdb.NewMemoryDatabase(), 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{byte(i)})
+	})
+	chain, err := NewBlockChain(db, config, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Reopen the chain without stopping it, the head is rewound to the block of
+	// the state flattened into disk
+	chain, err = NewBlockChain(db, config, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	disk := blocks[len(blocks)-TriesInMemory-1]
+	if head := chain.CurrentBlock(); head.Hash() != disk.Hash() {
+		t.Fatalf("head block mismatch: have #%d, want #%d", head.NumberU64(), disk.NumberU64())
+	}
+	// The blocks past the disk state are reimported on top of it
+	if _, err := chain.InsertChain(blocks[disk.NumberU64():]); err != nil {
+		t.Fatalf("failed to reimport chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head block mismatch: have #%d, want #%d", head.NumberU64(), blocks[len(blocks)-1].NumberU64())
+	}
+}
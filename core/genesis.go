@@ -178,9 +178,10 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		return genesis.Config, block.Hash(), nil
 	}
 	// We have the genesis block in database(perhaps in ancient database)
-	// but the corresponding state is missing.
+	// but the corresponding state is missing. The state trie nodes stored by
+	// path only hold the recent states, the genesis one is expected missing.
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil {
+	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil && rawdb.ReadStateScheme(db) != rawdb.PathScheme {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
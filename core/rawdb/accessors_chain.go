@@ -216,6 +216,22 @@ func WriteHeadFastBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// ReadFinalizedBlockHash retrieves the hash of the finalized block.
+func ReadFinalizedBlockHash(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headFinalizedBlockKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteFinalizedBlockHash stores the hash of the finalized block.
+func WriteFinalizedBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(headFinalizedBlockKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last finalized block's hash", "err", err)
+	}
+}
+
 // ReadLastPivotNumber retrieves the number of the last pivot block. If the node
 // full synced, the last pivot will always be nil.
 func ReadLastPivotNumber(db ethdb.KeyValueReader) *uint64 {
@@ -429,7 +445,10 @@ func ReadBodyRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue
 		// Check if the data is in ancients
 		if isCanon(reader, number, hash) {
 			data, _ = reader.Ancient(freezerBodiesTable, number)
-			return nil
+			if len(data) > 0 {
+				return nil
+			}
+			// Pruned from the ancients, the genesis is still kept in leveldb
 		}
 		// If not, try reading from leveldb
 		data, _ = db.Get(blockBodyKey(number, hash))
@@ -572,7 +591,10 @@ func ReadReceiptsRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawVa
 		// Check if the data is in ancients
 		if isCanon(reader, number, hash) {
 			data, _ = reader.Ancient(freezerReceiptTable, number)
-			return nil
+			if len(data) > 0 {
+				return nil
+			}
+			// Pruned from the ancients, the genesis is still kept in leveldb
 		}
 		// If not, try reading from leveldb
 		data, _ = db.Get(blockReceiptsKey(number, hash))
@@ -986,3 +1008,61 @@ func ReadHeadBlock(db ethdb.Reader) *types.Block {
 	}
 	return ReadBlock(db, headBlockHash, *headBlockNumber)
 }
+
+// prunedTables are the ancient tables the chain history is pruned from.
+var prunedTables = []string{freezerBodiesTable, freezerReceiptTable}
+
+// ReadHistoryTail retrieves the number of the first block whose body and receipts
+// are still available, zero if the chain history was never pruned. The genesis
+// body and receipts are kept even if pruned from the ancients.
+func ReadHistoryTail(db ethdb.AncientReader) uint64 {
+	var tail uint64
+	for _, kind := range prunedTables {
+		// Tables might be pruned to different tails if interrupted
+		if pruned, err := db.AncientTail(kind); err == nil && pruned > tail {
+			tail = pruned
+		}
+	}
+	return tail
+}
+
+// PruneHistory discards the ancient bodies and receipts of the blocks below the
+// given number, keeping the headers, hashes and total difficulties. The genesis
+// block is always kept in the key-value store, so it remains readable.
+func PruneHistory(db ethdb.Database, tail uint64) error {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if tail > frozen {
+		return fmt.Errorf("history tail %d above the ancient head %d", tail, frozen)
+	}
+	if tail > 0 {
+		hash := ReadCanonicalHash(db, 0)
+		if hash == (common.Hash{}) {
+			return errors.New("genesis not found")
+		}
+		if ok, _ := db.Has(blockBodyKey(0, hash)); !ok {
+			body, err := db.Ancient(freezerBodiesTable, 0)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve genesis body: %v", err)
+			}
+			WriteBodyRLP(db, hash, 0, body)
+		}
+		if ok, _ := db.Has(blockReceiptsKey(0, hash)); !ok {
+			receipts, err := db.Ancient(freezerReceiptTable, 0)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve genesis receipts: %v", err)
+			}
+			if err := db.Put(blockReceiptsKey(0, hash), receipts); err != nil {
+				return err
+			}
+		}
+	}
+	for _, kind := range prunedTables {
+		if err := db.TruncateAncientTail(kind, tail); err != nil {
+			return fmt.Errorf("failed to prune ancient %s: %v", kind, err)
+		}
+	}
+	return nil
+}
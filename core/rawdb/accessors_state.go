@@ -106,3 +106,24 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadStatePruning retrieves the serialized online state pruning progress saved
+// by an interrupted pruning.
+func ReadStatePruning(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(statePruningKey)
+	return data
+}
+
+// WriteStatePruning stores the serialized online state pruning progress.
+func WriteStatePruning(db ethdb.KeyValueWriter, status []byte) {
+	if err := db.Put(statePruningKey, status); err != nil {
+		log.Crit("Failed to store state pruning progress", "err", err)
+	}
+}
+
+// DeleteStatePruning deletes the online state pruning progress.
+func DeleteStatePruning(db ethdb.KeyValueWriter) {
+	if err := db.Delete(statePruningKey); err != nil {
+		log.Crit("Failed to remove state pruning progress", "err", err)
+	}
+}
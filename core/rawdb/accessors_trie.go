@@ -0,0 +1,154 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The list of schemes the state trie nodes can be stored with.
+const (
+	// HashScheme keys the trie nodes by their hash, sharing them between all the
+	// states referencing them. Stale nodes can only be removed by pruning.
+	HashScheme = "hash"
+
+	// PathScheme keys the trie nodes by their owner and path in the trie, keeping
+	// a single version of each node on disk. Stale nodes are overwritten or
+	// deleted in place.
+	PathScheme = "path"
+)
+
+// ReadStateScheme retrieves the scheme the state trie nodes are stored with,
+// defaulting to the hash scheme for databases created before it was recorded.
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	if len(data) == 0 {
+		return HashScheme
+	}
+	return string(data)
+}
+
+// WriteStateScheme stores the scheme the state trie nodes are stored with.
+func WriteStateScheme(db ethdb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
+
+// SetupStateScheme resolves the state scheme to use with the database. The
+// scheme can only be chosen when the database is created, requesting another
+// one for a pre-existing database fails:
+//
+//	                         scheme == ""      scheme != ""
+//	                   +------------------------------------------
+//	db is non-existent |  hash default  |  specified scheme
+//	db is existent     |  from db       |  specified scheme (if compatible)
+func SetupStateScheme(db ethdb.Database, scheme string) (string, error) {
+	if scheme != "" && scheme != HashScheme && scheme != PathScheme {
+		return "", fmt.Errorf("unknown state.scheme %v", scheme)
+	}
+	if stored, _ := db.Get(stateSchemeKey); len(stored) != 0 || ReadCanonicalHash(db, 0) != (common.Hash{}) {
+		existing := ReadStateScheme(db)
+		if scheme != "" && scheme != existing {
+			return "", fmt.Errorf("state.scheme choice was %v but found pre-existing %v state in specified data directory", scheme, existing)
+		}
+		return existing, nil
+	}
+	if scheme == "" {
+		scheme = HashScheme
+	}
+	WriteStateScheme(db, scheme)
+	return scheme, nil
+}
+
+// ReadAccountTrieNode retrieves the account trie node stored at the provided
+// path with the path scheme.
+func ReadAccountTrieNode(db ethdb.KeyValueReader, path []byte) []byte {
+	data, _ := db.Get(accountTrieNodeKey(path))
+	return data
+}
+
+// WriteAccountTrieNode writes the account trie node at the provided path with
+// the path scheme.
+func WriteAccountTrieNode(db ethdb.KeyValueWriter, path []byte, node []byte) {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		log.Crit("Failed to store account trie node", "err", err)
+	}
+}
+
+// DeleteAccountTrieNode deletes the account trie node at the provided path.
+func DeleteAccountTrieNode(db ethdb.KeyValueWriter, path []byte) {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		log.Crit("Failed to delete account trie node", "err", err)
+	}
+}
+
+// ReadStorageTrieNode retrieves the storage trie node of the account stored at
+// the provided path with the path scheme.
+func ReadStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte) []byte {
+	data, _ := db.Get(storageTrieNodeKey(accountHash, path))
+	return data
+}
+
+// WriteStorageTrieNode writes the storage trie node of the account at the
+// provided path with the path scheme.
+func WriteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		log.Crit("Failed to store storage trie node", "err", err)
+	}
+}
+
+// DeleteStorageTrieNode deletes the storage trie node of the account at the
+// provided path.
+func DeleteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte) {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		log.Crit("Failed to delete storage trie node", "err", err)
+	}
+}
+
+// IterateStorageTrieNodes returns an iterator for walking all the storage trie
+// nodes of the account stored with the path scheme.
+func IterateStorageTrieNodes(db ethdb.Iteratee, accountHash common.Hash) ethdb.Iterator {
+	return db.NewIterator(storageTrieNodesKey(accountHash), nil)
+}
+
+// ReadTrieJournal retrieves the serialized in-memory trie node layers saved at
+// the last shutdown.
+func ReadTrieJournal(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(trieJournalKey)
+	return data
+}
+
+// WriteTrieJournal stores the serialized in-memory trie node layers to save at
+// shutdown.
+func WriteTrieJournal(db ethdb.KeyValueWriter, journal []byte) {
+	if err := db.Put(trieJournalKey, journal); err != nil {
+		log.Crit("Failed to store trie journal", "err", err)
+	}
+}
+
+// DeleteTrieJournal deletes the serialized in-memory trie node layers saved at
+// the last shutdown.
+func DeleteTrieJournal(db ethdb.KeyValueWriter) {
+	if err := db.Delete(trieJournalKey); err != nil {
+		log.Crit("Failed to remove trie journal", "err", err)
+	}
+}
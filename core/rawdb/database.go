@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -114,6 +115,16 @@ func (db *nofreezedb) TruncateAncients(items uint64) error {
 	return errNotSupported
 }
 
+// AncientTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) AncientTail(kind string) (uint64, error) {
+	return 0, errNotSupported
+}
+
+// TruncateAncientTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) TruncateAncientTail(kind string, tail uint64) error {
+	return errNotSupported
+}
+
 // Sync returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) Sync() error {
 	return errNotSupported
@@ -266,6 +277,74 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+// The key-value database engines a persistent database can be backed by.
+const (
+	DBPebble  = "pebble"
+	DBLeveldb = "leveldb"
+)
+
+// PreexistingDatabase checks the given data directory whether a database is
+// already instantiated at that location, and if so, returns the type of database
+// (or the empty string).
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	if matches, err := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 || err != nil {
+		if err != nil {
+			panic(err) // only possible if the pattern is malformed
+		}
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// OpenOptions contains the options to apply when opening a database.
+type OpenOptions struct {
+	Type              string // "leveldb" | "pebble"
+	Directory         string // the datadir
+	AncientsDirectory string // the ancients-dir
+	Namespace         string // the namespace for database relevant metrics
+	Cache             int    // the capacity(in megabytes) of the data caching
+	Handles           int    // number of files to be open simultaneously
+	ReadOnly          bool
+}
+
+// Open opens a persistent key-value database, attaching a freezer to it if an
+// ancients directory is given. The database engine of a pre-existing database
+// takes precedence, and requesting another engine fails:
+//
+//	                      type == null          type != null
+//	                   +----------------------------------------
+//	db is non-existent |  leveldb default  |  specified type
+//	db is existent     |  from db          |  specified type (if compatible)
+func Open(o OpenOptions) (ethdb.Database, error) {
+	existingDb := PreexistingDatabase(o.Directory)
+	if len(existingDb) != 0 && len(o.Type) != 0 && o.Type != existingDb {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", o.Type, existingDb)
+	}
+	typ := o.Type
+	if typ == "" {
+		typ = existingDb
+	}
+	switch typ {
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		if o.AncientsDirectory == "" {
+			return NewPebbleDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+		}
+		return NewPebbleDBDatabaseWithFreezer(o.Directory, o.Cache, o.Handles, o.AncientsDirectory, o.Namespace, o.ReadOnly)
+	case DBLeveldb, "":
+		log.Info("Using leveldb as the backing database")
+		if o.AncientsDirectory == "" {
+			return NewLevelDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+		}
+		return NewLevelDBDatabaseWithFreezer(o.Directory, o.Cache, o.Handles, o.AncientsDirectory, o.Namespace, o.ReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown db.engine %v", typ)
+	}
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -363,6 +442,10 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			hashNumPairings.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
+		case bytes.HasPrefix(key, trieNodeAccountPrefix) && len(key) <= len(trieNodeAccountPrefix)+2*common.HashLength:
+			tries.Add(size)
+		case bytes.HasPrefix(key, trieNodeStoragePrefix) && len(key) >= len(trieNodeStoragePrefix)+common.HashLength && len(key) <= len(trieNodeStoragePrefix)+3*common.HashLength:
+			tries.Add(size)
 		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
@@ -392,10 +475,10 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		default:
 			var accounted bool
 			for _, meta := range [][]byte{
-				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
+				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, headFinalizedBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, SnapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey, transitionStatusKey,
+				uncleanShutdownKey, badBlockKey, transitionStatusKey, statePruningKey, stateSchemeKey, trieJournalKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
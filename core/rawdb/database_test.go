@@ -15,3 +15,48 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOpenEngine(t *testing.T) {
+	if !PebbleEnabled {
+		t.Skip("pebble unsupported on this platform")
+	}
+	dir, err := ioutil.TempDir("", "rawdb-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if typ := PreexistingDatabase(dir); typ != "" {
+		t.Fatalf("empty directory detected as %q database", typ)
+	}
+	db, err := Open(OpenOptions{Type: DBPebble, Directory: dir})
+	if err != nil {
+		t.Fatalf("failed to create pebble database: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	db.Close()
+
+	if typ := PreexistingDatabase(dir); typ != DBPebble {
+		t.Fatalf("database type mismatch: have %q, want %q", typ, DBPebble)
+	}
+	if _, err := Open(OpenOptions{Type: DBLeveldb, Directory: dir}); err == nil {
+		t.Fatalf("pebble database opened as leveldb")
+	}
+	// Without an explicit engine, the existing database is opened
+	db, err = Open(OpenOptions{Directory: dir})
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("value mismatch: have %q, %v, want %q", value, err, "value")
+	}
+}
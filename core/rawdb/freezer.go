@@ -239,6 +239,15 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 	return 0, errUnknownTable
 }
 
+// AncientTail returns the number of the first item of the specified category
+// still retrievable from the freezer.
+func (f *freezer) AncientTail(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.tail(), nil
+	}
+	return 0, errUnknownTable
+}
+
 // ReadAncients runs the given read operation while ensuring that no writes take place
 // on the underlying freezer.
 func (f *freezer) ReadAncients(fn func(ethdb.AncientReader) error) (err error) {
@@ -301,6 +310,22 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateAncientTail discards the data of the specified category below the
+// provided threshold number.
+func (f *freezer) TruncateAncientTail(kind string, tail uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	table := f.tables[kind]
+	if table == nil {
+		return errUnknownTable
+	}
+	return table.truncateTail(tail)
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -44,6 +44,10 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errTailAboveHead is returned if the tail of a freezer table is requested to
+	// be truncated beyond its head.
+	errTailAboveHead = errors.New("tail above head")
 )
 
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
@@ -261,6 +265,11 @@ func (t *freezerTable) repair() error {
 	t.tailId = firstIndex.filenum
 	t.itemOffset = firstIndex.offset
 
+	// Put the tail data file of an interrupted tail truncation in place
+	if err := t.repairTail(); err != nil {
+		return err
+	}
+
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
 	if t.readonly {
@@ -382,16 +391,25 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+
+	// If the head drops below the deleted tail items, nothing remains
+	if items < uint64(t.itemOffset) {
+		return t.resetNolock(items, oldSize)
+	}
+	if err := truncateFreezerFile(t.index, int64(items-uint64(t.itemOffset)+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64((items-uint64(t.itemOffset))*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
 	expected.unmarshalBinary(buffer)
+	if items == uint64(t.itemOffset) {
+		// The first index entry carries the tail file, no data remains in it
+		expected = indexEntry{filenum: t.tailId}
+	}
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -425,6 +443,242 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards any historic data below the provided threshold number.
+// The data files before the one of the new tail item are deleted, and the items
+// stored before it in its own file are cut off, so that the first index entry
+// carries the new tail like for any table whose tail files were deleted.
+func (t *freezerTable) truncateTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// If our tail is already high enough, don't do anything
+	if uint64(t.itemOffset) >= items {
+		return nil
+	}
+	head := atomic.LoadUint64(&t.items)
+	if items > head {
+		return errTailAboveHead
+	}
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	// Find where the new tail item starts: right after the item before it, unless
+	// that one filled up its data file, as items never span data files
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	var (
+		first   = int64(items - uint64(t.itemOffset)) // Index entry ending the item before the new tail
+		entries = stat.Size() / indexEntrySize
+		buffer  = make([]byte, indexEntrySize)
+		start   indexEntry
+	)
+	if _, err := t.index.ReadAt(buffer, first*indexEntrySize); err != nil {
+		return err
+	}
+	start.unmarshalBinary(buffer)
+	if first+1 < entries {
+		if _, err := t.index.ReadAt(buffer, (first+1)*indexEntrySize); err != nil {
+			return err
+		}
+		var end indexEntry
+		end.unmarshalBinary(buffer)
+		if end.filenum != start.filenum {
+			start = indexEntry{filenum: end.filenum}
+		}
+	}
+	// Assemble the index of the remaining items, shifting the offsets in the new
+	// tail file by the cut off data
+	kept := make([]byte, (entries-first-1)*indexEntrySize)
+	if _, err := t.index.ReadAt(kept, (first+1)*indexEntrySize); err != nil {
+		return err
+	}
+	index := (&indexEntry{filenum: start.filenum, offset: uint32(items)}).append(nil)
+	for i := 0; i < len(kept); i += indexEntrySize {
+		var entry indexEntry
+		entry.unmarshalBinary(kept[i:])
+		if entry.filenum == start.filenum {
+			entry.offset -= start.offset
+		}
+		index = entry.append(index)
+	}
+	// Write the new index, then the new tail file without the cut off data. Once
+	// the index is replaced, the truncation is completed by repairTail even if
+	// interrupted.
+	if err := writeFileSync(t.index.Name()+".tmp", index); err != nil {
+		return err
+	}
+	if start.offset > 0 {
+		if err := copyFileSync(t.fileName(start.filenum)+".tmp", t.fileName(start.filenum), int64(start.offset)); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(t.index.Name()+".tmp", t.index.Name()); err != nil {
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(t.index.Name()); err != nil {
+		return err
+	}
+	if start.offset > 0 {
+		t.releaseFile(start.filenum)
+		if err := os.Rename(t.fileName(start.filenum)+".tmp", t.fileName(start.filenum)); err != nil {
+			return err
+		}
+		if start.filenum == t.headId {
+			if t.head, err = t.openFile(t.headId, openFreezerFileForAppend); err != nil {
+				return err
+			}
+			t.headBytes -= int64(start.offset)
+		} else if _, err := t.openFile(start.filenum, openFreezerFileForReadOnly); err != nil {
+			return err
+		}
+	}
+	// Delete the data files below the new tail
+	for id := t.tailId; id < start.filenum; id++ {
+		t.releaseFile(id)
+		if err := os.Remove(t.fileName(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.tailId, t.itemOffset = start.filenum, uint32(items)
+	t.logger.Info("Truncated freezer table tail", "tail", items)
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
+// repairTail completes or discards a tail truncation interrupted by a crash. The
+// new index is written before the new tail data file and put in place first: a
+// pending index means the truncation didn't take effect yet, while a pending
+// data file without it must replace the tail data file to match the index.
+func (t *freezerTable) repairTail() error {
+	pending, err := filepath.Glob(filepath.Join(t.path, t.name+".*.tmp"))
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	if t.readonly {
+		return fmt.Errorf("interrupted tail truncation of freezer table %s", t.name)
+	}
+	if _, err := os.Stat(t.index.Name() + ".tmp"); err == nil {
+		t.logger.Warn("Discarding interrupted tail truncation")
+		for _, name := range pending {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tail := t.fileName(t.tailId) + ".tmp"
+	for _, name := range pending {
+		if name != tail {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+		t.logger.Warn("Completing interrupted tail truncation", "tail", t.itemOffset)
+		t.releaseFile(t.tailId)
+		if err := os.Rename(name, t.fileName(t.tailId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetNolock discards all data of the freezer table, starting it over empty at
+// the given item number in its current head file. The caller must hold the write
+// lock.
+func (t *freezerTable) resetNolock(items uint64, oldSize uint64) error {
+	index := indexEntry{filenum: t.headId, offset: uint32(items)}
+	if err := t.replaceIndex(index.append(nil)); err != nil {
+		return err
+	}
+	for id := t.tailId; id < t.headId; id++ {
+		t.releaseFile(id)
+		if err := os.Remove(t.fileName(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := truncateFreezerFile(t.head, 0); err != nil {
+		return err
+	}
+	t.tailId, t.itemOffset, t.headBytes = t.headId, uint32(items), 0
+	atomic.StoreUint64(&t.items, items)
+
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
+// replaceIndex atomically replaces the content of the index file. The caller
+// must hold the write lock.
+func (t *freezerTable) replaceIndex(content []byte) error {
+	name := t.index.Name()
+	if err := writeFileSync(name+".tmp", content); err != nil {
+		return err
+	}
+	if err := t.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	index, err := openFreezerFileForAppend(name)
+	if err != nil {
+		return err
+	}
+	t.index = index
+	return nil
+}
+
+// copyFileSync copies the content of the src file from the given offset on into
+// the dst file and flushes it to disk.
+func copyFileSync(dst, src string, offset int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// writeFileSync writes the content to the named file and flushes it to disk.
+func writeFileSync(name string, content []byte) error {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -453,13 +707,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(t.fileName(num))
 		if err != nil {
 			return nil, err
 		}
@@ -468,6 +716,17 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the path of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	var name string
+	if t.noCompression {
+		name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	} else {
+		name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
+	}
+	return filepath.Join(t.path, name)
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -673,7 +932,18 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return atomic.LoadUint64(&t.items) > number && uint64(t.itemOffset) <= number
+}
+
+// tail returns the number of the first item retrievable from the freezer table.
+func (t *freezerTable) tail() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return uint64(t.itemOffset)
 }
 
 // size returns the total data size in the freezer table.
@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -516,6 +517,188 @@ func TestFreezerReadAndTruncate(t *testing.T) {
 	}
 }
 
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-%d", rand.Uint64())
+
+	// Fill table with 8 x 20 bytes, two items per file
+	f, err := newTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := f.newBatch()
+	for x := 0; x < 8; x++ {
+		require.NoError(t, batch.AppendRaw(uint64(x), getChunk(20, 0xFF-x)))
+	}
+	require.NoError(t, batch.commit())
+
+	checkRetrieve := func(f *freezerTable, tail uint64) {
+		t.Helper()
+		if have := f.tail(); have != tail {
+			t.Fatalf("tail mismatch: have %d, want %d", have, tail)
+		}
+		for x := uint64(0); x < 8; x++ {
+			blob, err := f.Retrieve(x)
+			if x < tail {
+				if err != errOutOfBounds {
+					t.Fatalf("item %d: expected out of bounds, got %v", x, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("item %d: failed to retrieve: %v", x, err)
+			}
+			if exp := getChunk(20, 0xFF-int(x)); !bytes.Equal(blob, exp) {
+				t.Fatalf("item %d: have %x, want %x", x, blob, exp)
+			}
+		}
+	}
+	checkFiles := func(deleted, kept []int) {
+		t.Helper()
+		for _, id := range deleted {
+			if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%v.%04d.rdat", fname, id))); !os.IsNotExist(err) {
+				t.Fatalf("data file %d not deleted: %v", id, err)
+			}
+		}
+		for _, id := range kept {
+			if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%v.%04d.rdat", fname, id))); err != nil {
+				t.Fatalf("data file %d missing: %v", id, err)
+			}
+		}
+	}
+	// Hide an item of the first file, nothing can be deleted yet
+	require.NoError(t, f.truncateTail(1))
+	checkRetrieve(f, 1)
+	checkFiles(nil, []int{0, 1, 2, 3})
+
+	// Truncate into the middle of the second file, dropping the first one
+	require.NoError(t, f.truncateTail(3))
+	checkRetrieve(f, 3)
+	checkFiles([]int{0}, []int{1, 2, 3})
+
+	// Lower thresholds are ignored, thresholds above the head rejected
+	require.NoError(t, f.truncateTail(2))
+	checkRetrieve(f, 3)
+	if err := f.truncateTail(9); err != errTailAboveHead {
+		t.Fatalf("expected %v, got %v", errTailAboveHead, err)
+	}
+	// The tail must survive a restart
+	f.Close()
+	f, err = newTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 3)
+
+	require.NoError(t, f.truncateTail(6))
+	checkRetrieve(f, 6)
+	checkFiles([]int{0, 1, 2}, []int{3})
+
+	// Truncating the head below the tail empties the table
+	require.NoError(t, f.truncate(7))
+	if _, err := f.Retrieve(6); err != nil {
+		t.Fatalf("failed to retrieve item 6: %v", err)
+	}
+	require.NoError(t, f.truncate(5))
+	if f.items != 5 || f.tail() != 5 {
+		t.Fatalf("table mismatch after head truncation: items %d, tail %d", f.items, f.tail())
+	}
+	// The emptied table can be appended to at its head
+	batch = f.newBatch()
+	require.NoError(t, batch.AppendRaw(5, getChunk(20, 0xAA)))
+	require.NoError(t, batch.commit())
+	f.Close()
+
+	f, err = newTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if blob, err := f.Retrieve(5); err != nil || !bytes.Equal(blob, getChunk(20, 0xAA)) {
+		t.Fatalf("item 5 mismatch after reopen: %x, %v", blob, err)
+	}
+	if _, err := f.Retrieve(4); err != errOutOfBounds {
+		t.Fatalf("expected out of bounds for item 4, got %v", err)
+	}
+}
+
+func TestFreezerTruncateTailRepair(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-repair-%d", rand.Uint64())
+	dataFile := func(id int) string {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("%v.%04d.rdat", fname, id))
+	}
+	indexFile := filepath.Join(os.TempDir(), fmt.Sprintf("%v.ridx", fname))
+
+	// Fill table with 6 x 20 bytes, three items per file
+	f, err := newTable(os.TempDir(), fname, rm, wm, sg, 60, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := f.newBatch()
+	for x := 0; x < 6; x++ {
+		require.NoError(t, batch.AppendRaw(uint64(x), getChunk(20, 0xFF-x)))
+	}
+	require.NoError(t, batch.commit())
+	f.Close()
+
+	checkRetrieve := func(tail uint64) {
+		t.Helper()
+		f, err := newTable(os.TempDir(), fname, rm, wm, sg, 60, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if have := f.tail(); have != tail {
+			t.Fatalf("tail mismatch: have %d, want %d", have, tail)
+		}
+		for x := tail; x < 6; x++ {
+			blob, err := f.Retrieve(x)
+			if err != nil {
+				t.Fatalf("item %d: failed to retrieve: %v", x, err)
+			}
+			if exp := getChunk(20, 0xFF-int(x)); !bytes.Equal(blob, exp) {
+				t.Fatalf("item %d: have %x, want %x", x, blob, exp)
+			}
+		}
+	}
+	// A truncation interrupted before the index is replaced is discarded
+	require.NoError(t, ioutil.WriteFile(indexFile+".tmp", []byte{0x01}, 0644))
+	require.NoError(t, ioutil.WriteFile(dataFile(1)+".tmp", []byte{0x02}, 0644))
+	checkRetrieve(0)
+	for _, name := range []string{indexFile + ".tmp", dataFile(1) + ".tmp"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("pending file %s not removed: %v", name, err)
+		}
+	}
+	// A truncation interrupted after the index is replaced is completed
+	old, err := ioutil.ReadFile(dataFile(1))
+	require.NoError(t, err)
+
+	f, err = newTable(os.TempDir(), fname, rm, wm, sg, 60, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.NoError(t, f.truncateTail(4))
+	f.Close()
+
+	// The tail is carried by the first index entry
+	index, err := ioutil.ReadFile(indexFile)
+	require.NoError(t, err)
+	var first indexEntry
+	first.unmarshalBinary(index)
+	if first.filenum != 1 || first.offset != 4 {
+		t.Fatalf("first index entry mismatch: have %+v, want file 1, offset 4", first)
+	}
+	cut, err := ioutil.ReadFile(dataFile(1))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(dataFile(1)+".tmp", cut, 0644))
+	require.NoError(t, ioutil.WriteFile(dataFile(1), old, 0644))
+	checkRetrieve(4)
+}
+
 func TestFreezerOffset(t *testing.T) {
 	t.Parallel()
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
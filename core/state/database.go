@@ -89,8 +89,9 @@ type Trie interface {
 	Hash() common.Hash
 
 	// Commit writes all nodes to the trie's memory database, tracking the internal
-	// and external (for account tries) references.
-	Commit(onleaf trie.LeafCallback) (common.Hash, int, error)
+	// and external (for account tries) references. The committed nodes are
+	// returned to be sealed into the new state by the trie database.
+	Commit(onleaf trie.LeafCallback) (common.Hash, *trie.NodeSet, error)
 
 	// NodeIterator returns an iterator that returns nodes of the trie. Iteration
 	// starts at the key after the given start key.
@@ -142,7 +143,7 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 
 // OpenStorageTrie opens the storage trie of an account.
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	tr, err := trie.NewSecure(root, db.db)
+	tr, err := trie.NewSecureWithOwner(addrHash, root, db.db)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,521 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// defaultOnlineBloomSize is the size of the online pruning bloom filter in
+	// megabytes, if none is specified.
+	defaultOnlineBloomSize = 2048
+
+	// Phases of the online pruning reported in the progress.
+	phaseGenerating = "generating"
+	phasePruning    = "pruning"
+	phaseCompacting = "compacting"
+)
+
+var (
+	// ErrPruningRunning is returned if the online pruning is requested while
+	// another one is in progress.
+	ErrPruningRunning = errors.New("state pruning already running")
+
+	// errPruningInterrupted is returned if the online pruning is stopped before
+	// it completed.
+	errPruningInterrupted = errors.New("state pruning interrupted")
+)
+
+// pruningStatus is the online pruning progress persisted in the database, so an
+// interrupted pruning is resumed on the next startup.
+type pruningStatus struct {
+	Root      common.Hash // State root retained by the pruning
+	BloomSize uint64      // Size of the bloom filter in megabytes
+	Marker    []byte      // Database key the deletion continues from
+	Nodes     uint64      // Number of state entries deleted so far
+	Size      uint64      // Size of the state entries deleted so far
+}
+
+// Progress is the progress report of a running online state pruning.
+type Progress struct {
+	Phase    string             `json:"phase"`    // Current phase: generating, pruning or compacting
+	Root     common.Hash        `json:"root"`     // State root retained by the pruning
+	Percent  float64            `json:"percent"`  // Estimated progress of the current phase
+	Marker   hexutil.Bytes      `json:"marker"`   // Last account or database key processed
+	Retained uint64             `json:"retained"` // Number of state entries added to the bloom filter
+	Pruned   uint64             `json:"pruned"`   // Number of state entries deleted
+	Size     common.StorageSize `json:"size"`     // Size of the state entries deleted
+	Started  time.Time          `json:"started"`  // Time the pruning was started or resumed
+}
+
+// OnlinePruner prunes the stale state of a live chain in the background. Like
+// the offline Pruner, it fills a bloom filter with the state entries of the
+// target state and deletes every other trie node and contract code from the
+// database, but it keeps the node running meanwhile:
+//
+//   - the chain makes sure the target state is fully persisted and no older state
+//     is committed while pruning, flattening the snapshot into the target and
+//     dropping the older tries from memory
+//   - the state entries written by the chain while pruning are recorded into the
+//     bloom filter before they reach the disk, see Database
+//   - the deletions are checked against the bloom filter and written under the
+//     same lock, so a node written back by the chain is never lost
+//
+// The bloom filter is generated from the committed trie of the target state,
+// since the snapshot layers of a live chain are flattened long before a large
+// state is iterated. The deletion marker is persisted with every batch of
+// deletions. An interrupted pruning is resumed from it, retaining the state
+// of the head the chain restarted with.
+type OnlinePruner struct {
+	db ethdb.Database
+
+	bloom *stateBloom  // Filter of the retained state entries, nil if not pruning
+	lock  sync.RWMutex // Lock protecting the bloom, held while deletions are written
+
+	progress *Progress    // Progress of the running pruning, nil if not pruning
+	plock    sync.RWMutex // Lock protecting the progress
+
+	quit chan struct{} // Quit channel of the running pruning
+	done chan struct{} // Closed when the running pruning exits
+}
+
+// NewOnlinePruner creates an idle online pruner of the given database.
+func NewOnlinePruner(db ethdb.Database) *OnlinePruner {
+	return &OnlinePruner{db: db}
+}
+
+// Database returns the view of the pruned database the chain must write its
+// state through, recording the state entries into the bloom filter while
+// pruning.
+func (p *OnlinePruner) Database() ethdb.Database {
+	return &protectedDatabase{Database: p.db, pruner: p}
+}
+
+// Interrupted reports whether an interrupted pruning is waiting to be resumed.
+func (p *OnlinePruner) Interrupted() bool {
+	return len(rawdb.ReadStatePruning(p.db)) > 0
+}
+
+// Discard drops the progress of an interrupted pruning. The entries it didn't
+// reach are left stale in the database.
+func (p *OnlinePruner) Discard() {
+	rawdb.DeleteStatePruning(p.db)
+}
+
+// Start begins pruning every state but the one with the given root and the
+// ones committed after it, resuming the interrupted pruning if there's one. The
+// bloomSize is the size of the bloom filter in megabytes, zero to use the
+// interrupted pruning's or the default one.
+//
+// The caller must ensure the state of the root is fully persisted and must not
+// persist any older state while the pruning is running. No state may be written
+// concurrently with Start.
+func (p *OnlinePruner) Start(root common.Hash, bloomSize uint64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.bloom != nil {
+		return ErrPruningRunning
+	}
+	var status pruningStatus
+	if blob := rawdb.ReadStatePruning(p.db); len(blob) > 0 {
+		if err := rlp.DecodeBytes(blob, &status); err != nil {
+			log.Warn("Failed to decode state pruning progress", "err", err)
+			status = pruningStatus{}
+		} else {
+			log.Info("Resuming state pruning", "root", root, "marker", hexutil.Bytes(status.Marker))
+		}
+	}
+	if bloomSize == 0 {
+		bloomSize = status.BloomSize
+	}
+	if bloomSize == 0 {
+		bloomSize = defaultOnlineBloomSize
+	}
+	// Sanitize the bloom filter size if it's too small.
+	if bloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", bloomSize, "updated(MB)", 256)
+		bloomSize = 256
+	}
+	bloom, err := newStateBloomWithSize(bloomSize)
+	if err != nil {
+		return err
+	}
+	status.Root, status.BloomSize = root, bloomSize
+	if err := writeStatus(p.db, &status); err != nil {
+		return err
+	}
+	p.bloom = bloom
+	p.quit, p.done = make(chan struct{}), make(chan struct{})
+
+	p.plock.Lock()
+	p.progress = &Progress{
+		Phase:   phaseGenerating,
+		Root:    root,
+		Pruned:  status.Nodes,
+		Size:    common.StorageSize(status.Size),
+		Started: time.Now(),
+	}
+	p.plock.Unlock()
+
+	go p.run(&status, p.quit, p.done)
+	return nil
+}
+
+// Stop interrupts the running pruning, if any, and waits for it to exit. The
+// pruning is resumed from where it stopped on the next Start.
+func (p *OnlinePruner) Stop() {
+	p.lock.RLock()
+	quit, done := p.quit, p.done
+	p.lock.RUnlock()
+
+	if quit == nil {
+		return
+	}
+	select {
+	case <-quit:
+	default:
+		close(quit)
+	}
+	<-done
+}
+
+// Progress returns the progress of the running pruning, nil if none is running.
+func (p *OnlinePruner) Progress() *Progress {
+	p.plock.RLock()
+	defer p.plock.RUnlock()
+
+	if p.progress == nil {
+		return nil
+	}
+	progress := *p.progress
+	return &progress
+}
+
+// run generates the bloom filter of the retained state and deletes all other
+// state entries, persisting its progress along the way.
+func (p *OnlinePruner) run(status *pruningStatus, quit chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	err := p.prune(status, quit)
+	switch err {
+	case nil:
+		rawdb.DeleteStatePruning(p.db)
+		log.Info("State pruning successful", "pruned", status.Nodes, "size", common.StorageSize(status.Size))
+	case errPruningInterrupted:
+		log.Info("State pruning interrupted", "marker", hexutil.Bytes(status.Marker))
+	default:
+		log.Error("State pruning failed", "err", err)
+	}
+	p.plock.Lock()
+	p.progress = nil
+	p.plock.Unlock()
+
+	p.lock.Lock()
+	p.bloom, p.quit, p.done = nil, nil, nil
+	p.lock.Unlock()
+}
+
+// prune runs the phases of the online pruning.
+func (p *OnlinePruner) prune(status *pruningStatus, quit chan struct{}) error {
+	start := time.Now()
+	log.Info("Generating state bloom filter", "root", status.Root)
+
+	// Traverse the target state and the genesis state, committing all their
+	// entries to the bloom filter.
+	logged := time.Now()
+	onAccount := func(hash common.Hash) error {
+		select {
+		case <-quit:
+			return errPruningInterrupted
+		default:
+		}
+		p.plock.Lock()
+		p.progress.Marker, p.progress.Percent = hash.Bytes(), position(hash.Bytes())
+		p.plock.Unlock()
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state bloom filter", "at", hash, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		return nil
+	}
+	retained := &bloomWriter{pruner: p}
+	if err := extractState(p.db, status.Root, retained, onAccount); err != nil {
+		return err
+	}
+	genesis := rawdb.ReadHeader(p.db, rawdb.ReadCanonicalHash(p.db, 0), 0)
+	if genesis == nil {
+		return errors.New("missing genesis header")
+	}
+	if err := extractState(p.db, genesis.Root, retained, nil); err != nil {
+		return err
+	}
+	p.plock.Lock()
+	p.progress.Retained = retained.count
+	p.plock.Unlock()
+	log.Info("Generated state bloom filter", "entries", retained.count, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Delete all the state entries not retained by the bloom filter
+	p.plock.Lock()
+	p.progress.Phase, p.progress.Marker, p.progress.Percent = phasePruning, status.Marker, 0
+	p.plock.Unlock()
+
+	pruned := status.Nodes
+	if err := p.sweep(status, quit); err != nil {
+		return err
+	}
+	// Compact the database if enough entries were removed
+	if status.Nodes-pruned >= rangeCompactionThreshold {
+		p.plock.Lock()
+		p.progress.Phase = phaseCompacting
+		p.plock.Unlock()
+
+		if err := compact(p.db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweep iterates the database from the marker of the status, deleting all the
+// trie nodes and contract codes not contained in the bloom filter.
+func (p *OnlinePruner) sweep(status *pruningStatus, quit chan struct{}) error {
+	var (
+		keys   [][]byte
+		sizes  []int
+		size   int
+		iter   = p.db.NewIterator(nil, status.Marker)
+		start  = time.Now()
+		logged = time.Now()
+	)
+	defer func() { iter.Release() }()
+
+	// flush deletes the collected entries which were not written back since
+	// they were checked, persisting the marker atomically with them. A nil
+	// marker finishes the sweep.
+	flush := func(marker []byte) error {
+		batch := p.db.NewBatch()
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		for i, key := range keys {
+			if ok, _ := p.bloom.Contain(bloomKey(key)); ok {
+				continue
+			}
+			batch.Delete(key)
+			status.Nodes++
+			status.Size += uint64(sizes[i])
+		}
+		status.Marker = marker
+		if marker == nil {
+			rawdb.DeleteStatePruning(batch)
+		} else if err := writeStatus(batch, status); err != nil {
+			return err
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		keys, sizes, size = keys[:0], sizes[:0], 0
+
+		p.plock.Lock()
+		p.progress.Marker, p.progress.Percent = common.CopyBytes(marker), position(marker)
+		p.progress.Pruned, p.progress.Size = status.Nodes, common.StorageSize(status.Size)
+		p.plock.Unlock()
+		return nil
+	}
+	for iter.Next() {
+		key := iter.Key()
+		select {
+		case <-quit:
+			if err := flush(common.CopyBytes(key)); err != nil {
+				return err
+			}
+			return errPruningInterrupted
+		default:
+		}
+		if !isStateKey(key) {
+			continue
+		}
+		p.lock.RLock()
+		retained, _ := p.bloom.Contain(bloomKey(key))
+		p.lock.RUnlock()
+		if retained {
+			continue
+		}
+		keys = append(keys, common.CopyBytes(key))
+		sizes = append(sizes, len(key)+len(iter.Value()))
+		size += len(key) + len(iter.Value())
+
+		// Recreate the iterator after every batch commit in order
+		// to allow the underlying compactor to delete the entries.
+		if size >= ethdb.IdealBatchSize {
+			marker := common.CopyBytes(key)
+			if err := flush(marker); err != nil {
+				return err
+			}
+			iter.Release()
+			iter = p.db.NewIterator(nil, marker)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", status.Nodes, "size", common.StorageSize(status.Size),
+				"at", hexutil.Bytes(key), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return flush(nil)
+}
+
+// mark records the state entry with the given key into the bloom filter, if a
+// pruning is running.
+func (p *OnlinePruner) mark(keys [][]byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.bloom == nil {
+		return
+	}
+	for _, key := range keys {
+		p.bloom.Put(key, nil)
+	}
+}
+
+// writeStatus persists the online pruning progress.
+func writeStatus(db ethdb.KeyValueWriter, status *pruningStatus) error {
+	blob, err := rlp.EncodeToBytes(status)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteStatePruning(db, blob)
+	return nil
+}
+
+// bloomKey returns the key a state entry is recorded with in the bloom filter.
+func bloomKey(key []byte) []byte {
+	if isCode, codeKey := rawdb.IsCodeKey(key); isCode {
+		return codeKey
+	}
+	return key
+}
+
+// isStateKey reports whether the database key is a trie node or a contract code.
+func isStateKey(key []byte) bool {
+	isCode, _ := rawdb.IsCodeKey(key)
+	return len(key) == common.HashLength || isCode
+}
+
+// position estimates the progress of an iteration over the hash space from the
+// first bytes of the current key.
+func position(key []byte) float64 {
+	if len(key) == 0 {
+		return 0
+	}
+	var buf [8]byte
+	copy(buf[:], key)
+	return float64(binary.BigEndian.Uint64(buf[:])) / math.MaxUint64 * 100
+}
+
+// bloomWriter records the state entries written into it into the bloom filter
+// of the running pruning.
+type bloomWriter struct {
+	pruner *OnlinePruner
+	count  uint64
+}
+
+// Put implements the KeyValueWriter interface. But here only the key is needed.
+func (w *bloomWriter) Put(key []byte, value []byte) error {
+	w.pruner.lock.Lock()
+	defer w.pruner.lock.Unlock()
+
+	w.count++
+	if w.count%100000 == 0 {
+		w.pruner.plock.Lock()
+		w.pruner.progress.Retained = w.count
+		w.pruner.plock.Unlock()
+	}
+	return w.pruner.bloom.Put(key, nil)
+}
+
+// Delete removes the key from the key-value data store.
+func (w *bloomWriter) Delete(key []byte) error { panic("not supported") }
+
+// protectedDatabase is the database the chain writes its state through while
+// an online pruning may be running. It records every trie node and contract
+// code into the bloom filter before writing it.
+type protectedDatabase struct {
+	ethdb.Database
+	pruner *OnlinePruner
+}
+
+// Put inserts the given value into the key-value data store.
+func (db *protectedDatabase) Put(key []byte, value []byte) error {
+	if isStateKey(key) {
+		db.pruner.mark([][]byte{key})
+	}
+	return db.Database.Put(key, value)
+}
+
+// NewBatch creates a write-only database that buffers changes to its host db
+// until a final write is called.
+func (db *protectedDatabase) NewBatch() ethdb.Batch {
+	return &protectedBatch{Batch: db.Database.NewBatch(), pruner: db.pruner}
+}
+
+// protectedBatch is a batch recording its trie nodes and contract codes into
+// the bloom filter of the running pruning when it's written.
+type protectedBatch struct {
+	ethdb.Batch
+	pruner *OnlinePruner
+	keys   [][]byte
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *protectedBatch) Put(key []byte, value []byte) error {
+	if isStateKey(key) {
+		b.keys = append(b.keys, common.CopyBytes(key))
+	}
+	return b.Batch.Put(key, value)
+}
+
+// Write flushes any accumulated data to disk, after the state entries were
+// recorded so the pruning can't delete them anymore.
+func (b *protectedBatch) Write() error {
+	b.pruner.mark(b.keys)
+	return b.Batch.Write()
+}
+
+// Reset resets the batch for reuse.
+func (b *protectedBatch) Reset() {
+	b.Batch.Reset()
+	b.keys = b.keys[:0]
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// interruptDatabase is a database calling a hook after the first batch written
+// to it, which the online pruner only does while sweeping.
+type interruptDatabase struct {
+	ethdb.Database
+	hook func()
+}
+
+func (db *interruptDatabase) NewBatch() ethdb.Batch {
+	return &interruptBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+type interruptBatch struct {
+	ethdb.Batch
+	db *interruptDatabase
+}
+
+func (b *interruptBatch) Write() error {
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	if hook := b.db.hook; hook != nil {
+		b.db.hook = nil
+		hook()
+	}
+	return nil
+}
+
+// keySet collects the keys of the state entries written into it.
+type keySet map[string]struct{}
+
+func (s keySet) Put(key []byte, value []byte) error { s[string(key)] = struct{}{}; return nil }
+func (s keySet) Delete(key []byte) error            { panic("not supported") }
+
+// commitState commits accounts with the given balances into the database.
+func commitState(t *testing.T, db ethdb.Database, accounts int, balance int64) common.Hash {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	for i := 0; i < accounts; i++ {
+		statedb.AddBalance(common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(balance+int64(i)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return root
+}
+
+// waitPruning waits until the running pruning exits.
+func waitPruning(p *OnlinePruner) {
+	p.lock.RLock()
+	done := p.done
+	p.lock.RUnlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Tests that an online pruning interrupted in the middle of the sweep resumes
+// from its marker on restart, deleting the remaining stale state while keeping
+// the retained one intact.
+func TestOnlinePruningResume(t *testing.T) {
+	const accounts = 3000
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := &types.Header{Number: new(big.Int), Root: emptyRoot}
+	rawdb.WriteHeader(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+
+	stale, root := commitState(t, db, accounts, 1), commitState(t, db, accounts, 2)
+
+	retained, staleKeys := make(keySet), make(keySet)
+	if err := extractState(db, root, retained, nil); err != nil {
+		t.Fatalf("failed to extract retained state: %v", err)
+	}
+	if err := extractState(db, stale, staleKeys, nil); err != nil {
+		t.Fatalf("failed to extract stale state: %v", err)
+	}
+	for key := range retained {
+		delete(staleKeys, key)
+	}
+	countStale := func() (count int) {
+		for key := range staleKeys {
+			if ok, _ := db.Has([]byte(key)); ok {
+				count++
+			}
+		}
+		return count
+	}
+	// Interrupt the pruning right after its first batch of deletions
+	idb := &interruptDatabase{Database: db}
+	p := NewOnlinePruner(idb)
+	idb.hook = func() { close(p.quit) }
+	if err := p.Start(root, 0); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	waitPruning(p)
+
+	if !p.Interrupted() {
+		t.Fatalf("pruning not interrupted")
+	}
+	if left := countStale(); left == 0 || left == len(staleKeys) {
+		t.Fatalf("pruning not interrupted mid-sweep: %d of %d stale entries left", left, len(staleKeys))
+	}
+	// Restart the pruning on a fresh pruner, as after a node restart
+	p = NewOnlinePruner(db)
+	if !p.Interrupted() {
+		t.Fatalf("interrupted pruning not detected after restart")
+	}
+	if err := p.Start(root, 0); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	waitPruning(p)
+
+	if p.Interrupted() {
+		t.Fatalf("resumed pruning didn't complete")
+	}
+	if left := countStale(); left != 0 {
+		t.Errorf("stale entries left after resumed pruning: %d", left)
+	}
+	for key := range retained {
+		if ok, _ := db.Has([]byte(key)); !ok {
+			t.Fatalf("retained state entry %x deleted", key)
+		}
+	}
+	statedb, err := state.New(root, state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open retained state: %v", err)
+	}
+	for i := 0; i < accounts; i++ {
+		if balance := statedb.GetBalance(common.BigToAddress(big.NewInt(int64(i + 1)))); balance.Int64() != int64(2+i) {
+			t.Fatalf("account %d balance mismatch: have %d, want %d", i, balance, 2+i)
+		}
+	}
+}
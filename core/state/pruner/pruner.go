@@ -85,6 +85,9 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errors.New("state pruning is unavailable with the path state scheme")
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("Failed to load head block")
@@ -207,27 +210,36 @@ func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, sta
 	// Start compactions, will remove the deleted data from the disk immediately.
 	// Note for small pruning, the compaction is skipped.
 	if count >= rangeCompactionThreshold {
-		cstart := time.Now()
-		for b := 0x00; b <= 0xf0; b += 0x10 {
-			var (
-				start = []byte{byte(b)}
-				end   = []byte{byte(b + 0x10)}
-			)
-			if b == 0xf0 {
-				end = nil
-			}
-			log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
-			if err := maindb.Compact(start, end); err != nil {
-				log.Error("Database compaction failed", "error", err)
-				return err
-			}
+		if err := compact(maindb); err != nil {
+			return err
 		}
-		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
 	}
 	log.Info("State pruning successful", "pruned", size, "elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
 
+// compact runs a compaction over the entire database in sixteen ranges, to
+// remove the deleted state data from the disk.
+func compact(maindb ethdb.Database) error {
+	cstart := time.Now()
+	for b := 0x00; b <= 0xf0; b += 0x10 {
+		var (
+			start = []byte{byte(b)}
+			end   = []byte{byte(b + 0x10)}
+		)
+		if b == 0xf0 {
+			end = nil
+		}
+		log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+		if err := maindb.Compact(start, end); err != nil {
+			log.Error("Database compaction failed", "error", err)
+			return err
+		}
+	}
+	log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	return nil
+}
+
 // Prune deletes all historical state nodes except the nodes belong to the
 // specified state version. If user doesn't specify the state version, use
 // the bottom-most snapshot diff layer as the target.
@@ -410,7 +422,15 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 	if genesis == nil {
 		return errors.New("missing genesis block")
 	}
-	t, err := trie.NewSecure(genesis.Root(), trie.NewDatabase(db))
+	return extractState(db, genesis.Root(), stateBloom, nil)
+}
+
+// extractState loads the state with the given root and commits all the trie
+// nodes and contract code hashes into the given writer. The optional callback
+// is invoked on every account, aborting the traversal if it returns an error.
+func extractState(db ethdb.Database, root common.Hash, w ethdb.KeyValueWriter, onAccount func(hash common.Hash) error) error {
+	triedb := trie.NewDatabase(db)
+	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		return err
 	}
@@ -420,17 +440,22 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 
 		// Embedded nodes don't have hash.
 		if hash != (common.Hash{}) {
-			stateBloom.Put(hash.Bytes(), nil)
+			w.Put(hash.Bytes(), nil)
 		}
 		// If it's a leaf node, yes we are touching an account,
 		// dig into the storage trie further.
 		if accIter.Leaf() {
+			if onAccount != nil {
+				if err := onAccount(common.BytesToHash(accIter.LeafKey())); err != nil {
+					return err
+				}
+			}
 			var acc types.StateAccount
 			if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
 				return err
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, trie.NewDatabase(db))
+				storageTrie, err := trie.NewSecure(acc.Root, triedb)
 				if err != nil {
 					return err
 				}
@@ -438,7 +463,7 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 				for storageIter.Next(true) {
 					hash := storageIter.Hash()
 					if hash != (common.Hash{}) {
-						stateBloom.Put(hash.Bytes(), nil)
+						w.Put(hash.Bytes(), nil)
 					}
 				}
 				if storageIter.Error() != nil {
@@ -446,7 +471,7 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 				}
 			}
 			if !bytes.Equal(acc.CodeHash, emptyCode) {
-				stateBloom.Put(acc.CodeHash, nil)
+				w.Put(acc.CodeHash, nil)
 			}
 		}
 	}
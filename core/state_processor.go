@@ -85,8 +85,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 
 	for i, tx := range block.Transactions() {
 		if p.config.ChaophrayaBlock != nil && p.config.IsChaophraya(blockNumber) {
+			// System transactions trail the block. After the system transaction
+			// fork, anything following the first one is handed to the engine to
+			// be validated as one as well.
 			isSystemTx, _ := posa.IsSystemTransaction(tx, block.Header(), p.bc)
-			if isSystemTx {
+			if isSystemTx || (len(systemTxs) > 0 && p.config.IsChaophrayaSystemTx(blockNumber)) {
 				systemTxs = append(systemTxs, tx)
 				continue
 			}
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
@@ -429,13 +430,13 @@ type storageEntry struct {
 }
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
-func (api *PrivateDebugAPI) StorageRangeAt(blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
+func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
 	// Retrieve the block
 	block := api.eth.blockchain.GetBlockByHash(blockHash)
 	if block == nil {
 		return StorageRangeResult{}, fmt.Errorf("block %#x not found", blockHash)
 	}
-	_, _, statedb, err := api.eth.stateAtTransaction(block, txIndex, 0)
+	_, _, statedb, err := api.eth.stateAtTransaction(ctx, block, txIndex, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -612,3 +613,41 @@ func (api *PrivateDebugAPI) GetAccessibleState(from, to rpc.BlockNumber) (uint64
 	}
 	return 0, fmt.Errorf("No state found")
 }
+
+// PruneState starts deleting the stale state of the node in the background,
+// retaining the state of the current head and the ones imported after it. The
+// optional bloomSize is the size of the bloom filter in megabytes.
+func (api *PrivateDebugAPI) PruneState(bloomSize *uint64) error {
+	if !api.eth.Synced() {
+		return errors.New("state pruning unavailable while syncing")
+	}
+	var size uint64
+	if bloomSize != nil {
+		size = *bloomSize
+	}
+	return api.eth.blockchain.PruneState(size)
+}
+
+// StatePruningProgress returns the progress of the running state pruning, null
+// if the state is not being pruned.
+func (api *PrivateDebugAPI) StatePruningProgress() *pruner.Progress {
+	return api.eth.blockchain.StatePruningProgress()
+}
+
+// StateRegenerations returns the progress of the historical state regenerations
+// in flight.
+func (api *PrivateDebugAPI) StateRegenerations() ([]*StateRegenProgress, error) {
+	if api.eth.regen == nil {
+		return nil, errors.New("state regeneration unavailable with the path state scheme")
+	}
+	return api.eth.regen.progress(), nil
+}
+
+// CancelStateRegeneration aborts the historical state regeneration with the
+// given id, failing all the requests waiting for the state.
+func (api *PrivateDebugAPI) CancelStateRegeneration(id uint64) error {
+	if api.eth.regen == nil {
+		return errors.New("state regeneration unavailable with the path state scheme")
+	}
+	return api.eth.regen.cancel(id)
+}
@@ -72,6 +72,13 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		block, err := b.BlockByNumber(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		return block.Header(), nil
+	}
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
@@ -92,6 +99,12 @@ func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash
 	return nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// historyPruned reports whether the body and receipts of the given block were
+// pruned from the ancient store.
+func (b *EthAPIBackend) historyPruned(number uint64) bool {
+	return number < rawdb.ReadHistoryTail(b.eth.ChainDb())
+}
+
 func (b *EthAPIBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
 	return b.eth.blockchain.GetHeaderByHash(hash), nil
 }
@@ -106,11 +119,33 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
-	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
+	if number == rpc.FinalizedBlockNumber {
+		if block := b.eth.blockchain.CurrentFinalizedBlock(); block != nil {
+			return block, nil
+		}
+		return nil, errors.New("finalized block not found")
+	}
+	if number == rpc.SafeBlockNumber {
+		if block := b.eth.blockchain.CurrentSafeBlock(); block != nil {
+			return block, nil
+		}
+		return nil, errors.New("safe block not found")
+	}
+	block := b.eth.blockchain.GetBlockByNumber(uint64(number))
+	if block == nil && b.historyPruned(uint64(number)) {
+		return nil, core.ErrHistoryPruned
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return b.eth.blockchain.GetBlockByHash(hash), nil
+	block := b.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		if number := rawdb.ReadHeaderNumber(b.eth.ChainDb(), hash); number != nil && b.historyPruned(*number) {
+			return nil, core.ErrHistoryPruned
+		}
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
@@ -127,6 +162,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
+			if b.historyPruned(header.Number.Uint64()) {
+				return nil, core.ErrHistoryPruned
+			}
 			return nil, errors.New("header found, but block body is missing")
 		}
 		return block, nil
@@ -178,7 +216,13 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 }
 
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
-	return b.eth.blockchain.GetReceiptsByHash(hash), nil
+	receipts := b.eth.blockchain.GetReceiptsByHash(hash)
+	if receipts == nil {
+		if number := rawdb.ReadHeaderNumber(b.eth.ChainDb(), hash); number != nil && b.historyPruned(*number) {
+			return nil, core.ErrHistoryPruned
+		}
+	}
+	return receipts, nil
 }
 
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
@@ -189,6 +233,9 @@ func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*typ
 	}
 	logs := rawdb.ReadLogs(db, hash, *number, b.eth.blockchain.Config())
 	if logs == nil {
+		if b.historyPruned(*number) {
+			return nil, core.ErrHistoryPruned
+		}
 		return nil, errors.New("failed to get logs for block")
 	}
 	return logs, nil
@@ -357,9 +404,9 @@ func (b *EthAPIBackend) StartMining(threads int) error {
 }
 
 func (b *EthAPIBackend) StateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, checkLive, preferDisk bool) (*state.StateDB, error) {
-	return b.eth.StateAtBlock(block, reexec, base, checkLive, preferDisk)
+	return b.eth.stateAtBlock(ctx, block, reexec, base, checkLive, preferDisk)
 }
 
 func (b *EthAPIBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (core.Message, vm.BlockContext, *state.StateDB, error) {
-	return b.eth.stateAtTransaction(block, txIndex, reexec)
+	return b.eth.stateAtTransaction(ctx, block, txIndex, reexec)
 }
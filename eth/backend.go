@@ -27,11 +27,13 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/beacon"
 	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/clique/contract"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -70,6 +72,7 @@ type Ethereum struct {
 	// Handlers
 	txPool             *core.TxPool
 	blockchain         *core.BlockChain
+	regen              *stateRegenerator // Historical state regenerator, nil with the path state scheme
 	handler            *handler
 	ethDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
@@ -84,6 +87,7 @@ type Ethereum struct {
 
 	bloomRequests     chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer      *core.ChainIndexer             // Bloom indexer operating during block imports
+	slashIndexer      *core.ChainIndexer             // Slash indexer operating during block imports (clique only)
 	closeBloomHandler chan struct{}
 
 	APIBackend *EthAPIBackend
@@ -137,6 +141,16 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	scheme, err := rawdb.SetupStateScheme(chainDb, config.StateScheme)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == rawdb.PathScheme && config.SyncMode != downloader.FullSync {
+		log.Warn("Switching to full sync, snap sync unavailable with the path state scheme", "provided", config.SyncMode)
+		config.SyncMode = downloader.FullSync
+	}
+	log.Info("Initialised state scheme", "scheme", scheme)
+
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideArrowGlacier, config.OverrideTerminalTotalDifficulty)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -169,7 +183,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		log.Info("Unprotected transactions allowed")
 	}
 	ethAPI := ethapi.NewPublicBlockChainAPI(eth.APIBackend)
-	eth.engine = ethconfig.CreateConsensusEngine(stack, chainConfig, &ethashConfig, config.Miner.Notify, config.Miner.Noverify, chainDb, ethAPI)
+	caller := contract.NewChainCaller(chainConfig)
+	eth.engine = ethconfig.CreateConsensusEngine(stack, chainConfig, &ethashConfig, config.Miner.Notify, config.Miner.Noverify, chainDb, ethAPI, caller)
+	if c, ok := eth.engine.(*clique.Clique); ok && config.ValidatorSetSource != "" {
+		if err := c.SetValidatorSetSource(config.ValidatorSetSource); err != nil {
+			return nil, err
+		}
+	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb)
 	var dbVer = "<nil>"
@@ -202,6 +222,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			OnlinePruning:       config.OnlinePruning,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -214,7 +235,26 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		eth.blockchain.SetHead(compat.RewindTo)
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
+	// The historical states can only be regenerated from the ones stored by hash,
+	// the path scheme retains the recent states only.
+	if scheme == rawdb.HashScheme {
+		var cachedb ethdb.Database
+		if config.StateRegenCache > 0 {
+			if cachedb, err = stack.OpenDatabase("regencache", 16, 16, "eth/db/regencache/", false); err != nil {
+				return nil, err
+			}
+		}
+		eth.regen = newStateRegenerator(eth.blockchain, chainDb, cachedb, uint64(config.StateRegenCache)*1024*1024)
+	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	caller.Attach(eth.blockchain)
+	if c, ok := eth.engine.(*clique.Clique); ok {
+		eth.slashIndexer = clique.NewSlashIndexer(chainDb, eth.blockchain, c)
+		eth.slashIndexer.Start(eth.blockchain)
+		c.StartValidatorSetTracker(eth.blockchain)
+		c.StartLivenessTracker(eth.blockchain)
+		c.StartFinalityTracker(eth.blockchain)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
@@ -511,7 +551,13 @@ func (s *Ethereum) StartMining(threads int) error {
 				log.Error("Sealer account unavailable locally", "err", err)
 				return fmt.Errorf("signer missing: %v", err)
 			}
-			cli.Authorize(sa, wallet.SignData, wallet.SignTx)
+			// External signers get the system transactions presented with a dedicated
+			// content type, so they can be approved apart from regular transactions.
+			signTxFn := wallet.SignTx
+			if _, ok := wallet.(*external.ExternalSigner); ok {
+				signTxFn = clique.SystemTxSignerFn(wallet.SignData)
+			}
+			cli.Authorize(sa, wallet.SignData, signTxFn)
 			s.miner.SetSealer(sa)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
@@ -561,7 +607,10 @@ func (s *Ethereum) SyncMode() downloader.SyncMode {
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
 	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethDialCandidates)
-	if s.config.SnapshotCache > 0 {
+
+	// The state stored by path can't be served for snap sync, as only the recent
+	// states are retained and the trie nodes can't be looked up by hash.
+	if s.config.SnapshotCache > 0 && s.blockchain.StateCache().TrieDB().Scheme() != rawdb.PathScheme {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
 	}
 	return protos
@@ -601,9 +650,15 @@ func (s *Ethereum) Stop() error {
 
 	// Then stop everything else.
 	s.bloomIndexer.Close()
+	if s.slashIndexer != nil {
+		s.slashIndexer.Close()
+	}
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Close()
+	if s.regen != nil {
+		s.regen.stop()
+	}
 	s.blockchain.Stop()
 	s.engine.Close()
 
@@ -85,6 +85,7 @@ var Defaults = Config{
 	TrieDirtyCache:          256,
 	TrieTimeout:             60 * time.Minute,
 	SnapshotCache:           102,
+	StateRegenCache:         1024,
 	Miner: miner.Config{
 		GasCeil:  8000000,
 		GasPrice: big.NewInt(params.GWei),
@@ -135,11 +136,20 @@ type Config struct {
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
-	NoPruning  bool // Whether to disable pruning and flush everything to disk
-	NoPrefetch bool // Whether to disable prefetching and only load state on demand
+	NoPruning     bool // Whether to disable pruning and flush everything to disk
+	NoPrefetch    bool // Whether to disable prefetching and only load state on demand
+	OnlinePruning bool // Whether the stale state may be pruned while the node is running
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
+	// StateScheme is the scheme the state trie nodes are stored with ("hash" or
+	// "path"), only applicable when the database is created.
+	StateScheme string `toml:",omitempty"`
+
+	// ValidatorSetSource selects how the validator sets committed in Chaophraya
+	// span headers are verified ("contract", "header" or "proof").
+	ValidatorSetSource string `toml:",omitempty"`
+
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
@@ -169,6 +179,7 @@ type Config struct {
 	TrieDirtyCache          int
 	TrieTimeout             time.Duration
 	SnapshotCache           int
+	StateRegenCache         int `toml:",omitempty"` // Disk allowance in megabytes for caching regenerated historical states
 	Preimages               bool
 
 	// Mining options
@@ -213,12 +224,17 @@ type Config struct {
 }
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
-func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database, ee *ethapi.PublicBlockChainAPI) consensus.Engine {
+func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database, ee *ethapi.PublicBlockChainAPI, caller *contract.ChainCaller) consensus.Engine {
 	// If proof-of-authority is requested, set it up
 	var engine consensus.Engine
 	if chainConfig.Clique != nil {
-		// create contract client and use with clique
-		client, err := contract.New(chainConfig, ee)
+		// create contract client and use with clique, the system contracts
+		// being called in process against the chain attached to the caller
+		var calls contract.EthAPI
+		if caller != nil {
+			calls = caller
+		}
+		client, err := contract.New(chainConfig, calls)
 		if err != nil {
 			panic(err)
 		}
@@ -25,7 +25,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		SnapDiscoveryURLs               []string
 		NoPruning                       bool
 		NoPrefetch                      bool
+		OnlinePruning                   bool
 		TxLookupLimit                   uint64                 `toml:",omitempty"`
+		StateScheme                     string                 `toml:",omitempty"`
+		ValidatorSetSource              string                 `toml:",omitempty"`
 		Whitelist                       map[uint64]common.Hash `toml:"-"`
 		LightServ                       int                    `toml:",omitempty"`
 		LightIngress                    int                    `toml:",omitempty"`
@@ -47,6 +50,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TrieDirtyCache                  int
 		TrieTimeout                     time.Duration
 		SnapshotCache                   int
+		StateRegenCache                 int `toml:",omitempty"`
 		Preimages                       bool
 		Miner                           miner.Config
 		Ethash                          ethash.Config
@@ -70,7 +74,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
+	enc.OnlinePruning = c.OnlinePruning
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.StateScheme = c.StateScheme
+	enc.ValidatorSetSource = c.ValidatorSetSource
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -92,6 +99,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TrieDirtyCache = c.TrieDirtyCache
 	enc.TrieTimeout = c.TrieTimeout
 	enc.SnapshotCache = c.SnapshotCache
+	enc.StateRegenCache = c.StateRegenCache
 	enc.Preimages = c.Preimages
 	enc.Miner = c.Miner
 	enc.Ethash = c.Ethash
@@ -119,7 +127,10 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		SnapDiscoveryURLs               []string
 		NoPruning                       *bool
 		NoPrefetch                      *bool
+		OnlinePruning                   *bool
 		TxLookupLimit                   *uint64                `toml:",omitempty"`
+		StateScheme                     *string                `toml:",omitempty"`
+		ValidatorSetSource              *string                `toml:",omitempty"`
 		Whitelist                       map[uint64]common.Hash `toml:"-"`
 		LightServ                       *int                   `toml:",omitempty"`
 		LightIngress                    *int                   `toml:",omitempty"`
@@ -141,6 +152,7 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TrieDirtyCache                  *int
 		TrieTimeout                     *time.Duration
 		SnapshotCache                   *int
+		StateRegenCache                 *int `toml:",omitempty"`
 		Preimages                       *bool
 		Miner                           *miner.Config
 		Ethash                          *ethash.Config
@@ -181,9 +193,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPrefetch != nil {
 		c.NoPrefetch = *dec.NoPrefetch
 	}
+	if dec.OnlinePruning != nil {
+		c.OnlinePruning = *dec.OnlinePruning
+	}
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.StateScheme != nil {
+		c.StateScheme = *dec.StateScheme
+	}
+	if dec.ValidatorSetSource != nil {
+		c.ValidatorSetSource = *dec.ValidatorSetSource
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -247,6 +268,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SnapshotCache != nil {
 		c.SnapshotCache = *dec.SnapshotCache
 	}
+	if dec.StateRegenCache != nil {
+		c.StateRegenCache = *dec.StateRegenCache
+	}
 	if dec.Preimages != nil {
 		c.Preimages = *dec.Preimages
 	}
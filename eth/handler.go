@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/forkid"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -193,7 +194,14 @@ func newHandler(config *handlerConfig) (*handler, error) {
 				return errors.New("unexpected post-merge header")
 			}
 		}
-		return h.chain.Engine().VerifyHeader(h.chain, header, true)
+		if err := h.chain.Engine().VerifyHeader(h.chain, header, true); err != nil {
+			return err
+		}
+		// Track the headers signed by the validators to detect double signing
+		if c, ok := h.chain.Engine().(*clique.Clique); ok {
+			c.ReportHeader(h.chain, header)
+		}
+		return nil
 	}
 	heighter := func() uint64 {
 		return h.chain.CurrentBlock().NumberU64()
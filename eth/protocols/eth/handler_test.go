@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"bytes"
 	"math"
 	"math/big"
 	"math/rand"
@@ -484,6 +485,36 @@ func testGetNodeData(t *testing.T, protocol uint) {
 	}
 }
 
+// Tests that only the contract codes are served if the state trie nodes are
+// stored by path.
+func TestGetNodeDataPathScheme(t *testing.T) {
+	var (
+		code   = []byte{byte(vm.PUSH1), 0x01, byte(vm.STOP)}
+		gspec  = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{testAddr: {Balance: big.NewInt(params.Ether), Code: code}}}
+		gendb  = rawdb.NewMemoryDatabase()
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+	)
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+	gspec.MustCommit(db)
+
+	blocks, _ := core.GenerateChain(params.TestChainConfig, gspec.MustCommit(gendb), engine, gendb, 1, nil)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	root := chain.CurrentBlock().Root()
+	nodes := ServiceGetNodeDataQuery(chain, GetNodeDataPacket{root, crypto.Keccak256Hash(code)})
+	if len(nodes) != 1 || !bytes.Equal(nodes[0], code) {
+		t.Fatalf("node data mismatch: have %x, want [%x]", nodes, code)
+	}
+}
+
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetBlockReceipts66(t *testing.T) { testGetBlockReceipts(t, ETH66) }
 
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -251,13 +252,23 @@ func ServiceGetNodeDataQuery(chain *core.BlockChain, query GetNodeDataPacket) []
 		bytes int
 		nodes [][]byte
 	)
+	// The trie nodes stored by path can't be looked up by hash, only the contract
+	// codes are served then.
+	byHash := chain.StateCache().TrieDB().Scheme() != rawdb.PathScheme
+
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(nodes) >= maxNodeDataServe ||
 			lookups >= 2*maxNodeDataServe {
 			break
 		}
 		// Retrieve the requested state entry
-		entry, err := chain.TrieNode(hash)
+		var (
+			entry []byte
+			err   error
+		)
+		if byHash {
+			entry, err = chain.TrieNode(hash)
+		}
 		if len(entry) == 0 || err != nil {
 			// Read the contract code with prefix only to save unnecessary lookups.
 			entry, err = chain.ContractCodeWithPrefix(hash)
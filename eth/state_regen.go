@@ -0,0 +1,700 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// regenCheckpointInterval is the number of blocks between the intermediate
+// states cached while regenerating a historical state, so that the requests
+// for the nearby blocks don't need to start over from the persisted state.
+const regenCheckpointInterval = 128
+
+var (
+	// regenEntryPrefix + state root -> cached state metadata
+	regenEntryPrefix = []byte("e")
+
+	// regenNodePrefix + state root + node hash -> trie node of the cached state
+	regenNodePrefix = []byte("n")
+
+	regenCacheHitMeter   = metrics.NewRegisteredMeter("eth/regen/cache/hit", nil)
+	regenCacheMissMeter  = metrics.NewRegisteredMeter("eth/regen/cache/miss", nil)
+	regenCacheEvictMeter = metrics.NewRegisteredMeter("eth/regen/cache/evict", nil)
+	regenSharedMeter     = metrics.NewRegisteredMeter("eth/regen/shared", nil)
+	regenBlockMeter      = metrics.NewRegisteredMeter("eth/regen/blocks", nil)
+
+	errRegenCancelled = errors.New("state regeneration cancelled")
+	errRegenStopped   = errors.New("state regenerator stopped")
+	errRegenUnknown   = errors.New("unknown state regeneration")
+)
+
+// StateRegenProgress is the progress of a historical state regeneration.
+type StateRegenProgress struct {
+	ID      uint64      `json:"id"`      // Identifier to cancel the regeneration with
+	Number  uint64      `json:"number"`  // Number of the block whose state is regenerated
+	Hash    common.Hash `json:"hash"`    // Hash of the block whose state is regenerated
+	Origin  uint64      `json:"origin"`  // Number of the block the regeneration started from
+	Current uint64      `json:"current"` // Number of the last block processed
+	Waiters int         `json:"waiters"` // Number of requests waiting for the state
+	Started time.Time   `json:"started"` // Time the regeneration was started
+}
+
+// regenEntry is the metadata of a regenerated state cached on disk. The trie
+// nodes of the state not present in the chain database are cached along, so
+// the state is available as long as the persisted one it was regenerated from.
+type regenEntry struct {
+	Root   common.Hash // Root of the cached state
+	Number uint64      // Number of the block the state belongs to
+	Base   common.Hash // Root of the persisted state the regeneration started from
+	Nodes  uint64      // Number of the trie nodes cached
+	Size   uint64      // Total size of the trie nodes cached
+	Used   uint64      // Sequence number of the last use, ordering the LRU on restart
+}
+
+// regenTask is a historical state being regenerated, shared by all the requests
+// for the state and the regenerations of its descendants.
+type regenTask struct {
+	id      uint64
+	block   *types.Block
+	started time.Time
+
+	origin  uint64 // Number of the block the regeneration started from
+	current uint64 // Number of the last block processed
+	waiters int    // Number of requests waiting for the state
+	lock    sync.Mutex
+
+	cancel     chan struct{} // Channel closed to abort the regeneration
+	cancelOnce sync.Once
+	done       chan struct{} // Channel closed when the regeneration finished
+
+	database state.Database // Database holding the regenerated state
+	base     common.Hash    // Root of the persisted state the regeneration started from
+	err      error          // Failure of the regeneration
+}
+
+// progress returns the progress of the regeneration.
+func (t *regenTask) progress() *StateRegenProgress {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return &StateRegenProgress{
+		ID:      t.id,
+		Number:  t.block.NumberU64(),
+		Hash:    t.block.Hash(),
+		Origin:  t.origin,
+		Current: t.current,
+		Waiters: t.waiters,
+		Started: t.started,
+	}
+}
+
+// stateRegenerator regenerates the historical states missing from the chain
+// database by re-executing the blocks from the nearest available state.
+//
+// Concurrent requests for the same state wait for a single regeneration, and
+// the regenerations of the descendant states continue from it. The regenerated
+// states are cached on disk in a bounded LRU, along with checkpoints along the
+// way, so later requests for nearby blocks don't redo the same work.
+type stateRegenerator struct {
+	chain   *core.BlockChain
+	chaindb ethdb.Database
+	cachedb ethdb.Database // Database caching the regenerated states, nil if disabled
+	limit   uint64         // Maximum total size of the cached trie nodes
+
+	entries *simplelru.LRU             // Cached states by root, in order of use
+	evicted []*regenEntry              // Cached states evicted, pending deletion from disk
+	size    uint64                     // Total size of the cached trie nodes
+	used    uint64                     // Sequence number of the last cached state use
+	tasks   map[common.Hash]*regenTask // Regenerations in flight by block hash
+	nextID  uint64
+	lock    sync.Mutex
+
+	// dblock protects the content of the cached states on disk, which is read
+	// while holding it for reading and written or deleted while holding it for
+	// writing. The set of cached states doesn't change while it's held.
+	dblock sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newStateRegenerator creates a historical state regenerator, caching up to limit
+// bytes of regenerated states in the cache database if it's not nil.
+func newStateRegenerator(chain *core.BlockChain, chaindb ethdb.Database, cachedb ethdb.Database, limit uint64) *stateRegenerator {
+	r := &stateRegenerator{
+		chain:   chain,
+		chaindb: chaindb,
+		cachedb: cachedb,
+		limit:   limit,
+		tasks:   make(map[common.Hash]*regenTask),
+		quit:    make(chan struct{}),
+	}
+	r.entries, _ = simplelru.NewLRU(math.MaxInt32, func(key, value interface{}) {
+		entry := value.(*regenEntry)
+		r.size -= entry.Size
+		r.evicted = append(r.evicted, entry)
+	})
+	if cachedb != nil {
+		r.loadEntries()
+	}
+	return r
+}
+
+// loadEntries indexes the states cached on disk by a previous run.
+func (r *stateRegenerator) loadEntries() {
+	var entries []*regenEntry
+
+	it := r.cachedb.NewIterator(regenEntryPrefix, nil)
+	for it.Next() {
+		entry := new(regenEntry)
+		if err := rlp.DecodeBytes(it.Value(), entry); err != nil {
+			log.Warn("Dropping corrupted regenerated state", "key", common.Bytes2Hex(it.Key()), "err", err)
+			r.evicted = append(r.evicted, &regenEntry{Root: common.BytesToHash(it.Key()[len(regenEntryPrefix):])})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	it.Release()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Used < entries[j].Used })
+	for _, entry := range entries {
+		r.entries.Add(entry.Root, entry)
+		r.size += entry.Size
+		r.used = entry.Used
+	}
+	r.evict()
+	r.deleteEvicted()
+
+	if len(entries) > 0 {
+		log.Info("Loaded regenerated state cache", "states", r.entries.Len(), "size", common.StorageSize(r.size))
+	}
+}
+
+// evict drops the least recently used cached states beyond the size limit.
+//
+// Note, this method assumes that the regenerator's lock is held!
+func (r *stateRegenerator) evict() {
+	for r.size > r.limit {
+		if _, _, ok := r.entries.RemoveOldest(); !ok {
+			break
+		}
+		regenCacheEvictMeter.Mark(1)
+	}
+}
+
+// deleteEvicted deletes the evicted cached states from disk.
+//
+// Note, this method assumes that the disk lock is held for writing!
+func (r *stateRegenerator) deleteEvicted() {
+	r.lock.Lock()
+	evicted := r.evicted
+	r.evicted = nil
+	r.lock.Unlock()
+
+	batch := r.cachedb.NewBatch()
+	for _, entry := range evicted {
+		it := r.cachedb.NewIterator(append(regenNodePrefix, entry.Root[:]...), nil)
+		for it.Next() {
+			batch.Delete(it.Key())
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					log.Error("Failed to delete regenerated state", "err", err)
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+		batch.Delete(append(regenEntryPrefix, entry.Root[:]...))
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to delete regenerated state", "err", err)
+	}
+}
+
+// stateAt returns the state of the given block, regenerating it from the nearest
+// available state within reexec blocks if it's missing from the chain database.
+func (r *stateRegenerator) stateAt(ctx context.Context, block *types.Block, reexec uint64) (*state.StateDB, error) {
+	r.lock.Lock()
+	select {
+	case <-r.quit:
+		r.lock.Unlock()
+		return nil, errRegenStopped
+	default:
+	}
+	task := r.tasks[block.Hash()]
+	if task == nil {
+		r.nextID++
+		task = &regenTask{
+			id:      r.nextID,
+			block:   block,
+			started: time.Now(),
+			origin:  block.NumberU64(),
+			current: block.NumberU64(),
+			cancel:  make(chan struct{}),
+			done:    make(chan struct{}),
+		}
+		r.tasks[block.Hash()] = task
+
+		r.wg.Add(1)
+		go r.run(task, reexec)
+	} else {
+		regenSharedMeter.Mark(1)
+	}
+	r.lock.Unlock()
+
+	task.lock.Lock()
+	task.waiters++
+	task.lock.Unlock()
+
+	defer func() {
+		task.lock.Lock()
+		task.waiters--
+		task.lock.Unlock()
+	}()
+	select {
+	case <-task.done:
+		if task.err != nil {
+			return nil, task.err
+		}
+		return state.New(block.Root(), task.database, nil)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// progress returns the progress of the regenerations in flight.
+func (r *stateRegenerator) progress() []*StateRegenProgress {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	progress := make([]*StateRegenProgress, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		progress = append(progress, task.progress())
+	}
+	sort.Slice(progress, func(i, j int) bool { return progress[i].ID < progress[j].ID })
+	return progress
+}
+
+// cancel aborts the regeneration with the given id, failing all the requests
+// waiting for it.
+func (r *stateRegenerator) cancel(id uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, task := range r.tasks {
+		if task.id == id {
+			task.cancelOnce.Do(func() { close(task.cancel) })
+			return nil
+		}
+	}
+	return errRegenUnknown
+}
+
+// stop aborts all the regenerations in flight and closes the cache database.
+func (r *stateRegenerator) stop() {
+	r.lock.Lock()
+	close(r.quit)
+	r.lock.Unlock()
+
+	r.wg.Wait()
+	if r.cachedb != nil {
+		r.cachedb.Close()
+	}
+}
+
+// run regenerates the state of the task's block, caching it on completion.
+func (r *stateRegenerator) run(task *regenTask, reexec uint64) {
+	defer r.wg.Done()
+
+	database, base, err := r.regenerate(task, reexec)
+	task.database, task.base, task.err = database, base, err
+	close(task.done)
+
+	// Cache the regenerated state, requests arriving meanwhile still get it
+	// from the task.
+	if err == nil && task.origin != task.block.NumberU64() {
+		r.store(task.block, database, base)
+	}
+	r.lock.Lock()
+	delete(r.tasks, task.block.Hash())
+	r.lock.Unlock()
+}
+
+// regenerate looks up the nearest available state of the task block's ancestors
+// and re-executes the blocks on top of it. The returned database holds the state
+// of the block, regenerated from the persisted state with the returned root.
+func (r *stateRegenerator) regenerate(task *regenTask, reexec uint64) (state.Database, common.Hash, error) {
+	var (
+		current  = task.block
+		database state.Database
+		base     common.Hash
+		blocks   []common.Hash // Hashes of the blocks to re-execute, in reverse order
+
+		// Create an ephemeral trie.Database for isolating the live one. Otherwise
+		// the internal junks created by tracing will be persisted into the disk.
+		disk = state.NewDatabaseWithConfig(r.chaindb, &trie.Config{Cache: 16})
+	)
+	for {
+		// Check the persisted state, then the cached ones and the ones being
+		// regenerated by other tasks
+		if _, err := state.New(current.Root(), disk, nil); err == nil {
+			database, base = disk, current.Root()
+			break
+		}
+		if database, base = r.load(current.Root()); database != nil {
+			break
+		}
+		if current != task.block {
+			if database, base = r.join(task, current); database != nil {
+				break
+			}
+		}
+		select {
+		case <-task.cancel:
+			return nil, common.Hash{}, errRegenCancelled
+		case <-r.quit:
+			return nil, common.Hash{}, errRegenStopped
+		default:
+		}
+		if uint64(len(blocks)) >= reexec {
+			return nil, common.Hash{}, fmt.Errorf("required historical state unavailable (reexec=%d)", reexec)
+		}
+		if current.NumberU64() == 0 {
+			return nil, common.Hash{}, errors.New("genesis state is missing")
+		}
+		parent := r.chain.GetBlock(current.ParentHash(), current.NumberU64()-1)
+		if parent == nil {
+			return nil, common.Hash{}, fmt.Errorf("missing block %v %d", current.ParentHash(), current.NumberU64()-1)
+		}
+		blocks = append(blocks, current.Hash())
+		current = parent
+	}
+	task.lock.Lock()
+	task.origin, task.current = current.NumberU64(), current.NumberU64()
+	task.lock.Unlock()
+
+	// State was available at historical point, regenerate
+	statedb, err := state.New(current.Root(), database, nil)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		parent common.Hash
+	)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		select {
+		case <-task.cancel:
+			return nil, common.Hash{}, errRegenCancelled
+		case <-r.quit:
+			return nil, common.Hash{}, errRegenStopped
+		default:
+		}
+		// Print progress logs if long enough time elapsed
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Regenerating historical state", "block", current.NumberU64()+1, "target", task.block.NumberU64(), "remaining", i+1, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		// Retrieve the next block to regenerate and process it
+		if current = r.chain.GetBlock(blocks[i], current.NumberU64()+1); current == nil {
+			return nil, common.Hash{}, fmt.Errorf("block %x not found", blocks[i])
+		}
+		if _, _, _, err := r.chain.Processor().Process(current, statedb, vm.Config{}); err != nil {
+			return nil, common.Hash{}, fmt.Errorf("processing block %d failed: %v", current.NumberU64(), err)
+		}
+		// Finalize the state so any modifications are written to the trie
+		root, err := statedb.Commit(r.chain.Config().IsEIP158(current.Number()))
+		if err != nil {
+			return nil, common.Hash{}, fmt.Errorf("stateAtBlock commit failed, number %d root %v: %w",
+				current.NumberU64(), current.Root().Hex(), err)
+		}
+		statedb, err = state.New(root, database, nil)
+		if err != nil {
+			return nil, common.Hash{}, fmt.Errorf("state reset after block %d failed: %v", current.NumberU64(), err)
+		}
+		database.TrieDB().Reference(root, common.Hash{})
+		if parent != (common.Hash{}) {
+			database.TrieDB().Dereference(parent)
+		}
+		parent = root
+		regenBlockMeter.Mark(1)
+
+		task.lock.Lock()
+		task.current = current.NumberU64()
+		task.lock.Unlock()
+
+		// Cache the intermediate states along the way for the nearby requests
+		if i > 0 && (current.NumberU64()-task.origin)%regenCheckpointInterval == 0 {
+			r.store(current, database, base)
+		}
+	}
+	nodes, imgs := database.TrieDB().Size()
+	log.Info("Historical state regenerated", "block", current.NumberU64(), "elapsed", common.PrettyDuration(time.Since(start)), "nodes", nodes, "preimages", imgs)
+	return database, base, nil
+}
+
+// join waits for the task regenerating the state of the given block, if there's
+// any, returning the database holding it and the root of the persisted state
+// it was regenerated from.
+func (r *stateRegenerator) join(task *regenTask, block *types.Block) (state.Database, common.Hash) {
+	r.lock.Lock()
+	other := r.tasks[block.Hash()]
+	r.lock.Unlock()
+
+	if other == nil {
+		return nil, common.Hash{}
+	}
+	regenSharedMeter.Mark(1)
+
+	select {
+	case <-other.done:
+	case <-task.cancel:
+		return nil, common.Hash{}
+	case <-r.quit:
+		return nil, common.Hash{}
+	}
+	if other.err != nil {
+		return nil, common.Hash{}
+	}
+	return other.database, other.base
+}
+
+// load retrieves the cached state with the given root, returning the database
+// holding it and the root of the persisted state it was regenerated from.
+func (r *stateRegenerator) load(root common.Hash) (state.Database, common.Hash) {
+	if r.cachedb == nil {
+		return nil, common.Hash{}
+	}
+	r.dblock.RLock()
+	defer r.dblock.RUnlock()
+
+	r.lock.Lock()
+	value, ok := r.entries.Get(root)
+	if ok {
+		r.used++
+		value.(*regenEntry).Used = r.used
+	}
+	r.lock.Unlock()
+
+	if !ok {
+		regenCacheMissMeter.Mark(1)
+		return nil, common.Hash{}
+	}
+	entry := value.(*regenEntry)
+
+	// The cached trie nodes are only complete as long as the persisted state
+	// they were regenerated from is around, the state might've been pruned.
+	if ok, _ := r.chaindb.Has(entry.Base[:]); !ok && entry.Base != types.EmptyRootHash {
+		log.Debug("Regenerated state obsolete", "number", entry.Number, "root", root, "base", entry.Base)
+		regenCacheMissMeter.Mark(1)
+		return nil, common.Hash{}
+	}
+	nodes := make(map[common.Hash][]byte, entry.Nodes)
+
+	prefix := append(regenNodePrefix, root[:]...)
+	it := r.cachedb.NewIterator(prefix, nil)
+	for it.Next() {
+		nodes[common.BytesToHash(it.Key()[len(prefix):])] = common.CopyBytes(it.Value())
+	}
+	it.Release()
+
+	if uint64(len(nodes)) != entry.Nodes {
+		log.Warn("Regenerated state incomplete", "number", entry.Number, "root", root, "have", len(nodes), "want", entry.Nodes)
+		regenCacheMissMeter.Mark(1)
+		return nil, common.Hash{}
+	}
+	if blob, err := rlp.EncodeToBytes(entry); err == nil {
+		r.cachedb.Put(append(regenEntryPrefix, root[:]...), blob)
+	}
+	regenCacheHitMeter.Mark(1)
+
+	db := &regenDatabase{Database: r.chaindb, nodes: nodes}
+	return state.NewDatabaseWithConfig(db, &trie.Config{Cache: 16}), entry.Base
+}
+
+// store caches the regenerated state of the block on disk, along with the trie
+// nodes missing from the chain database.
+func (r *stateRegenerator) store(block *types.Block, database state.Database, base common.Hash) {
+	if r.cachedb == nil {
+		return
+	}
+	r.dblock.Lock()
+	defer r.dblock.Unlock()
+
+	root := block.Root()
+
+	r.lock.Lock()
+	known := r.entries.Contains(root)
+	r.lock.Unlock()
+	if known {
+		return
+	}
+	start := time.Now()
+
+	nodes, err := r.collect(root, database)
+	if err != nil {
+		log.Warn("Failed to collect regenerated state", "number", block.NumberU64(), "root", root, "err", err)
+		return
+	}
+	entry := &regenEntry{Root: root, Number: block.NumberU64(), Base: base, Nodes: uint64(len(nodes))}
+	for _, blob := range nodes {
+		entry.Size += uint64(common.HashLength + len(blob))
+	}
+	if entry.Size > r.limit {
+		return
+	}
+	batch := r.cachedb.NewBatch()
+	for hash, blob := range nodes {
+		batch.Put(append(append(regenNodePrefix, root[:]...), hash[:]...), blob)
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Error("Failed to cache regenerated state", "err", err)
+				return
+			}
+			batch.Reset()
+		}
+	}
+	r.lock.Lock()
+	r.used++
+	entry.Used = r.used
+	r.lock.Unlock()
+
+	blob, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		log.Error("Failed to encode regenerated state", "err", err)
+		return
+	}
+	batch.Put(append(regenEntryPrefix, root[:]...), blob)
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to cache regenerated state", "err", err)
+		return
+	}
+	r.lock.Lock()
+	r.entries.Add(root, entry)
+	r.size += entry.Size
+	r.evict()
+	r.lock.Unlock()
+
+	r.deleteEvicted()
+	log.Debug("Cached regenerated state", "number", block.NumberU64(), "root", root, "nodes", entry.Nodes, "size", common.StorageSize(entry.Size), "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// collect gathers the trie nodes of the state with the given root which are not
+// present in the chain database. The subtries found in the chain database are
+// complete and skipped.
+func (r *stateRegenerator) collect(root common.Hash, database state.Database) (map[common.Hash][]byte, error) {
+	nodes := make(map[common.Hash][]byte)
+
+	// collectTrie gathers the missing nodes of a single trie, invoking onLeaf for
+	// the leaves of the missing parts.
+	collectTrie := func(root common.Hash, onLeaf func(blob []byte) error) error {
+		if ok, _ := r.chaindb.Has(root[:]); ok {
+			return nil
+		}
+		tr, err := trie.New(root, database.TrieDB())
+		if err != nil {
+			return err
+		}
+		it := tr.NodeIterator(nil)
+		for descend := true; it.Next(descend); {
+			descend = true
+			if hash := it.Hash(); hash != (common.Hash{}) {
+				if _, ok := nodes[hash]; ok {
+					descend = false
+					continue
+				}
+				if ok, _ := r.chaindb.Has(hash[:]); ok {
+					descend = false
+					continue
+				}
+				blob, err := database.TrieDB().Node(hash)
+				if err != nil {
+					return err
+				}
+				nodes[hash] = blob
+			}
+			if it.Leaf() && onLeaf != nil {
+				if err := onLeaf(it.LeafBlob()); err != nil {
+					return err
+				}
+			}
+		}
+		return it.Error()
+	}
+	err := collectTrie(root, func(blob []byte) error {
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return err
+		}
+		if account.Root == types.EmptyRootHash {
+			return nil
+		}
+		return collectTrie(account.Root, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// regenDatabase layers the trie nodes of a cached regenerated state on top of
+// the chain database.
+type regenDatabase struct {
+	ethdb.Database
+	nodes map[common.Hash][]byte
+}
+
+// Has retrieves if a key is present in the cached trie nodes or the chain
+// database.
+func (db *regenDatabase) Has(key []byte) (bool, error) {
+	if len(key) == common.HashLength {
+		if _, ok := db.nodes[common.BytesToHash(key)]; ok {
+			return true, nil
+		}
+	}
+	return db.Database.Has(key)
+}
+
+// Get retrieves the given key from the cached trie nodes or the chain database.
+func (db *regenDatabase) Get(key []byte) ([]byte, error) {
+	if len(key) == common.HashLength {
+		if blob, ok := db.nodes[common.BytesToHash(key)]; ok {
+			return blob, nil
+		}
+	}
+	return db.Database.Get(key)
+}
@@ -0,0 +1,255 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newRegenTestChain creates a chain of the given length whose blocks reward a
+// distinct coinbase each, only the state of the genesis and the recent blocks
+// being available.
+func newRegenTestChain(t *testing.T, n int) (*core.BlockChain, ethdb.Database, []*types.Block) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, BaseFee: big.NewInt(params.InitialBaseFee)}
+		genesis = gspec.MustCommit(db)
+		engine  = ethash.NewFaker()
+	)
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, engine, rawdb.NewMemoryDatabase(), n, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{byte(i + 1)})
+	})
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return chain, db, blocks
+}
+
+// checkRegenState ensures the regenerated state is the one of the block.
+func checkRegenState(t *testing.T, statedb *state.StateDB, block *types.Block) {
+	t.Helper()
+
+	if root := statedb.IntermediateRoot(true); root != block.Root() {
+		t.Fatalf("block #%d: state root mismatch: have %x, want %x", block.NumberU64(), root, block.Root())
+	}
+	number := block.NumberU64()
+	if statedb.GetBalance(common.Address{byte(number)}).Sign() == 0 {
+		t.Fatalf("block #%d: coinbase not rewarded", number)
+	}
+	if statedb.Exist(common.Address{byte(number + 1)}) {
+		t.Fatalf("block #%d: future coinbase exists", number)
+	}
+}
+
+// countRegenKeys returns the number of keys with the given prefix in the cache.
+func countRegenKeys(db ethdb.Iteratee, prefix []byte) int {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+	return count
+}
+
+// Tests that regenerated states are cached on disk and later regenerations of
+// nearby states continue from them, also after a restart.
+func TestStateRegenCache(t *testing.T) {
+	chain, db, blocks := newRegenTestChain(t, 200)
+	defer chain.Stop()
+
+	if chain.HasState(blocks[49].Root()) {
+		t.Fatalf("historical state unexpectedly available")
+	}
+	cachedb := rawdb.NewMemoryDatabase()
+	regen := newStateRegenerator(chain, db, cachedb, 64*1024*1024)
+
+	// Regenerate the state from genesis, then the nearby ones from the cache
+	statedb, err := regen.stateAt(context.Background(), blocks[49], 64)
+	if err != nil {
+		t.Fatalf("failed to regenerate state: %v", err)
+	}
+	checkRegenState(t, statedb, blocks[49])
+
+	if _, err := regen.stateAt(context.Background(), blocks[59], 5); err == nil {
+		t.Fatalf("state regenerated beyond the reexec limit")
+	}
+	statedb, err = regen.stateAt(context.Background(), blocks[59], 10)
+	if err != nil {
+		t.Fatalf("failed to regenerate state from the cache: %v", err)
+	}
+	checkRegenState(t, statedb, blocks[59])
+
+	if have := countRegenKeys(cachedb, regenEntryPrefix); have != 2 {
+		t.Fatalf("cached state count mismatch: have %d, want %d", have, 2)
+	}
+	// Restart the regenerator and ensure the cached states are reused, the cache
+	// database being closed along the regenerator
+	cachedb2 := rawdb.NewMemoryDatabase()
+	it := cachedb.NewIterator(nil, nil)
+	for it.Next() {
+		cachedb2.Put(it.Key(), it.Value())
+	}
+	it.Release()
+	regen.stop()
+
+	regen = newStateRegenerator(chain, db, cachedb2, 64*1024*1024)
+	defer regen.stop()
+
+	statedb, err = regen.stateAt(context.Background(), blocks[64], 5)
+	if err != nil {
+		t.Fatalf("failed to regenerate state from the cache after restart: %v", err)
+	}
+	checkRegenState(t, statedb, blocks[64])
+}
+
+// Tests that the least recently used states are evicted from the cache.
+func TestStateRegenEviction(t *testing.T) {
+	chain, db, blocks := newRegenTestChain(t, 200)
+	defer chain.Stop()
+
+	cachedb := rawdb.NewMemoryDatabase()
+	regen := newStateRegenerator(chain, db, cachedb, 64*1024*1024)
+	defer regen.stop()
+
+	for _, block := range []*types.Block{blocks[9], blocks[19]} {
+		if _, err := regen.stateAt(context.Background(), block, 64); err != nil {
+			t.Fatalf("failed to regenerate state: %v", err)
+		}
+	}
+	// Shrink the allowance to the most recent state, evicting the older one
+	regen.dblock.Lock()
+	regen.lock.Lock()
+	value, _ := regen.entries.Peek(blocks[19].Root())
+	regen.limit = value.(*regenEntry).Size
+	regen.evict()
+	regen.lock.Unlock()
+	regen.deleteEvicted()
+	regen.dblock.Unlock()
+
+	if have := countRegenKeys(cachedb, append(regenNodePrefix, blocks[9].Root().Bytes()...)); have != 0 {
+		t.Fatalf("evicted state nodes left: %d", have)
+	}
+	if have := countRegenKeys(cachedb, regenEntryPrefix); have != 1 {
+		t.Fatalf("cached state count mismatch: have %d, want %d", have, 1)
+	}
+	statedb, err := regen.stateAt(context.Background(), blocks[24], 5)
+	if err != nil {
+		t.Fatalf("failed to regenerate state from the cache: %v", err)
+	}
+	checkRegenState(t, statedb, blocks[24])
+}
+
+// Tests that concurrent requests share a single regeneration, which can be
+// tracked and cancelled.
+func TestStateRegenSharing(t *testing.T) {
+	chain, db, blocks := newRegenTestChain(t, 200)
+	defer chain.Stop()
+
+	regen := newStateRegenerator(chain, db, rawdb.NewMemoryDatabase(), 64*1024*1024)
+	defer regen.stop()
+
+	// Hold the cache, blocking the regenerations while looking for a state
+	regen.dblock.Lock()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 3)
+	)
+	for i := 0; i < len(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			statedb, err := regen.stateAt(context.Background(), blocks[99], 128)
+			if err == nil && statedb.IntermediateRoot(true) != blocks[99].Root() {
+				err = errRegenUnknown
+			}
+			errs[i] = err
+		}(i)
+	}
+	progress := waitRegenWaiters(t, regen, 3)
+	if len(progress) != 1 || progress[0].Number != blocks[99].NumberU64() {
+		t.Fatalf("unexpected regenerations: %v", progress)
+	}
+	regen.dblock.Unlock()
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: failed to regenerate state: %v", i, err)
+		}
+	}
+	// Block a new regeneration again and cancel it
+	regen.dblock.Lock()
+
+	done := make(chan error)
+	go func() {
+		_, err := regen.stateAt(context.Background(), blocks[149], 160)
+		done <- err
+	}()
+	progress = waitRegenWaiters(t, regen, 1)
+	if err := regen.cancel(progress[0].ID); err != nil {
+		t.Fatalf("failed to cancel regeneration: %v", err)
+	}
+	regen.dblock.Unlock()
+
+	if err := <-done; err != errRegenCancelled {
+		t.Fatalf("cancelled regeneration error mismatch: have %v, want %v", err, errRegenCancelled)
+	}
+	if err := regen.cancel(progress[0].ID + 1); err != errRegenUnknown {
+		t.Fatalf("unknown regeneration error mismatch: have %v, want %v", err, errRegenUnknown)
+	}
+}
+
+// waitRegenWaiters waits until the requests wait for the regenerations.
+func waitRegenWaiters(t *testing.T, regen *stateRegenerator, waiters int) []*StateRegenProgress {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		progress := regen.progress()
+
+		have := 0
+		for _, p := range progress {
+			have += p.Waiters
+		}
+		if have == waiters {
+			return progress
+		}
+	}
+	t.Fatalf("timed out waiting for %d regeneration waiters", waiters)
+	return nil
+}
@@ -88,6 +88,10 @@ type AncientReader interface {
 
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
+
+	// AncientTail returns the number of the first item of the specified category
+	// still retrievable from the ancient store.
+	AncientTail(kind string) (uint64, error)
 }
 
 // AncientBatchReader is the interface for 'batched' or 'atomic' reading.
@@ -109,6 +113,10 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateAncientTail discards the ancient data of the specified category
+	// below the provided number, keeping the other categories.
+	TruncateAncientTail(kind string, tail uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
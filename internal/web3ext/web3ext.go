@@ -79,6 +79,96 @@ web3._extend({
 			params: 1,
 			inputFormatter: [null]
 		}),
+		new web3._extend.Method({
+			name: 'getSpan',
+			call: 'clique_getSpan',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSpanValidators',
+			call: 'clique_getSpanValidators',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getInturnSigner',
+			call: 'clique_getInturnSigner',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSchedule',
+			call: 'clique_getSchedule',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'getSlashes',
+			call: 'clique_getSlashes',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
+		new web3._extend.Method({
+			name: 'validatorStats',
+			call: 'clique_validatorStats',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRewards',
+			call: 'clique_getRewards',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRewardsInRange',
+			call: 'clique_getRewardsInRange',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getRewardSummary',
+			call: 'clique_getRewardSummary',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSystemContracts',
+			call: 'clique_getSystemContracts',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'getEvidence',
+			call: 'clique_getEvidence',
+		}),
+		new web3._extend.Method({
+			name: 'getFinality',
+			call: 'clique_getFinality',
+		}),
+		new web3._extend.Method({
+			name: 'getCheckpointVotes',
+			call: 'clique_getCheckpointVotes',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'submitCheckpointVote',
+			call: 'clique_submitCheckpointVote',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getOfficialPreemptions',
+			call: 'clique_getOfficialPreemptions',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getSealProof',
+			call: 'clique_getSealProof',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -471,6 +561,25 @@ web3._extend({
 			params: 2,
 			inputFormatter:[web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter],
 		}),
+		new web3._extend.Method({
+			name: 'pruneState',
+			call: 'debug_pruneState',
+			params: 1,
+			inputFormatter: [null],
+		}),
+		new web3._extend.Method({
+			name: 'statePruningProgress',
+			call: 'debug_statePruningProgress',
+		}),
+		new web3._extend.Method({
+			name: 'stateRegenerations',
+			call: 'debug_stateRegenerations',
+		}),
+		new web3._extend.Method({
+			name: 'cancelStateRegeneration',
+			call: 'debug_cancelStateRegeneration',
+			params: 1,
+		}),
 	],
 	properties: []
 });
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -115,7 +116,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*LightEthereum, error) {
 		reqDist:         newRequestDistributor(peers, &mclock.System{}),
 		accountManager:  stack.AccountManager(),
 		merger:          merger,
-		engine:          ethconfig.CreateConsensusEngine(stack, chainConfig, &config.Ethash, nil, false, chainDb, nil),
+		engine:          ethconfig.CreateConsensusEngine(stack, chainConfig, &config.Ethash, nil, false, chainDb, nil, nil),
 		bloomRequests:   make(chan chan *bloombits.Retrieval),
 		bloomIndexer:    core.NewBloomIndexer(chainDb, params.BloomBitsBlocksClient, params.HelperTrieConfirmations),
 		p2pServer:       stack.Server(),
@@ -124,6 +125,18 @@ func New(stack *node.Node, config *ethconfig.Config) (*LightEthereum, error) {
 		shutdownTracker: shutdowncheck.NewShutdownTracker(chainDb),
 	}
 
+	// Light clients have no state to call the validator set contract against,
+	// verify span validator sets against the headers instead.
+	if c, ok := leth.engine.(*clique.Clique); ok {
+		source := config.ValidatorSetSource
+		if source == "" || source == clique.ValidatorSetContract {
+			source = clique.ValidatorSetHeader
+		}
+		if err := c.SetValidatorSetSource(source); err != nil {
+			return nil, err
+		}
+	}
+
 	var prenegQuery vfc.QueryFunc
 	if leth.udpEnabled {
 		prenegQuery = leth.prenegQuery
@@ -389,6 +389,12 @@ func (w *worker) isRunning() bool {
 	return atomic.LoadInt32(&w.running) == 1
 }
 
+// isZeroPeriod returns whether the pending block is sealed by a 0-period clique
+// engine (dev mode), taking the scheduled period changes into account.
+func (w *worker) isZeroPeriod() bool {
+	return w.chainConfig.Clique != nil && w.chainConfig.Clique.PeriodAt(w.chain.CurrentBlock().NumberU64()+1) == 0
+}
+
 // close terminates all background threads maintained by the worker.
 // Note the worker does not support being closed multiple times.
 func (w *worker) close() {
@@ -475,7 +481,7 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		case <-timer.C:
 			// If sealing is running resubmit a new work cycle periodically to pull in
 			// higher priced transactions. Disable this overhead for pending blocks.
-			if w.isRunning() && (w.chainConfig.Clique == nil || w.chainConfig.Clique.Period > 0) {
+			if w.isRunning() && !w.isZeroPeriod() {
 				// Short circuit if no new transaction arrives.
 				if atomic.LoadInt32(&w.newTxs) == 0 {
 					timer.Reset(recommit)
@@ -627,7 +633,7 @@ func (w *worker) mainLoop() {
 				// Special case, if the consensus engine is 0 period clique(dev mode),
 				// submit sealing work here since all empty submission will be rejected
 				// by clique. Of course the advance sealing(empty submission) is disabled.
-				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
+				if w.isZeroPeriod() {
 					w.commitWork(nil, true, time.Now().Unix())
 				}
 			}
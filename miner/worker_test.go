@@ -210,10 +210,10 @@ func newMockContractClient(t *testing.T) *mock.MockContractClient {
 	mockContractClient.EXPECT().CommitSpan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	mockContractClient.EXPECT().DistributeToValidator(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	mockContractClient.EXPECT().GetCurrentSpan(gomock.Any(), gomock.Any()).AnyTimes()
-	mockContractClient.EXPECT().GetCurrentValidators(gomock.Any(), gomock.Any()).AnyTimes()
-	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any()).AnyTimes()
+	mockContractClient.EXPECT().GetCurrentValidators(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockContractClient.EXPECT().GetEligibleValidators(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	mockContractClient.EXPECT().Inject(gomock.Any(), gomock.Any()).AnyTimes()
-	mockContractClient.EXPECT().IsSlashed(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	mockContractClient.EXPECT().IsSlashed(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	mockContractClient.EXPECT().Slash(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 	return mockContractClient
 }
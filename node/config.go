@@ -65,6 +65,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value database engine backing the databases of the
+	// node, either "leveldb" or "pebble". If empty, the engine of an existing
+	// database is used, or leveldb for a new one.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -262,16 +262,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, new(EthashConfig), nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int), false)
 )
 
@@ -343,18 +343,22 @@ type ChainConfig struct {
 	EIP155Block *big.Int `json:"eip155Block,omitempty"` // EIP155 HF block
 	EIP158Block *big.Int `json:"eip158Block,omitempty"` // EIP158 HF block
 
-	ByzantiumBlock         *big.Int `json:"byzantiumBlock,omitempty"`         // Byzantium switch block (nil = no fork, 0 = already on byzantium)
-	ConstantinopleBlock    *big.Int `json:"constantinopleBlock,omitempty"`    // Constantinople switch block (nil = no fork, 0 = already activated)
-	PetersburgBlock        *big.Int `json:"petersburgBlock,omitempty"`        // Petersburg switch block (nil = same as Constantinople)
-	IstanbulBlock          *big.Int `json:"istanbulBlock,omitempty"`          // Istanbul switch block (nil = no fork, 0 = already on istanbul)
-	ErawanBlock            *big.Int `json:"erawanBlock,omitempty"`            // IsErawan switch block (nil = no fork, 0 = already on Erawan)
-	ChaophrayaBlock        *big.Int `json:"chaophrayaBlock,omitempty"`        // IsChaophraya switch block (nil = no fork, 0 = already on Chaophraya)
-	ChaophrayaBangkokBlock *big.Int `json:"chaophrayaBangkokBlock,omitempty"` // IsChaophraya Testnet switch block (nil = no fork, 0 = already on Chaophraya Testnet)
-	MuirGlacierBlock       *big.Int `json:"muirGlacierBlock,omitempty"`       // Eip-2384 (bomb delay) switch block (nil = no fork, 0 = already activated)
-	BerlinBlock            *big.Int `json:"berlinBlock,omitempty"`            // Berlin switch block (nil = no fork, 0 = already on berlin)
-	LondonBlock            *big.Int `json:"londonBlock,omitempty"`            // London switch block (nil = no fork, 0 = already on london)
-	ArrowGlacierBlock      *big.Int `json:"arrowGlacierBlock,omitempty"`      // Eip-4345 (bomb delay) switch block (nil = no fork, 0 = already activated)
-	MergeForkBlock         *big.Int `json:"mergeForkBlock,omitempty"`         // EIP-3675 (TheMerge) switch block (nil = no fork, 0 = already in merge proceedings)
+	ByzantiumBlock          *big.Int `json:"byzantiumBlock,omitempty"`          // Byzantium switch block (nil = no fork, 0 = already on byzantium)
+	ConstantinopleBlock     *big.Int `json:"constantinopleBlock,omitempty"`     // Constantinople switch block (nil = no fork, 0 = already activated)
+	PetersburgBlock         *big.Int `json:"petersburgBlock,omitempty"`         // Petersburg switch block (nil = same as Constantinople)
+	IstanbulBlock           *big.Int `json:"istanbulBlock,omitempty"`           // Istanbul switch block (nil = no fork, 0 = already on istanbul)
+	ErawanBlock             *big.Int `json:"erawanBlock,omitempty"`             // IsErawan switch block (nil = no fork, 0 = already on Erawan)
+	ChaophrayaBlock         *big.Int `json:"chaophrayaBlock,omitempty"`         // IsChaophraya switch block (nil = no fork, 0 = already on Chaophraya)
+	ChaophrayaBangkokBlock  *big.Int `json:"chaophrayaBangkokBlock,omitempty"`  // IsChaophraya Testnet switch block (nil = no fork, 0 = already on Chaophraya Testnet)
+	ChaophrayaBackupBlock   *big.Int `json:"chaophrayaBackupBlock,omitempty"`   // IsChaophrayaBackup switch block (nil = no fork, 0 = backup sealers already enabled)
+	ChaophrayaEvidenceBlock *big.Int `json:"chaophrayaEvidenceBlock,omitempty"` // IsChaophrayaEvidence switch block (nil = no fork, 0 = double sign slashing already enabled)
+	ChaophrayaOfficialBlock *big.Int `json:"chaophrayaOfficialBlock,omitempty"` // IsChaophrayaOfficial switch block (nil = no fork, 0 = official node delay already enforced)
+	ChaophrayaSystemTxBlock *big.Int `json:"chaophrayaSystemTxBlock,omitempty"` // IsChaophrayaSystemTx switch block (nil = no fork, 0 = strict system transactions already enforced)
+	MuirGlacierBlock        *big.Int `json:"muirGlacierBlock,omitempty"`        // Eip-2384 (bomb delay) switch block (nil = no fork, 0 = already activated)
+	BerlinBlock             *big.Int `json:"berlinBlock,omitempty"`             // Berlin switch block (nil = no fork, 0 = already on berlin)
+	LondonBlock             *big.Int `json:"londonBlock,omitempty"`             // London switch block (nil = no fork, 0 = already on london)
+	ArrowGlacierBlock       *big.Int `json:"arrowGlacierBlock,omitempty"`       // Eip-4345 (bomb delay) switch block (nil = no fork, 0 = already activated)
+	MergeForkBlock          *big.Int `json:"mergeForkBlock,omitempty"`          // EIP-3675 (TheMerge) switch block (nil = no fork, 0 = already in merge proceedings)
 
 	// TerminalTotalDifficulty is the amount of total difficulty reached by
 	// the network that triggers the consensus upgrade.
@@ -375,11 +379,25 @@ func (c *EthashConfig) String() string {
 
 // CliqueConfig is the consensus engine configs for proof-of-authority based sealing.
 type CliqueConfig struct {
-	Period              uint64         `json:"period"` // Number of seconds between blocks to enforce
-	Epoch               uint64         `json:"epoch"`  // Epoch length to reset votes and checkpoint
-	Span                uint64         `json:"span"`   // Size of each span in block
-	ValidatorContract   common.Address `json:"validatorContract"`
-	ValidatorContractV2 common.Address `json:"validatorContractV2"`
+	Period              uint64           `json:"period"` // Number of seconds between blocks to enforce
+	Epoch               uint64           `json:"epoch"`  // Epoch length to reset votes and checkpoint
+	Span                uint64           `json:"span"`   // Size of each span in block
+	ValidatorContract   common.Address   `json:"validatorContract"`
+	ValidatorContractV2 common.Address   `json:"validatorContractV2"`
+	BackupSealers       uint64           `json:"backupSealers,omitempty"` // Number of span validators allowed to seal when the in-turn one is down
+	BackupDelay         uint64           `json:"backupDelay,omitempty"`   // Number of seconds each backup sealer waits after the previous one
+	OfficialDelay       uint64           `json:"officialDelay,omitempty"` // Number of seconds the official node waits before sealing out of turn
+	Overrides           []CliqueOverride `json:"overrides,omitempty"`     // Fork-scheduled parameter changes, in ascending block order
+}
+
+// CliqueOverride is a fork-scheduled change of the clique parameters, taking
+// effect from Block on. Zero values keep the parameter unchanged. Span and epoch
+// changes must be scheduled on a span, respectively epoch boundary.
+type CliqueOverride struct {
+	Block  *big.Int `json:"block"`
+	Period uint64   `json:"period,omitempty"` // Number of seconds between blocks to enforce
+	Epoch  uint64   `json:"epoch,omitempty"`  // Epoch length to reset votes and checkpoint
+	Span   uint64   `json:"span,omitempty"`   // Size of each span in block
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -387,6 +405,152 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// PeriodAt returns the block period in effect at the given block.
+func (c *CliqueConfig) PeriodAt(num uint64) uint64 {
+	period := c.Period
+	for _, o := range c.Overrides {
+		if o.Block.Uint64() > num {
+			break
+		}
+		if o.Period != 0 {
+			period = o.Period
+		}
+	}
+	return period
+}
+
+// EpochAt returns the epoch length in effect at the given block, along with the
+// block the epochs are counted from.
+func (c *CliqueConfig) EpochAt(num uint64) (length uint64, origin uint64) {
+	length = c.Epoch
+	for _, o := range c.Overrides {
+		if o.Block.Uint64() > num {
+			break
+		}
+		if o.Epoch != 0 {
+			length, origin = o.Epoch, o.Block.Uint64()
+		}
+	}
+	return length, origin
+}
+
+// IsEpochStart returns whether the given block is the first block of an epoch.
+func (c *CliqueConfig) IsEpochStart(num uint64) bool {
+	length, origin := c.EpochAt(num)
+	return (num-origin)%length == 0
+}
+
+// SpanAt returns the number of the span the given block belongs to, along with
+// the first block and the length of the span. Spans are counted from the genesis
+// block on, carrying the count over span length changes.
+func (c *CliqueConfig) SpanAt(num uint64) (number uint64, start uint64, length uint64) {
+	var origin uint64
+	length = c.Span
+	for _, o := range c.Overrides {
+		if o.Block.Uint64() > num {
+			break
+		}
+		if o.Span != 0 {
+			if length != 0 {
+				number += (o.Block.Uint64() - origin) / length
+			}
+			origin, length = o.Block.Uint64(), o.Span
+		}
+	}
+	if length == 0 {
+		return 0, 0, 0
+	}
+	number += (num - origin) / length
+	return number, num - (num-origin)%length, length
+}
+
+// SpanStart returns the first block and the length of the span with the given
+// number.
+func (c *CliqueConfig) SpanStart(span uint64) (start uint64, length uint64) {
+	var origin, base uint64
+	length = c.Span
+	for _, o := range c.Overrides {
+		if o.Span == 0 {
+			continue
+		}
+		if length != 0 {
+			spans := (o.Block.Uint64() - origin) / length
+			if span < base+spans {
+				break
+			}
+			base += spans
+		}
+		origin, length = o.Block.Uint64(), o.Span
+	}
+	return origin + (span-base)*length, length
+}
+
+// checkOverrides verifies that the parameter overrides are ordered and that span
+// and epoch changes happen on boundaries of the previous lengths.
+func (c *CliqueConfig) checkOverrides() error {
+	var (
+		last                    *big.Int
+		spanOrigin, epochOrigin uint64
+		span, epoch             = c.Span, c.Epoch
+	)
+	for i, o := range c.Overrides {
+		if o.Block == nil {
+			return fmt.Errorf("clique override %d has no block", i)
+		}
+		if last != nil && last.Cmp(o.Block) >= 0 {
+			return fmt.Errorf("unsupported clique override ordering: %v after %v", o.Block, last)
+		}
+		last = o.Block
+
+		number := o.Block.Uint64()
+		if o.Span != 0 {
+			if span != 0 && (number-spanOrigin)%span != 0 {
+				return fmt.Errorf("clique span override at %v not on a span boundary", o.Block)
+			}
+			span, spanOrigin = o.Span, number
+		}
+		if o.Epoch != 0 {
+			if epoch != 0 && (number-epochOrigin)%epoch != 0 {
+				return fmt.Errorf("clique epoch override at %v not on an epoch boundary", o.Block)
+			}
+			epoch, epochOrigin = o.Epoch, number
+		}
+	}
+	return nil
+}
+
+// overridesIncompatible returns the block of the first parameter override which
+// differs between the two configs, if it's already active at head.
+func (c *CliqueConfig) overridesIncompatible(newcfg *CliqueConfig, head *big.Int) *big.Int {
+	for i := 0; i < len(c.Overrides) || i < len(newcfg.Overrides); i++ {
+		var o1, o2 *CliqueOverride
+		if i < len(c.Overrides) {
+			o1 = &c.Overrides[i]
+		}
+		if i < len(newcfg.Overrides) {
+			o2 = &newcfg.Overrides[i]
+		}
+		if o1 != nil && o2 != nil && configNumEqual(o1.Block, o2.Block) && o1.Period == o2.Period && o1.Epoch == o2.Epoch && o1.Span == o2.Span {
+			continue
+		}
+		// Overrides differ from here on, only fine if neither is active yet
+		var block *big.Int
+		switch {
+		case o1 == nil:
+			block = o2.Block
+		case o2 == nil || o1.Block.Cmp(o2.Block) < 0:
+			block = o1.Block
+		default:
+			block = o2.Block
+		}
+		if isForked(block, head) {
+			return block
+		}
+		return nil
+	}
+	return nil
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -498,6 +662,26 @@ func (c *ChainConfig) IsChaophrayaBangkok(num *big.Int) bool {
 	return isForked(c.ChaophrayaBangkokBlock, num)
 }
 
+// IsChaophrayaBackup returns whether num is either equal to the backup sealer fork block or greater.
+func (c *ChainConfig) IsChaophrayaBackup(num *big.Int) bool {
+	return isForked(c.ChaophrayaBackupBlock, num)
+}
+
+// IsChaophrayaEvidence returns whether num is either equal to the double sign evidence fork block or greater.
+func (c *ChainConfig) IsChaophrayaEvidence(num *big.Int) bool {
+	return isForked(c.ChaophrayaEvidenceBlock, num)
+}
+
+// IsChaophrayaOfficial returns whether num is either equal to the official node delay fork block or greater.
+func (c *ChainConfig) IsChaophrayaOfficial(num *big.Int) bool {
+	return isForked(c.ChaophrayaOfficialBlock, num)
+}
+
+// IsChaophrayaSystemTx returns whether num is either equal to the strict system transaction fork block or greater.
+func (c *ChainConfig) IsChaophrayaSystemTx(num *big.Int) bool {
+	return isForked(c.ChaophrayaSystemTxBlock, num)
+}
+
 // IsArrowGlacier returns whether num is either equal to the Arrow Glacier (EIP-4345) fork block or greater.
 func (c *ChainConfig) IsArrowGlacier(num *big.Int) bool {
 	return isForked(c.ArrowGlacierBlock, num)
@@ -574,6 +758,9 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.Clique != nil {
+		return c.Clique.checkOverrides()
+	}
 	return nil
 }
 
@@ -624,6 +811,30 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.ChaophrayaBangkokBlock, newcfg.ChaophrayaBangkokBlock, head) {
 		return newCompatError("ChaophrayaBangkokBlock fork block", c.ChaophrayaBangkokBlock, newcfg.ChaophrayaBangkokBlock)
 	}
+	if isForkIncompatible(c.ChaophrayaBackupBlock, newcfg.ChaophrayaBackupBlock, head) {
+		return newCompatError("ChaophrayaBackupBlock fork block", c.ChaophrayaBackupBlock, newcfg.ChaophrayaBackupBlock)
+	}
+	if c.IsChaophrayaBackup(head) && c.Clique != nil && newcfg.Clique != nil &&
+		(c.Clique.BackupSealers != newcfg.Clique.BackupSealers || c.Clique.BackupDelay != newcfg.Clique.BackupDelay) {
+		return newCompatError("Clique backup sealers", c.ChaophrayaBackupBlock, newcfg.ChaophrayaBackupBlock)
+	}
+	if isForkIncompatible(c.ChaophrayaEvidenceBlock, newcfg.ChaophrayaEvidenceBlock, head) {
+		return newCompatError("ChaophrayaEvidenceBlock fork block", c.ChaophrayaEvidenceBlock, newcfg.ChaophrayaEvidenceBlock)
+	}
+	if isForkIncompatible(c.ChaophrayaOfficialBlock, newcfg.ChaophrayaOfficialBlock, head) {
+		return newCompatError("ChaophrayaOfficialBlock fork block", c.ChaophrayaOfficialBlock, newcfg.ChaophrayaOfficialBlock)
+	}
+	if c.IsChaophrayaOfficial(head) && c.Clique != nil && newcfg.Clique != nil && c.Clique.OfficialDelay != newcfg.Clique.OfficialDelay {
+		return newCompatError("Clique official delay", c.ChaophrayaOfficialBlock, newcfg.ChaophrayaOfficialBlock)
+	}
+	if isForkIncompatible(c.ChaophrayaSystemTxBlock, newcfg.ChaophrayaSystemTxBlock, head) {
+		return newCompatError("ChaophrayaSystemTxBlock fork block", c.ChaophrayaSystemTxBlock, newcfg.ChaophrayaSystemTxBlock)
+	}
+	if c.Clique != nil && newcfg.Clique != nil {
+		if block := c.Clique.overridesIncompatible(newcfg.Clique, head); block != nil {
+			return newCompatError("Clique parameter override", block, block)
+		}
+	}
 	if isForkIncompatible(c.MuirGlacierBlock, newcfg.MuirGlacierBlock, head) {
 		return newCompatError("Muir Glacier fork block", c.MuirGlacierBlock, newcfg.MuirGlacierBlock)
 	}
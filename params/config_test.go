@@ -87,6 +87,74 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{Clique: &CliqueConfig{Period: 5}},
+			new:     &ChainConfig{Clique: &CliqueConfig{Period: 5, Overrides: []CliqueOverride{{Block: big.NewInt(50), Period: 3}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Clique: &CliqueConfig{Period: 5, Overrides: []CliqueOverride{{Block: big.NewInt(30), Period: 3}}}},
+			new:    &ChainConfig{Clique: &CliqueConfig{Period: 5, Overrides: []CliqueOverride{{Block: big.NewInt(30), Period: 2}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Clique parameter override",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:  &ChainConfig{ChaophrayaBackupBlock: big.NewInt(30), Clique: &CliqueConfig{BackupSealers: 2}},
+			new:     &ChainConfig{ChaophrayaBackupBlock: big.NewInt(30), Clique: &CliqueConfig{BackupSealers: 3}},
+			head:    20,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{ChaophrayaBackupBlock: big.NewInt(30), Clique: &CliqueConfig{BackupSealers: 2}},
+			new:    &ChainConfig{ChaophrayaBackupBlock: big.NewInt(30), Clique: &CliqueConfig{BackupSealers: 2, BackupDelay: 5}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Clique backup sealers",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:  &ChainConfig{ChaophrayaSystemTxBlock: big.NewInt(30)},
+			new:     &ChainConfig{ChaophrayaSystemTxBlock: big.NewInt(40)},
+			head:    20,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{ChaophrayaSystemTxBlock: big.NewInt(30)},
+			new:    &ChainConfig{ChaophrayaSystemTxBlock: big.NewInt(40)},
+			head:   35,
+			wantErr: &ConfigCompatError{
+				What:         "ChaophrayaSystemTxBlock fork block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(40),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:  &ChainConfig{ChaophrayaOfficialBlock: big.NewInt(30), Clique: &CliqueConfig{OfficialDelay: 2}},
+			new:     &ChainConfig{ChaophrayaOfficialBlock: big.NewInt(30), Clique: &CliqueConfig{OfficialDelay: 4}},
+			head:    20,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{ChaophrayaOfficialBlock: big.NewInt(30), Clique: &CliqueConfig{OfficialDelay: 2}},
+			new:    &ChainConfig{ChaophrayaOfficialBlock: big.NewInt(30), Clique: &CliqueConfig{OfficialDelay: 4}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Clique official delay",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,3 +164,57 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCliqueOverrides(t *testing.T) {
+	config := &CliqueConfig{
+		Period: 5,
+		Epoch:  100,
+		Span:   10,
+		Overrides: []CliqueOverride{
+			{Block: big.NewInt(50), Period: 3},
+			{Block: big.NewInt(100), Span: 20, Epoch: 40},
+		},
+	}
+	if err := config.checkOverrides(); err != nil {
+		t.Fatalf("valid overrides rejected: %v", err)
+	}
+	for _, tt := range []struct {
+		number, period, span, start, length uint64
+		epochStart                          bool
+	}{
+		{0, 5, 0, 0, 10, true},
+		{49, 5, 4, 40, 10, false},
+		{50, 3, 5, 50, 10, false},
+		{99, 3, 9, 90, 10, false},
+		{100, 3, 10, 100, 20, true},
+		{139, 3, 11, 120, 20, false},
+		{140, 3, 12, 140, 20, true},
+	} {
+		if period := config.PeriodAt(tt.number); period != tt.period {
+			t.Errorf("block %d: period mismatch: have %d, want %d", tt.number, period, tt.period)
+		}
+		span, start, length := config.SpanAt(tt.number)
+		if span != tt.span || start != tt.start || length != tt.length {
+			t.Errorf("block %d: span mismatch: have %d [%d, +%d], want %d [%d, +%d]", tt.number, span, start, length, tt.span, tt.start, tt.length)
+		}
+		if start, length := config.SpanStart(tt.span); start != tt.start || length != tt.length {
+			t.Errorf("span %d: start mismatch: have [%d, +%d], want [%d, +%d]", tt.span, start, length, tt.start, tt.length)
+		}
+		if epochStart := config.IsEpochStart(tt.number); epochStart != tt.epochStart {
+			t.Errorf("block %d: epoch start mismatch: have %v, want %v", tt.number, epochStart, tt.epochStart)
+		}
+	}
+	// Span and epoch changes must be aligned to the previous lengths
+	config.Overrides = []CliqueOverride{{Block: big.NewInt(105), Span: 20}}
+	if err := config.checkOverrides(); err == nil {
+		t.Errorf("unaligned span override accepted")
+	}
+	config.Overrides = []CliqueOverride{{Block: big.NewInt(50), Epoch: 20}}
+	if err := config.checkOverrides(); err == nil {
+		t.Errorf("unaligned epoch override accepted")
+	}
+	config.Overrides = []CliqueOverride{{Block: big.NewInt(50), Period: 1}, {Block: big.NewInt(50), Period: 2}}
+	if err := config.checkOverrides(); err == nil {
+		t.Errorf("unordered overrides accepted")
+	}
+}
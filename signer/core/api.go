@@ -42,7 +42,7 @@ const (
 	// numberOfAccountsToDerive For hardware wallets, the number of accounts to derive
 	numberOfAccountsToDerive = 10
 	// ExternalAPIVersion -- see extapi_changelog.md
-	ExternalAPIVersion = "6.1.0"
+	ExternalAPIVersion = "6.3.0"
 	// InternalAPIVersion -- see intapi_changelog.md
 	InternalAPIVersion = "7.0.1"
 )
@@ -117,6 +117,8 @@ type SignerAPI struct {
 	validator   Validator
 	rejectMode  bool
 	credentials storage.Storage
+
+	systemContracts map[common.Address]struct{} // Contracts PoS system transactions may be signed for
 }
 
 // Metadata about a request
@@ -285,7 +287,7 @@ func NewSignerAPI(am *accounts.Manager, chainID int64, noUSB bool, ui UIClientAP
 	if advancedMode {
 		log.Info("Clef is in advanced mode: will warn instead of reject")
 	}
-	signer := &SignerAPI{big.NewInt(chainID), am, ui, validator, !advancedMode, credentials}
+	signer := &SignerAPI{big.NewInt(chainID), am, ui, validator, !advancedMode, credentials, nil}
 	if !noUSB {
 		signer.startUSBListener()
 	}
@@ -186,6 +186,14 @@ var (
 		accounts.MimetypeClique,
 		0x02,
 	}
+	ApplicationCliqueSystemTx = SigFormat{
+		accounts.MimetypeCliqueSystemTx,
+		0x03,
+	}
+	ApplicationCliqueVote = SigFormat{
+		accounts.MimetypeCliqueVote,
+		0x04,
+	}
 	TextPlain = SigFormat{
 		accounts.MimetypeTextPlain,
 		0x45,
@@ -169,6 +169,78 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		// Clique uses V on the form 0 or 1
 		useEthereumV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: cliqueRlp, Messages: messages, Hash: sighash}
+	case apitypes.ApplicationCliqueSystemTx.Mime:
+		// PoS system transactions issued by the consensus engine while sealing
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, useEthereumV, fmt.Errorf("input for %v must be an hex-encoded string", apitypes.ApplicationCliqueSystemTx.Mime)
+		}
+		txData, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		tx, err := clique.DecodeSystemTx(txData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		if tx.ChainID == nil || tx.ChainID.Cmp(api.chainID) != 0 {
+			return nil, useEthereumV, fmt.Errorf("system transaction chain id %v does not match %v", tx.ChainID, api.chainID)
+		}
+		if len(api.systemContracts) == 0 {
+			return nil, useEthereumV, errors.New("no system contracts configured")
+		}
+		method, err := tx.Verify(api.systemContracts)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		sighash, txRlp, err := tx.SigHash()
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		messages := []*apitypes.NameValueType{
+			{
+				Name:  "Clique system transaction",
+				Typ:   "clique",
+				Value: fmt.Sprintf("%s on %v, nonce %d, value %v", method, tx.To.Hex(), tx.Nonce, tx.Value),
+			},
+			{
+				Name:  "method",
+				Typ:   "string",
+				Value: method,
+			},
+			{
+				Name:  "to",
+				Typ:   "address",
+				Value: tx.To.Hex(),
+			},
+		}
+		// The signature is applied to the transaction as is, V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: txRlp, Messages: messages, Hash: sighash.Bytes()}
+	case apitypes.ApplicationCliqueVote.Mime:
+		// Checkpoint votes of the finality gadget, cast by PoS validators
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, useEthereumV, fmt.Errorf("input for %v must be an hex-encoded string", apitypes.ApplicationCliqueVote.Mime)
+		}
+		voteData, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		number, hash, err := clique.ParseCheckpointVoteData(voteData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		messages := []*apitypes.NameValueType{
+			{
+				Name:  "Clique checkpoint vote",
+				Typ:   "clique",
+				Value: fmt.Sprintf("checkpoint %d [0x%x]", number, hash),
+			},
+		}
+		// Clique uses V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: voteData, Messages: messages, Hash: crypto.Keccak256(voteData)}
 	default: // also case TextPlain.Mime:
 		// Calculates an Ethereum ECDSA signature for:
 		// hash = keccak256("\x19${byteVersion}Ethereum Signed Message:\n${message length}${message}")
@@ -196,6 +268,16 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 	return req, useEthereumV, nil
 }
 
+// SetSystemContracts configures the contracts PoS system transactions signed with
+// the application/x-clique-system-tx content type may be sent to. Without any,
+// such requests are refused.
+func (api *SignerAPI) SetSystemContracts(contracts []common.Address) {
+	api.systemContracts = make(map[common.Address]struct{}, len(contracts))
+	for _, contract := range contracts {
+		api.systemContracts[contract] = struct{}{}
+	}
+}
+
 // SignTextWithValidator signs the given message which can be further recovered
 // with the given validator.
 // hash = keccak256("\x19\x00"${address}${data}).
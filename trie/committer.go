@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -35,6 +36,7 @@ type leaf struct {
 	size int         // size of the rlp data (estimate)
 	hash common.Hash // hash of rlp data
 	node node        // the node to commit
+	path []byte      // path of the node in the trie
 }
 
 // committer is a type used for the trie Commit operation. A committer has some
@@ -49,6 +51,10 @@ type committer struct {
 
 	onleaf LeafCallback
 	leafCh chan *leaf
+
+	nodes    *NodeSet // Nodes committed by the trie, held here if stored by path
+	tracer   *tracer  // Changes of the committed trie, used by the path scheme
+	embedded [][]byte // Paths of the nodes stored by path, now embedded in their parents
 }
 
 // committers live in a global sync.Pool
@@ -62,13 +68,16 @@ var committerPool = sync.Pool{
 }
 
 // newCommitter creates a new committer or picks one from the pool.
-func newCommitter() *committer {
-	return committerPool.Get().(*committer)
+func newCommitter(nodes *NodeSet, tracer *tracer) *committer {
+	c := committerPool.Get().(*committer)
+	c.nodes, c.tracer = nodes, tracer
+	return c
 }
 
 func returnCommitterToPool(h *committer) {
 	h.onleaf = nil
 	h.leafCh = nil
+	h.nodes, h.tracer, h.embedded = nil, nil, nil
 	committerPool.Put(h)
 }
 
@@ -77,7 +86,7 @@ func (c *committer) Commit(n node, db *Database) (hashNode, int, error) {
 	if db == nil {
 		return nil, 0, errors.New("no db provided")
 	}
-	h, committed, err := c.commit(n, db)
+	h, committed, err := c.commit(nil, n, db)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -85,7 +94,7 @@ func (c *committer) Commit(n node, db *Database) (hashNode, int, error) {
 }
 
 // commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) commit(n node, db *Database) (node, int, error) {
+func (c *committer) commit(path []byte, n node, db *Database) (node, int, error) {
 	// if this path is clean, use available cached data
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
@@ -101,7 +110,7 @@ func (c *committer) commit(n node, db *Database) (node, int, error) {
 		// otherwise it can only be hashNode or valueNode.
 		var childCommitted int
 		if _, ok := cn.Val.(*fullNode); ok {
-			childV, committed, err := c.commit(cn.Val, db)
+			childV, committed, err := c.commit(append(path, cn.Key...), cn.Val, db)
 			if err != nil {
 				return nil, 0, err
 			}
@@ -109,20 +118,20 @@ func (c *committer) commit(n node, db *Database) (node, int, error) {
 		}
 		// The key needs to be copied, since we're delivering it to database
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, childCommitted + 1, nil
 		}
 		return collapsed, childCommitted, nil
 	case *fullNode:
-		hashedKids, childCommitted, err := c.commitChildren(cn, db)
+		hashedKids, childCommitted, err := c.commitChildren(path, cn, db)
 		if err != nil {
 			return nil, 0, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, childCommitted + 1, nil
 		}
@@ -136,7 +145,7 @@ func (c *committer) commit(n node, db *Database) (node, int, error) {
 }
 
 // commitChildren commits the children of the given fullnode
-func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, error) {
+func (c *committer) commitChildren(path []byte, n *fullNode, db *Database) ([17]node, int, error) {
 	var (
 		committed int
 		children  [17]node
@@ -156,7 +165,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, er
 		// Commit the child recursively and store the "hashed" value.
 		// Note the returned node can be some embedded nodes, so it's
 		// possible the type is not hashNode.
-		hashed, childCommitted, err := c.commit(child, db)
+		hashed, childCommitted, err := c.commit(append(path, byte(i)), child, db)
 		if err != nil {
 			return children, 0, err
 		}
@@ -173,7 +182,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, er
 // store hashes the node n and if we have a storage layer specified, it writes
 // the key/value pair to it and tracks any node->child references as well as any
 // node->external trie references.
-func (c *committer) store(n node, db *Database) node {
+func (c *committer) store(path []byte, n node, db *Database) node {
 	// Larger nodes are replaced by their hash and stored in the database.
 	var (
 		hash, _ = n.cache()
@@ -184,6 +193,13 @@ func (c *committer) store(n node, db *Database) node {
 		// In theory, we should apply the leafCall here if it's not nil(embedded
 		// node usually contains value). But small value(less than 32bytes) is
 		// not our target.
+		//
+		// If the node was stored on its own by path before, it's now embedded
+		// and needs to be deleted. It's collected separately, as the node set
+		// may be concurrently filled by the commit loop.
+		if c.tracer.loaded(path) {
+			c.embedded = append(c.embedded, common.CopyBytes(path))
+		}
 		return n
 	} else {
 		// We have the hash already, estimate the RLP encoding-size of the node.
@@ -197,17 +213,32 @@ func (c *committer) store(n node, db *Database) node {
 			size: size,
 			hash: common.BytesToHash(hash),
 			node: n,
+			path: common.CopyBytes(path),
 		}
 	} else if db != nil {
 		// No leaf-callback used, but there's still a database. Do serial
 		// insertion
-		db.lock.Lock()
-		db.insert(common.BytesToHash(hash), size, n)
-		db.lock.Unlock()
+		c.insert(db, path, common.BytesToHash(hash), size, n)
 	}
 	return hash
 }
 
+// insert tracks a collapsed node committed at the given path in the node set if
+// the nodes are stored by path, or inserts it into the database otherwise.
+func (c *committer) insert(db *Database, path []byte, hash common.Hash, size int, n node) {
+	if c.nodes != nil && c.nodes.byPath() {
+		blob, err := rlp.EncodeToBytes(simplifyNode(n))
+		if err != nil {
+			panic(err)
+		}
+		c.nodes.add(path, hash, blob)
+		return
+	}
+	db.lock.Lock()
+	db.insert(hash, size, n)
+	db.lock.Unlock()
+}
+
 // commitLoop does the actual insert + leaf callback for nodes.
 func (c *committer) commitLoop(db *Database) {
 	for item := range c.leafCh {
@@ -217,9 +248,7 @@ func (c *committer) commitLoop(db *Database) {
 			n    = item.node
 		)
 		// We are pooling the trie nodes into an intermediate memory cache
-		db.lock.Lock()
-		db.insert(hash, size, n)
-		db.lock.Unlock()
+		c.insert(db, item.path, hash, size, n)
 
 		if c.onleaf != nil {
 			switch n := n.(type) {
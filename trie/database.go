@@ -68,6 +68,7 @@ var (
 // servers even while the trie is executing expensive garbage collection.
 type Database struct {
 	diskdb ethdb.KeyValueStore // Persistent storage for matured trie nodes
+	scheme string              // Scheme of the trie nodes on disk, hash or path based
 
 	cleans  *fastcache.Cache            // GC friendly memory cache of clean node RLPs
 	dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes
@@ -88,6 +89,11 @@ type Database struct {
 	childrenSize  common.StorageSize // Storage size of the external children tracking
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
+	layers     map[common.Hash]*diffLayer // Path-based diff layers on top of the disk state, by state root
+	lookup     map[common.Hash]*layerNode // Path-based trie nodes held by the diff layers, by hash
+	diskRoot   common.Hash                // Root of the path-based state on disk
+	layersSize common.StorageSize         // Storage size of the path-based diff layers
+
 	lock sync.RWMutex
 }
 
@@ -300,6 +306,7 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	}
 	db := &Database{
 		diskdb: diskdb,
+		scheme: rawdb.ReadStateScheme(diskdb),
 		cleans: cleans,
 		dirties: map[common.Hash]*cachedNode{{}: {
 			children: make(map[common.Hash]uint16),
@@ -308,6 +315,14 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	if db.scheme == rawdb.PathScheme {
+		db.layers = make(map[common.Hash]*diffLayer)
+		db.lookup = make(map[common.Hash]*layerNode)
+		db.diskRoot = db.diskStateRoot()
+		if err := db.loadJournal(); err != nil {
+			log.Warn("Failed to load trie layers journal", "err", err)
+		}
+	}
 	return db
 }
 
@@ -430,6 +445,17 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	}
 	memcacheDirtyMissMeter.Mark(1)
 
+	// Nodes stored by path can only be retrieved by hash from the diff layers
+	if db.scheme == rawdb.PathScheme {
+		db.lock.RLock()
+		n := db.lookup[hash]
+		db.lock.RUnlock()
+
+		if n != nil {
+			return n.blob, nil
+		}
+		return nil, errors.New("not found")
+	}
 	// Content unavailable in memory, attempt to retrieve from disk
 	enc := rawdb.ReadTrieNode(db.diskdb, hash)
 	if len(enc) != 0 {
@@ -710,6 +736,29 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 		}
 		batch.Reset()
 	}
+	// Nodes stored by path are flattened into the disk with all the diff layers
+	// below the requested state
+	if db.scheme == rawdb.PathScheme {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		if db.preimages != nil {
+			db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+		}
+		if node == db.diskRoot {
+			return nil
+		}
+		if err := db.capLayers(node, 0, common.Hash{}); err != nil {
+			log.Error("Failed to commit trie from trie database", "err", err)
+			return err
+		}
+		logger := log.Info
+		if !report {
+			logger = log.Debug
+		}
+		logger("Persisted trie layers to disk", "root", node, "layers", len(db.layers), "size", db.layersSize, "time", time.Since(start))
+		return nil
+	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
 
@@ -845,7 +894,7 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 	// counted.
 	var metadataSize = common.StorageSize((len(db.dirties) - 1) * cachedNodeSize)
 	var metarootRefs = common.StorageSize(len(db.dirties[common.Hash{}].children) * (common.HashLength + 2))
-	return db.dirtiesSize + db.childrenSize + metadataSize - metarootRefs, db.preimagesSize
+	return db.dirtiesSize + db.childrenSize + metadataSize - metarootRefs + db.layersSize, db.preimagesSize
 }
 
 // saveCache saves clean state cache to given directory path
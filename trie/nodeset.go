@@ -0,0 +1,92 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NodeSet is the set of trie nodes committed by a single trie. If the nodes are
+// stored by path, they're held by the set until it's sealed into a diff layer
+// by Database.Update. The nodes stored by hash are inserted into the database
+// right away, only their number is tracked then.
+type NodeSet struct {
+	owner     common.Hash
+	nodes     map[string]*pathNode // Nodes by path, nil if stored by hash
+	committed int
+}
+
+// newNodeSet creates the node set of the trie owned by the given account,
+// holding the committed nodes if they're stored by path.
+func newNodeSet(owner common.Hash, byPath bool) *NodeSet {
+	set := &NodeSet{owner: owner}
+	if byPath {
+		set.nodes = make(map[string]*pathNode)
+	}
+	return set
+}
+
+// Owner returns the hash of the account owning the trie, zero for the account
+// trie.
+func (set *NodeSet) Owner() common.Hash {
+	return set.owner
+}
+
+// Committed returns the number of trie nodes committed.
+func (set *NodeSet) Committed() int {
+	if set == nil {
+		return 0
+	}
+	return set.committed
+}
+
+// byPath reports whether the set holds the nodes stored by path.
+func (set *NodeSet) byPath() bool {
+	return set.nodes != nil
+}
+
+// add tracks the node committed at the given path, a nil blob marking the node
+// deleted.
+func (set *NodeSet) add(path []byte, hash common.Hash, blob []byte) {
+	set.nodes[string(path)] = &pathNode{hash: hash, blob: blob}
+}
+
+// MergedNodeSet is the set of the node sets committed by the tries of a single
+// state transition, grouped by their owner.
+type MergedNodeSet struct {
+	sets map[common.Hash]*NodeSet
+}
+
+// NewMergedNodeSet creates an empty merged node set.
+func NewMergedNodeSet() *MergedNodeSet {
+	return &MergedNodeSet{sets: make(map[common.Hash]*NodeSet)}
+}
+
+// Merge adds the node set of a trie. The sets of the nodes stored by hash carry
+// nothing to seal and are ignored.
+func (set *MergedNodeSet) Merge(other *NodeSet) error {
+	if other == nil || !other.byPath() {
+		return nil
+	}
+	if _, present := set.sets[other.owner]; present {
+		return fmt.Errorf("duplicate trie for owner %#x", other.owner)
+	}
+	set.sets[other.owner] = other
+	return nil
+}
@@ -0,0 +1,496 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// journalVersion is the version of the path-based trie layer journal, bumped
+// on any incompatible change of its format.
+const journalVersion uint64 = 0
+
+var (
+	memcacheLayerHitMeter   = metrics.NewRegisteredMeter("trie/memcache/layer/hit", nil)
+	memcacheLayerMissMeter  = metrics.NewRegisteredMeter("trie/memcache/layer/miss", nil)
+	memcacheLayerFlushTimer = metrics.NewRegisteredResettingTimer("trie/memcache/layer/flush", nil)
+)
+
+// pathNode is a trie node stored by its owner and path, a nil blob marking the
+// node deleted.
+type pathNode struct {
+	hash common.Hash
+	blob []byte
+}
+
+// nodeSet is a set of trie nodes stored by path, grouped by their owner.
+type nodeSet map[common.Hash]map[string]*pathNode
+
+// diffLayer is the set of trie node changes made by a state transition on top
+// of the parent state, similar to the diff layers of the state snapshot. The
+// storage tries of the destructed accounts are wiped before the changes apply.
+type diffLayer struct {
+	root      common.Hash
+	parent    common.Hash
+	nodes     nodeSet
+	destructs map[common.Hash]struct{}
+	size      common.StorageSize
+}
+
+// layerNode is a trie node held by the diff layers, reference counted as the
+// same node may be present in multiple layers.
+type layerNode struct {
+	blob []byte
+	refs int
+}
+
+// Scheme returns the scheme the trie nodes are stored with on disk.
+func (db *Database) Scheme() string {
+	return db.scheme
+}
+
+// resolve retrieves the trie node with the given hash, located at the path of
+// the trie owned by the account if the nodes are stored by path.
+func (db *Database) resolve(owner common.Hash, path []byte, hash common.Hash) node {
+	if db.scheme != rawdb.PathScheme {
+		return db.node(hash)
+	}
+	if blob := db.pathBlob(owner, path, hash); blob != nil {
+		return mustDecodeNode(hash[:], blob)
+	}
+	return nil
+}
+
+// nodeBlob retrieves the encoded trie node with the given hash, located at the
+// path of the trie owned by the account if the nodes are stored by path.
+func (db *Database) nodeBlob(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	if db.scheme != rawdb.PathScheme {
+		return db.Node(hash)
+	}
+	if blob := db.pathBlob(owner, path, hash); blob != nil {
+		return blob, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// pathBlob retrieves the encoded trie node with the given hash from the clean
+// cache, the diff layers or the disk at the path of the trie owned by the
+// account.
+//
+// The layers are searched by hash, so a node is found regardless of the state
+// it's requested for. The disk only holds a single node per path, which is only
+// returned if its hash matches.
+func (db *Database) pathBlob(owner common.Hash, path []byte, hash common.Hash) []byte {
+	if db.cleans != nil {
+		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(enc)))
+			return enc
+		}
+	}
+	db.lock.RLock()
+	n := db.lookup[hash]
+	db.lock.RUnlock()
+
+	if n != nil {
+		memcacheLayerHitMeter.Mark(1)
+		return n.blob
+	}
+	memcacheLayerMissMeter.Mark(1)
+
+	var enc []byte
+	if owner == (common.Hash{}) {
+		enc = rawdb.ReadAccountTrieNode(db.diskdb, path)
+	} else {
+		enc = rawdb.ReadStorageTrieNode(db.diskdb, owner, path)
+	}
+	if len(enc) == 0 || crypto.Keccak256Hash(enc) != hash {
+		return nil
+	}
+	if db.cleans != nil {
+		db.cleans.Set(hash[:], enc)
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(enc)))
+	}
+	return enc
+}
+
+// diskStateRoot returns the root of the state stored by path on disk, derived
+// from the root node of the account trie.
+func (db *Database) diskStateRoot() common.Hash {
+	enc := rawdb.ReadAccountTrieNode(db.diskdb, nil)
+	if len(enc) == 0 {
+		return emptyRoot
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// Update seals the trie nodes committed by the tries of a state transition into
+// the diff layer of the state root, on top of the parent state. The storage
+// tries of the destructed accounts are wiped in the new state.
+//
+// The nodes stored by hash are tracked as soon as they're committed, the method
+// is a noop for them.
+func (db *Database) Update(root common.Hash, parent common.Hash, nodes *MergedNodeSet, destructs map[common.Hash]struct{}) error {
+	if db.scheme != rawdb.PathScheme {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if parent == (common.Hash{}) {
+		parent = emptyRoot
+	}
+	// Skip empty transitions and states already known
+	if root == parent || root == db.diskRoot {
+		return nil
+	}
+	if _, ok := db.layers[root]; ok {
+		return nil
+	}
+	if _, ok := db.layers[parent]; !ok && parent != db.diskRoot {
+		return fmt.Errorf("parent state [%#x] unknown", parent)
+	}
+	layer := &diffLayer{
+		root:      root,
+		parent:    parent,
+		nodes:     make(nodeSet),
+		destructs: make(map[common.Hash]struct{}),
+	}
+	if nodes != nil {
+		for owner, set := range nodes.sets {
+			layer.nodes[owner] = set.nodes
+		}
+	}
+	for owner := range destructs {
+		layer.destructs[owner] = struct{}{}
+	}
+	db.addLayer(layer)
+	return nil
+}
+
+// addLayer links a diff layer into the layer tree, indexing its nodes.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) addLayer(layer *diffLayer) {
+	layer.size = common.StorageSize(len(layer.destructs) * common.HashLength)
+	for _, subset := range layer.nodes {
+		for path, n := range subset {
+			layer.size += common.StorageSize(common.HashLength + len(path) + len(n.blob))
+			if n.blob == nil {
+				continue
+			}
+			if entry := db.lookup[n.hash]; entry != nil {
+				entry.refs++
+			} else {
+				db.lookup[n.hash] = &layerNode{blob: n.blob, refs: 1}
+			}
+		}
+	}
+	db.layers[layer.root] = layer
+	db.layersSize += layer.size
+}
+
+// removeLayer unlinks a diff layer from the layer tree, dropping its nodes from
+// the index.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) removeLayer(layer *diffLayer) {
+	for _, subset := range layer.nodes {
+		for _, n := range subset {
+			if n.blob == nil {
+				continue
+			}
+			if entry := db.lookup[n.hash]; entry != nil {
+				if entry.refs--; entry.refs == 0 {
+					delete(db.lookup, n.hash)
+				}
+			}
+		}
+	}
+	delete(db.layers, layer.root)
+	db.layersSize -= layer.size
+}
+
+// CapLayers traverses downwards the diff layers from the given state root and
+// writes the ones beyond the permitted number into the disk, overwriting and
+// deleting the stale trie nodes in place. The layers are never flattened past
+// the keep state if it's one of them, and the layers no longer built on top of
+// the disk are discarded.
+//
+// The method is a noop if the trie nodes are stored by hash.
+func (db *Database) CapLayers(root common.Hash, layers int, keep common.Hash) error {
+	if db.scheme != rawdb.PathScheme {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.capLayers(root, layers, keep)
+}
+
+// capLayers is the internal version of CapLayers.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) capLayers(root common.Hash, layers int, keep common.Hash) error {
+	// Collect the layers from the requested state down to the disk
+	var chain []*diffLayer
+	for current := root; current != db.diskRoot; {
+		layer := db.layers[current]
+		if layer == nil {
+			return fmt.Errorf("trie layer [%#x] missing", current)
+		}
+		chain = append(chain, layer)
+		current = layer.parent
+	}
+	if len(chain) <= layers || keep == db.diskRoot {
+		return nil
+	}
+	flat := chain[layers:]
+	for i, layer := range flat {
+		if layer.root == keep {
+			flat = flat[i:]
+			break
+		}
+	}
+	if err := db.flatten(flat); err != nil {
+		return err
+	}
+	db.diskRoot = flat[0].root
+
+	// Discard the flattened layers and every other one not linked to the disk
+	children := make(map[common.Hash][]*diffLayer)
+	for _, layer := range db.layers {
+		children[layer.parent] = append(children[layer.parent], layer)
+	}
+	alive := make(map[common.Hash]struct{})
+	queue := []common.Hash{db.diskRoot}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent] {
+			alive[child.root] = struct{}{}
+			queue = append(queue, child.root)
+		}
+	}
+	for root, layer := range db.layers {
+		if _, ok := alive[root]; !ok {
+			db.removeLayer(layer)
+		}
+	}
+	return nil
+}
+
+// flatten merges the given layers, ordered from the top-most one, and writes
+// them atomically into the disk.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) flatten(layers []*diffLayer) error {
+	start := time.Now()
+
+	var (
+		merged    = make(nodeSet)
+		destructs = make(map[common.Hash]struct{})
+	)
+	for i := len(layers) - 1; i >= 0; i-- {
+		for owner := range layers[i].destructs {
+			delete(merged, owner)
+			destructs[owner] = struct{}{}
+		}
+		for owner, subset := range layers[i].nodes {
+			target := merged[owner]
+			if target == nil {
+				target = make(map[string]*pathNode)
+				merged[owner] = target
+			}
+			for path, n := range subset {
+				target[path] = n
+			}
+		}
+	}
+	// Wipe the storage tries of the destructed accounts first, the nodes of the
+	// recreated ones are written afterwards.
+	batch := db.diskdb.NewBatch()
+	for owner := range destructs {
+		it := rawdb.IterateStorageTrieNodes(db.diskdb, owner)
+		for it.Next() {
+			batch.Delete(it.Key())
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	var nodes, deleted int
+	for owner, subset := range merged {
+		for path, n := range subset {
+			switch {
+			case owner == (common.Hash{}) && n.blob == nil:
+				rawdb.DeleteAccountTrieNode(batch, []byte(path))
+			case owner == (common.Hash{}):
+				rawdb.WriteAccountTrieNode(batch, []byte(path), n.blob)
+			case n.blob == nil:
+				rawdb.DeleteStorageTrieNode(batch, owner, []byte(path))
+			default:
+				rawdb.WriteStorageTrieNode(batch, owner, []byte(path), n.blob)
+			}
+			if n.blob == nil {
+				deleted++
+			} else {
+				nodes++
+			}
+		}
+	}
+	// The layers are written in a single batch, a partially written state on
+	// disk couldn't be recovered.
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie layers to disk", "err", err)
+		return err
+	}
+	memcacheLayerFlushTimer.Update(time.Since(start))
+	log.Debug("Flattened trie layers into disk", "layers", len(layers), "root", layers[0].root, "nodes", nodes, "deleted", deleted, "destructs", len(destructs), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// journalNode is a trie node in the disk journal, an empty blob marking the
+// node deleted.
+type journalNode struct {
+	Path []byte
+	Blob []byte
+}
+
+// journalNodes is the set of trie nodes of an owner in the disk journal.
+type journalNodes struct {
+	Owner common.Hash
+	Nodes []journalNode
+}
+
+// journalLayer is a diff layer in the disk journal.
+type journalLayer struct {
+	Root      common.Hash
+	Parent    common.Hash
+	Destructs []common.Hash
+	Nodes     []journalNodes
+}
+
+// journal is the set of diff layers persisted across restarts.
+type journal struct {
+	Version  uint64
+	DiskRoot common.Hash
+	Layers   []journalLayer // Ordered from the bottom-most layer
+}
+
+// Journal persists the diff layers from the given state root down to the disk,
+// to be restored after a restart. The trie nodes already on disk must be kept
+// in place for the journal to be loaded.
+//
+// The layers are only journalled on a clean shutdown. After a crash, only the
+// state flattened into disk survives, up to the number of retained layers
+// behind the head, and the chain is rewound to its block.
+//
+// The method is a noop if the trie nodes are stored by hash.
+func (db *Database) Journal(root common.Hash) error {
+	if db.scheme != rawdb.PathScheme {
+		return nil
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var layers []journalLayer
+	for current := root; current != db.diskRoot; {
+		layer := db.layers[current]
+		if layer == nil {
+			return fmt.Errorf("trie layer [%#x] missing", current)
+		}
+		entry := journalLayer{Root: layer.root, Parent: layer.parent}
+		for owner := range layer.destructs {
+			entry.Destructs = append(entry.Destructs, owner)
+		}
+		for owner, subset := range layer.nodes {
+			nodes := journalNodes{Owner: owner}
+			for path, n := range subset {
+				nodes.Nodes = append(nodes.Nodes, journalNode{Path: []byte(path), Blob: n.blob})
+			}
+			entry.Nodes = append(entry.Nodes, nodes)
+		}
+		layers = append([]journalLayer{entry}, layers...)
+		current = layer.parent
+	}
+	blob, err := rlp.EncodeToBytes(&journal{Version: journalVersion, DiskRoot: db.diskRoot, Layers: layers})
+	if err != nil {
+		return err
+	}
+	rawdb.WriteTrieJournal(db.diskdb, blob)
+	log.Info("Journalled trie layers", "root", root, "layers", len(layers), "size", common.StorageSize(len(blob)))
+	return nil
+}
+
+// loadJournal restores the diff layers persisted at the last shutdown, if they
+// were built on top of the current disk state.
+func (db *Database) loadJournal() error {
+	blob := rawdb.ReadTrieJournal(db.diskdb)
+	if len(blob) == 0 {
+		return nil
+	}
+	var journal journal
+	if err := rlp.DecodeBytes(blob, &journal); err != nil {
+		return err
+	}
+	if journal.Version != journalVersion {
+		return fmt.Errorf("journal version mismatch: have %d, want %d", journal.Version, journalVersion)
+	}
+	if journal.DiskRoot != db.diskRoot {
+		return fmt.Errorf("journal disk root mismatch: have %#x, want %#x", journal.DiskRoot, db.diskRoot)
+	}
+	for _, entry := range journal.Layers {
+		if _, ok := db.layers[entry.Parent]; !ok && entry.Parent != db.diskRoot {
+			return fmt.Errorf("journalled parent state [%#x] unknown", entry.Parent)
+		}
+		layer := &diffLayer{
+			root:      entry.Root,
+			parent:    entry.Parent,
+			nodes:     make(nodeSet),
+			destructs: make(map[common.Hash]struct{}),
+		}
+		for _, owner := range entry.Destructs {
+			layer.destructs[owner] = struct{}{}
+		}
+		for _, nodes := range entry.Nodes {
+			subset := make(map[string]*pathNode)
+			for _, n := range nodes.Nodes {
+				if len(n.Blob) == 0 {
+					subset[string(n.Path)] = &pathNode{}
+				} else {
+					subset[string(n.Path)] = &pathNode{hash: crypto.Keccak256Hash(n.Blob), blob: n.Blob}
+				}
+			}
+			layer.nodes[nodes.Owner] = subset
+		}
+		db.addLayer(layer)
+	}
+	log.Info("Loaded trie layers journal", "diskroot", db.diskRoot, "layers", len(journal.Layers))
+	return nil
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// newPathDatabase creates a trie database storing the nodes by path on top of
+// an empty in-memory key-value store.
+func newPathDatabase() (ethdb.Database, *Database) {
+	diskdb := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	return diskdb, NewDatabase(diskdb)
+}
+
+// commitTrie applies the updates to the trie of the given owner and root,
+// returning the new root along with the committed nodes.
+func commitTrie(t *testing.T, triedb *Database, owner, root common.Hash, updates map[string]string) (common.Hash, *NodeSet) {
+	tr, err := NewWithOwner(owner, root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	for key, val := range updates {
+		if val == "" {
+			tr.Delete([]byte(key))
+		} else {
+			tr.Update([]byte(key), []byte(val))
+		}
+	}
+	root, nodes, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	return root, nodes
+}
+
+// commitPathTrie applies the updates to the account trie of the given root,
+// sealing the result on top of it along with the committed storage tries.
+func commitPathTrie(t *testing.T, triedb *Database, root common.Hash, updates map[string]string, storage ...*NodeSet) common.Hash {
+	next, nodes := commitTrie(t, triedb, common.Hash{}, root, updates)
+
+	merged := NewMergedNodeSet()
+	for _, set := range append(storage, nodes) {
+		if err := merged.Merge(set); err != nil {
+			t.Fatalf("failed to merge node set: %v", err)
+		}
+	}
+	if err := triedb.Update(next, root, merged, nil); err != nil {
+		t.Fatalf("failed to update trie layers: %v", err)
+	}
+	return next
+}
+
+// checkPathTrie ensures the trie of the given root holds exactly the values.
+func checkPathTrie(t *testing.T, triedb *Database, owner, root common.Hash, values map[string]string) {
+	t.Helper()
+
+	tr, err := NewWithOwner(owner, root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	it := NewIterator(tr.NodeIterator(nil))
+	found := 0
+	for it.Next() {
+		if want := values[string(it.Key)]; want != string(it.Value) {
+			t.Errorf("value mismatch for %q: have %q, want %q", it.Key, it.Value, want)
+		}
+		found++
+	}
+	if it.Err != nil {
+		t.Fatalf("failed to iterate trie %x: %v", root, it.Err)
+	}
+	if found != len(values) {
+		t.Errorf("value count mismatch: have %d, want %d", found, len(values))
+	}
+}
+
+// countAccountTrieNodes returns the number of account trie nodes stored on disk.
+func countAccountTrieNodes(db ethdb.Database) int {
+	it := db.NewIterator([]byte("A"), nil)
+	defer it.Release()
+
+	count := 0
+	for it.Next() {
+		if len(it.Key()) <= 1+64 {
+			count++
+		}
+	}
+	return count
+}
+
+// countTrieNodes returns the number of non-embedded nodes of the trie.
+func countTrieNodes(t *testing.T, triedb *Database, root common.Hash) int {
+	tr, err := New(root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	it := tr.NodeIterator(nil)
+	count := 0
+	for it.Next(true) {
+		if it.Hash() != (common.Hash{}) {
+			count++
+		}
+	}
+	if it.Error() != nil {
+		t.Fatalf("failed to iterate trie %x: %v", root, it.Error())
+	}
+	return count
+}
+
+// Tests that the trie nodes stored by path are kept in diff layers until they
+// are flattened into disk, where the stale nodes are deleted in place.
+func TestPathSchemeLayers(t *testing.T) {
+	diskdb, triedb := newPathDatabase()
+
+	values := make(map[string]string)
+	for i := 0; i < 256; i++ {
+		values[fmt.Sprintf("key-%03d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	root1 := commitPathTrie(t, triedb, emptyRoot, values)
+	if err := triedb.Commit(root1, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	if have := rawdb.ReadAccountTrieNode(diskdb, nil); crypto.Keccak256Hash(have) != root1 {
+		t.Fatalf("disk root mismatch: have %x, want %x", crypto.Keccak256Hash(have), root1)
+	}
+	if blob, _ := diskdb.Get(root1[:]); len(blob) != 0 {
+		t.Fatalf("trie node stored by hash")
+	}
+	if have, want := countAccountTrieNodes(diskdb), countTrieNodes(t, triedb, root1); have != want {
+		t.Fatalf("disk node count mismatch: have %d, want %d", have, want)
+	}
+	// Delete half of the values and modify the rest in a new layer
+	updates := make(map[string]string)
+	next := make(map[string]string)
+	for i := 0; i < 256; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		if i%2 == 0 {
+			updates[key] = ""
+		} else {
+			updates[key] = fmt.Sprintf("updated-%d", i)
+			next[key] = updates[key]
+		}
+	}
+	root2 := commitPathTrie(t, triedb, root1, updates)
+
+	// Both states must be available until the layer is flattened
+	checkPathTrie(t, triedb, common.Hash{}, root1, values)
+	checkPathTrie(t, triedb, common.Hash{}, root2, next)
+
+	if err := triedb.CapLayers(root2, 1, common.Hash{}); err != nil {
+		t.Fatalf("failed to cap trie layers: %v", err)
+	}
+	checkPathTrie(t, triedb, common.Hash{}, root1, values)
+
+	if err := triedb.CapLayers(root2, 0, common.Hash{}); err != nil {
+		t.Fatalf("failed to cap trie layers: %v", err)
+	}
+	checkPathTrie(t, triedb, common.Hash{}, root2, next)
+	if _, err := New(root1, triedb); err == nil {
+		t.Fatalf("flattened state still available")
+	}
+	if have, want := countAccountTrieNodes(diskdb), countTrieNodes(t, triedb, root2); have != want {
+		t.Fatalf("stale nodes left on disk: have %d, want %d", have, want)
+	}
+	if size, _ := triedb.Size(); size != 0 {
+		t.Fatalf("layers left after flattening: %v", size)
+	}
+}
+
+// Tests that the layers are never flattened past the state to keep.
+func TestPathSchemeCapKeep(t *testing.T) {
+	_, triedb := newPathDatabase()
+
+	var (
+		roots  = []common.Hash{emptyRoot}
+		states []map[string]string
+	)
+	values := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		update := map[string]string{fmt.Sprintf("key-%d", i): fmt.Sprintf("value-%d", i)}
+		values[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d", i)
+
+		state := make(map[string]string)
+		for key, val := range values {
+			state[key] = val
+		}
+		roots = append(roots, commitPathTrie(t, triedb, roots[len(roots)-1], update))
+		states = append(states, state)
+	}
+	if err := triedb.CapLayers(roots[8], 2, roots[3]); err != nil {
+		t.Fatalf("failed to cap trie layers: %v", err)
+	}
+	for i := 3; i <= 8; i++ {
+		checkPathTrie(t, triedb, common.Hash{}, roots[i], states[i-1])
+	}
+	if _, err := New(roots[2], triedb); err == nil {
+		t.Fatalf("flattened state still available")
+	}
+	// Flattening again while keeping the disk state must be a noop
+	if err := triedb.CapLayers(roots[8], 2, roots[3]); err != nil {
+		t.Fatalf("failed to cap trie layers: %v", err)
+	}
+	checkPathTrie(t, triedb, common.Hash{}, roots[3], states[2])
+}
+
+// Tests that the nodes of tries committed concurrently are sealed into the layer
+// of their own state only.
+func TestPathSchemeOverlappingCommits(t *testing.T) {
+	diskdb, triedb := newPathDatabase()
+
+	valuesA, valuesB := make(map[string]string), make(map[string]string)
+	for i := 0; i < 64; i++ {
+		valuesA[fmt.Sprintf("key-%02d", i)] = fmt.Sprintf("a-%d", i)
+		valuesB[fmt.Sprintf("key-%02d", i)] = fmt.Sprintf("b-%d", i)
+	}
+	// Commit both tries before sealing either of them
+	rootA, nodesA := commitTrie(t, triedb, common.Hash{}, emptyRoot, valuesA)
+	rootB, nodesB := commitTrie(t, triedb, common.Hash{}, emptyRoot, valuesB)
+
+	for _, update := range []struct {
+		root  common.Hash
+		nodes *NodeSet
+	}{{rootB, nodesB}, {rootA, nodesA}} {
+		merged := NewMergedNodeSet()
+		if err := merged.Merge(update.nodes); err != nil {
+			t.Fatalf("failed to merge node set: %v", err)
+		}
+		if err := triedb.Update(update.root, emptyRoot, merged, nil); err != nil {
+			t.Fatalf("failed to update trie layers: %v", err)
+		}
+	}
+	checkPathTrie(t, triedb, common.Hash{}, rootA, valuesA)
+	checkPathTrie(t, triedb, common.Hash{}, rootB, valuesB)
+
+	if err := triedb.Commit(rootA, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	checkPathTrie(t, triedb, common.Hash{}, rootA, valuesA)
+	if have, want := countAccountTrieNodes(diskdb), countTrieNodes(t, triedb, rootA); have != want {
+		t.Fatalf("disk node count mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that the storage tries of the destructed accounts are wiped from disk.
+func TestPathSchemeDestruct(t *testing.T) {
+	diskdb, triedb := newPathDatabase()
+
+	var (
+		owner   = common.HexToHash("0x01")
+		storage = make(map[string]string)
+	)
+	for i := 0; i < 64; i++ {
+		storage[fmt.Sprintf("slot-%02d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	storageRoot, storageNodes := commitTrie(t, triedb, owner, emptyRoot, storage)
+	root1 := commitPathTrie(t, triedb, emptyRoot, map[string]string{"account": string(storageRoot[:])}, storageNodes)
+	if err := triedb.Commit(root1, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	checkPathTrie(t, triedb, owner, storageRoot, storage)
+
+	if it := rawdb.IterateStorageTrieNodes(diskdb, owner); !it.Next() {
+		t.Fatalf("storage trie nodes missing from disk")
+	} else {
+		it.Release()
+	}
+	// Destruct the account in the next state
+	tr, _ := New(root1, triedb)
+	tr.Delete([]byte("account"))
+	tr.Update([]byte("other"), []byte("value"))
+	root2, nodes, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	merged := NewMergedNodeSet()
+	merged.Merge(nodes)
+	if err := triedb.Update(root2, root1, merged, map[common.Hash]struct{}{owner: {}}); err != nil {
+		t.Fatalf("failed to update trie layers: %v", err)
+	}
+	if err := triedb.Commit(root2, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	it := rawdb.IterateStorageTrieNodes(diskdb, owner)
+	defer it.Release()
+	if it.Next() {
+		t.Fatalf("storage trie node of destructed account left: %x", it.Key())
+	}
+}
+
+// Tests that the diff layers are restored from the journal after a restart.
+func TestPathSchemeJournal(t *testing.T) {
+	diskdb, triedb := newPathDatabase()
+
+	root1 := commitPathTrie(t, triedb, emptyRoot, map[string]string{"a": "1", "b": "2"})
+	if err := triedb.Commit(root1, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	root2 := commitPathTrie(t, triedb, root1, map[string]string{"a": "", "c": "3"})
+	root3 := commitPathTrie(t, triedb, root2, map[string]string{"d": "4"})
+
+	if err := triedb.Journal(root3); err != nil {
+		t.Fatalf("failed to journal trie layers: %v", err)
+	}
+	restored := NewDatabase(diskdb)
+	checkPathTrie(t, restored, common.Hash{}, root1, map[string]string{"a": "1", "b": "2"})
+	checkPathTrie(t, restored, common.Hash{}, root2, map[string]string{"b": "2", "c": "3"})
+	checkPathTrie(t, restored, common.Hash{}, root3, map[string]string{"b": "2", "c": "3", "d": "4"})
+
+	// The journal is ignored once the disk state moved on
+	if err := restored.Commit(root3, false, nil); err != nil {
+		t.Fatalf("failed to commit trie layers: %v", err)
+	}
+	if blob := rawdb.ReadAccountTrieNode(diskdb, nil); !bytes.Equal(crypto.Keccak256(blob), root3[:]) {
+		t.Fatalf("disk root mismatch")
+	}
+	restored = NewDatabase(diskdb)
+	if size, _ := restored.Size(); size != 0 {
+		t.Fatalf("stale journal loaded: %v", size)
+	}
+}
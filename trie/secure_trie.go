@@ -54,10 +54,16 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db *Database) (*SecureTrie, error) {
+	return NewSecureWithOwner(common.Hash{}, root, db)
+}
+
+// NewSecureWithOwner creates a secure trie owned by the account with the given
+// hash, see NewWithOwner.
+func NewSecureWithOwner(owner common.Hash, root common.Hash, db *Database) (*SecureTrie, error) {
 	if db == nil {
 		panic("trie.NewSecure called without a database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithOwner(owner, root, db)
 	if err != nil {
 		return nil, err
 	}
@@ -161,7 +167,7 @@ func (t *SecureTrie) GetKey(shaKey []byte) []byte {
 //
 // Committing flushes nodes from memory. Subsequent Get calls will load nodes
 // from the database.
-func (t *SecureTrie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
+func (t *SecureTrie) Commit(onleaf LeafCallback) (common.Hash, *NodeSet, error) {
 	// Write all the pre-images to the actual disk database
 	if len(t.getSecKeyCache()) > 0 {
 		if t.trie.db.preimages != nil { // Ugly direct check but avoids the below write lock
@@ -186,6 +192,7 @@ func (t *SecureTrie) Hash() common.Hash {
 // Copy returns a copy of SecureTrie.
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
+	cpy.trie.tracer = t.trie.tracer.copy()
 	return &cpy
 }
 
@@ -0,0 +1,127 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+// tracer tracks the changes of the trie nodes during the trie operations, so
+// that the nodes removed from the trie can be deleted from a database storing
+// them by path.
+//
+// Only the nodes loaded from the database are of interest: the nodes inserted
+// and deleted again before a commit never reached the database, and embedded
+// nodes are stored within their parents. The tracer is nil for tries stored
+// with the hash scheme, all its methods are noops then.
+type tracer struct {
+	insert map[string]struct{} // Paths of the nodes inserted since the last commit
+	delete map[string]struct{} // Paths of the nodes deleted since the last commit
+	origin map[string]struct{} // Paths of the nodes loaded from the database
+}
+
+// newTracer initializes the tracer for capturing trie changes.
+func newTracer() *tracer {
+	return &tracer{
+		insert: make(map[string]struct{}),
+		delete: make(map[string]struct{}),
+		origin: make(map[string]struct{}),
+	}
+}
+
+// onRead tracks a node loaded from the database at the given path.
+func (t *tracer) onRead(path []byte) {
+	if t == nil {
+		return
+	}
+	t.origin[string(path)] = struct{}{}
+}
+
+// onInsert tracks a node inserted at the given path. A node deleted at the same
+// path before is resurrected instead.
+func (t *tracer) onInsert(path []byte) {
+	if t == nil {
+		return
+	}
+	if _, present := t.delete[string(path)]; present {
+		delete(t.delete, string(path))
+		return
+	}
+	t.insert[string(path)] = struct{}{}
+}
+
+// onDelete tracks a node deleted at the given path. A node inserted at the same
+// path before is simply dropped instead.
+func (t *tracer) onDelete(path []byte) {
+	if t == nil {
+		return
+	}
+	if _, present := t.insert[string(path)]; present {
+		delete(t.insert, string(path))
+		return
+	}
+	t.delete[string(path)] = struct{}{}
+}
+
+// loaded reports whether the node at the given path was loaded from the
+// database.
+func (t *tracer) loaded(path []byte) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.origin[string(path)]
+	return ok
+}
+
+// deleted returns the paths of the deleted nodes which are present in the
+// database.
+func (t *tracer) deleted() [][]byte {
+	if t == nil {
+		return nil
+	}
+	var paths [][]byte
+	for path := range t.delete {
+		if _, ok := t.origin[path]; ok {
+			paths = append(paths, []byte(path))
+		}
+	}
+	return paths
+}
+
+// reset clears the tracked changes, called after the trie is committed.
+func (t *tracer) reset() {
+	if t == nil {
+		return
+	}
+	t.insert = make(map[string]struct{})
+	t.delete = make(map[string]struct{})
+	t.origin = make(map[string]struct{})
+}
+
+// copy returns a deep copy of the tracer.
+func (t *tracer) copy() *tracer {
+	if t == nil {
+		return nil
+	}
+	cpy := newTracer()
+	for path := range t.insert {
+		cpy.insert[path] = struct{}{}
+	}
+	for path := range t.delete {
+		cpy.delete[path] = struct{}{}
+	}
+	for path := range t.origin {
+		cpy.origin[path] = struct{}{}
+	}
+	return cpy
+}
@@ -24,6 +24,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -60,12 +61,18 @@ type LeafCallback func(paths [][]byte, hexpath []byte, leaf []byte, parent commo
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db    *Database
+	root  node
+	owner common.Hash // Hash of the account owning the trie, zero for the account trie
+
 	// Keep track of the number leafs which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
 	unhashed int
+
+	// tracer is the tool to track the trie changes, only used if the trie
+	// nodes are stored by path.
+	tracer *tracer
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -80,11 +87,23 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+// NewWithOwner creates a trie with an existing root node from db, owned by the
+// account with the given hash. The owner is needed to locate the nodes of the
+// storage tries in a database storing the trie nodes by path, it's ignored by
+// the hash scheme.
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
+	}
+	if db.Scheme() == rawdb.PathScheme {
+		trie.tracer = newTracer()
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -194,7 +213,7 @@ func (t *Trie) tryGetNode(origNode node, path []byte, pos int) (item []byte, new
 		if hash == nil {
 			return nil, origNode, 0, errors.New("non-consensus node")
 		}
-		blob, err := t.db.Node(common.BytesToHash(hash))
+		blob, err := t.db.nodeBlob(t.owner, path, common.BytesToHash(hash))
 		return blob, origNode, 1, err
 	}
 	// Path still needs to be traversed, descend into children
@@ -317,7 +336,9 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		if matchlen == 0 {
 			return true, branch, nil
 		}
-		// Otherwise, replace it with a short node leading up to the branch.
+		// Otherwise, replace it with a short node leading up to the branch,
+		// the branch being a new node on the path.
+		t.tracer.onInsert(append(prefix, key[:matchlen]...))
 		return true, &shortNode{key[:matchlen], branch, t.newFlag()}, nil
 
 	case *fullNode:
@@ -331,6 +352,9 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		return true, n, nil
 
 	case nil:
+		// The value node is always embedded into the new short node, only
+		// the short node itself is a new node on the path.
+		t.tracer.onInsert(prefix)
 		return true, &shortNode{key, value, t.newFlag()}, nil
 
 	case hashNode:
@@ -383,6 +407,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			return false, n, nil // don't replace n on mismatch
 		}
 		if matchlen == len(key) {
+			t.tracer.onDelete(prefix)
 			return true, nil, nil // remove n entirely for whole matches
 		}
 		// The key is longer than n.Key. Remove the remaining suffix
@@ -400,7 +425,9 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			// shortNode{..., shortNode{...}}. Use concat (which
 			// always creates a new slice) instead of append to
 			// avoid modifying n.Key since it might be shared with
-			// other nodes.
+			// other nodes. The child node is merged into its parent, so its
+			// own path is deleted.
+			t.tracer.onDelete(append(prefix, n.Key...))
 			return true, &shortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
 		default:
 			return true, &shortNode{n.Key, child, t.newFlag()}, nil
@@ -451,11 +478,14 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
 				if cnode, ok := cnode.(*shortNode); ok {
+					// The child short node is merged into the new one
+					// replacing n, so its own path is deleted.
+					t.tracer.onDelete(append(prefix, byte(pos)))
 					k := append([]byte{byte(pos)}, cnode.Key...)
 					return true, &shortNode{k, cnode.Val, t.newFlag()}, nil
 				}
@@ -508,7 +538,8 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
-	if node := t.db.node(hash); node != nil {
+	if node := t.db.resolve(t.owner, prefix, hash); node != nil {
+		t.tracer.onRead(prefix)
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
@@ -523,25 +554,36 @@ func (t *Trie) Hash() common.Hash {
 }
 
 // Commit writes all nodes to the trie's memory database, tracking the internal
-// and external (for account tries) references.
-func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
+// and external (for account tries) references. The committed nodes are returned
+// in a node set, which has to be passed to Database.Update along with the sets
+// of the other tries of the new state if the nodes are stored by path.
+func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, *NodeSet, error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	nodes := newNodeSet(t.owner, t.db.Scheme() == rawdb.PathScheme)
+
+	// Drop the nodes deleted from the trie from a database storing them by
+	// path, the remaining ones are overwritten when committed.
+	for _, path := range t.tracer.deleted() {
+		nodes.add(path, common.Hash{}, nil)
+	}
 	if t.root == nil {
-		return emptyRoot, 0, nil
+		t.tracer.reset()
+		return emptyRoot, nodes, nil
 	}
 	// Derive the hash for all dirty nodes first. We hold the assumption
 	// in the following procedure that all nodes are hashed.
 	rootHash := t.Hash()
-	h := newCommitter()
+	h := newCommitter(nodes, t.tracer)
 	defer returnCommitterToPool(h)
 
 	// Do a quick check if we really need to commit, before we spin
 	// up goroutines. This can happen e.g. if we load a trie for reading storage
 	// values, but don't write to it.
 	if _, dirty := t.root.cache(); !dirty {
-		return rootHash, 0, nil
+		t.tracer.reset()
+		return rootHash, nodes, nil
 	}
 	var wg sync.WaitGroup
 	if onleaf != nil {
@@ -563,10 +605,16 @@ func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
 		wg.Wait()
 	}
 	if err != nil {
-		return common.Hash{}, 0, err
+		return common.Hash{}, nil, err
 	}
+	for _, path := range h.embedded {
+		nodes.add(path, common.Hash{}, nil)
+	}
+	nodes.committed = committed
+
 	t.root = newRoot
-	return rootHash, committed, nil
+	t.tracer.reset()
+	return rootHash, nodes, nil
 }
 
 // hashRoot calculates the root hash of the given trie
@@ -586,4 +634,5 @@ func (t *Trie) hashRoot() (node, node, error) {
 func (t *Trie) Reset() {
 	t.root = nil
 	t.unhashed = 0
+	t.tracer.reset()
 }